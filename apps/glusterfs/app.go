@@ -17,8 +17,10 @@
 package glusterfs
 
 import (
+	"errors"
 	"io"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -28,19 +30,25 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/executors/kubeexec"
+	"github.com/heketi/heketi/executors/localexec"
 	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/heketi/executors/recordexec"
 	"github.com/heketi/heketi/executors/sshexec"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/rest"
 )
 
 const (
-	ASYNC_ROUTE           = "/queue"
-	BOLTDB_BUCKET_CLUSTER = "CLUSTER"
-	BOLTDB_BUCKET_NODE    = "NODE"
-	BOLTDB_BUCKET_VOLUME  = "VOLUME"
-	BOLTDB_BUCKET_DEVICE  = "DEVICE"
-	BOLTDB_BUCKET_BRICK   = "BRICK"
+	ASYNC_ROUTE            = "/queue"
+	BOLTDB_BUCKET_CLUSTER  = "CLUSTER"
+	BOLTDB_BUCKET_NODE     = "NODE"
+	BOLTDB_BUCKET_VOLUME   = "VOLUME"
+	BOLTDB_BUCKET_DEVICE   = "DEVICE"
+	BOLTDB_BUCKET_BRICK    = "BRICK"
+	BOLTDB_BUCKET_SNAPSHOT = "SNAPSHOT"
+	BOLTDB_BUCKET_GEOREP   = "GEOREPLICATION"
+	BOLTDB_BUCKET_PENDING  = "PENDINGOPERATION"
+	BOLTDB_BUCKET_HOSTKEY  = "HOSTKEY"
 )
 
 var (
@@ -55,6 +63,14 @@ type App struct {
 	executor     executors.Executor
 	allocator    Allocator
 	conf         *GlusterFSConfig
+	brickGc      *BrickGc
+	gcAuditLog   *os.File
+	commandLog   *os.File
+	faults       *appFaults
+	nodeSsh      *NodeSshSettings
+
+	// Closed once the interrupted operations are recovered
+	recovered chan struct{}
 
 	// For testing only.  Keep access to the object
 	// not through the interface
@@ -78,14 +94,19 @@ func NewApp(configIo io.Reader) *App {
 
 	// Setup executor
 	var err error
+	app.nodeSsh = NewNodeSshSettings()
 	switch {
 	case app.conf.Executor == "mock":
 		app.xo, err = mockexec.NewMockExecutor()
 		app.executor = app.xo
 	case app.conf.Executor == "kube" || app.conf.Executor == "kubernetes":
 		app.executor, err = kubeexec.NewKubeExecutor(&app.conf.KubeConfig)
+	case app.conf.Executor == "local":
+		app.executor, err = localexec.NewLocalExecutor(&app.conf.LocalConfig)
+	case app.conf.Executor == "replay":
+		app.executor, err = newReplayExecutor(&app.conf.RecordConfig)
 	case app.conf.Executor == "ssh" || app.conf.Executor == "":
-		app.executor, err = sshexec.NewSshExecutor(&app.conf.SshConfig)
+		app.executor, err = newSshExecutor(app)
 	default:
 		return nil
 	}
@@ -95,6 +116,22 @@ func NewApp(configIo io.Reader) *App {
 	}
 	logger.Info("Loaded %v executor", app.conf.Executor)
 
+	// Record the commands sent to the nodes
+	if app.conf.RecordConfig.Record != "" {
+		err = app.recordCommands()
+		if err != nil {
+			logger.LogError("Unable to record commands: %v", err)
+			return nil
+		}
+	}
+
+	// Inject faults in the calls to the executor
+	err = app.setupFaults()
+	if err != nil {
+		logger.LogError("Unable to setup fault injection: %v", err)
+		return nil
+	}
+
 	// Set db is set in the configuration file
 	if app.conf.DBfile != "" {
 		dbfilename = app.conf.DBfile
@@ -151,6 +188,40 @@ func NewApp(configIo io.Reader) *App {
 				return err
 			}
 
+			// Create Snapshot Bucket
+			_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_SNAPSHOT))
+			if err != nil {
+				logger.LogError("Unable to create snapshot bucket in DB")
+				return err
+			}
+
+			// Create Geo-replication Bucket
+			_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_GEOREP))
+			if err != nil {
+				logger.LogError("Unable to create geo-replication bucket in DB")
+				return err
+			}
+
+			// Create Pending Operation Bucket
+			_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_PENDING))
+			if err != nil {
+				logger.LogError("Unable to create pending operation bucket in DB")
+				return err
+			}
+
+			// Create Host Key Bucket
+			_, err = tx.CreateBucketIfNotExists([]byte(BOLTDB_BUCKET_HOSTKEY))
+			if err != nil {
+				logger.LogError("Unable to create host key bucket in DB")
+				return err
+			}
+
+			err = upgradeVolumeStates(tx)
+			if err != nil {
+				logger.LogError("Unable to upgrade volume states in DB")
+				return err
+			}
+
 			return nil
 
 		})
@@ -175,6 +246,38 @@ func NewApp(configIo io.Reader) *App {
 	}
 	logger.Info("Loaded %v allocator", app.conf.Allocator)
 
+	// Finish or undo the volume operations interrupted by a restart.
+	// Nodes may take long to answer, so the server does not wait
+	// for the recovery to start.
+	if !app.dbReadOnly {
+		err = app.nodeSsh.Load(app.db)
+		if err != nil {
+			logger.LogError("Unable to load ssh settings of the nodes: %v", err)
+			return nil
+		}
+
+		ops, err := LoadPendingOperations(app.db)
+		if err != nil {
+			logger.LogError("Unable to load pending operations: %v", err)
+			return nil
+		}
+
+		app.recovered = make(chan struct{})
+		go func() {
+			defer close(app.recovered)
+			recoverPendingOperations(app.db, app.executor, ops)
+		}()
+	}
+
+	// Start the garbage collection of bricks
+	if app.conf.BrickGcInterval > 0 && !app.dbReadOnly {
+		err = app.startBrickGc()
+		if err != nil {
+			logger.LogError("Unable to start brick garbage collection: %v", err)
+			return nil
+		}
+	}
+
 	// Show application has loaded
 	logger.Info("GlusterFS Application Loaded")
 
@@ -219,6 +322,86 @@ func (a *App) setAdvSettings() {
 		// Convert to KB
 		BrickMinSize = uint64(a.conf.BrickMinSize) * 1024 * 1024
 	}
+	if a.conf.ShrinkTimeout != 0 {
+		logger.Info("Adv: Shrink timeout %v minutes", a.conf.ShrinkTimeout)
+
+		// From volume_entry_shrink.go
+		ShrinkTimeout = time.Duration(a.conf.ShrinkTimeout) * time.Minute
+	}
+}
+
+// Loads the executor serving the outputs recorded in the replay file
+func newReplayExecutor(config *recordexec.RecordConfig) (executors.Executor, error) {
+	if config.Replay == "" {
+		return nil, errors.New("Missing replay file in configuration")
+	}
+
+	fp, err := os.Open(config.Replay)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	return recordexec.NewReplayExecutor(fp, config)
+}
+
+func newSshExecutor(app *App) (executors.Executor, error) {
+	s, err := sshexec.NewSshExecutor(&app.conf.SshConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the host keys trusted on first use in the db
+	s.SetHostKeyStore(NewHostKeyDb(app))
+
+	// Reach the nodes with their own ssh settings
+	s.NodeSettings = app.nodeSsh
+	return s, nil
+}
+
+func (a *App) recordCommands() error {
+	var err error
+	a.commandLog, err = os.OpenFile(a.conf.RecordConfig.Record,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = recordexec.RecordCommands(a.executor, a.commandLog)
+	if err != nil {
+		a.commandLog.Close()
+		a.commandLog = nil
+		return err
+	}
+
+	logger.Info("Recording commands to %v", a.conf.RecordConfig.Record)
+	return nil
+}
+
+func (a *App) startBrickGc() error {
+	var auditLog io.Writer = os.Stderr
+	if a.conf.BrickGcAuditLog != "" {
+		var err error
+		a.gcAuditLog, err = os.OpenFile(a.conf.BrickGcAuditLog,
+			os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		auditLog = a.gcAuditLog
+	}
+
+	grace := BRICK_GC_DEFAULT_GRACE_PERIOD
+	if a.conf.BrickGcGracePeriod > 0 {
+		grace = time.Duration(a.conf.BrickGcGracePeriod) * time.Minute
+	}
+	interval := time.Duration(a.conf.BrickGcInterval) * time.Minute
+
+	a.brickGc = NewBrickGc(a.db, a.executor, grace, a.conf.BrickGcDryRun, auditLog)
+	a.brickGc.Start(interval)
+	logger.Info("Brick garbage collection every %v with a grace period of %v, dry-run %v",
+		interval, grace, a.conf.BrickGcDryRun)
+
+	return nil
 }
 
 // Register Routes
@@ -276,6 +459,11 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/state",
 			HandlerFunc: a.NodeSetState},
+		rest.Route{
+			Name:        "NodeRemove",
+			Method:      "POST",
+			Pattern:     "/nodes/{id:[A-Fa-f0-9]+}/remove",
+			HandlerFunc: a.NodeRemove},
 
 		// Devices
 		rest.Route{
@@ -298,6 +486,16 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/state",
 			HandlerFunc: a.DeviceSetState},
+		rest.Route{
+			Name:        "DeviceRemove",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/remove",
+			HandlerFunc: a.DeviceRemove},
+		rest.Route{
+			Name:        "DeviceResync",
+			Method:      "POST",
+			Pattern:     "/devices/{id:[A-Fa-f0-9]+}/resync",
+			HandlerFunc: a.DeviceResync},
 
 		// Volume
 		rest.Route{
@@ -315,6 +513,46 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "POST",
 			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/expand",
 			HandlerFunc: a.VolumeExpand},
+		rest.Route{
+			Name:        "VolumeShrink",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/shrink",
+			HandlerFunc: a.VolumeShrink},
+		rest.Route{
+			Name:        "VolumeOptions",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/options",
+			HandlerFunc: a.VolumeOptions},
+		rest.Route{
+			Name:        "VolumeSetOptions",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/options",
+			HandlerFunc: a.VolumeSetOptions},
+		rest.Route{
+			Name:        "VolumeQuota",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/quota",
+			HandlerFunc: a.VolumeQuota},
+		rest.Route{
+			Name:        "VolumeQuotaEnable",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/quota/enable",
+			HandlerFunc: a.VolumeQuotaEnable},
+		rest.Route{
+			Name:        "VolumeQuotaSetLimit",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/quota/limits",
+			HandlerFunc: a.VolumeQuotaSetLimit},
+		rest.Route{
+			Name:        "VolumeQuotaRemoveLimit",
+			Method:      "DELETE",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/quota/limits",
+			HandlerFunc: a.VolumeQuotaRemoveLimit},
+		rest.Route{
+			Name:        "VolumeHealInfo",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/heal",
+			HandlerFunc: a.VolumeHealInfo},
 		rest.Route{
 			Name:        "VolumeDelete",
 			Method:      "DELETE",
@@ -325,6 +563,70 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/volumes",
 			HandlerFunc: a.VolumeList},
+		rest.Route{
+			Name:        "VolumeReplaceBrick",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/bricks/{brick:[A-Fa-f0-9]+}/replace",
+			HandlerFunc: a.VolumeReplaceBrick},
+
+		// Snapshot
+		rest.Route{
+			Name:        "SnapshotCreate",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/snapshots",
+			HandlerFunc: a.SnapshotCreate},
+		rest.Route{
+			Name:        "SnapshotList",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/snapshots",
+			HandlerFunc: a.SnapshotList},
+		rest.Route{
+			Name:        "SnapshotInfo",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/snapshots/{snapshot:[A-Fa-f0-9]+}",
+			HandlerFunc: a.SnapshotInfo},
+		rest.Route{
+			Name:        "SnapshotDelete",
+			Method:      "DELETE",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/snapshots/{snapshot:[A-Fa-f0-9]+}",
+			HandlerFunc: a.SnapshotDelete},
+		rest.Route{
+			Name:        "SnapshotRestore",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/snapshots/{snapshot:[A-Fa-f0-9]+}/restore",
+			HandlerFunc: a.SnapshotRestore},
+		rest.Route{
+			Name:        "SnapshotClone",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/snapshots/{snapshot:[A-Fa-f0-9]+}/clone",
+			HandlerFunc: a.SnapshotClone},
+
+		// Geo-replication
+		rest.Route{
+			Name:        "GeoReplicationCreate",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/georeplication",
+			HandlerFunc: a.GeoReplicationCreate},
+		rest.Route{
+			Name:        "GeoReplicationList",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/georeplication",
+			HandlerFunc: a.GeoReplicationList},
+		rest.Route{
+			Name:        "GeoReplicationInfo",
+			Method:      "GET",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/georeplication/{session:[A-Fa-f0-9]+}",
+			HandlerFunc: a.GeoReplicationInfo},
+		rest.Route{
+			Name:        "GeoReplicationDelete",
+			Method:      "DELETE",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/georeplication/{session:[A-Fa-f0-9]+}",
+			HandlerFunc: a.GeoReplicationDelete},
+		rest.Route{
+			Name:        "GeoReplicationAction",
+			Method:      "POST",
+			Pattern:     "/volumes/{id:[A-Fa-f0-9]+}/georeplication/{session:[A-Fa-f0-9]+}/{action:start|stop|pause|resume}",
+			HandlerFunc: a.GeoReplicationAction},
 
 		// Backup
 		rest.Route{
@@ -332,8 +634,18 @@ func (a *App) SetRoutes(router *mux.Router) error {
 			Method:      "GET",
 			Pattern:     "/backup/db",
 			HandlerFunc: a.Backup},
+
+		// Consistency
+		rest.Route{
+			Name:        "ConsistencyCheck",
+			Method:      "GET",
+			Pattern:     "/admin/consistency",
+			HandlerFunc: a.ConsistencyCheck},
 	}
 
+	// Fault injection
+	routes = append(routes, a.faultRoutes()...)
+
 	// Register all routes from the App
 	for _, route := range routes {
 
@@ -352,6 +664,22 @@ func (a *App) SetRoutes(router *mux.Router) error {
 
 func (a *App) Close() {
 
+	// Let the recovery of interrupted operations finish
+	if a.recovered != nil {
+		<-a.recovered
+	}
+
+	// Stop the garbage collection of bricks
+	if a.brickGc != nil {
+		a.brickGc.Stop()
+	}
+	if a.gcAuditLog != nil {
+		a.gcAuditLog.Close()
+	}
+	if a.commandLog != nil {
+		a.commandLog.Close()
+	}
+
 	// Close the DB
 	a.db.Close()
 	logger.Info("Closed")
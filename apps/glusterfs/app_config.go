@@ -22,21 +22,36 @@ import (
 	"os"
 
 	"github.com/heketi/heketi/executors/kubeexec"
+	"github.com/heketi/heketi/executors/localexec"
+	"github.com/heketi/heketi/executors/recordexec"
 	"github.com/heketi/heketi/executors/sshexec"
 )
 
 type GlusterFSConfig struct {
-	DBfile     string              `json:"db"`
-	Executor   string              `json:"executor"`
-	Allocator  string              `json:"allocator"`
-	SshConfig  sshexec.SshConfig   `json:"sshexec"`
-	KubeConfig kubeexec.KubeConfig `json:"kubeexec"`
-	Loglevel   string              `json:"loglevel"`
+	DBfile       string                  `json:"db"`
+	Executor     string                  `json:"executor"`
+	Allocator    string                  `json:"allocator"`
+	SshConfig    sshexec.SshConfig       `json:"sshexec"`
+	KubeConfig   kubeexec.KubeConfig     `json:"kubeexec"`
+	LocalConfig  localexec.LocalConfig   `json:"localexec"`
+	RecordConfig recordexec.RecordConfig `json:"recordexec"`
+	FaultConfig  faultConfig             `json:"faultexec"`
+	Loglevel     string                  `json:"loglevel"`
 
 	// advanced settings
 	BrickMaxSize int `json:"brick_max_size_gb"`
 	BrickMinSize int `json:"brick_min_size_gb"`
 	BrickMaxNum  int `json:"max_bricks_per_volume"`
+
+	// Time given to the data migration of a volume shrink
+	ShrinkTimeout int `json:"shrink_timeout_minutes"`
+
+	// Garbage collection of bricks unknown to the db.  Disabled
+	// when the interval is zero.
+	BrickGcInterval    int    `json:"brick_gc_interval_minutes"`
+	BrickGcGracePeriod int    `json:"brick_gc_grace_period_minutes"`
+	BrickGcDryRun      bool   `json:"brick_gc_dry_run"`
+	BrickGcAuditLog    string `json:"brick_gc_audit_log"`
 }
 
 type ConfigFile struct {
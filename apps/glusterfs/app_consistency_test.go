@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestConsistencyCheck(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil)
+
+	// Consistent
+	_, volumes := mockConsistentStorage(t, app)
+	report, err := c.ConsistencyCheck()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, report.Consistent)
+	tests.Assert(t, len(report.Issues) == 0)
+
+	// Volume created outside of Heketi
+	*volumes = append(*volumes, "external")
+	report, err = c.ConsistencyCheck()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, !report.Consistent)
+	tests.Assert(t, len(report.Issues) == 1)
+	tests.Assert(t, report.Issues[0].Type == api.ConsistencyUnknownVolume)
+	tests.Assert(t, report.Issues[0].Volume == "external")
+}
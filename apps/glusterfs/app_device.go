@@ -92,7 +92,7 @@ func (a *App) DeviceAdd(w http.ResponseWriter, r *http.Request) {
 
 		// Setup device on node
 		info, err := a.executor.DeviceSetup(node.ManageHostName(),
-			device.Info.Name, device.Info.Id)
+			device.Info.Name, device.Info.Id, msg.DestroyData)
 		if err != nil {
 			return "", err
 		}
@@ -362,3 +362,119 @@ func (a *App) DeviceSetState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (a *App) DeviceRemove(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get device entry
+	var device *DeviceEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		// The allocator must not use the device while it is emptied
+		if device.isOnline() {
+			http.Error(w, "Device must be offline or failed to be removed",
+				http.StatusConflict)
+			return ErrConflict
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Move bricks in an asynchronous function
+	logger.Info("Removing bricks from device %v", device.Info.Id)
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		err := device.Remove(a.db, a.executor, a.allocator)
+		if err != nil {
+			logger.LogError("Failed to remove bricks from device %v: %v",
+				device.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Removed all bricks from device %v", device.Info.Id)
+
+		// Done
+		return "", nil
+	})
+}
+
+func (a *App) DeviceResync(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get device and node entries
+	var (
+		device *DeviceEntry
+		node   *NodeEntry
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		device, err = NewDeviceEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		node, err = NewNodeEntryFromId(tx, device.NodeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Read the size of the device in an asynchronous function
+	logger.Info("Resyncing device %v on node %v", device.Info.Name, node.ManageHostName())
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		info, err := a.executor.DeviceResync(node.ManageHostName(),
+			device.Info.Name, device.Info.Id)
+		if err != nil {
+			return "", err
+		}
+
+		// Bricks may have been added or removed meanwhile
+		err = a.db.Update(func(tx *bolt.Tx) error {
+			device, err := NewDeviceEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+
+			device.SetExtentSize(info.ExtentSize)
+			err = device.StorageResync(tx, info.Size)
+			if err != nil {
+				return err
+			}
+
+			return device.Save(tx)
+		})
+		if err != nil {
+			return "", err
+		}
+
+		logger.Info("Resynced device %v to %v KB", id, info.Size)
+		return "/devices/" + id, nil
+	})
+}
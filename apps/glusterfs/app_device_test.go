@@ -18,10 +18,12 @@ package glusterfs
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -377,7 +379,7 @@ func TestDeviceAddCleansUp(t *testing.T) {
 	// Mock the device setup to return an error, which will
 	// cause the cleanup.
 	deviceSetupFn := app.xo.MockDeviceSetup
-	app.xo.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+	app.xo.MockDeviceSetup = func(host, device, vgid string, destroyData bool) (*executors.DeviceInfo, error) {
 		return nil, ErrDbAccess
 	}
 
@@ -432,6 +434,74 @@ func TestDeviceAddCleansUp(t *testing.T) {
 	}
 }
 
+func TestDeviceAddDestroyData(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a client
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Create Cluster
+	cluster, err := c.ClusterCreate()
+	tests.Assert(t, err == nil)
+
+	// Create Node
+	nodeReq := &api.NodeAddRequest{
+		Zone:      1,
+		ClusterId: cluster.Id,
+	}
+	nodeReq.Hostnames.Manage = sort.StringSlice{"manage.host"}
+	nodeReq.Hostnames.Storage = sort.StringSlice{"storage.host"}
+	node, err := c.NodeAdd(nodeReq)
+	tests.Assert(t, err == nil)
+
+	// The disk was used before
+	deviceSetupFn := app.xo.MockDeviceSetup
+	destroyed := false
+	app.xo.MockDeviceSetup = func(host, device, vgid string, destroyData bool) (*executors.DeviceInfo, error) {
+		if !destroyData {
+			return nil, &executors.DeviceInUseError{
+				Host:       host,
+				Device:     device,
+				Signatures: []string{"xfs"},
+			}
+		}
+		destroyed = true
+		return deviceSetupFn(host, device, vgid, destroyData)
+	}
+
+	deviceReq := &api.DeviceAddRequest{}
+	deviceReq.Name = "/dev/fake1"
+	deviceReq.NodeId = node.Id
+
+	err = c.DeviceAdd(deviceReq)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(),
+		"Device /dev/fake1 on manage.host is in use: signatures xfs"), err)
+	tests.Assert(t, destroyed == false)
+
+	// Its data is destroyed only when asked
+	deviceReq.DestroyData = true
+	err = c.DeviceAdd(deviceReq)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, destroyed == true)
+
+	node, err = c.NodeInfo(node.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(node.DevicesInfo) == 1)
+}
+
 func TestDeviceInfoIdNotFound(t *testing.T) {
 	tmpfile := tests.Tempfile()
 	defer os.Remove(tmpfile)
@@ -685,3 +755,178 @@ func TestDeviceState(t *testing.T) {
 	tests.Assert(t, info.Storage.Used == device.Storage.Used)
 	tests.Assert(t, info.Storage.Total == device.Storage.Total)
 }
+
+func TestDeviceRemove(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	mockVolumeInfoFromDb(t, app)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	v := createSampleVolumeEntry(100)
+	tests.Assert(t, v != nil)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Get the device of the first brick
+	var deviceId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		brick, err := NewBrickEntryFromId(tx, v.Bricks[0])
+		tests.Assert(t, err == nil)
+		deviceId = brick.Info.DeviceId
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Create a client
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Unknown device
+	err = c.DeviceRemove("123")
+	tests.Assert(t, err != nil)
+
+	// Device must not be online
+	err = c.DeviceRemove(deviceId)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "offline"))
+
+	err = c.DeviceState(deviceId, &api.StateRequest{
+		State: api.EntryStateOffline,
+	})
+	tests.Assert(t, err == nil)
+
+	// Remove bricks from the device
+	err = c.DeviceRemove(deviceId)
+	tests.Assert(t, err == nil)
+
+	// Check the volume kept all its bricks on other devices
+	err = app.db.View(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, deviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(device.Bricks) == 0)
+		tests.Assert(t, device.Info.Storage.Used == 0)
+
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(volume.Bricks) == len(v.Bricks))
+		for _, id := range volume.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, brick.Info.DeviceId != deviceId)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// The device can now be deleted
+	err = c.DeviceDelete(deviceId)
+	tests.Assert(t, err == nil)
+}
+
+func TestDeviceResync(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// One device of 500 GB
+	err := setupSampleDbWithTopology(app,
+		1,      // clusters
+		1,      // nodes_per_cluster
+		1,      // devices_per_node,
+		500*GB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityDistributeOnly
+	_, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil, err)
+
+	var device *DeviceEntry
+	var used uint64
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		devices, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(devices) == 1)
+		device, err = NewDeviceEntryFromId(tx, devices[0])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(device.Bricks) > 0)
+
+		for _, id := range device.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			used += brick.TotalSize()
+		}
+		tests.Assert(t, device.Info.Storage.Used == used)
+
+		// The accounting drifted
+		device.Info.Storage.Used = 1
+		device.Info.Storage.Free = 2
+		return device.Save(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	// The LUN grew
+	var resynced string
+	app.xo.MockDeviceResync = func(host, dev, vgid string) (*executors.DeviceInfo, error) {
+		resynced = host + ":" + dev + ":" + vgid
+		return &executors.DeviceInfo{
+			Size:       800 * GB,
+			ExtentSize: 4096,
+		}, nil
+	}
+
+	info, err := c.DeviceResync(device.Info.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, resynced != "")
+	tests.Assert(t, strings.HasSuffix(resynced, ":"+device.Info.Name+":"+device.Info.Id), resynced)
+	tests.Assert(t, info.Storage.Total == 800*GB, info.Storage)
+	tests.Assert(t, info.Storage.Used == used, info.Storage)
+	tests.Assert(t, info.Storage.Free == 800*GB-used, info.Storage)
+
+	// Failures leave the device as is
+	app.xo.MockDeviceResync = func(host, dev, vgid string) (*executors.DeviceInfo, error) {
+		return nil, errors.New("pvresize failed")
+	}
+	_, err = c.DeviceResync(device.Info.Id)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "pvresize failed"), err)
+
+	info, err = c.DeviceInfo(device.Info.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.Storage.Total == 800*GB, info.Storage)
+
+	// Unknown device
+	_, err = c.DeviceResync("123456")
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,114 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build faults
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/heketi/heketi/executors/faultexec"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/rest"
+)
+
+// Fault injection is only built with the faults build tag, so that
+// production servers cannot fail their calls to the executor
+
+type faultConfig faultexec.FaultConfig
+
+type appFaults struct {
+	*faultexec.FaultExecutor
+}
+
+// Wraps the executor when fault injection is enabled in the
+// configuration file
+func (a *App) setupFaults() error {
+	if !a.conf.FaultConfig.Enabled {
+		return nil
+	}
+
+	f, err := faultexec.NewFaultExecutor(a.executor, a.conf.FaultConfig.Faults)
+	if err != nil {
+		return err
+	}
+	a.faults = &appFaults{f}
+	a.executor = f
+	logger.Warning("Fault injection enabled with %v faults",
+		len(a.conf.FaultConfig.Faults))
+	return nil
+}
+
+// Routes are only registered when fault injection is enabled
+// in the configuration file
+func (a *App) faultRoutes() rest.Routes {
+	if a.faults == nil {
+		return nil
+	}
+
+	return rest.Routes{
+		rest.Route{
+			Name:        "FaultList",
+			Method:      "GET",
+			Pattern:     "/admin/faults",
+			HandlerFunc: a.FaultList},
+		rest.Route{
+			Name:        "FaultAdd",
+			Method:      "POST",
+			Pattern:     "/admin/faults",
+			HandlerFunc: a.FaultAdd},
+		rest.Route{
+			Name:        "FaultClear",
+			Method:      "DELETE",
+			Pattern:     "/admin/faults",
+			HandlerFunc: a.FaultClear},
+	}
+}
+
+func (a *App) FaultList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(a.faults.Faults()); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) FaultAdd(w http.ResponseWriter, r *http.Request) {
+	var msg faultexec.Fault
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	err = a.faults.Add(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.Warning("Added fault %+v", msg)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *App) FaultClear(w http.ResponseWriter, r *http.Request) {
+	a.faults.Clear()
+	logger.Warning("Cleared all faults")
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,606 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build faults
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/faultexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func NewTestFaultApp(dbfile string) *App {
+	app := NewApp(bytes.NewBufferString(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"allocator" : "simple",
+			"db" : "` + dbfile + `",
+			"faultexec" : {
+				"enabled" : true
+			}
+		}
+	}`))
+	if app == nil {
+		panic("unable to create app with fault injection")
+	}
+	return app
+}
+
+// What an operation failing on a fault must leave unchanged
+type faultDbState struct {
+	volumes map[string]*VolumeEntry
+	devices map[string]*DeviceEntry
+	bricks  []string
+	pending []string
+}
+
+func readFaultDbState(t *testing.T, app *App) *faultDbState {
+	s := &faultDbState{
+		volumes: make(map[string]*VolumeEntry),
+		devices: make(map[string]*DeviceEntry),
+	}
+	err := app.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range volumes {
+			s.volumes[id], err = NewVolumeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+		}
+
+		devices, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range devices {
+			s.devices[id], err = NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+		}
+
+		s.bricks, err = BrickList(tx)
+		tests.Assert(t, err == nil)
+		s.pending, err = PendingOperationList(tx)
+		tests.Assert(t, err == nil)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	return s
+}
+
+func ringDevices(ring *SimpleAllocatorRing) sort.StringSlice {
+	devices := make(sort.StringSlice, 0)
+	for _, nodes := range ring.ring {
+		for _, node := range nodes {
+			for _, device := range node {
+				devices = append(devices, device.String())
+			}
+		}
+	}
+	devices.Sort()
+	return devices
+}
+
+// Checks the space and brick lists of the devices account for
+// exactly the bricks in the db, and the allocator rings match
+// the devices
+func assertAllocatorClean(t *testing.T, app *App) {
+	s := readFaultDbState(t, app)
+	used := make(map[string]uint64)
+	bricks := make(map[string]sort.StringSlice)
+	err := app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range s.bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			used[brick.Info.DeviceId] += brick.TotalSize()
+			bricks[brick.Info.DeviceId] = append(bricks[brick.Info.DeviceId], id)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	for id, device := range s.devices {
+		storage := device.Info.Storage
+		tests.Assert(t, storage.Used == used[id], id, storage.Used, used[id])
+		tests.Assert(t, storage.Free+storage.Used == storage.Total,
+			id, storage)
+
+		expected := bricks[id]
+		if expected == nil {
+			expected = sort.StringSlice{}
+		}
+		expected.Sort()
+		actual := append(sort.StringSlice{}, device.Bricks...)
+		actual.Sort()
+		tests.Assert(t, reflect.DeepEqual(actual, expected),
+			id, actual, expected)
+	}
+
+	allocator := app.allocator.(*SimpleAllocator)
+	fresh := NewSimpleAllocatorFromDb(app.db)
+	tests.Assert(t, len(allocator.rings) == len(fresh.rings))
+	for id, ring := range fresh.rings {
+		tests.Assert(t, allocator.rings[id] != nil)
+		tests.Assert(t, reflect.DeepEqual(ringDevices(allocator.rings[id]),
+			ringDevices(ring)))
+	}
+}
+
+func assertFaultDbState(t *testing.T, app *App, expected *faultDbState) {
+	s := readFaultDbState(t, app)
+	tests.Assert(t, reflect.DeepEqual(s.bricks, expected.bricks),
+		s.bricks, expected.bricks)
+	tests.Assert(t, reflect.DeepEqual(s.pending, expected.pending),
+		s.pending, expected.pending)
+	tests.Assert(t, reflect.DeepEqual(s.devices, expected.devices))
+	tests.Assert(t, reflect.DeepEqual(s.volumes, expected.volumes))
+	assertAllocatorClean(t, app)
+}
+
+// Every replica 2 volume has a brick on each node
+func setupFaultApp(t *testing.T, dbfile string) *App {
+	app := NewTestFaultApp(dbfile)
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		2,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	return app
+}
+
+func firstNodeHost(t *testing.T, app *App) string {
+	var host string
+	err := app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, err == nil)
+		cluster, err := NewClusterEntryFromId(tx, clusters[0])
+		tests.Assert(t, err == nil)
+		node, err := NewNodeEntryFromId(tx, cluster.Info.Nodes[0])
+		tests.Assert(t, err == nil)
+		host = node.ManageHostName()
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	return host
+}
+
+func TestVolumeCreateFaultRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+	host := firstNodeHost(t, app)
+
+	for _, faults := range [][]faultexec.Fault{
+		{{Method: "BrickCreate", Call: 3}},
+		{{Method: "BrickCreate", Host: host}},
+		{{Method: "VolumeCreate", Delay: 10}},
+		{{Method: "VolumeCreate", Action: faultexec.FAULT_TIMEOUT}},
+		{{Method: "VolumeCreate"},
+			{Method: "VolumeDestroy"}},
+	} {
+		expected := readFaultDbState(t, app)
+		for _, fault := range faults {
+			tests.Assert(t, app.faults.Add(fault) == nil)
+		}
+
+		v := createSampleVolumeEntry(100)
+		err := v.Create(app.db, app.executor, app.allocator)
+		tests.Assert(t, err != nil, faults)
+		assertFaultDbState(t, app, expected)
+
+		// The space is available again
+		app.faults.Clear()
+		v = createSampleVolumeEntry(100)
+		err = v.Create(app.db, app.executor, app.allocator)
+		tests.Assert(t, err == nil, err)
+		err = v.Destroy(app.db, app.executor)
+		tests.Assert(t, err == nil, err)
+		assertFaultDbState(t, app, expected)
+	}
+}
+
+// Checks the devices still hold the bricks of the failed operation
+// in the journal
+func assertPendingBricksAllocated(t *testing.T, app *App, expected *faultDbState) {
+	s := readFaultDbState(t, app)
+	tests.Assert(t, len(s.pending) == len(expected.pending)+1)
+
+	var op *PendingOperationEntry
+	err := app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range s.pending {
+			if !utils.SortedStringHas(expected.pending, id) {
+				var err error
+				op, err = NewPendingOperationEntryFromId(tx, id)
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, op != nil)
+	tests.Assert(t, len(op.Bricks) > 0)
+	for _, brick := range op.Bricks {
+		device := s.devices[brick.Info.DeviceId]
+		tests.Assert(t, utils.SortedStringHas(device.Bricks, brick.Info.Id))
+		tests.Assert(t, device.Info.Storage.Used >
+			expected.devices[brick.Info.DeviceId].Info.Storage.Used)
+	}
+}
+
+func TestVolumeCreateFaultKeepsUndestroyedBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+	expected := readFaultDbState(t, app)
+
+	// The brick created first cannot be destroyed again
+	for _, fault := range []faultexec.Fault{
+		{Method: "BrickCreate", Call: 2},
+		{Method: "BrickDestroy"},
+	} {
+		tests.Assert(t, app.faults.Add(fault) == nil)
+	}
+
+	v := createSampleVolumeEntry(100)
+	err := v.Create(app.db, app.executor, app.allocator)
+	_, ok := err.(*BrickCleanupError)
+	tests.Assert(t, ok, err)
+
+	// The operation is kept with its bricks until it is rolled back
+	assertPendingBricksAllocated(t, app, expected)
+	s := readFaultDbState(t, app)
+	tests.Assert(t, s.volumes[v.Info.Id].Info.State == api.VolumeStateCreating)
+
+	app.faults.Clear()
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	assertFaultDbState(t, app, expected)
+}
+
+func TestVolumeCreateHungHost(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+	expected := readFaultDbState(t, app)
+
+	err := app.faults.Add(faultexec.Fault{
+		Method: "VolumeCreate",
+		Action: faultexec.FAULT_HANG,
+	})
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	done := make(chan error)
+	go func() {
+		done <- v.Create(app.db, app.executor, app.allocator)
+	}()
+
+	// The volume is shown as being created while the host hangs
+	time.Sleep(50 * time.Millisecond)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.State == api.VolumeStateCreating)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	app.faults.Clear()
+	err = <-done
+	tests.Assert(t, err == faultexec.ErrTimeout, err)
+	assertFaultDbState(t, app, expected)
+}
+
+func TestVolumeExpandFaultRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+
+	v := createSampleVolumeEntry(100)
+	err := v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	for _, faults := range [][]faultexec.Fault{
+		{{Method: "BrickCreate", Call: 2}},
+		{{Method: "VolumeExpand"}},
+		{{Method: "VolumeExpand", Action: faultexec.FAULT_TIMEOUT, Delay: 10}},
+	} {
+		expected := readFaultDbState(t, app)
+		for _, fault := range faults {
+			tests.Assert(t, app.faults.Add(fault) == nil)
+		}
+
+		err = v.Expand(app.db, app.executor, app.allocator, 50)
+		tests.Assert(t, err != nil, faults)
+		assertFaultDbState(t, app, expected)
+		app.faults.Clear()
+	}
+
+	err = v.Expand(app.db, app.executor, app.allocator, 50)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, v.Info.Size == 150)
+}
+
+func TestVolumeExpandFaultKeepsUndestroyedBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+
+	v := createSampleVolumeEntry(100)
+	err := v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	expected := readFaultDbState(t, app)
+
+	// GlusterFS fails to take the bricks, which cannot be destroyed
+	for _, fault := range []faultexec.Fault{
+		{Method: "VolumeExpand"},
+		{Method: "BrickDestroy"},
+	} {
+		tests.Assert(t, app.faults.Add(fault) == nil)
+	}
+
+	err = v.Expand(app.db, app.executor, app.allocator, 50)
+	tests.Assert(t, err != nil)
+
+	// The operation is kept with its bricks until it is rolled back
+	assertPendingBricksAllocated(t, app, expected)
+	s := readFaultDbState(t, app)
+	tests.Assert(t, s.volumes[v.Info.Id].Info.State == api.VolumeStateExpanding)
+
+	app.faults.Clear()
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	assertFaultDbState(t, app, expected)
+}
+
+func TestVolumeExpandFaultAfterExpansion(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+
+	v := createSampleVolumeEntry(100)
+	err := v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	expected := readFaultDbState(t, app)
+
+	// The operation cannot be recorded once GlusterFS took the
+	// new bricks
+	destroyed := 0
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed++
+		return nil
+	}
+	var (
+		served []executors.BrickInfo
+		op     *PendingOperationEntry
+	)
+	app.xo.MockVolumeExpand = func(host string,
+		volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		served = volume.Bricks
+		err := app.db.Update(func(tx *bolt.Tx) error {
+			ids, err := PendingOperationList(tx)
+			tests.Assert(t, err == nil && len(ids) == 1)
+			op, err = NewPendingOperationEntryFromId(tx, ids[0])
+			tests.Assert(t, err == nil)
+			return tx.DeleteBucket([]byte(BOLTDB_BUCKET_PENDING))
+		})
+		tests.Assert(t, err == nil)
+		return &executors.VolumeInfo{}, nil
+	}
+	app.xo.MockVolumeList = func(host string) ([]string, error) {
+		return []string{v.Info.Name}, nil
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		return &executors.VolumeInfo{
+			Name:   volume,
+			Bricks: served,
+		}, nil
+	}
+	err = v.Expand(app.db, app.executor, app.allocator, 50)
+	tests.Assert(t, err != nil)
+
+	// The bricks served by GlusterFS are kept
+	tests.Assert(t, destroyed == 0)
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(BOLTDB_BUCKET_PENDING))
+		tests.Assert(t, err == nil)
+		return op.Save(tx)
+	})
+	tests.Assert(t, err == nil)
+	assertPendingBricksAllocated(t, app, expected)
+	s := readFaultDbState(t, app)
+	tests.Assert(t, s.volumes[v.Info.Id].Info.State == api.VolumeStateExpanding)
+
+	// The expansion is completed on recovery
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, destroyed == 0)
+	s = readFaultDbState(t, app)
+	tests.Assert(t, len(s.pending) == 0)
+	tests.Assert(t, s.volumes[v.Info.Id].Info.State == api.VolumeStateOnline)
+	tests.Assert(t, s.volumes[v.Info.Id].Info.Size == 150)
+	tests.Assert(t, len(s.volumes[v.Info.Id].Bricks) == len(s.bricks))
+	assertAllocatorClean(t, app)
+}
+
+func TestVolumeDestroyFaultRollback(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+	empty := readFaultDbState(t, app)
+
+	v := createSampleVolumeEntry(100)
+	err := v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Failures before the volume is stopped leave it online
+	for _, fault := range []faultexec.Fault{
+		{Method: "VolumeDestroyCheck"},
+		{Method: "BrickDestroyCheck", Call: 2},
+		{Method: "VolumeDestroy", Action: faultexec.FAULT_TIMEOUT},
+	} {
+		expected := readFaultDbState(t, app)
+		tests.Assert(t, app.faults.Add(fault) == nil)
+
+		err = v.Destroy(app.db, app.executor)
+		tests.Assert(t, err != nil, fault)
+		assertFaultDbState(t, app, expected)
+		app.faults.Clear()
+	}
+
+	// Once the volume is stopped it is kept as failed
+	// until the remaining bricks are destroyed
+	err = app.faults.Add(faultexec.Fault{Method: "BrickDestroy", Call: 1})
+	tests.Assert(t, err == nil)
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err != nil)
+	s := readFaultDbState(t, app)
+	tests.Assert(t, s.volumes[v.Info.Id].Info.State == api.VolumeStateFailed)
+	tests.Assert(t, len(s.pending) == 1)
+	assertAllocatorClean(t, app)
+
+	app.faults.Clear()
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	assertFaultDbState(t, app, empty)
+}
+
+func TestAppFaults(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := setupFaultApp(t, tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Add a fault
+	r, err := http.Post(ts.URL+"/admin/faults", "application/json",
+		bytes.NewBufferString(`{"method":"VolumeCreate","error":"injected"}`))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusCreated)
+
+	// Unknown method
+	r, err = http.Post(ts.URL+"/admin/faults", "application/json",
+		bytes.NewBufferString(`{"method":"VolumeExplode"}`))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// List
+	r, err = http.Get(ts.URL + "/admin/faults")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	var faults []faultexec.Fault
+	err = utils.GetJsonFromResponse(r, &faults)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(faults) == 1)
+	tests.Assert(t, faults[0].Method == "VolumeCreate")
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "injected"))
+
+	// Clear
+	req, err := http.NewRequest("DELETE", ts.URL+"/admin/faults", nil)
+	tests.Assert(t, err == nil)
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	tests.Assert(t, len(app.faults.Faults()) == 0)
+
+	v = createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil, err)
+}
+
+func TestAppFaultsDisabled(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL + "/admin/faults")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+}
+
+func TestAppFaultsFromConfig(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewApp(bytes.NewBufferString(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + tmpfile + `",
+			"faultexec" : {
+				"enabled" : true,
+				"faults" : [{"method" : "BrickCreate", "call" : 2}]
+			}
+		}
+	}`))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	tests.Assert(t, len(app.faults.Faults()) == 1)
+
+	// Bad faults are rejected
+	app2 := NewApp(bytes.NewBufferString(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + tmpfile + `",
+			"faultexec" : {
+				"enabled" : true,
+				"faults" : [{"method" : "BrickCreate", "action" : "explode"}]
+			}
+		}
+	}`))
+	tests.Assert(t, app2 == nil)
+}
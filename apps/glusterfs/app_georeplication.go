@@ -0,0 +1,283 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) GeoReplicationCreate(w http.ResponseWriter, r *http.Request) {
+
+	// Get the volume id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.GeoReplicationCreateRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	// Check the message
+	if msg.SlaveVolumeId == "" {
+		http.Error(w, "Slave volume missing", http.StatusBadRequest)
+		return
+	}
+
+	// Create a session entry
+	session := NewGeoReplicationEntryFromRequest(id, &msg)
+
+	// Check the volumes exist and are not already replicated
+	err = a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		err = session.CheckVolumes(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return err
+		}
+
+		for _, sessionId := range volume.GeoReplications {
+			entry, err := NewGeoReplicationEntryFromId(tx, sessionId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return err
+			}
+			if entry.Info.VolumeId == id && entry.Info.SlaveVolumeId == msg.SlaveVolumeId {
+				err := fmt.Errorf("Volume %v is already replicated to %v in session %v",
+					id, msg.SlaveVolumeId, entry.Info.Id)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Create session in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Creating geo-replication session %v", session.Info.Id)
+		err := session.Create(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to create geo-replication session: %v", err)
+			return "", err
+		}
+
+		logger.Info("Created geo-replication session %v", session.Info.Id)
+
+		// Done
+		return "/volumes/" + id + "/georeplication/" + session.Info.Id, nil
+	})
+}
+
+func (a *App) GeoReplicationList(w http.ResponseWriter, r *http.Request) {
+
+	// Get the volume id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var list api.GeoReplicationListResponse
+
+	// Get all the session ids of the volume from the DB
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		list.Sessions = volume.GeoReplications
+		if list.Sessions == nil {
+			list.Sessions = make([]string, 0)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+// Returns the session entry referenced in the URL.  On error, the
+// http response has already been written.
+func (a *App) geoReplicationFromRequest(w http.ResponseWriter,
+	r *http.Request,
+	tx *bolt.Tx) (*GeoReplicationEntry, error) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	sessionId := vars["session"]
+
+	entry, err := NewGeoReplicationEntryFromId(tx, sessionId)
+	if err == ErrNotFound {
+		http.Error(w, "Id not found", http.StatusNotFound)
+		return nil, err
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	// Check the session is from or to the volume
+	if entry.Info.VolumeId != id && entry.Info.SlaveVolumeId != id {
+		http.Error(w, "Id not found", http.StatusNotFound)
+		return nil, ErrNotFound
+	}
+
+	return entry, nil
+}
+
+func (a *App) GeoReplicationInfo(w http.ResponseWriter, r *http.Request) {
+
+	// Get session information
+	var (
+		session *GeoReplicationEntry
+		info    *api.GeoReplicationInfoResponse
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = a.geoReplicationFromRequest(w, r, tx)
+		if err != nil {
+			return err
+		}
+
+		info, err = session.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Get the status from GlusterFS
+	info.Status, err = session.Status(a.db, a.executor)
+	if err != nil {
+		logger.LogError("Failed to get status of geo-replication session %v: %v",
+			session.Info.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) GeoReplicationAction(w http.ResponseWriter, r *http.Request) {
+
+	// Get the action from the URL
+	vars := mux.Vars(r)
+	action := vars["action"]
+
+	// Get session entry
+	var session *GeoReplicationEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = a.geoReplicationFromRequest(w, r, tx)
+		if err != nil {
+			return err
+		}
+
+		err = session.CheckAction(action)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		err := session.Action(a.db, a.executor, action)
+		if err != nil {
+			logger.LogError("Failed to %v geo-replication session %v: %v",
+				action, session.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Ran %v on geo-replication session %v", action, session.Info.Id)
+
+		// Done
+		return "/volumes/" + session.Info.VolumeId + "/georeplication/" + session.Info.Id, nil
+	})
+}
+
+func (a *App) GeoReplicationDelete(w http.ResponseWriter, r *http.Request) {
+
+	// Get session entry
+	var session *GeoReplicationEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		session, err = a.geoReplicationFromRequest(w, r, tx)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		err := session.Destroy(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to delete geo-replication session %v: %v",
+				session.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Deleted geo-replication session %v", session.Info.Id)
+		return "", nil
+	})
+}
@@ -0,0 +1,144 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestGeoReplication(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	master, slave := createSampleGeoReplicationVolumes(t, app)
+	app.xo.MockGeoReplicationStatus = func(host string,
+		session *executors.GeoReplicationRequest) (*executors.GeoReplicationStatus, error) {
+		return &executors.GeoReplicationStatus{
+			Pairs: []executors.GeoReplicationPair{
+				{MasterNode: "host1", MasterBrick: "/b1", Status: "Active"},
+			},
+		}, nil
+	}
+	c := client.NewClientNoAuth(ts.URL)
+
+	// Unknown volume
+	_, err := c.GeoReplicationCreate("123",
+		&api.GeoReplicationCreateRequest{SlaveVolumeId: slave.Info.Id})
+	tests.Assert(t, err != nil)
+
+	// Missing or unknown slave volume
+	r, err := http.Post(ts.URL+"/volumes/"+master.Info.Id+"/georeplication",
+		"application/json", bytes.NewBuffer([]byte(`{}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	r, err = http.Post(ts.URL+"/volumes/"+master.Info.Id+"/georeplication",
+		"application/json", bytes.NewBuffer([]byte(`{"slave_volume" : "123"}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Create session
+	session, err := c.GeoReplicationCreate(master.Info.Id,
+		&api.GeoReplicationCreateRequest{SlaveVolumeId: slave.Info.Id})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, session.VolumeId == master.Info.Id)
+	tests.Assert(t, session.SlaveVolumeId == slave.Info.Id)
+	tests.Assert(t, session.SlaveVolume == slave.Info.Name)
+	tests.Assert(t, session.State == api.GeoReplicationCreated)
+	tests.Assert(t, len(session.Status) == 1)
+	tests.Assert(t, session.Status[0].Status == "Active")
+
+	// Only one session between the volumes
+	r, err = http.Post(ts.URL+"/volumes/"+master.Info.Id+"/georeplication",
+		"application/json",
+		bytes.NewBuffer([]byte(`{"slave_volume" : "`+slave.Info.Id+`"}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusConflict)
+
+	// Listed from both volumes
+	for _, id := range []string{master.Info.Id, slave.Info.Id} {
+		list, err := c.GeoReplicationList(id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(list.Sessions) == 1)
+		tests.Assert(t, list.Sessions[0] == session.Id)
+
+		info, err := c.GeoReplicationInfo(id, session.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, info.Id == session.Id)
+	}
+
+	// Not a session of another volume
+	other := createSampleVolumeEntry(100)
+	err = other.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	_, err = c.GeoReplicationInfo(other.Info.Id, session.Id)
+	tests.Assert(t, err != nil)
+
+	// Invalid state
+	r, err = http.Post(ts.URL+"/volumes/"+master.Info.Id+"/georeplication/"+session.Id+"/pause",
+		"application/json", bytes.NewBuffer([]byte{}))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusConflict)
+
+	// Start, pause and resume
+	session, err = c.GeoReplicationStart(master.Info.Id, session.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, session.State == api.GeoReplicationStarted)
+	session, err = c.GeoReplicationPause(master.Info.Id, session.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, session.State == api.GeoReplicationPaused)
+	session, err = c.GeoReplicationResume(master.Info.Id, session.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, session.State == api.GeoReplicationStarted)
+
+	// Volumes with sessions cannot be deleted
+	err = c.VolumeDelete(slave.Info.Id)
+	tests.Assert(t, err != nil)
+
+	// Stop and delete
+	session, err = c.GeoReplicationStop(master.Info.Id, session.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, session.State == api.GeoReplicationStopped)
+	err = c.GeoReplicationDelete(master.Info.Id, session.Id)
+	tests.Assert(t, err == nil)
+
+	list, err := c.GeoReplicationList(master.Info.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(list.Sessions) == 0)
+
+	err = c.VolumeDelete(slave.Info.Id)
+	tests.Assert(t, err == nil)
+}
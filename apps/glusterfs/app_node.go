@@ -19,11 +19,13 @@ package glusterfs
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/heketi/pkg/utils/ssh"
 )
 
 func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +63,13 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if msg.Ssh != nil && msg.Ssh.Port != "" {
+		if port, err := strconv.Atoi(msg.Ssh.Port); err != nil || port <= 0 || port > 65535 {
+			http.Error(w, "Invalid ssh port", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Create a node entry
 	node := NewNodeEntryFromRequest(&msg)
 
@@ -112,9 +121,22 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 					node.Deregister(tx)
 					return nil
 				})
+				a.nodeSsh.Remove(node.ManageHostName())
 			}
 		}()
 
+		// Reach the node with its own ssh settings
+		a.nodeSsh.Set(node.ManageHostName(), node.Info.Ssh)
+
+		// Check the host key of the new node before it joins the
+		// cluster, when the keys are verified
+		if a.conf.SshConfig.EffectiveHostKeyPolicy() != ssh.HOSTKEY_INSECURE {
+			err := a.executor.GlusterdCheck(node.ManageHostName())
+			if err != nil {
+				return "", err
+			}
+		}
+
 		// Peer probe if there is at least one other node
 		// TODO: What happens if the peer_node is not responding.. we need to choose another.
 		if peer_node != nil {
@@ -125,7 +147,7 @@ func (a *App) NodeAdd(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Add node entry into the db
-		err = a.db.Update(func(tx *bolt.Tx) error {
+		err := a.db.Update(func(tx *bolt.Tx) error {
 			cluster, err := NewClusterEntryFromId(tx, msg.ClusterId)
 			if err == ErrNotFound {
 				http.Error(w, "Cluster id does not exist", http.StatusNotFound)
@@ -303,6 +325,13 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 			// Remove hostnames
 			node.Deregister(tx)
 
+			// Forget its host keys
+			err = removeHostKeys(tx, node.ManageHostName())
+			if err != nil {
+				logger.Err(err)
+				return err
+			}
+
 			// Delete node from db
 			err = node.Delete(tx)
 			if err != nil {
@@ -316,6 +345,8 @@ func (a *App) NodeDelete(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return "", err
 		}
+		a.nodeSsh.Remove(node.ManageHostName())
+
 		// Show that the key has been deleted
 		logger.Info("Deleted node [%s]", id)
 
@@ -368,3 +399,52 @@ func (a *App) NodeSetState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (a *App) NodeRemove(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get node entry
+	var node *NodeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		node, err = NewNodeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		// The allocator must not use the node while it is emptied
+		if node.isOnline() {
+			http.Error(w, "Node must be offline or failed to be removed",
+				http.StatusConflict)
+			return ErrConflict
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Move bricks in an asynchronous function
+	logger.Info("Removing bricks from node %v", node.Info.Id)
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		err := node.Remove(a.db, a.executor, a.allocator)
+		if err != nil {
+			logger.LogError("Failed to remove bricks from node %v: %v",
+				node.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Removed all bricks from node %v", node.Info.Id)
+
+		// Done
+		return "", nil
+	})
+}
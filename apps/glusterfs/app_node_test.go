@@ -30,8 +30,11 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
 	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/sshexec"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/heketi/pkg/utils/ssh"
 	"github.com/heketi/tests"
 )
 
@@ -1088,3 +1091,337 @@ func TestNodeState(t *testing.T) {
 	tests.Assert(t, mockAllocator.clustermap[cluster.Id][0] == device.Id)
 
 }
+
+func TestNodeRemove(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	mockVolumeInfoFromDb(t, app)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	v := createSampleVolumeEntry(100)
+	tests.Assert(t, v != nil)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Get the node of the first brick
+	var nodeId string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		brick, err := NewBrickEntryFromId(tx, v.Bricks[0])
+		tests.Assert(t, err == nil)
+		nodeId = brick.Info.NodeId
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Create a client
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Unknown node
+	err = c.NodeRemove("123")
+	tests.Assert(t, err != nil)
+
+	// Node must not be online
+	err = c.NodeRemove(nodeId)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "offline"))
+
+	err = c.NodeState(nodeId, &api.StateRequest{
+		State: api.EntryStateOffline,
+	})
+	tests.Assert(t, err == nil)
+
+	// Remove bricks from the node
+	err = c.NodeRemove(nodeId)
+	tests.Assert(t, err == nil)
+
+	// Check the volume kept all its bricks on other nodes
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(volume.Bricks) == len(v.Bricks))
+		for _, id := range volume.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, brick.Info.NodeId != nodeId)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// The devices and then the node can now be deleted
+	node, err := c.NodeInfo(nodeId)
+	tests.Assert(t, err == nil)
+	for _, device := range node.DevicesInfo {
+		tests.Assert(t, len(device.Bricks) == 0)
+		err = c.DeviceDelete(device.Id)
+		tests.Assert(t, err == nil)
+	}
+
+	err = c.NodeDelete(nodeId)
+	tests.Assert(t, err == nil)
+}
+
+func TestNodeRemoveUnreachable(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	mockVolumeInfoFromDb(t, app)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		6,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	v := createSampleVolumeEntry(100)
+	tests.Assert(t, v != nil)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Get the nodes of the first two bricks
+	var nodeIds []string
+	hosts := make(map[string]string)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			if _, ok := hosts[brick.Info.NodeId]; ok {
+				continue
+			}
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			tests.Assert(t, err == nil)
+			hosts[node.Info.Id] = node.ManageHostName()
+			nodeIds = append(nodeIds, node.Info.Id)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(nodeIds) >= 2)
+
+	// Both nodes cannot be reached
+	down := map[string]bool{
+		hosts[nodeIds[0]]: true,
+		hosts[nodeIds[1]]: true,
+	}
+	app.xo.MockBrickDestroyCheck = func(host string, brick *executors.BrickRequest) error {
+		tests.Assert(t, !down[host], host)
+		return nil
+	}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		tests.Assert(t, !down[host], host)
+		return nil
+	}
+
+	c := client.NewClientNoAuth(ts.URL)
+	tests.Assert(t, c != nil)
+
+	// Bricks of a failed node are moved without reaching it
+	err = c.NodeState(nodeIds[0], &api.StateRequest{
+		State: api.EntryStateOffline,
+	})
+	tests.Assert(t, err == nil)
+	err = c.NodeState(nodeIds[0], &api.StateRequest{
+		State: api.EntryStateFailed,
+	})
+	tests.Assert(t, err == nil)
+	err = c.NodeRemove(nodeIds[0])
+	tests.Assert(t, err == nil, err)
+
+	// Bricks of an offline node are moved without reaching it either
+	err = c.NodeState(nodeIds[1], &api.StateRequest{
+		State: api.EntryStateOffline,
+	})
+	tests.Assert(t, err == nil)
+	err = c.NodeRemove(nodeIds[1])
+	tests.Assert(t, err == nil, err)
+
+	// No brick is left on either node
+	for _, nodeId := range nodeIds[:2] {
+		node, err := c.NodeInfo(nodeId)
+		tests.Assert(t, err == nil)
+		for _, device := range node.DevicesInfo {
+			tests.Assert(t, len(device.Bricks) == 0)
+		}
+	}
+}
+
+func TestNodeGlusterdCheckFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	c := client.NewClientNoAuth(ts.URL)
+	cluster, err := c.ClusterCreate()
+	tests.Assert(t, err == nil)
+
+	// Nodes are not checked when their host keys are not verified
+	checked := ""
+	app.xo.MockGlusterdCheck = func(host string) error {
+		checked = host
+		return errors.New("Host key verification failed for manage0.hostname.com")
+	}
+	probe_called := false
+	app.xo.MockPeerProbe = func(exec_host, newnode string) error {
+		probe_called = true
+		return nil
+	}
+
+	req := &api.NodeAddRequest{
+		ClusterId: cluster.Id,
+		Zone:      1,
+	}
+	req.Hostnames.Manage = []string{"unchecked.hostname.com"}
+	req.Hostnames.Storage = []string{"unchecked-storage.hostname.com"}
+	_, err = c.NodeAdd(req)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, checked == "")
+
+	// The new node cannot be trusted
+	app.conf.SshConfig.HostKeyPolicy = ssh.HOSTKEY_TOFU
+	req.Hostnames.Manage = []string{"manage0.hostname.com"}
+	req.Hostnames.Storage = []string{"storage0.hostname.com"}
+	_, err = c.NodeAdd(req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Host key verification failed"), err)
+	tests.Assert(t, checked == "manage0.hostname.com")
+	tests.Assert(t, probe_called == false)
+
+	// Only the unchecked node was added
+	info, err := c.ClusterInfo(cluster.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(info.Nodes) == 1)
+
+	app.xo.MockGlusterdCheck = func(host string) error {
+		return nil
+	}
+	_, err = c.NodeAdd(req)
+	tests.Assert(t, err == nil, err)
+}
+
+func TestNodeSshSettings(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+
+	c := client.NewClientNoAuth(ts.URL)
+	cluster, err := c.ClusterCreate()
+	tests.Assert(t, err == nil)
+
+	req := &api.NodeAddRequest{
+		ClusterId: cluster.Id,
+		Zone:      1,
+		Ssh: &api.NodeSshSettings{
+			User: "admin",
+			Port: "99999",
+		},
+	}
+	req.Hostnames.Manage = []string{"manage0.hostname.com"}
+	req.Hostnames.Storage = []string{"storage0.hostname.com"}
+	_, err = c.NodeAdd(req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Invalid ssh port"), err)
+
+	// The node is reached with its settings from the start
+	app.conf.SshConfig.KnownHostsFile = "/etc/heketi/known_hosts"
+	var checked *sshexec.NodeSettings
+	app.xo.MockGlusterdCheck = func(host string) error {
+		checked = app.nodeSsh.NodeSettings(host)
+		return errors.New("Permission denied")
+	}
+	req.Ssh.Port = "2222"
+	req.Ssh.KeyFile = "/etc/heketi/node0_key"
+	_, err = c.NodeAdd(req)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, checked != nil)
+	tests.Assert(t, *checked == sshexec.NodeSettings{
+		User:    "admin",
+		Port:    "2222",
+		KeyFile: "/etc/heketi/node0_key",
+	}, checked)
+	tests.Assert(t, app.nodeSsh.NodeSettings("manage0.hostname.com") == nil)
+
+	app.xo.MockGlusterdCheck = func(host string) error {
+		return nil
+	}
+	node, err := c.NodeAdd(req)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, node.Ssh != nil)
+	tests.Assert(t, *node.Ssh == *req.Ssh)
+	tests.Assert(t, *app.nodeSsh.NodeSettings("manage0.hostname.com") == *checked)
+
+	// Nodes without settings use the configuration
+	req.Ssh = nil
+	req.Hostnames.Manage = []string{"manage1.hostname.com"}
+	req.Hostnames.Storage = []string{"storage1.hostname.com"}
+	_, err = c.NodeAdd(req)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, app.nodeSsh.NodeSettings("manage1.hostname.com") == nil)
+
+	ts.Close()
+	app.Close()
+
+	// The settings are loaded from the db on restart
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	router = mux.NewRouter()
+	app.SetRoutes(router)
+	ts = httptest.NewServer(router)
+	defer ts.Close()
+	c = client.NewClientNoAuth(ts.URL)
+
+	tests.Assert(t, *app.nodeSsh.NodeSettings("manage0.hostname.com") == *checked)
+	tests.Assert(t, app.nodeSsh.NodeSettings("manage1.hostname.com") == nil)
+
+	err = c.NodeDelete(node.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, app.nodeSsh.NodeSettings("manage0.hostname.com") == nil)
+}
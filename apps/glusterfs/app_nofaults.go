@@ -0,0 +1,44 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build !faults
+
+package glusterfs
+
+import (
+	"github.com/heketi/rest"
+)
+
+// Without the faults build tag only the setting enabling fault
+// injection is read, to warn it is ignored
+
+type faultConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type appFaults struct{}
+
+func (a *App) setupFaults() error {
+	if a.conf.FaultConfig.Enabled {
+		logger.Warning("Fault injection is not built into this server, " +
+			"ignoring the faultexec settings")
+	}
+	return nil
+}
+
+func (a *App) faultRoutes() rest.Routes {
+	return nil
+}
@@ -0,0 +1,62 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// +build !faults
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+func TestAppFaultsNotBuilt(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Enabling fault injection in the configuration is ignored
+	app := NewApp(bytes.NewBufferString(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + tmpfile + `",
+			"faultexec" : {
+				"enabled" : true,
+				"faults" : [{"method" : "BrickCreate"}]
+			}
+		}
+	}`))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+	tests.Assert(t, app.faults == nil)
+	_, ok := app.executor.(*mockexec.MockExecutor)
+	tests.Assert(t, ok)
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	r, err := http.Get(ts.URL + "/admin/faults")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+}
@@ -0,0 +1,232 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) VolumeQuota(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get quota information
+	var info *api.QuotaInfoResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		info = entry.NewQuotaInfoResponse()
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+
+}
+
+func (a *App) VolumeQuotaEnable(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Enable quota in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Enabling quota on volume %v", volume.Info.Id)
+		err := volume.QuotaEnable(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to enable quota on volume %v: %v",
+				volume.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Enabled quota on volume %v", volume.Info.Id)
+
+		// Done
+		return "/volumes/" + volume.Info.Id + "/quota", nil
+	})
+
+}
+
+func (a *App) VolumeQuotaSetLimit(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.QuotaLimit
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	// Check the message
+	err = ValidateQuotaLimit(&msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if !volume.Quota.Enable {
+			http.Error(w, ErrQuotaNotEnabled.Error(), http.StatusConflict)
+			return ErrQuotaNotEnabled
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Set the limit in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Setting quota limit on %v of volume %v",
+			msg.Path, volume.Info.Id)
+		err := volume.QuotaSetLimit(a.db, a.executor, &msg)
+		if err != nil {
+			logger.LogError("Failed to set quota limit on %v of volume %v: %v",
+				msg.Path, volume.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Set quota limit on %v of volume %v", msg.Path, volume.Info.Id)
+
+		// Done
+		return "/volumes/" + volume.Info.Id + "/quota", nil
+	})
+
+}
+
+func (a *App) VolumeQuotaRemoveLimit(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the directory from the query
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "Quota path missing", http.StatusBadRequest)
+		return
+	}
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if _, ok := volume.Quota.Limits[path]; !ok {
+			http.Error(w, "No quota limit on "+path, http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Remove the limit in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Removing quota limit on %v of volume %v",
+			path, volume.Info.Id)
+		err := volume.QuotaRemoveLimit(a.db, a.executor, path)
+		if err != nil {
+			logger.LogError("Failed to remove quota limit on %v of volume %v: %v",
+				path, volume.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Removed quota limit on %v of volume %v", path, volume.Info.Id)
+
+		// Done
+		return "", nil
+	})
+
+}
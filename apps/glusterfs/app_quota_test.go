@@ -0,0 +1,113 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestVolumeQuota(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil)
+
+	// Unknown volume
+	r, err := http.Get(ts.URL + "/volumes/123/quota")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Quota disabled by default
+	quota, err := c.VolumeQuota(volume.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, !quota.Enable)
+	tests.Assert(t, len(quota.Limits) == 0)
+
+	// Limits need quota enabled
+	limit := &api.QuotaLimit{Path: "/tenant1", Size: 10}
+	r, err = http.Post(ts.URL+"/volumes/"+volume.Id+"/quota/limits",
+		"application/json",
+		bytes.NewBuffer([]byte(`{"path" : "/tenant1", "size" : 10}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusConflict)
+
+	// Enable quota
+	quota, err = c.VolumeQuotaEnable(volume.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, quota.Enable)
+
+	// Bad limits
+	r, err = http.Post(ts.URL+"/volumes/"+volume.Id+"/quota/limits",
+		"application/json",
+		bytes.NewBuffer([]byte(`{"path" : "/tenant1", "size" : 0}`)))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+	_, err = c.VolumeQuotaSetLimit(volume.Id, &api.QuotaLimit{Path: "../x", Size: 1})
+	tests.Assert(t, err != nil)
+
+	// Set limit
+	quota, err = c.VolumeQuotaSetLimit(volume.Id, limit)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(quota.Limits, []api.QuotaLimit{*limit}))
+
+	// Remove unknown limit
+	err = c.VolumeQuotaRemoveLimit(volume.Id, "/tenant2")
+	tests.Assert(t, err != nil)
+
+	// Remove limit
+	err = c.VolumeQuotaRemoveLimit(volume.Id, "/tenant1")
+	tests.Assert(t, err == nil)
+
+	quota, err = c.VolumeQuota(volume.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, quota.Enable)
+	tests.Assert(t, len(quota.Limits) == 0)
+}
@@ -0,0 +1,352 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (a *App) SnapshotCreate(w http.ResponseWriter, r *http.Request) {
+
+	// Get the volume id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.SnapshotCreateRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	// Check the values can be passed to the gluster cli
+	if msg.Name != "" {
+		if err := ValidateSnapshotName(msg.Name); err != nil {
+			http.Error(w, "Invalid snapshot name", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := ValidateSnapshotDescription(msg.Description); err != nil {
+		http.Error(w, "Invalid snapshot description", http.StatusBadRequest)
+		return
+	}
+
+	// Create a snapshot entry
+	snapshot := NewSnapshotEntryFromRequest(id, &msg)
+
+	// Check the volume exists and the name is not in use
+	err = a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		err = checkVolumeOnline(w, volume, "snapshot")
+		if err != nil {
+			return err
+		}
+
+		snapshots, err := SnapshotList(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		for _, snapshotId := range snapshots {
+			entry, err := NewSnapshotEntryFromId(tx, snapshotId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return err
+			}
+			if entry.Info.Name == snapshot.Info.Name {
+				err := fmt.Errorf("Snapshot name %v already in use", snapshot.Info.Name)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Create snapshot in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Creating snapshot %v", snapshot.Info.Id)
+		err := snapshot.Create(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to create snapshot: %v", err)
+			return "", err
+		}
+
+		logger.Info("Created snapshot %v", snapshot.Info.Id)
+
+		// Done
+		return "/volumes/" + id + "/snapshots/" + snapshot.Info.Id, nil
+	})
+}
+
+func (a *App) SnapshotList(w http.ResponseWriter, r *http.Request) {
+
+	// Get the volume id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var list api.SnapshotListResponse
+
+	// Get all the snapshot ids of the volume from the DB
+	err := a.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		list.Snapshots = volume.Snapshots
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Send list back
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		panic(err)
+	}
+}
+
+// Returns the snapshot entry referenced in the URL.  On error, the
+// http response has already been written.
+func (a *App) snapshotFromRequest(w http.ResponseWriter,
+	r *http.Request,
+	tx *bolt.Tx) (*SnapshotEntry, error) {
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+	snapshotId := vars["snapshot"]
+
+	entry, err := NewSnapshotEntryFromId(tx, snapshotId)
+	if err == ErrNotFound {
+		http.Error(w, "Id not found", http.StatusNotFound)
+		return nil, err
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	// Check the snapshot belongs to the volume
+	if entry.Info.VolumeId != id {
+		http.Error(w, "Id not found", http.StatusNotFound)
+		return nil, ErrNotFound
+	}
+
+	return entry, nil
+}
+
+func (a *App) SnapshotInfo(w http.ResponseWriter, r *http.Request) {
+
+	// Get snapshot information
+	var info *api.SnapshotInfoResponse
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := a.snapshotFromRequest(w, r, tx)
+		if err != nil {
+			return err
+		}
+
+		info, err = entry.NewInfoResponse(tx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) SnapshotDelete(w http.ResponseWriter, r *http.Request) {
+
+	// Get snapshot entry
+	var snapshot *SnapshotEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		snapshot, err = a.snapshotFromRequest(w, r, tx)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		err := snapshot.Destroy(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to delete snapshot %v: %v", snapshot.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Deleted snapshot [%s]", snapshot.Info.Id)
+		return "", nil
+	})
+}
+
+func (a *App) SnapshotRestore(w http.ResponseWriter, r *http.Request) {
+
+	// Get snapshot entry
+	var snapshot *SnapshotEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		snapshot, err = a.snapshotFromRequest(w, r, tx)
+		if err != nil {
+			return err
+		}
+
+		volume, err := NewVolumeEntryFromId(tx, snapshot.Info.VolumeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		return checkVolumeOnline(w, volume, "restore a snapshot of")
+	})
+	if err != nil {
+		return
+	}
+
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Restoring snapshot %v", snapshot.Info.Id)
+		err := snapshot.Restore(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to restore snapshot %v: %v", snapshot.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Restored snapshot %v", snapshot.Info.Id)
+
+		// Done
+		return "/volumes/" + snapshot.Info.VolumeId, nil
+	})
+}
+
+func (a *App) SnapshotClone(w http.ResponseWriter, r *http.Request) {
+
+	var msg api.SnapshotCloneRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	// Check the name can be passed to the gluster cli
+	if msg.Name != "" {
+		if err := ValidateSnapshotName(msg.Name); err != nil {
+			http.Error(w, "Invalid volume name", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Get snapshot entry
+	var snapshot *SnapshotEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+		var err error
+		snapshot, err = a.snapshotFromRequest(w, r, tx)
+		if err != nil {
+			return err
+		}
+
+		volume, err := NewVolumeEntryFromId(tx, snapshot.Info.VolumeId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		err = checkVolumeOnline(w, volume, "clone a snapshot of")
+		if err != nil {
+			return err
+		}
+
+		// Check the name is not in use in the cluster of the volume
+		if msg.Name == "" {
+			return nil
+		}
+		cluster, err := NewClusterEntryFromId(tx, volume.Info.Cluster)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		for _, volumeId := range cluster.Info.Volumes {
+			entry, err := NewVolumeEntryFromId(tx, volumeId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return err
+			}
+			if entry.Info.Name == msg.Name {
+				err := fmt.Errorf("Name %v already in use in cluster %v",
+					msg.Name, cluster.Info.Id)
+				http.Error(w, err.Error(), http.StatusConflict)
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Cloning snapshot %v", snapshot.Info.Id)
+		clone, err := snapshot.Clone(a.db, a.executor, msg.Name)
+		if err != nil {
+			logger.LogError("Failed to clone snapshot %v: %v", snapshot.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Cloned snapshot %v to volume %v", snapshot.Info.Id, clone.Info.Id)
+
+		// Done
+		return "/volumes/" + clone.Info.Id, nil
+	})
+}
@@ -0,0 +1,342 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSnapshotCreateErrors(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	// Bad JSON
+	request := []byte(`{ asdfsdf }`)
+	r, err := http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == 422)
+
+	// Unknown volume
+	request = []byte(`{ "name" : "snap" }`)
+	r, err = http.Post(ts.URL+"/volumes/123/snapshots",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Bad name
+	request = []byte(`{ "name" : "my snap" }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Bad description
+	request = []byte(`{ "description" : "it's" }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Shell expansions are rejected
+	for _, request := range []string{
+		`{ "name" : "$(id)" }`,
+		`{ "name" : "snap;id" }`,
+		"{ \"name\" : \"`id`\" }",
+		`{ "description" : "$(id)" }`,
+		`{ "description" : "a\\\"; id; \\\"" }`,
+		"{ \"description\" : \"`id`\" }",
+	} {
+		r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots",
+			"application/json", bytes.NewBufferString(request))
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusBadRequest, request)
+	}
+
+	// Name already in use
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{
+		Name: "snap",
+	})
+	err = s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	request = []byte(`{ "name" : "snap" }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusConflict)
+}
+
+func TestSnapshotCreateListInfoDelete(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	// Create snapshot
+	request := []byte(`{
+		"name" : "mysnap",
+		"description" : "nightly"
+	}`)
+	r, err := http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.SnapshotInfoResponse
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+	tests.Assert(t, info.Id != "")
+	tests.Assert(t, info.Name == "mysnap")
+	tests.Assert(t, info.Description == "nightly")
+	tests.Assert(t, info.VolumeId == v.Info.Id)
+
+	// List
+	r, err = http.Get(ts.URL + "/volumes/" + v.Info.Id + "/snapshots")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusOK)
+	var list api.SnapshotListResponse
+	err = utils.GetJsonFromResponse(r, &list)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(list.Snapshots) == 1)
+	tests.Assert(t, list.Snapshots[0] == info.Id)
+
+	// Info through another volume id is not found
+	r, err = http.Get(ts.URL + "/volumes/123/snapshots/" + info.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Volume cannot be deleted while it has snapshots
+	req, err := http.NewRequest("DELETE", ts.URL+"/volumes/"+v.Info.Id, nil)
+	tests.Assert(t, err == nil)
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusConflict)
+
+	// Delete snapshot
+	req, err = http.NewRequest("DELETE",
+		ts.URL+"/volumes/"+v.Info.Id+"/snapshots/"+info.Id, nil)
+	tests.Assert(t, err == nil)
+	r, err = http.DefaultClient.Do(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err = r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		if r.Header.Get("X-Pending") == "true" {
+			tests.Assert(t, r.StatusCode == http.StatusOK)
+			time.Sleep(time.Millisecond * 10)
+		} else {
+			tests.Assert(t, r.StatusCode == http.StatusNoContent)
+			break
+		}
+	}
+
+	// Check it is gone
+	r, err = http.Get(ts.URL + "/volumes/" + v.Info.Id + "/snapshots/" + info.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(volume.Snapshots) == 0)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Restore
+	r, err := http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots/"+s.Info.Id+"/restore",
+		"application/json", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.VolumeInfoResponse
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+	tests.Assert(t, info.Id == v.Info.Id)
+
+	// Snapshot is consumed by the restore
+	r, err = http.Get(ts.URL + "/volumes/" + v.Info.Id + "/snapshots/" + s.Info.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+}
+
+func TestSnapshotClone(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Bad name
+	request := []byte(`{ "name" : "my clone" }`)
+	r, err := http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots/"+s.Info.Id+"/clone",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Shell expansions are rejected
+	for _, request := range []string{
+		`{ "name" : "$(id)" }`,
+		"{ \"name\" : \"`id`\" }",
+	} {
+		r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots/"+s.Info.Id+"/clone",
+			"application/json", bytes.NewBufferString(request))
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusBadRequest, request)
+	}
+
+	// Name already in use
+	request = []byte(`{ "name" : "` + v.Info.Name + `" }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots/"+s.Info.Id+"/clone",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusConflict)
+
+	// Clone
+	request = []byte(`{ "name" : "devcopy" }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/snapshots/"+s.Info.Id+"/clone",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.VolumeInfoResponse
+	for {
+		r, err = http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+	tests.Assert(t, info.Id != v.Info.Id)
+	tests.Assert(t, info.Name == "devcopy")
+	tests.Assert(t, len(info.Bricks) == len(v.Bricks))
+	for _, brick := range info.Bricks {
+		tests.Assert(t, brick.Path == "/mockclonepath")
+	}
+}
@@ -18,10 +18,18 @@ package glusterfs
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/boltdb/bolt"
+	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors/recordexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/tests"
 )
@@ -193,3 +201,91 @@ func TestAppReadOnlyDb(t *testing.T) {
 	tests.Assert(t, app != nil)
 	tests.Assert(t, app.dbReadOnly == true)
 }
+
+func TestAppReplayExecutor(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	replayfile := tests.Tempfile()
+	defer os.Remove(replayfile)
+
+	// Commands recorded while adding three nodes.  The probe of the
+	// second one fails so that both probes run on the first node.
+	err := ioutil.WriteFile(replayfile, []byte(
+		`{"host":"manage1","commands":["gluster peer probe storage2"],"output":null,"error":"peer probe: failed: storage2 is not reachable","duration_ms":3004}
+{"host":"manage1","commands":["gluster peer probe storage3"],"output":[""],"duration_ms":812}
+`), 0600)
+	tests.Assert(t, err == nil)
+
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "replay",
+			"allocator" : "simple",
+			"db" : "` + dbfile + `",
+			"recordexec" : {
+				"replay" : "` + replayfile + `"
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app != nil)
+	defer app.Close()
+
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	c := client.NewClientNoAuth(ts.URL)
+
+	cluster, err := c.ClusterCreate()
+	tests.Assert(t, err == nil)
+
+	for i := 1; i <= 3; i++ {
+		req := &api.NodeAddRequest{
+			Zone:      1,
+			ClusterId: cluster.Id,
+		}
+		req.Hostnames.Manage = []string{fmt.Sprintf("manage%v", i)}
+		req.Hostnames.Storage = []string{fmt.Sprintf("storage%v", i)}
+
+		_, err = c.NodeAdd(req)
+		if i != 2 {
+			tests.Assert(t, err == nil, err)
+		} else {
+			tests.Assert(t, err != nil)
+			tests.Assert(t, strings.Contains(err.Error(), "not reachable"), err)
+		}
+	}
+
+	replay := app.executor.(*recordexec.ReplayExecutor)
+	tests.Assert(t, len(replay.Replayer.Remaining()) == 0)
+}
+
+func TestAppRecordUnsupportedExecutor(t *testing.T) {
+	dbfile := tests.Tempfile()
+	defer os.Remove(dbfile)
+	recordfile := tests.Tempfile()
+	defer os.Remove(recordfile)
+
+	// The mock executor sends no commands to record
+	data := []byte(`{
+		"glusterfs" : {
+			"executor" : "mock",
+			"db" : "` + dbfile + `",
+			"recordexec" : {
+				"record" : "` + recordfile + `"
+			}
+		}
+	}`)
+	app := NewApp(bytes.NewReader(data))
+	tests.Assert(t, app == nil)
+
+	// The replay executor needs a file
+	data = []byte(`{
+		"glusterfs" : {
+			"executor" : "replay",
+			"db" : "` + dbfile + `"
+		}
+	}`)
+	app = NewApp(bytes.NewReader(data))
+	tests.Assert(t, app == nil)
+}
@@ -45,6 +45,7 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 	switch msg.Durability.Type {
 	case api.DurabilityEC:
 	case api.DurabilityReplicate:
+	case api.DurabilityArbiter:
 	case api.DurabilityDistributeOnly:
 	case "":
 		msg.Durability.Type = api.DurabilityDistributeOnly
@@ -89,6 +90,13 @@ func (a *App) VolumeCreate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Check volume options
+	err = ValidateVolumeOptions(msg.Options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Check that the clusters requested are available
 	err = a.db.View(func(tx *bolt.Tx) error {
 
@@ -177,7 +185,10 @@ func (a *App) VolumeInfo(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	// Get device information
-	var info *api.VolumeInfoResponse
+	var (
+		volume *VolumeEntry
+		info   *api.VolumeInfoResponse
+	)
 	err := a.db.View(func(tx *bolt.Tx) error {
 		entry, err := NewVolumeEntryFromId(tx, id)
 		if err == ErrNotFound {
@@ -188,6 +199,7 @@ func (a *App) VolumeInfo(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		volume = entry
 		info, err = entry.NewInfoResponse(tx)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -200,6 +212,17 @@ func (a *App) VolumeInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Add the state of the volume on the nodes if requested
+	if r.URL.Query().Get("live") == "true" {
+		info.Live, err = volume.NewLiveInfo(a.db, a.executor)
+		if err != nil {
+			logger.LogError("Failed to get live information of volume %v: %v",
+				volume.Info.Id, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Write msg
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
@@ -229,12 +252,34 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
+		if volume.Info.State != api.VolumeStateOnline &&
+			volume.Info.State != api.VolumeStateFailed {
+			err := fmt.Errorf("Cannot delete volume %v while it is %v",
+				volume.Info.Id, volume.Info.State)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
 		if volume.Info.Name == db.HeketiStorageVolumeName {
 			err := fmt.Errorf("Cannot delete volume containing the Heketi database")
 			http.Error(w, err.Error(), http.StatusConflict)
 			return err
 		}
 
+		if len(volume.Snapshots) > 0 {
+			err := fmt.Errorf("Cannot delete volume %v because it contains %v snapshots",
+				volume.Info.Id, len(volume.Snapshots))
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
+		if len(volume.GeoReplications) > 0 {
+			err := fmt.Errorf("Cannot delete volume %v because it has %v geo-replication sessions",
+				volume.Info.Id, len(volume.GeoReplications))
+			http.Error(w, err.Error(), http.StatusConflict)
+			return err
+		}
+
 		return nil
 
 	})
@@ -244,12 +289,10 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 
 	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
 
-		// Actually destroy the Volume here
+		// Actually destroy the Volume here.  If it fails after
+		// GlusterFS deleted the volume, the entry is marked failed
 		err := volume.Destroy(a.db, a.executor)
 
-		// If it fails for some reason, we will need to add to the DB again
-		// or hold state on the entry "DELETING"
-
 		// Show that the key has been deleted
 		if err != nil {
 			logger.LogError("Failed to delete volume %v: %v", volume.Info.Id, err)
@@ -263,6 +306,21 @@ func (a *App) VolumeDelete(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Writes a conflict response when another operation is using the
+// volume, or when it failed
+func checkVolumeOnline(w http.ResponseWriter,
+	volume *VolumeEntry,
+	action string) error {
+
+	if volume.Info.State != api.VolumeStateOnline {
+		err := fmt.Errorf("Cannot %v volume %v while it is %v",
+			action, volume.Info.Id, volume.Info.State)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return err
+	}
+	return nil
+}
+
 func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("In VolumeExpand")
 
@@ -300,7 +358,7 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 
-		return nil
+		return checkVolumeOnline(w, volume, "expand")
 
 	})
 	if err != nil {
@@ -324,3 +382,273 @@ func (a *App) VolumeExpand(w http.ResponseWriter, r *http.Request) {
 	})
 
 }
+
+func (a *App) VolumeShrink(w http.ResponseWriter, r *http.Request) {
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.VolumeShrinkRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	// Check the message
+	if msg.Size < 1 {
+		http.Error(w, "Invalid volume size", http.StatusBadRequest)
+		return
+	}
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		if msg.Size >= volume.Info.Size {
+			http.Error(w, "Volume is not larger than the requested size",
+				http.StatusBadRequest)
+			return ErrNoSpace
+		}
+
+		return checkVolumeOnline(w, volume, "shrink")
+
+	})
+	if err != nil {
+		return
+	}
+
+	// Shrink volume in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Shrinking volume %v", volume.Info.Id)
+		err := volume.Shrink(a.db, a.executor, msg.Size)
+		if err != nil {
+			logger.LogError("Failed to shrink volume %v: %v", volume.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Shrunk volume %v", volume.Info.Id)
+
+		// Done
+		return "/volumes/" + volume.Info.Id, nil
+	})
+
+}
+
+func (a *App) VolumeReplaceBrick(w http.ResponseWriter, r *http.Request) {
+	// Get the ids from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+	brickId := vars["brick"]
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		err = checkVolumeOnline(w, volume, "replace a brick of")
+		if err != nil {
+			return err
+		}
+
+		if !utils.SortedStringHas(volume.Bricks, brickId) {
+			http.Error(w, "Brick id not found in volume", http.StatusNotFound)
+			return ErrNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Replace brick in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Replacing brick %v of volume %v", brickId, volume.Info.Id)
+		err := volume.ReplaceBrick(a.db, a.executor, a.allocator, brickId)
+		if err != nil {
+			logger.LogError("Failed to replace brick %v of volume %v: %v",
+				brickId, volume.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Replaced brick %v of volume %v", brickId, volume.Info.Id)
+
+		// Done
+		return "/volumes/" + volume.Info.Id, nil
+	})
+
+}
+
+func (a *App) VolumeOptions(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get volume options
+	info := &api.VolumeOptionsResponse{
+		Options: make(map[string]string),
+	}
+	err := a.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, "Id not found", http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		for key, value := range entry.Info.Options {
+			info.Options[key] = value
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+
+}
+
+func (a *App) VolumeSetOptions(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var msg api.VolumeOptionsRequest
+	err := utils.GetJsonFromRequest(r, &msg)
+	if err != nil {
+		http.Error(w, "request unable to be parsed", 422)
+		return
+	}
+
+	// Check the message
+	if len(msg.Options) == 0 {
+		http.Error(w, "No volume options", http.StatusBadRequest)
+		return
+	}
+	err = ValidateVolumeOptions(msg.Options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err = a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return checkVolumeOnline(w, volume, "set options of")
+	})
+	if err != nil {
+		return
+	}
+
+	// Set options in an asynchronous function
+	a.asyncManager.AsyncHttpRedirectFunc(w, r, func() (string, error) {
+
+		logger.Info("Setting options of volume %v", volume.Info.Id)
+		err := volume.SetOptions(a.db, a.executor, msg.Options)
+		if err != nil {
+			logger.LogError("Failed to set options of volume %v: %v",
+				volume.Info.Id, err)
+			return "", err
+		}
+
+		logger.Info("Set options of volume %v", volume.Info.Id)
+
+		// Done
+		return "/volumes/" + volume.Info.Id + "/options", nil
+	})
+
+}
+
+func (a *App) VolumeHealInfo(w http.ResponseWriter, r *http.Request) {
+
+	// Get the id from the URL
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get volume entry
+	var volume *VolumeEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+
+		// Access volume entry
+		var err error
+		volume, err = NewVolumeEntryFromId(tx, id)
+		if err == ErrNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return err
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	// Get the heal state from GlusterFS
+	info, err := volume.HealInfo(a.db, a.executor)
+	if err == ErrNoHeal {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logger.LogError("Failed to get heal information of volume %v: %v",
+			volume.Info.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write msg
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		panic(err)
+	}
+}
@@ -30,6 +30,8 @@ import (
 
 	"github.com/boltdb/bolt"
 	"github.com/gorilla/mux"
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/db"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
@@ -964,3 +966,526 @@ func TestVolumeExpand(t *testing.T) {
 	tests.Assert(t, info.Size == 100+1000)
 	tests.Assert(t, len(vc.Bricks) < len(info.Bricks))
 }
+
+func TestVolumeReplaceBrick(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	mockVolumeInfoFromDb(t, app)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		10,   // nodes_per_cluster
+		10,   // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume
+	v := createSampleVolumeEntry(100)
+	tests.Assert(t, v != nil)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	oldBrickId := v.Bricks[0]
+
+	// Unknown volume
+	r, err := http.Post(ts.URL+"/volumes/123/bricks/"+oldBrickId+"/replace",
+		"application/json", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Brick not in the volume
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/bricks/123/replace",
+		"application/json", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Replace brick
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/bricks/"+oldBrickId+"/replace",
+		"application/json", nil)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.VolumeInfoResponse
+	for {
+		r, err := http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+
+	tests.Assert(t, len(info.Bricks) == len(v.Bricks))
+	for _, brick := range info.Bricks {
+		tests.Assert(t, brick.Id != oldBrickId)
+	}
+}
+
+func TestVolumeShrink(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+	mockVolumeInfoInCreateOrder(t, app)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create a volume with two more brick sets
+	v := createSampleVolumeEntry(100)
+	tests.Assert(t, v != nil)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	err = v.Expand(app.db, app.executor, app.allocator, 100)
+	tests.Assert(t, err == nil)
+
+	// Bad JSON
+	request := []byte(`{ asdfsdf }`)
+	r, err := http.Post(ts.URL+"/volumes/"+v.Info.Id+"/shrink",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == 422)
+
+	// Bad size
+	request = []byte(`{ "shrink_size" : 0 }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/shrink",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Unknown volume
+	request = []byte(`{ "shrink_size" : 100 }`)
+	r, err = http.Post(ts.URL+"/volumes/123/shrink",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Size of the whole volume
+	request = []byte(`{ "shrink_size" : 200 }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/shrink",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Shrink
+	request = []byte(`{ "shrink_size" : 100 }`)
+	r, err = http.Post(ts.URL+"/volumes/"+v.Info.Id+"/shrink",
+		"application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusAccepted)
+	location, err := r.Location()
+	tests.Assert(t, err == nil)
+
+	// Query queue until finished
+	var info api.VolumeInfoResponse
+	for {
+		r, err := http.Get(location.String())
+		tests.Assert(t, err == nil)
+		tests.Assert(t, r.StatusCode == http.StatusOK)
+		if r.Header.Get("X-Pending") == "true" {
+			time.Sleep(time.Millisecond * 10)
+			continue
+		} else {
+			err = utils.GetJsonFromResponse(r, &info)
+			tests.Assert(t, err == nil)
+			break
+		}
+	}
+
+	tests.Assert(t, info.Size == 100)
+	tests.Assert(t, len(info.Bricks) == 4)
+}
+
+func TestVolumeOptions(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Unknown option on create
+	request := []byte(`{
+		"size" : 100,
+		"options" : { "performance.unknown" : "on" }
+	}`)
+	r, err := http.Post(ts.URL+"/volumes", "application/json", bytes.NewBuffer(request))
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+
+	// Create a volume with options
+	var created map[string]string
+	app.xo.MockVolumeCreate = func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		created = volume.Options
+		return &executors.VolumeInfo{}, nil
+	}
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Options = map[string]string{
+		"performance.cache-size": "1GB",
+	}
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(created, req.Options))
+	tests.Assert(t, reflect.DeepEqual(volume.Options, req.Options))
+
+	// Get options
+	info, err := c.VolumeOptions(volume.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(info.Options, req.Options))
+
+	r, err = http.Get(ts.URL + "/volumes/123/options")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Bad options
+	_, err = c.VolumeSetOptions(volume.Id, &api.VolumeOptionsRequest{})
+	tests.Assert(t, err != nil)
+	_, err = c.VolumeSetOptions(volume.Id, &api.VolumeOptionsRequest{
+		Options: map[string]string{"network.ping-timeout": "-1"},
+	})
+	tests.Assert(t, err != nil)
+
+	// Set options
+	info, err = c.VolumeSetOptions(volume.Id, &api.VolumeOptionsRequest{
+		Options: map[string]string{"network.ping-timeout": "10"},
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(info.Options, map[string]string{
+		"performance.cache-size": "1GB",
+		"network.ping-timeout":   "10",
+	}))
+}
+
+func TestVolumeHealInfo(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Bricks need distinct paths to be told apart
+	app.xo.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		return &executors.BrickInfo{
+			Path: "/mockpath/" + brick.Name,
+		}, nil
+	}
+
+	// Create a volume
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityReplicate
+	req.Durability.Replicate.Replica = 3
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil)
+
+	// Unknown volume
+	r, err := http.Get(ts.URL + "/volumes/123/heal")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusNotFound)
+
+	// Bricks as reported by GlusterFS
+	healBricks := make([]executors.BrickHealInfo, 0)
+	for _, brick := range volume.Bricks {
+		node, err := c.NodeInfo(brick.NodeId)
+		tests.Assert(t, err == nil)
+		healBricks = append(healBricks, executors.BrickHealInfo{
+			Host:      node.Hostnames.Storage[0],
+			Path:      brick.Path,
+			Connected: true,
+		})
+	}
+	app.xo.MockVolumeHealInfo = func(host string, volume string) (*executors.VolumeHealInfo, error) {
+		return &executors.VolumeHealInfo{Bricks: healBricks}, nil
+	}
+
+	// Healed volume
+	heal, err := c.VolumeHealInfo(volume.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, heal.VolumeId == volume.Id)
+	tests.Assert(t, heal.Healed)
+	tests.Assert(t, len(heal.Bricks) == len(volume.Bricks))
+	for i, brick := range heal.Bricks {
+		tests.Assert(t, brick.Id == volume.Bricks[i].Id)
+		tests.Assert(t, brick.NodeId == volume.Bricks[i].NodeId)
+		tests.Assert(t, brick.Path == volume.Bricks[i].Path)
+		tests.Assert(t, brick.Connected)
+		tests.Assert(t, brick.SplitBrainEntries != nil)
+	}
+
+	// Entries pending heal and in split-brain
+	healBricks[0].PendingEntries = 2
+	healBricks[0].SplitBrainEntries = []string{"/dir/file"}
+	heal, err = c.VolumeHealInfo(volume.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, !heal.Healed)
+	tests.Assert(t, heal.Bricks[0].PendingEntries == 2)
+	tests.Assert(t, reflect.DeepEqual(heal.Bricks[0].SplitBrainEntries, []string{"/dir/file"}))
+
+	// Brick down
+	healBricks[0].PendingEntries = 0
+	healBricks[0].SplitBrainEntries = nil
+	healBricks[1].Connected = false
+	heal, err = c.VolumeHealInfo(volume.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, !heal.Healed)
+	tests.Assert(t, !heal.Bricks[1].Connected)
+
+	// Failure from GlusterFS
+	app.xo.MockVolumeHealInfo = func(host string, volume string) (*executors.VolumeHealInfo, error) {
+		return nil, ErrDbAccess
+	}
+	_, err = c.VolumeHealInfo(volume.Id)
+	tests.Assert(t, err != nil)
+
+	// Distributed only volumes have nothing to heal
+	req = &api.VolumeCreateRequest{}
+	req.Size = 100
+	req.Durability.Type = api.DurabilityDistributeOnly
+	volume, err = c.VolumeCreate(req)
+	tests.Assert(t, err == nil)
+	r, err = http.Get(ts.URL + "/volumes/" + volume.Id + "/heal")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, r.StatusCode == http.StatusBadRequest)
+}
+
+func TestVolumeInfoLive(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Setup database
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Bricks need distinct paths to be told apart
+	app.xo.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		return &executors.BrickInfo{
+			Path: "/mockpath/" + brick.Name,
+		}, nil
+	}
+
+	// Create a volume
+	c := client.NewClientNoAuth(ts.URL)
+	req := &api.VolumeCreateRequest{}
+	req.Size = 100
+	volume, err := c.VolumeCreate(req)
+	tests.Assert(t, err == nil)
+
+	// Volume as reported by GlusterFS, with the first brick offline
+	// and a brick unknown to Heketi
+	volInfo := &executors.VolumeInfo{
+		Name:        volume.Name,
+		Type:        "Distributed-Replicate",
+		Status:      "Started",
+		BrickStatus: make(map[executors.BrickInfo]executors.BrickStatus),
+		Options:     map[string]string{"performance.readdir-ahead": "on"},
+	}
+	for i, brick := range volume.Bricks {
+		node, err := c.NodeInfo(brick.NodeId)
+		tests.Assert(t, err == nil)
+		b := executors.BrickInfo{
+			Host: node.Hostnames.Storage[0],
+			Path: brick.Path,
+		}
+		volInfo.Bricks = append(volInfo.Bricks, b)
+		if i != 0 {
+			volInfo.BrickStatus[b] = executors.BrickStatus{
+				Online: true,
+				Port:   49152 + i,
+			}
+		}
+	}
+	volInfo.Bricks = append(volInfo.Bricks, executors.BrickInfo{
+		Host: "unknown",
+		Path: "/unknown/brick",
+	})
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		return volInfo, nil
+	}
+
+	// Only the db record by default
+	info, err := c.VolumeInfo(volume.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.Live == nil)
+
+	// Live information
+	info, err = c.VolumeLiveInfo(volume.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Id == volume.Id)
+	tests.Assert(t, info.Live != nil)
+	tests.Assert(t, info.Live.Type == "Distributed-Replicate")
+	tests.Assert(t, info.Live.Status == "Started")
+	tests.Assert(t, info.Live.Options["performance.readdir-ahead"] == "on")
+	tests.Assert(t, len(info.Live.Bricks) == len(volume.Bricks)+1)
+	for i, brick := range volume.Bricks {
+		tests.Assert(t, info.Live.Bricks[i].Id == brick.Id)
+		tests.Assert(t, info.Live.Bricks[i].Path == brick.Path)
+		tests.Assert(t, info.Live.Bricks[i].Online == (i != 0))
+		if i != 0 {
+			tests.Assert(t, info.Live.Bricks[i].Port == 49152+i)
+		}
+	}
+	unknown := info.Live.Bricks[len(volume.Bricks)]
+	tests.Assert(t, unknown.Id == "")
+	tests.Assert(t, unknown.Host == "unknown")
+	tests.Assert(t, !unknown.Online)
+
+	// Failure from GlusterFS
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		return nil, ErrDbAccess
+	}
+	_, err = c.VolumeLiveInfo(volume.Id)
+	tests.Assert(t, err != nil)
+	_, err = c.VolumeInfo(volume.Id)
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeBusy(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	router := mux.NewRouter()
+	app.SetRoutes(router)
+
+	// Setup the server
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Volume still being created
+	v := createSampleVolumeEntry(100)
+	v.Info.State = api.VolumeStateCreating
+	snapshot := NewSnapshotEntryFromRequest(v.Info.Id,
+		&api.SnapshotCreateRequest{Name: "snap"})
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		err := snapshot.Save(tx)
+		if err != nil {
+			return err
+		}
+		return v.Save(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	c := client.NewClientNoAuth(ts.URL)
+	info, err := c.VolumeInfo(v.Info.Id)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.State == api.VolumeStateCreating)
+
+	_, err = c.VolumeExpand(v.Info.Id, &api.VolumeExpandRequest{Size: 10})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	err = c.VolumeDelete(v.Info.Id)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	// No other operation may change the volume
+	_, err = c.VolumeShrink(v.Info.Id, &api.VolumeShrinkRequest{Size: 10})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	_, err = c.VolumeReplaceBrick(v.Info.Id, utils.GenUUID())
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	_, err = c.VolumeSetOptions(v.Info.Id, &api.VolumeOptionsRequest{
+		Options: map[string]string{"network.ping-timeout": "10"},
+	})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	_, err = c.SnapshotCreate(v.Info.Id, &api.SnapshotCreateRequest{Name: "other"})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	_, err = c.SnapshotRestore(v.Info.Id, snapshot.Info.Id)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+
+	_, err = c.SnapshotClone(v.Info.Id, snapshot.Info.Id, &api.SnapshotCloneRequest{})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "while it is creating"), err)
+}
@@ -17,6 +17,8 @@
 package glusterfs
 
 import (
+	"fmt"
+
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/utils"
@@ -29,6 +31,18 @@ const (
 	CREATOR_DESTROY
 )
 
+// Returned when bricks which failed to be created could not be
+// destroyed again, so some of them may be left on their nodes
+type BrickCleanupError struct {
+	CreateErr  error
+	DestroyErr error
+}
+
+func (e *BrickCleanupError) Error() string {
+	return fmt.Sprintf("%v, and the bricks could not be destroyed: %v",
+		e.CreateErr, e.DestroyErr)
+}
+
 func createDestroyConcurrently(db *bolt.DB,
 	executor executors.Executor,
 	brick_entries []*BrickEntry,
@@ -57,7 +71,10 @@ func createDestroyConcurrently(db *bolt.DB,
 
 		// Destroy all bricks and cleanup
 		if create_type == CREATOR_CREATE {
-			createDestroyConcurrently(db, executor, brick_entries, CREATOR_DESTROY)
+			derr := createDestroyConcurrently(db, executor, brick_entries, CREATOR_DESTROY)
+			if derr != nil {
+				return &BrickCleanupError{CreateErr: err, DestroyErr: derr}
+			}
 		}
 	}
 	return err
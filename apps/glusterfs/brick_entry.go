@@ -19,6 +19,9 @@ package glusterfs
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
+	"sort"
+
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
@@ -30,6 +33,14 @@ type BrickEntry struct {
 	Info             api.BrickInfo
 	TpSize           uint64
 	PoolMetadataSize uint64
+
+	// Id of the brick owning the thin pool used by this brick.
+	// Only set on bricks of cloned volumes.
+	PoolId string
+
+	// Ids of the bricks of cloned volumes using the thin pool
+	// of this brick
+	Clones sort.StringSlice
 }
 
 func BrickList(tx *bolt.Tx) ([]string, error) {
@@ -64,6 +75,21 @@ func NewBrickEntry(size, tpsize, poolMetadataSize uint64, deviceid, nodeid strin
 	return entry
 }
 
+// Returns a new brick entry for the clone of this brick found at path.
+// The clone lives in the same thin pool, so no storage is allocated
+// from the device.
+func (b *BrickEntry) NewCloneBrickEntry(path string) *BrickEntry {
+	godbc.Require(path != "")
+
+	entry := NewBrickEntry(b.Info.Size, b.TpSize, 0, b.Info.DeviceId, b.Info.NodeId)
+	entry.Info.Path = path
+	entry.PoolId = b.PoolOwner()
+
+	godbc.Ensure(entry.TotalSize() == 0)
+
+	return entry
+}
+
 func NewBrickEntryFromId(tx *bolt.Tx, id string) (*BrickEntry, error) {
 	godbc.Require(tx != nil)
 
@@ -194,6 +220,8 @@ func (b *BrickEntry) Destroy(db *bolt.DB, executor executors.Executor) error {
 	req.Size = b.Info.Size
 	req.TpSize = b.TpSize
 	req.VgId = b.Info.DeviceId
+	req.PoolId = b.PoolId
+	req.Path = b.Info.Path
 
 	// Delete brick on node
 	logger.Info("Deleting brick %v", b.Info.Id)
@@ -220,6 +248,19 @@ func (b *BrickEntry) DestroyCheck(db *bolt.DB, executor executors.Executor) erro
 
 		host = node.ManageHostName()
 		godbc.Check(host != "")
+
+		// The thin pool cannot be removed while clones use it
+		if b.PoolId == "" {
+			clones, err := b.poolClones(tx)
+			if err != nil {
+				return err
+			}
+			if clones > 0 {
+				return fmt.Errorf("Cannot delete brick %v because its thin pool "+
+					"is used by %v brick(s) of cloned volumes", b.Info.Id, clones)
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -232,12 +273,67 @@ func (b *BrickEntry) DestroyCheck(db *bolt.DB, executor executors.Executor) erro
 	req.Size = b.Info.Size
 	req.TpSize = b.TpSize
 	req.VgId = b.Info.DeviceId
+	req.PoolId = b.PoolId
+	req.Path = b.Info.Path
 
 	// Check brick on node
 	return executor.BrickDestroyCheck(host, req)
 }
 
-// Size consumed on device
+// Size consumed on device.  Bricks sharing the thin pool
+// of another brick do not consume any.
 func (b *BrickEntry) TotalSize() uint64 {
+	if b.PoolId != "" {
+		return 0
+	}
 	return b.TpSize + b.PoolMetadataSize
 }
+
+// Id of the brick owning the thin pool used by this brick
+func (b *BrickEntry) PoolOwner() string {
+	if b.PoolId != "" {
+		return b.PoolId
+	}
+	return b.Info.Id
+}
+
+// Number of bricks using the thin pool of this brick
+func (b *BrickEntry) poolClones(tx *bolt.Tx) (int, error) {
+	entry, err := NewBrickEntryFromId(tx, b.Info.Id)
+	if err == ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return len(entry.Clones), nil
+}
+
+// Adds the brick of a cloned volume to the clones of the brick
+// owning its thin pool
+func (b *BrickEntry) poolCloneAdd(tx *bolt.Tx) error {
+	godbc.Require(b.PoolId != "")
+
+	owner, err := NewBrickEntryFromId(tx, b.PoolId)
+	if err != nil {
+		return err
+	}
+	owner.Clones = append(owner.Clones, b.Info.Id)
+	owner.Clones.Sort()
+	return owner.Save(tx)
+}
+
+// Removes the brick of a cloned volume from the clones of the brick
+// owning its thin pool
+func (b *BrickEntry) poolCloneDelete(tx *bolt.Tx) error {
+	godbc.Require(b.PoolId != "")
+
+	owner, err := NewBrickEntryFromId(tx, b.PoolId)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	owner.Clones = utils.SortedStringsDelete(owner.Clones, b.Info.Id)
+	return owner.Save(tx)
+}
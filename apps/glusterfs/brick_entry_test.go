@@ -223,3 +223,82 @@ func TestBrickEntryDestroyCheck(t *testing.T) {
 	err = b.DestroyCheck(app.db, app.executor)
 	tests.Assert(t, err == nil, err)
 }
+
+func TestBrickEntryCloneDestroyCheck(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Create a brick and its clone
+	b := NewBrickEntry(10, 20, 5, "abc", "node")
+	b.Info.Path = "/brick"
+	c := b.NewCloneBrickEntry("/clone")
+	tests.Assert(t, c.Info.Id != b.Info.Id)
+	tests.Assert(t, c.PoolId == b.Info.Id)
+	tests.Assert(t, c.PoolOwner() == b.Info.Id)
+	tests.Assert(t, c.Info.Path == "/clone")
+	tests.Assert(t, c.Info.Size == b.Info.Size)
+	tests.Assert(t, c.TotalSize() == 0)
+	tests.Assert(t, b.TotalSize() == 25)
+
+	// A clone of the clone uses the same thin pool
+	cc := c.NewCloneBrickEntry("/clone2")
+	tests.Assert(t, cc.PoolId == b.Info.Id)
+
+	n := NewNodeEntry()
+	n.Info.Id = "node"
+	n.Info.Hostnames.Manage = []string{"manage"}
+	n.Info.Hostnames.Storage = []string{"storage"}
+
+	// Save element in database
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		err := n.Save(tx)
+		tests.Assert(t, err == nil)
+		err = b.Save(tx)
+		tests.Assert(t, err == nil)
+		err = c.Save(tx)
+		tests.Assert(t, err == nil)
+		return c.poolCloneAdd(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	// The clone is recorded on the brick owning the thin pool
+	err = app.db.View(func(tx *bolt.Tx) error {
+		owner, err := NewBrickEntryFromId(tx, b.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(owner.Clones) == 1 && owner.Clones[0] == c.Info.Id,
+			owner.Clones)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// The brick owning the thin pool cannot be destroyed
+	err = b.DestroyCheck(app.db, app.executor)
+	tests.Assert(t, err != nil)
+
+	// The clone can
+	app.xo.MockBrickDestroyCheck = func(host string, brick *executors.BrickRequest) error {
+		tests.Assert(t, brick.PoolId == b.Info.Id)
+		tests.Assert(t, brick.Path == "/clone")
+		return nil
+	}
+	err = c.DestroyCheck(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+
+	// Once the clone is gone the brick can be destroyed
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		err := c.Delete(tx)
+		tests.Assert(t, err == nil)
+		return c.poolCloneDelete(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	app.xo.MockBrickDestroyCheck = func(host string, brick *executors.BrickRequest) error {
+		return nil
+	}
+	err = b.DestroyCheck(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+}
@@ -0,0 +1,273 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+const (
+	BRICK_GC_DEFAULT_GRACE_PERIOD = 60 * time.Minute
+)
+
+// Removes the thin pools, LVs, fstab lines and mount points of bricks
+// which are not in the db, like the ones left behind when Heketi stops
+// in the middle of creating or deleting a volume.  A brick is only
+// removed once it has been found without a db entry for the whole
+// grace period, so bricks of operations in progress are left alone.
+type BrickGc struct {
+	db       *bolt.DB
+	executor executors.Executor
+	grace    time.Duration
+	dryRun   bool
+	audit    *log.Logger
+
+	// When each orphan brick was first found, by host and brick id
+	found map[brickGcKey]time.Time
+
+	lock sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+
+	// For testing
+	now func() time.Time
+}
+
+type brickGcKey struct {
+	host    string
+	brickId string
+}
+
+// Orphan brick found on a node
+type brickGcOrphan struct {
+	brickGcKey
+	vgId string
+}
+
+// Audit lines are written to auditLog, each action with its own line
+func NewBrickGc(db *bolt.DB,
+	executor executors.Executor,
+	grace time.Duration,
+	dryRun bool,
+	auditLog io.Writer) *BrickGc {
+
+	godbc.Require(db != nil)
+	godbc.Require(auditLog != nil)
+
+	return &BrickGc{
+		db:       db,
+		executor: executor,
+		grace:    grace,
+		dryRun:   dryRun,
+		audit:    log.New(auditLog, "[heketi] GC ", log.LstdFlags),
+		found:    make(map[brickGcKey]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Returns the management hostname and the device ids of each node,
+// and the ids of all bricks and of the bricks owning thin pools
+// used by cloned bricks
+func (g *BrickGc) readDb() (map[string]map[string]bool, map[string]bool, error) {
+	nodes := make(map[string]map[string]bool)
+	bricks := make(map[string]bool)
+
+	err := g.db.View(func(tx *bolt.Tx) error {
+		nodeIds, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, nodeId := range nodeIds {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return err
+			}
+			devices := make(map[string]bool)
+			for _, deviceId := range node.Devices {
+				devices[deviceId] = true
+			}
+			nodes[node.ManageHostName()] = devices
+		}
+
+		brickIds, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		for _, brickId := range brickIds {
+			brick, err := NewBrickEntryFromId(tx, brickId)
+			if err != nil {
+				return err
+			}
+			bricks[brickId] = true
+			if brick.PoolId != "" {
+				bricks[brick.PoolId] = true
+			}
+		}
+
+		// Bricks of operations in progress are not saved yet
+		opIds, err := PendingOperationList(tx)
+		if err != nil {
+			return err
+		}
+		for _, opId := range opIds {
+			op, err := NewPendingOperationEntryFromId(tx, opId)
+			if err != nil {
+				return err
+			}
+			for _, brick := range op.Bricks {
+				bricks[brick.Info.Id] = true
+			}
+		}
+
+		return nil
+	})
+
+	return nodes, bricks, err
+}
+
+// Returns the bricks unknown to the db in the volume groups of the
+// devices of each node
+func (g *BrickGc) findOrphans(nodes map[string]map[string]bool,
+	bricks map[string]bool) []brickGcOrphan {
+
+	hosts := make([]string, 0, len(nodes))
+	for host := range nodes {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	orphans := make([]brickGcOrphan, 0)
+	for _, host := range hosts {
+		storage, err := g.executor.NodeStorage(host)
+		if err != nil {
+			logger.LogError("GC unable to get storage of node %v: %v", host, err)
+			continue
+		}
+
+		brickIds := make([]string, 0, len(storage.Bricks))
+		for brickId, b := range storage.Bricks {
+			if !bricks[brickId] && nodes[host][b.VgId] {
+				brickIds = append(brickIds, brickId)
+			}
+		}
+		sort.Strings(brickIds)
+
+		for _, brickId := range brickIds {
+			orphans = append(orphans, brickGcOrphan{
+				brickGcKey: brickGcKey{host: host, brickId: brickId},
+				vgId:       storage.Bricks[brickId].VgId,
+			})
+		}
+	}
+
+	return orphans
+}
+
+// Runs a single collection.  Bricks found without a db entry for the
+// grace period are removed, or only reported in dry-run mode.
+func (g *BrickGc) Run() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	nodes, bricks, err := g.readDb()
+	if err != nil {
+		return err
+	}
+
+	now := g.now()
+	found := make(map[brickGcKey]time.Time)
+	for _, orphan := range g.findOrphans(nodes, bricks) {
+		first, ok := g.found[orphan.brickGcKey]
+		if !ok {
+			first = now
+			g.audit.Printf("Found brick %v in vg_%v on %v unknown to the db",
+				orphan.brickId, orphan.vgId, orphan.host)
+		}
+
+		if now.Sub(first) < g.grace {
+			found[orphan.brickGcKey] = first
+			continue
+		}
+
+		if g.dryRun {
+			g.audit.Printf("Dry-run: would remove brick %v in vg_%v on %v",
+				orphan.brickId, orphan.vgId, orphan.host)
+			found[orphan.brickGcKey] = first
+			continue
+		}
+
+		err := g.executor.BrickDestroy(orphan.host, &executors.BrickRequest{
+			VgId: orphan.vgId,
+			Name: orphan.brickId,
+		})
+		if err != nil {
+			g.audit.Printf("Failed to remove brick %v in vg_%v on %v: %v",
+				orphan.brickId, orphan.vgId, orphan.host, err)
+			found[orphan.brickGcKey] = first
+			continue
+		}
+		g.audit.Printf("Removed brick %v in vg_%v on %v",
+			orphan.brickId, orphan.vgId, orphan.host)
+	}
+
+	// Forget bricks which were removed or are now in the db
+	g.found = found
+
+	return nil
+}
+
+// Runs a collection every interval until Stop is called
+func (g *BrickGc) Start(interval time.Duration) {
+	godbc.Require(interval > 0)
+	godbc.Require(g.stop == nil)
+
+	g.stop = make(chan struct{})
+	g.done = make(chan struct{})
+	go func() {
+		defer close(g.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+				if err := g.Run(); err != nil {
+					logger.LogError("GC failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (g *BrickGc) Stop() {
+	if g.stop == nil {
+		return
+	}
+	close(g.stop)
+	<-g.done
+	g.stop = nil
+}
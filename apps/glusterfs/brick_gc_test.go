@@ -0,0 +1,327 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/tests"
+)
+
+func TestBrickGc(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Add orphan bricks to the storage of the node of the first brick
+	storage, _ := mockConsistentStorage(t, app)
+	var (
+		brick *BrickEntry
+		node  *NodeEntry
+	)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		brick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, brick.Info.NodeId)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	host := node.ManageHostName()
+	storage[host].Bricks["orphan"] = &executors.BrickStorage{
+		VgId:   brick.Info.DeviceId,
+		TpSize: 1024,
+		Size:   1024,
+	}
+	storage[host].Bricks["unmanaged"] = &executors.BrickStorage{
+		VgId: "unknowndevice",
+		Size: 1024,
+	}
+
+	var destroyed []*executors.BrickRequest
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed = append(destroyed, brick)
+		return nil
+	}
+
+	var audit bytes.Buffer
+	now := time.Now()
+	gc := NewBrickGc(app.db, app.executor, time.Hour, true, &audit)
+	gc.now = func() time.Time { return now }
+
+	// Found, within the grace period
+	err = gc.Run()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(destroyed) == 0)
+	tests.Assert(t, strings.Count(audit.String(), "\n") == 1, audit.String())
+	tests.Assert(t, strings.Contains(audit.String(),
+		"Found brick orphan in vg_"+brick.Info.DeviceId+" on "+host))
+
+	// Dry-run only reports it after the grace period
+	audit.Reset()
+	now = now.Add(time.Hour)
+	err = gc.Run()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(destroyed) == 0)
+	tests.Assert(t, strings.Contains(audit.String(), "Dry-run: would remove brick orphan"),
+		audit.String())
+
+	// Removed after the grace period
+	audit.Reset()
+	gc.dryRun = false
+	err = gc.Run()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(destroyed) == 1)
+	tests.Assert(t, destroyed[0].Name == "orphan")
+	tests.Assert(t, destroyed[0].VgId == brick.Info.DeviceId)
+	tests.Assert(t, strings.Contains(audit.String(), "Removed brick orphan"), audit.String())
+	tests.Assert(t, len(gc.found) == 0)
+
+	// A brick found again starts a new grace period
+	audit.Reset()
+	err = gc.Run()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(destroyed) == 1)
+	tests.Assert(t, strings.Contains(audit.String(), "Found brick orphan"), audit.String())
+
+	// Bricks which disappear are forgotten
+	delete(storage[host].Bricks, "orphan")
+	err = gc.Run()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(gc.found) == 0)
+}
+
+func TestBrickGcKeepsClonePools(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		1,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// A brick of a clone using the thin pool of a brick no longer in the db
+	var brick *BrickEntry
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		brick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		brick.PoolId = "origin"
+		return brick.Save(tx)
+	})
+	tests.Assert(t, err == nil)
+
+	storage, _ := mockConsistentStorage(t, app)
+	for _, s := range storage {
+		if _, ok := s.Bricks[brick.Info.Id]; ok {
+			s.Bricks["origin"] = &executors.BrickStorage{
+				VgId:   brick.Info.DeviceId,
+				TpSize: 1024,
+			}
+		}
+	}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		t.Errorf("Brick %v should not be removed", brick.Name)
+		return nil
+	}
+
+	var audit bytes.Buffer
+	gc := NewBrickGc(app.db, app.executor, 0, false, &audit)
+	err = gc.Run()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, audit.Len() == 0, audit.String())
+}
+
+func TestBrickGcKeepsReplacementBrick(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	mockVolumeInfoFromDb(t, app)
+
+	storage, _ := mockConsistentStorage(t, app)
+	var audit bytes.Buffer
+	gc := NewBrickGc(app.db, app.executor, 0, false, &audit)
+
+	// Run the gc while GlusterFS moves the volume to the new brick,
+	// which is not yet saved in the db
+	var newBrickId string
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+		ops := pendingOperations(t, app)
+		tests.Assert(t, len(ops) == 1)
+		err := app.db.View(func(tx *bolt.Tx) error {
+			op, err := NewPendingOperationEntryFromId(tx, ops[0])
+			if err != nil {
+				return err
+			}
+			tests.Assert(t, op.Type == PENDING_BRICK_REPLACE)
+			tests.Assert(t, len(op.Bricks) == 1)
+			newBrickId = op.Bricks[0].Info.Id
+			node, err := NewNodeEntryFromId(tx, op.Bricks[0].Info.NodeId)
+			if err != nil {
+				return err
+			}
+			storage[node.ManageHostName()].Bricks[newBrickId] = &executors.BrickStorage{
+				VgId:   op.Bricks[0].Info.DeviceId,
+				TpSize: op.Bricks[0].TpSize,
+				Size:   op.Bricks[0].Info.Size,
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil)
+
+		err = gc.Run()
+		tests.Assert(t, err == nil, err)
+		return nil
+	}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		tests.Assert(t, brick.Name != newBrickId, "replacement brick removed")
+		return nil
+	}
+
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, v.Bricks[0])
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, newBrickId != "")
+	tests.Assert(t, audit.Len() == 0, audit.String())
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+}
+
+func TestBrickGcStartStop(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	runs := make(chan string, 1)
+	app.xo.MockNodeStorage = func(host string) (*executors.NodeStorage, error) {
+		select {
+		case runs <- host:
+		default:
+		}
+		return &executors.NodeStorage{}, nil
+	}
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		1,    // nodes_per_cluster
+		1,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var audit bytes.Buffer
+	gc := NewBrickGc(app.db, app.executor, time.Hour, false, &audit)
+	gc.Start(time.Millisecond)
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Error("Garbage collection did not run")
+	}
+	gc.Stop()
+	gc.Stop()
+}
+
+func TestBrickGcRegisteredNodes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Hostnames are registered in the node bucket when nodes are added
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(nodes) == 3)
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, node.Register(tx) == nil)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	g := NewBrickGc(app.db, app.executor, 0, true, ioutil.Discard)
+	nodes, _, err := g.readDb()
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(nodes) == 3)
+}
@@ -0,0 +1,390 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+// Entries of a node to check against its storage
+type consistencyNode struct {
+	node    *NodeEntry
+	devices []*DeviceEntry
+	bricks  map[string]*BrickEntry
+
+	// Bricks of volume operations still in progress
+	pending map[string]bool
+}
+
+// Entries of a cluster to check against its nodes and volumes
+type consistencyCluster struct {
+	id    string
+	nodes []*consistencyNode
+
+	// Volume ids by name and by the ids of their bricks
+	volumes      map[string]string
+	brickVolumes map[string]string
+
+	// Names of the volumes being created or deleted, which GlusterFS
+	// may or may not have
+	busy map[string]bool
+}
+
+// LVM rounds sizes up to a whole number of extents
+func consistentSize(actual, expected, extentSize uint64) bool {
+	if actual < expected {
+		return false
+	}
+	return extentSize == 0 || actual-expected < extentSize
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func readConsistencyClusters(tx *bolt.Tx) ([]*consistencyCluster, error) {
+	clusterIds, err := ClusterList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bricks of operations in progress are not saved yet
+	pending := make(map[string]bool)
+	opIds, err := PendingOperationList(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, opId := range opIds {
+		op, err := NewPendingOperationEntryFromId(tx, opId)
+		if err != nil {
+			return nil, err
+		}
+		for _, brick := range op.Bricks {
+			pending[brick.Info.Id] = true
+		}
+	}
+
+	clusters := make([]*consistencyCluster, 0, len(clusterIds))
+	for _, clusterId := range clusterIds {
+		cluster, err := NewClusterEntryFromId(tx, clusterId)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := &consistencyCluster{
+			id:           clusterId,
+			volumes:      make(map[string]string),
+			brickVolumes: make(map[string]string),
+			busy:         make(map[string]bool),
+		}
+		for _, volumeId := range cluster.Info.Volumes {
+			volume, err := NewVolumeEntryFromId(tx, volumeId)
+			if err != nil {
+				return nil, err
+			}
+			switch volume.Info.State {
+			case api.VolumeStateCreating, api.VolumeStateDeleting:
+				cc.busy[volume.Info.Name] = true
+			default:
+				cc.volumes[volume.Info.Name] = volume.Info.Id
+			}
+			for _, brickId := range volume.Bricks {
+				cc.brickVolumes[brickId] = volume.Info.Id
+			}
+		}
+
+		for _, nodeId := range cluster.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return nil, err
+			}
+
+			cn := &consistencyNode{
+				node:    node,
+				bricks:  make(map[string]*BrickEntry),
+				pending: make(map[string]bool),
+			}
+			for _, deviceId := range node.Devices {
+				device, err := NewDeviceEntryFromId(tx, deviceId)
+				if err != nil {
+					return nil, err
+				}
+				cn.devices = append(cn.devices, device)
+
+				for _, brickId := range device.Bricks {
+					if pending[brickId] {
+						cn.pending[brickId] = true
+						continue
+					}
+					brick, err := NewBrickEntryFromId(tx, brickId)
+					if err != nil {
+						return nil, err
+					}
+					cn.bricks[brickId] = brick
+				}
+			}
+			cc.nodes = append(cc.nodes, cn)
+		}
+
+		clusters = append(clusters, cc)
+	}
+
+	return clusters, nil
+}
+
+// Returns the differences between the entries of a node and its storage
+func (cn *consistencyNode) check(cc *consistencyCluster,
+	storage *executors.NodeStorage) []api.ConsistencyIssue {
+
+	issues := make([]api.ConsistencyIssue, 0)
+	clusterId := cc.id
+	nodeId := cn.node.Info.Id
+	host := cn.node.ManageHostName()
+
+	// Volume groups
+	devices := make(map[string]bool)
+	for _, device := range cn.devices {
+		devices[device.Info.Id] = true
+
+		size, ok := storage.Devices[device.Info.Id]
+		if !ok {
+			issues = append(issues, api.ConsistencyIssue{
+				Type:      api.ConsistencyMissingDevice,
+				ClusterId: clusterId,
+				NodeId:    nodeId,
+				DeviceId:  device.Info.Id,
+				Description: fmt.Sprintf("Volume group of device %v (%v) not found on %v",
+					device.Info.Id, device.Info.Name, host),
+			})
+		} else if size != device.Info.Storage.Total {
+			issues = append(issues, api.ConsistencyIssue{
+				Type:      api.ConsistencySizeMismatch,
+				ClusterId: clusterId,
+				NodeId:    nodeId,
+				DeviceId:  device.Info.Id,
+				Description: fmt.Sprintf("Volume group of device %v on %v is %v KB, expected %v KB",
+					device.Info.Id, host, size, device.Info.Storage.Total),
+			})
+		}
+	}
+	orphanDevices := make(map[string]bool)
+	for vgid := range storage.Devices {
+		if !devices[vgid] {
+			orphanDevices[vgid] = true
+		}
+	}
+	for _, vgid := range sortedKeys(orphanDevices) {
+		issues = append(issues, api.ConsistencyIssue{
+			Type:      api.ConsistencyOrphanDevice,
+			ClusterId: clusterId,
+			NodeId:    nodeId,
+			DeviceId:  vgid,
+			Description: fmt.Sprintf("Volume group of unknown device %v found on %v",
+				vgid, host),
+		})
+	}
+
+	// Bricks in the order of the db
+	brickIds := make([]string, 0, len(cn.bricks))
+	for brickId := range cn.bricks {
+		brickIds = append(brickIds, brickId)
+	}
+	sort.Strings(brickIds)
+
+	extentSizes := make(map[string]uint64)
+	for _, device := range cn.devices {
+		extentSizes[device.Info.Id] = device.ExtentSize
+	}
+
+	for _, brickId := range brickIds {
+		brick := cn.bricks[brickId]
+
+		// Bricks of cloned volumes use the LVs created by GlusterFS
+		if brick.PoolId != "" {
+			continue
+		}
+
+		issue := api.ConsistencyIssue{
+			ClusterId: clusterId,
+			NodeId:    nodeId,
+			DeviceId:  brick.Info.DeviceId,
+			BrickId:   brickId,
+			Volume:    cc.brickVolumes[brickId],
+		}
+
+		found, ok := storage.Bricks[brickId]
+		if !ok || found.Size == 0 || found.TpSize == 0 {
+			issue.Type = api.ConsistencyMissingBrick
+			issue.Description = fmt.Sprintf("LV or thin pool of brick %v not found on %v",
+				brickId, host)
+			issues = append(issues, issue)
+			continue
+		}
+
+		extentSize := extentSizes[brick.Info.DeviceId]
+		if !consistentSize(found.Size, brick.Info.Size, extentSize) ||
+			!consistentSize(found.TpSize, brick.TpSize, extentSize) {
+			issue.Type = api.ConsistencySizeMismatch
+			issue.Description = fmt.Sprintf("Brick %v on %v is %v KB in a %v KB thin pool, "+
+				"expected %v KB in a %v KB thin pool",
+				brickId, host, found.Size, found.TpSize, brick.Info.Size, brick.TpSize)
+			issues = append(issues, issue)
+		}
+
+		if !found.Fstab {
+			issue.Type = api.ConsistencyMissingFstab
+			issue.Description = fmt.Sprintf("Brick %v has no fstab line on %v",
+				brickId, host)
+			issues = append(issues, issue)
+		}
+	}
+
+	orphanBricks := make(map[string]bool)
+	for brickId := range storage.Bricks {
+		if _, ok := cn.bricks[brickId]; !ok && !cn.pending[brickId] {
+			orphanBricks[brickId] = true
+		}
+	}
+	for _, brickId := range sortedKeys(orphanBricks) {
+		issues = append(issues, api.ConsistencyIssue{
+			Type:      api.ConsistencyOrphanBrick,
+			ClusterId: clusterId,
+			NodeId:    nodeId,
+			DeviceId:  storage.Bricks[brickId].VgId,
+			BrickId:   brickId,
+			Description: fmt.Sprintf("Brick %v unknown to Heketi found on %v",
+				brickId, host),
+		})
+	}
+
+	return issues
+}
+
+// Returns the differences between the volumes of a cluster
+// and the volumes known to GlusterFS
+func (cc *consistencyCluster) check(volumes []string) []api.ConsistencyIssue {
+	issues := make([]api.ConsistencyIssue, 0)
+
+	found := make(map[string]bool)
+	for _, name := range volumes {
+		found[name] = true
+	}
+
+	names := make([]string, 0, len(cc.volumes))
+	for name := range cc.volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !found[name] {
+			issues = append(issues, api.ConsistencyIssue{
+				Type:        api.ConsistencyMissingVolume,
+				ClusterId:   cc.id,
+				Volume:      cc.volumes[name],
+				Description: fmt.Sprintf("Volume %v not found in GlusterFS", name),
+			})
+		}
+	}
+
+	unknown := make(map[string]bool)
+	for name := range found {
+		if _, ok := cc.volumes[name]; !ok && !cc.busy[name] {
+			unknown[name] = true
+		}
+	}
+	for _, name := range sortedKeys(unknown) {
+		issues = append(issues, api.ConsistencyIssue{
+			Type:        api.ConsistencyUnknownVolume,
+			ClusterId:   cc.id,
+			Volume:      name,
+			Description: fmt.Sprintf("Volume %v unknown to Heketi found in GlusterFS", name),
+		})
+	}
+
+	return issues
+}
+
+// Checks the db against the storage found on every node and the
+// volumes known to GlusterFS in every cluster
+func CheckConsistency(db *bolt.DB, executor executors.Executor) (*api.ConsistencyReport, error) {
+	godbc.Require(db != nil)
+
+	var clusters []*consistencyCluster
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = readConsistencyClusters(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &api.ConsistencyReport{
+		Issues: make([]api.ConsistencyIssue, 0),
+	}
+	for _, cc := range clusters {
+
+		// Volumes are listed from the first node which can be reached
+		var volumeHost string
+		for _, cn := range cc.nodes {
+			storage, err := executor.NodeStorage(cn.node.ManageHostName())
+			if err != nil {
+				report.Issues = append(report.Issues, api.ConsistencyIssue{
+					Type:      api.ConsistencyNodeUnreachable,
+					ClusterId: cc.id,
+					NodeId:    cn.node.Info.Id,
+					Description: fmt.Sprintf("Unable to check node %v: %v",
+						cn.node.ManageHostName(), err),
+				})
+				continue
+			}
+			if volumeHost == "" {
+				volumeHost = cn.node.ManageHostName()
+			}
+
+			report.Issues = append(report.Issues, cn.check(cc, storage)...)
+		}
+		if volumeHost == "" {
+			continue
+		}
+
+		volumes, err := executor.VolumeList(volumeHost)
+		if err != nil {
+			report.Issues = append(report.Issues, api.ConsistencyIssue{
+				Type:        api.ConsistencyNodeUnreachable,
+				ClusterId:   cc.id,
+				Description: fmt.Sprintf("Unable to list volumes on %v: %v", volumeHost, err),
+			})
+			continue
+		}
+		report.Issues = append(report.Issues, cc.check(volumes)...)
+	}
+	report.Consistent = len(report.Issues) == 0
+
+	return report, nil
+}
@@ -0,0 +1,282 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// Mocks the executor to report the storage and volumes in the db
+func mockConsistentStorage(t *testing.T, app *App) (map[string]*executors.NodeStorage, *[]string) {
+	storage := make(map[string]*executors.NodeStorage)
+	volumes := make([]string, 0)
+
+	err := app.db.View(func(tx *bolt.Tx) error {
+		for _, nodeId := range EntryKeys(tx, BOLTDB_BUCKET_NODE) {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return err
+			}
+
+			s := &executors.NodeStorage{
+				Devices: make(map[string]uint64),
+				Bricks:  make(map[string]*executors.BrickStorage),
+			}
+			for _, deviceId := range node.Devices {
+				device, err := NewDeviceEntryFromId(tx, deviceId)
+				if err != nil {
+					return err
+				}
+				s.Devices[deviceId] = device.Info.Storage.Total
+
+				for _, brickId := range device.Bricks {
+					brick, err := NewBrickEntryFromId(tx, brickId)
+					if err != nil {
+						return err
+					}
+					s.Bricks[brickId] = &executors.BrickStorage{
+						VgId:   deviceId,
+						Size:   brick.Info.Size,
+						TpSize: brick.TpSize,
+						Fstab:  true,
+					}
+				}
+			}
+			storage[node.ManageHostName()] = s
+		}
+
+		volumeIds, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, volumeId := range volumeIds {
+			volume, err := NewVolumeEntryFromId(tx, volumeId)
+			if err != nil {
+				return err
+			}
+			volumes = append(volumes, volume.Info.Name)
+		}
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	app.xo.MockNodeStorage = func(host string) (*executors.NodeStorage, error) {
+		s, ok := storage[host]
+		if !ok {
+			return nil, errors.New("Unable to connect")
+		}
+		return s, nil
+	}
+	app.xo.MockVolumeList = func(host string) ([]string, error) {
+		return volumes, nil
+	}
+
+	return storage, &volumes
+}
+
+func TestCheckConsistency(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		3,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Nodes match the db
+	storage, volumes := mockConsistentStorage(t, app)
+	report, err := CheckConsistency(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, report.Consistent, report.Issues)
+	tests.Assert(t, len(report.Issues) == 0)
+
+	// Pick a brick of the volume and the storage of its node
+	var (
+		brick *BrickEntry
+		node  *NodeEntry
+	)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		brick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		node, err = NewNodeEntryFromId(tx, brick.Info.NodeId)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	nodeStorage := storage[node.ManageHostName()]
+
+	// Find the issues of the given type
+	find := func(report *api.ConsistencyReport,
+		issueType api.ConsistencyIssueType) []api.ConsistencyIssue {
+
+		found := make([]api.ConsistencyIssue, 0)
+		for _, issue := range report.Issues {
+			if issue.Type == issueType {
+				found = append(found, issue)
+			}
+		}
+		return found
+	}
+
+	// Brick without fstab line and too small
+	nodeStorage.Bricks[brick.Info.Id].Fstab = false
+	nodeStorage.Bricks[brick.Info.Id].Size = brick.Info.Size / 2
+	// Orphan brick and volume group
+	nodeStorage.Bricks["orphan"] = &executors.BrickStorage{
+		VgId: brick.Info.DeviceId,
+		Size: 1024,
+	}
+	nodeStorage.Devices["unknown"] = 1024
+	// Volumes unknown to Heketi and missing from GlusterFS
+	*volumes = []string{"external"}
+
+	report, err = CheckConsistency(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, !report.Consistent)
+	tests.Assert(t, len(report.Issues) == 6, report.Issues)
+
+	issues := find(report, api.ConsistencyMissingFstab)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].BrickId == brick.Info.Id)
+	tests.Assert(t, issues[0].NodeId == node.Info.Id)
+	tests.Assert(t, issues[0].Volume == v.Info.Id)
+
+	issues = find(report, api.ConsistencySizeMismatch)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].BrickId == brick.Info.Id)
+
+	issues = find(report, api.ConsistencyOrphanBrick)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].BrickId == "orphan")
+	tests.Assert(t, issues[0].DeviceId == brick.Info.DeviceId)
+
+	issues = find(report, api.ConsistencyOrphanDevice)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].DeviceId == "unknown")
+
+	issues = find(report, api.ConsistencyUnknownVolume)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].Volume == "external")
+
+	issues = find(report, api.ConsistencyMissingVolume)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].Volume == v.Info.Id)
+
+	// Missing brick and volume group, unreachable node
+	storage, volumes = mockConsistentStorage(t, app)
+	nodeStorage = storage[node.ManageHostName()]
+	delete(nodeStorage.Bricks, brick.Info.Id)
+	for deviceId := range nodeStorage.Devices {
+		if deviceId != brick.Info.DeviceId {
+			delete(nodeStorage.Devices, deviceId)
+			break
+		}
+	}
+	for host := range storage {
+		if host != node.ManageHostName() {
+			delete(storage, host)
+			break
+		}
+	}
+
+	report, err = CheckConsistency(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, !report.Consistent)
+	tests.Assert(t, len(report.Issues) == 3, report.Issues)
+
+	issues = find(report, api.ConsistencyMissingBrick)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].BrickId == brick.Info.Id)
+
+	issues = find(report, api.ConsistencyMissingDevice)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].DeviceId != brick.Info.DeviceId)
+
+	issues = find(report, api.ConsistencyNodeUnreachable)
+	tests.Assert(t, len(issues) == 1)
+	tests.Assert(t, issues[0].NodeId != node.Info.Id)
+}
+
+func TestConsistentSize(t *testing.T) {
+	tests.Assert(t, consistentSize(100, 100, 0))
+	tests.Assert(t, consistentSize(200, 100, 0))
+	tests.Assert(t, !consistentSize(99, 100, 0))
+	tests.Assert(t, consistentSize(4096, 1000, 4096))
+	tests.Assert(t, !consistentSize(8192, 1000, 4096))
+}
+
+func TestCheckConsistencyPendingOperation(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	storage, _ := mockConsistentStorage(t, app)
+
+	// Bricks of a volume being created are neither missing nor orphans
+	_, op := createPendingVolume(t, app, PENDING_STEP_BRICKS_CREATED)
+	tests.Assert(t, len(op.Bricks) > 1)
+	brick := op.Bricks[0]
+	err = app.db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return err
+		}
+		storage[node.ManageHostName()].Bricks[brick.Info.Id] = &executors.BrickStorage{
+			VgId:   brick.Info.DeviceId,
+			Size:   brick.Info.Size,
+			TpSize: brick.TpSize,
+			Fstab:  true,
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	report, err := CheckConsistency(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, report.Consistent, report.Issues)
+}
@@ -22,8 +22,10 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
@@ -68,6 +70,7 @@ func NewDeviceEntryFromRequest(req *api.DeviceAddRequest) *DeviceEntry {
 	device := NewDeviceEntry()
 	device.Info.Id = utils.GenUUID()
 	device.Info.Name = req.Name
+	device.Info.Class = req.Class
 	device.NodeId = req.NodeId
 
 	return device
@@ -244,6 +247,82 @@ func (d *DeviceEntry) SetState(tx *bolt.Tx,
 	return nil
 }
 
+// Moves all the bricks on the device to other devices in the cluster.
+// The device must not be online, so that the allocator does not place
+// the new bricks back on it.
+func (d *DeviceEntry) Remove(db *bolt.DB,
+	executor executors.Executor,
+	allocator Allocator) error {
+
+	godbc.Require(db != nil)
+	godbc.Require(!d.isOnline())
+
+	left, err := d.moveBricks(db, executor, allocator)
+	if err != nil {
+		return err
+	}
+
+	return bricksLeftError(left)
+}
+
+// Moves the bricks off the device.  Bricks which were moved, but could
+// not be destroyed on the node, are returned in left.
+func (d *DeviceEntry) moveBricks(db *bolt.DB,
+	executor executors.Executor,
+	allocator Allocator) (left []*BrickTeardownError, e error) {
+
+	// Copy the list, replacing a brick updates the device in the db
+	bricks := make([]string, len(d.Bricks))
+	copy(bricks, d.Bricks)
+
+	for _, brickId := range bricks {
+		var volume *VolumeEntry
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			volume, err = NewVolumeEntryFromBrickId(tx, brickId)
+			return err
+		})
+		if err != nil {
+			logger.LogError("Unable to find volume of brick %v: %v", brickId, err)
+			return left, err
+		}
+
+		logger.Info("Moving brick %v of volume %v off device %v",
+			brickId, volume.Info.Id, d.Info.Id)
+		err = volume.replaceBrick(db, executor, allocator, brickId, true)
+		if teardownErr, ok := err.(*BrickTeardownError); ok {
+			left = append(left, teardownErr)
+		} else if err != nil {
+			return left, err
+		}
+	}
+
+	// Reload the device to get the new brick list
+	err := db.View(func(tx *bolt.Tx) error {
+		device, err := NewDeviceEntryFromId(tx, d.Info.Id)
+		if err != nil {
+			return err
+		}
+		*d = *device
+		return nil
+	})
+	return left, err
+}
+
+// Returns an error listing the bricks left on the nodes, if any
+func bricksLeftError(left []*BrickTeardownError) error {
+	if len(left) == 0 {
+		return nil
+	}
+
+	bricks := make([]string, 0, len(left))
+	for _, brick := range left {
+		bricks = append(bricks, fmt.Sprintf("%v (%v)", brick.BrickId, brick.Err))
+	}
+	return fmt.Errorf("All bricks were moved, but %v replaced brick(s) "+
+		"could not be destroyed: %v", len(left), strings.Join(bricks, ", "))
+}
+
 func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, error) {
 
 	godbc.Require(tx != nil)
@@ -251,6 +330,7 @@ func (d *DeviceEntry) NewInfoResponse(tx *bolt.Tx) (*api.DeviceInfoResponse, err
 	info := &api.DeviceInfoResponse{}
 	info.Id = d.Info.Id
 	info.Name = d.Info.Name
+	info.Class = d.Info.Class
 	info.Storage = d.Info.Storage
 	info.State = d.State
 	info.Bricks = make([]api.BrickInfo, 0)
@@ -311,6 +391,32 @@ func (d *DeviceEntry) StorageSet(amount uint64) {
 	d.Info.Storage.Total = amount
 }
 
+// Sets the size of the device and recomputes the storage used by
+// the bricks on it
+func (d *DeviceEntry) StorageResync(tx *bolt.Tx, amount uint64) error {
+	godbc.Require(tx != nil)
+
+	var used uint64
+	for _, id := range d.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		used += brick.TotalSize()
+	}
+
+	d.Info.Storage.Total = amount
+	d.Info.Storage.Used = used
+	if used > amount {
+		logger.Warning("Bricks on device %v use %v KB out of %v KB",
+			d.Info.Id, used, amount)
+		d.Info.Storage.Free = 0
+	} else {
+		d.Info.Storage.Free = amount - used
+	}
+	return nil
+}
+
 func (d *DeviceEntry) StorageAllocate(amount uint64) {
 	d.Info.Storage.Free -= amount
 	d.Info.Storage.Used += amount
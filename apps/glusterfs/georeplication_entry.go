@@ -0,0 +1,386 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+// Operation on a geo-replication session and the states it
+// can be run from
+type geoReplicationAction struct {
+	from []api.GeoReplicationState
+	to   api.GeoReplicationState
+	run  func(executors.Executor, string, *executors.GeoReplicationRequest) error
+}
+
+var geoReplicationActions = map[string]geoReplicationAction{
+	"start": {
+		from: []api.GeoReplicationState{api.GeoReplicationCreated, api.GeoReplicationStopped},
+		to:   api.GeoReplicationStarted,
+		run:  executors.Executor.GeoReplicationStart,
+	},
+	"stop": {
+		from: []api.GeoReplicationState{api.GeoReplicationStarted, api.GeoReplicationPaused},
+		to:   api.GeoReplicationStopped,
+		run:  executors.Executor.GeoReplicationStop,
+	},
+	"pause": {
+		from: []api.GeoReplicationState{api.GeoReplicationStarted},
+		to:   api.GeoReplicationPaused,
+		run:  executors.Executor.GeoReplicationPause,
+	},
+	"resume": {
+		from: []api.GeoReplicationState{api.GeoReplicationPaused},
+		to:   api.GeoReplicationStarted,
+		run:  executors.Executor.GeoReplicationResume,
+	},
+}
+
+type GeoReplicationEntry struct {
+	Info api.GeoReplicationInfo
+}
+
+func GeoReplicationList(tx *bolt.Tx) ([]string, error) {
+
+	list := EntryKeys(tx, BOLTDB_BUCKET_GEOREP)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewGeoReplicationEntry() *GeoReplicationEntry {
+	return &GeoReplicationEntry{}
+}
+
+func NewGeoReplicationEntryFromRequest(volumeId string,
+	req *api.GeoReplicationCreateRequest) *GeoReplicationEntry {
+
+	godbc.Require(req != nil)
+	godbc.Require(volumeId != "")
+
+	session := NewGeoReplicationEntry()
+	session.Info.Id = utils.GenUUID()
+	session.Info.VolumeId = volumeId
+	session.Info.SlaveVolumeId = req.SlaveVolumeId
+
+	return session
+}
+
+func NewGeoReplicationEntryFromId(tx *bolt.Tx, id string) (*GeoReplicationEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewGeoReplicationEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (g *GeoReplicationEntry) BucketName() string {
+	return BOLTDB_BUCKET_GEOREP
+}
+
+func (g *GeoReplicationEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(g.Info.Id) > 0)
+
+	return EntrySave(tx, g, g.Info.Id)
+}
+
+func (g *GeoReplicationEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, g, g.Info.Id)
+}
+
+func (g *GeoReplicationEntry) NewInfoResponse(tx *bolt.Tx) (*api.GeoReplicationInfoResponse, error) {
+	godbc.Require(tx != nil)
+
+	info := &api.GeoReplicationInfoResponse{}
+	info.GeoReplicationInfo = g.Info
+	info.Status = make([]api.GeoReplicationPairStatus, 0)
+
+	return info, nil
+}
+
+func (g *GeoReplicationEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*g)
+
+	return buffer.Bytes(), err
+}
+
+func (g *GeoReplicationEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(g)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Checks the session can be created between the volumes
+func (g *GeoReplicationEntry) CheckVolumes(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+
+	master, err := NewVolumeEntryFromId(tx, g.Info.VolumeId)
+	if err != nil {
+		return err
+	}
+
+	slave, err := NewVolumeEntryFromId(tx, g.Info.SlaveVolumeId)
+	if err == ErrNotFound {
+		return fmt.Errorf("Slave volume %v not found", g.Info.SlaveVolumeId)
+	} else if err != nil {
+		return err
+	}
+
+	if master.Info.Cluster == slave.Info.Cluster {
+		return fmt.Errorf("Slave volume %v must be in another cluster than volume %v",
+			slave.Info.Id, master.Info.Id)
+	}
+
+	return nil
+}
+
+// Returns the executor request for this session together with the
+// host used to send the gluster commands
+func (g *GeoReplicationEntry) sessionRequest(db *bolt.DB) (*executors.GeoReplicationRequest, string, error) {
+	godbc.Require(db != nil)
+
+	req := &executors.GeoReplicationRequest{}
+	var host string
+	err := db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, g.Info.VolumeId)
+		if err != nil {
+			return err
+		}
+
+		host, err = volume.manageHostName(tx)
+		if err != nil {
+			return err
+		}
+
+		req.Volume = volume.Info.Name
+		req.SlaveHost = g.Info.SlaveHost
+		req.SlaveVolume = g.Info.SlaveVolume
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return req, host, nil
+}
+
+func (g *GeoReplicationEntry) Create(db *bolt.DB, executor executors.Executor) (e error) {
+	godbc.Require(db != nil)
+
+	// The master nodes reach the slave volume on its storage network
+	err := db.View(func(tx *bolt.Tx) error {
+		err := g.CheckVolumes(tx)
+		if err != nil {
+			return err
+		}
+
+		slave, err := NewVolumeEntryFromId(tx, g.Info.SlaveVolumeId)
+		if err != nil {
+			return err
+		}
+		if len(slave.Info.Mount.GlusterFS.Hosts) == 0 {
+			return fmt.Errorf("Slave volume %v has no hosts", slave.Info.Id)
+		}
+
+		g.Info.SlaveHost = slave.Info.Mount.GlusterFS.Hosts[0]
+		g.Info.SlaveVolume = slave.Info.Name
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	req, host, err := g.sessionRequest(db)
+	if err != nil {
+		return err
+	}
+
+	// Create the session
+	logger.Info("Creating geo-replication session from volume %v to %v::%v",
+		req.Volume, req.SlaveHost, req.SlaveVolume)
+	err = executor.GeoReplicationCreate(host, req)
+	if err != nil {
+		return err
+	}
+
+	// Delete the session on failure
+	defer func() {
+		if e != nil {
+			executor.GeoReplicationDelete(host, req)
+		}
+	}()
+
+	// Save information on db
+	g.Info.State = api.GeoReplicationCreated
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, id := range []string{g.Info.VolumeId, g.Info.SlaveVolumeId} {
+			volume, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+
+			volume.GeoReplicationAdd(g.Info.Id)
+			err = volume.Save(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return g.Save(tx)
+	})
+}
+
+// Checks the action can be run on the session in its current state
+func (g *GeoReplicationEntry) CheckAction(action string) error {
+	a, ok := geoReplicationActions[action]
+	if !ok {
+		return fmt.Errorf("Unknown geo-replication action %v", action)
+	}
+
+	for _, state := range a.from {
+		if g.Info.State == state {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unable to %v geo-replication session %v which is %v",
+		action, g.Info.Id, g.Info.State)
+}
+
+// Runs start, stop, pause or resume on the session
+func (g *GeoReplicationEntry) Action(db *bolt.DB,
+	executor executors.Executor,
+	action string) error {
+
+	godbc.Require(db != nil)
+
+	err := g.CheckAction(action)
+	if err != nil {
+		return err
+	}
+
+	req, host, err := g.sessionRequest(db)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Running %v on geo-replication session %v", action, g.Info.Id)
+	a := geoReplicationActions[action]
+	err = a.run(executor, host, req)
+	if err != nil {
+		return err
+	}
+
+	// Save information on db
+	return db.Update(func(tx *bolt.Tx) error {
+		g.Info.State = a.to
+		return g.Save(tx)
+	})
+}
+
+// Returns the status of the replication of each brick of the volume
+func (g *GeoReplicationEntry) Status(db *bolt.DB,
+	executor executors.Executor) ([]api.GeoReplicationPairStatus, error) {
+
+	godbc.Require(db != nil)
+
+	req, host, err := g.sessionRequest(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := executor.GeoReplicationStatus(host, req)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]api.GeoReplicationPairStatus, 0, len(status.Pairs))
+	for _, pair := range status.Pairs {
+		pairs = append(pairs, api.GeoReplicationPairStatus{
+			MasterNode:  pair.MasterNode,
+			MasterBrick: pair.MasterBrick,
+			SlaveNode:   pair.SlaveNode,
+			Status:      pair.Status,
+			CrawlStatus: pair.CrawlStatus,
+			LastSynced:  pair.LastSynced,
+		})
+	}
+
+	return pairs, nil
+}
+
+func (g *GeoReplicationEntry) Destroy(db *bolt.DB, executor executors.Executor) error {
+	godbc.Require(db != nil)
+
+	req, host, err := g.sessionRequest(db)
+	if err != nil {
+		return err
+	}
+
+	// Sessions must be stopped before they are deleted
+	if g.CheckAction("stop") == nil {
+		err = g.Action(db, executor, "stop")
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Deleting geo-replication session %v", g.Info.Id)
+	err = executor.GeoReplicationDelete(host, req)
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, id := range []string{g.Info.VolumeId, g.Info.SlaveVolumeId} {
+			volume, err := NewVolumeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+
+			volume.GeoReplicationDelete(g.Info.Id)
+			err = volume.Save(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return g.Delete(tx)
+	})
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+// Creates a volume in each of the two clusters of the app
+func createSampleGeoReplicationVolumes(t *testing.T, app *App) (*VolumeEntry, *VolumeEntry) {
+	err := setupSampleDbWithTopology(app,
+		2,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	var clusters []string
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		clusters, err = ClusterList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(clusters) == 2)
+
+	volumes := make([]*VolumeEntry, 0, 2)
+	for _, cluster := range clusters {
+		v := createSampleVolumeEntry(100)
+		v.Info.Clusters = []string{cluster}
+		err = v.Create(app.db, app.executor, app.allocator)
+		tests.Assert(t, err == nil)
+		volumes = append(volumes, v)
+	}
+
+	return volumes[0], volumes[1]
+}
+
+func TestNewGeoReplicationEntryMarshal(t *testing.T) {
+	req := &api.GeoReplicationCreateRequest{}
+	req.SlaveVolumeId = "slaveid"
+	g := NewGeoReplicationEntryFromRequest("volid", req)
+	tests.Assert(t, g.Info.Id != "")
+	tests.Assert(t, g.Info.VolumeId == "volid")
+	tests.Assert(t, g.Info.SlaveVolumeId == "slaveid")
+
+	buffer, err := g.Marshal()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(buffer) > 0)
+
+	um := &GeoReplicationEntry{}
+	err = um.Unmarshal(buffer)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(g, um))
+}
+
+func TestGeoReplicationEntryCheckVolumes(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	master, slave := createSampleGeoReplicationVolumes(t, app)
+
+	// Another volume in the cluster of the master
+	other := createSampleVolumeEntry(100)
+	other.Info.Clusters = []string{master.Info.Cluster}
+	err := other.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		g := NewGeoReplicationEntryFromRequest(master.Info.Id,
+			&api.GeoReplicationCreateRequest{SlaveVolumeId: slave.Info.Id})
+		tests.Assert(t, g.CheckVolumes(tx) == nil)
+
+		g.Info.SlaveVolumeId = "123"
+		tests.Assert(t, g.CheckVolumes(tx) != nil)
+
+		g.Info.SlaveVolumeId = other.Info.Id
+		tests.Assert(t, g.CheckVolumes(tx) != nil)
+
+		g.Info.SlaveVolumeId = master.Info.Id
+		tests.Assert(t, g.CheckVolumes(tx) != nil)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestGeoReplicationEntryCreateDestroy(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	master, slave := createSampleGeoReplicationVolumes(t, app)
+
+	var ops []string
+	record := func(op string) func(host string, session *executors.GeoReplicationRequest) error {
+		return func(host string, session *executors.GeoReplicationRequest) error {
+			tests.Assert(t, session.Volume == master.Info.Name)
+			tests.Assert(t, session.SlaveVolume == slave.Info.Name)
+			tests.Assert(t, session.SlaveHost == slave.Info.Mount.GlusterFS.Hosts[0])
+			ops = append(ops, op)
+			return nil
+		}
+	}
+	app.xo.MockGeoReplicationCreate = record("create")
+	app.xo.MockGeoReplicationStart = record("start")
+	app.xo.MockGeoReplicationStop = record("stop")
+	app.xo.MockGeoReplicationPause = record("pause")
+	app.xo.MockGeoReplicationResume = record("resume")
+	app.xo.MockGeoReplicationDelete = record("delete")
+
+	// Create the session
+	g := NewGeoReplicationEntryFromRequest(master.Info.Id,
+		&api.GeoReplicationCreateRequest{SlaveVolumeId: slave.Info.Id})
+	err := g.Create(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, g.Info.State == api.GeoReplicationCreated)
+
+	// Both volumes know about the session
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range []string{master.Info.Id, slave.Info.Id} {
+			v, err := NewVolumeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(v.GeoReplications) == 1)
+			tests.Assert(t, v.GeoReplications[0] == g.Info.Id)
+		}
+
+		entry, err := NewGeoReplicationEntryFromId(tx, g.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, reflect.DeepEqual(entry, g))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Actions not allowed in the current state
+	tests.Assert(t, g.Action(app.db, app.executor, "pause") != nil)
+	tests.Assert(t, g.Action(app.db, app.executor, "resume") != nil)
+	tests.Assert(t, g.Action(app.db, app.executor, "stop") != nil)
+	tests.Assert(t, g.Action(app.db, app.executor, "unknown") != nil)
+
+	// Go through the states
+	for _, step := range []struct {
+		action string
+		state  api.GeoReplicationState
+	}{
+		{"start", api.GeoReplicationStarted},
+		{"pause", api.GeoReplicationPaused},
+		{"resume", api.GeoReplicationStarted},
+		{"stop", api.GeoReplicationStopped},
+		{"start", api.GeoReplicationStarted},
+	} {
+		err = g.Action(app.db, app.executor, step.action)
+		tests.Assert(t, err == nil, step.action, err)
+		tests.Assert(t, g.Info.State == step.state)
+	}
+
+	// Failures keep the state
+	ErrMock := errors.New("MOCK")
+	app.xo.MockGeoReplicationPause = func(host string, session *executors.GeoReplicationRequest) error {
+		return ErrMock
+	}
+	err = g.Action(app.db, app.executor, "pause")
+	tests.Assert(t, err == ErrMock)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewGeoReplicationEntryFromId(tx, g.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.State == api.GeoReplicationStarted)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Started sessions are stopped before they are deleted
+	ops = nil
+	err = g.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(ops, []string{"stop", "delete"}), ops)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range []string{master.Info.Id, slave.Info.Id} {
+			v, err := NewVolumeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(v.GeoReplications) == 0)
+		}
+
+		_, err := NewGeoReplicationEntryFromId(tx, g.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestGeoReplicationEntryCreateFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	master, slave := createSampleGeoReplicationVolumes(t, app)
+
+	ErrMock := errors.New("MOCK")
+	app.xo.MockGeoReplicationCreate = func(host string, session *executors.GeoReplicationRequest) error {
+		return ErrMock
+	}
+
+	g := NewGeoReplicationEntryFromRequest(master.Info.Id,
+		&api.GeoReplicationCreateRequest{SlaveVolumeId: slave.Info.Id})
+	err := g.Create(app.db, app.executor)
+	tests.Assert(t, err == ErrMock)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, master.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(v.GeoReplications) == 0)
+
+		_, err = NewGeoReplicationEntryFromId(tx, g.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
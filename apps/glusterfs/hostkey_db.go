@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// Keeps the host keys of the nodes trusted on first use by the
+// ssh executor
+type HostKeyDb struct {
+	app *App
+}
+
+func NewHostKeyDb(app *App) *HostKeyDb {
+	return &HostKeyDb{app: app}
+}
+
+func (h *HostKeyDb) HostKey(host string) ([]byte, error) {
+	var key []byte
+	err := h.app.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_HOSTKEY))
+		if b == nil {
+			return ErrDbAccess
+		}
+		if val := b.Get([]byte(host)); val != nil {
+			key = append([]byte{}, val...)
+		}
+		return nil
+	})
+	return key, err
+}
+
+func (h *HostKeyDb) SaveHostKey(host string, key []byte) error {
+	logger.Info("Trusting host key of %v on first use: %s", host, key)
+	return h.app.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BOLTDB_BUCKET_HOSTKEY))
+		if b == nil {
+			return ErrDbAccess
+		}
+		return b.Put([]byte(host), key)
+	})
+}
+
+// Forgets the keys of a host on any port so that a reinstalled
+// node can be added again
+func removeHostKeys(tx *bolt.Tx, host string) error {
+	b := tx.Bucket([]byte(BOLTDB_BUCKET_HOSTKEY))
+	if b == nil {
+		return ErrDbAccess
+	}
+
+	var keys [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		name := string(k)
+		if name == host || strings.HasPrefix(name, "["+host+"]:") {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		err := b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func TestHostKeyDb(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	h := NewHostKeyDb(app)
+	key, err := h.HostKey("host1")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, key == nil)
+
+	for _, host := range []string{"host1", "[host1]:2222", "host10", "host2"} {
+		err = h.SaveHostKey(host, []byte("ecdsa-sha2-nistp256 AAAA "+host))
+		tests.Assert(t, err == nil)
+	}
+	key, err = h.HostKey("[host1]:2222")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, string(key) == "ecdsa-sha2-nistp256 AAAA [host1]:2222")
+
+	// Keys of the host on all ports are removed
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		return removeHostKeys(tx, "host1")
+	})
+	tests.Assert(t, err == nil)
+
+	var hosts sort.StringSlice
+	err = app.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BOLTDB_BUCKET_HOSTKEY)).ForEach(func(k, v []byte) error {
+			hosts = append(hosts, string(k))
+			return nil
+		})
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(hosts) == 2, hosts)
+	tests.Assert(t, hosts[0] == "host10")
+	tests.Assert(t, hosts[1] == "host2")
+}
@@ -24,6 +24,7 @@ import (
 	"sort"
 
 	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
 	"github.com/heketi/heketi/pkg/glusterfs/api"
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/lpabon/godbc"
@@ -36,6 +37,25 @@ type NodeEntry struct {
 	Devices sort.StringSlice
 }
 
+// Returns the ids of the nodes in all the clusters.  The node bucket
+// cannot be listed since it also holds the registered hostnames.
+func NodeList(tx *bolt.Tx) ([]string, error) {
+	clusters, err := ClusterList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]string, 0)
+	for _, id := range clusters {
+		cluster, err := NewClusterEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, cluster.Info.Nodes...)
+	}
+	return nodes, nil
+}
+
 func NewNodeEntry() *NodeEntry {
 	entry := &NodeEntry{}
 	entry.Devices = make(sort.StringSlice, 0)
@@ -52,6 +72,7 @@ func NewNodeEntryFromRequest(req *api.NodeAddRequest) *NodeEntry {
 	node.Info.ClusterId = req.ClusterId
 	node.Info.Hostnames = req.Hostnames
 	node.Info.Zone = req.Zone
+	node.Info.Ssh = req.Ssh
 
 	return node
 }
@@ -274,6 +295,37 @@ func (n *NodeEntry) SetState(tx *bolt.Tx,
 	return nil
 }
 
+// Moves all the bricks on the devices of the node to other nodes
+// in the cluster.  The node must not be online.
+func (n *NodeEntry) Remove(db *bolt.DB,
+	executor executors.Executor,
+	allocator Allocator) error {
+
+	godbc.Require(db != nil)
+	godbc.Require(!n.isOnline())
+
+	var left []*BrickTeardownError
+	for _, deviceId := range n.Devices {
+		var device *DeviceEntry
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			device, err = NewDeviceEntryFromId(tx, deviceId)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		deviceLeft, err := device.moveBricks(db, executor, allocator)
+		left = append(left, deviceLeft...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bricksLeftError(left)
+}
+
 func (n *NodeEntry) NewInfoReponse(tx *bolt.Tx) (*api.NodeInfoResponse, error) {
 
 	godbc.Require(tx != nil)
@@ -283,6 +335,7 @@ func (n *NodeEntry) NewInfoReponse(tx *bolt.Tx) (*api.NodeInfoResponse, error) {
 	info.Hostnames = n.Info.Hostnames
 	info.Id = n.Info.Id
 	info.Zone = n.Info.Zone
+	info.Ssh = n.Info.Ssh
 	info.State = n.State
 	info.DevicesInfo = make([]api.DeviceInfoResponse, 0)
 
@@ -0,0 +1,80 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"sync"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+)
+
+// Keeps the ssh settings of the nodes overriding the configuration
+// of the ssh executor, by manage hostname
+type NodeSshSettings struct {
+	lock     sync.RWMutex
+	settings map[string]*sshexec.NodeSettings
+}
+
+func NewNodeSshSettings() *NodeSshSettings {
+	return &NodeSshSettings{
+		settings: make(map[string]*sshexec.NodeSettings),
+	}
+}
+
+// Loads the settings of the nodes in the db
+func (n *NodeSshSettings) Load(db *bolt.DB) error {
+	return db.View(func(tx *bolt.Tx) error {
+		nodes, err := NodeList(tx)
+		if err != nil {
+			return err
+		}
+		for _, id := range nodes {
+			node, err := NewNodeEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			n.Set(node.ManageHostName(), node.Info.Ssh)
+		}
+		return nil
+	})
+}
+
+func (n *NodeSshSettings) NodeSettings(host string) *sshexec.NodeSettings {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.settings[host]
+}
+
+func (n *NodeSshSettings) Set(host string, s *api.NodeSshSettings) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if s == nil {
+		delete(n.settings, host)
+		return
+	}
+	n.settings[host] = &sshexec.NodeSettings{
+		User:    s.User,
+		Port:    s.Port,
+		KeyFile: s.KeyFile,
+	}
+}
+
+func (n *NodeSshSettings) Remove(host string) {
+	n.Set(host, nil)
+}
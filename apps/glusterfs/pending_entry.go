@@ -0,0 +1,648 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+type PendingOperationType int
+
+const (
+	PENDING_VOLUME_CREATE PendingOperationType = iota
+	PENDING_VOLUME_EXPAND
+	PENDING_VOLUME_DESTROY
+	PENDING_BRICK_REPLACE
+)
+
+func (t PendingOperationType) String() string {
+	switch t {
+	case PENDING_VOLUME_CREATE:
+		return "create"
+	case PENDING_VOLUME_EXPAND:
+		return "expand"
+	case PENDING_VOLUME_DESTROY:
+		return "destroy"
+	case PENDING_BRICK_REPLACE:
+		return "brick replace"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// Last step of an operation which is known to have been started
+type PendingOperationStep int
+
+const (
+	// Bricks allocated in the db, or volume about to be destroyed
+	PENDING_STEP_PLANNED PendingOperationStep = iota
+
+	// Bricks created on the nodes
+	PENDING_STEP_BRICKS_CREATED
+
+	// GlusterFS volume created, or expanded, with the bricks
+	PENDING_STEP_VOLUME_CREATED
+
+	// GlusterFS volume destroyed
+	PENDING_STEP_VOLUME_DESTROYED
+)
+
+func (s PendingOperationStep) String() string {
+	switch s {
+	case PENDING_STEP_PLANNED:
+		return "planned"
+	case PENDING_STEP_BRICKS_CREATED:
+		return "bricks created"
+	case PENDING_STEP_VOLUME_CREATED:
+		return "volume created"
+	case PENDING_STEP_VOLUME_DESTROYED:
+		return "volume destroyed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// Volume operation in progress.  It is saved in the db before each
+// step is run so that an operation interrupted by a restart of
+// heketi can be rolled back or forward.
+type PendingOperationEntry struct {
+	Id     string
+	Type   PendingOperationType
+	Step   PendingOperationStep
+	Volume *VolumeEntry
+
+	// Bricks being added to the volume
+	Bricks []*BrickEntry
+
+	// Size in GB added to the volume by an expansion
+	Size int
+
+	// Brick of the volume being replaced by the brick of the operation
+	ReplacedBrickId string
+}
+
+func PendingOperationList(tx *bolt.Tx) ([]string, error) {
+
+	list := EntryKeys(tx, BOLTDB_BUCKET_PENDING)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewPendingOperationEntry() *PendingOperationEntry {
+	entry := &PendingOperationEntry{}
+	entry.Volume = NewVolumeEntry()
+	entry.Bricks = make([]*BrickEntry, 0)
+
+	return entry
+}
+
+func NewPendingOperationEntryForVolume(optype PendingOperationType,
+	v *VolumeEntry,
+	brick_entries []*BrickEntry) *PendingOperationEntry {
+
+	godbc.Require(v != nil)
+
+	entry := NewPendingOperationEntry()
+	entry.Id = utils.GenUUID()
+	entry.Type = optype
+	entry.Volume = v
+	if brick_entries != nil {
+		entry.Bricks = brick_entries
+	}
+
+	return entry
+}
+
+func NewPendingOperationEntryFromId(tx *bolt.Tx, id string) (*PendingOperationEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewPendingOperationEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (p *PendingOperationEntry) BucketName() string {
+	return BOLTDB_BUCKET_PENDING
+}
+
+func (p *PendingOperationEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(p.Id) > 0)
+
+	return EntrySave(tx, p, p.Id)
+}
+
+func (p *PendingOperationEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, p, p.Id)
+}
+
+func (p *PendingOperationEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*p)
+
+	return buffer.Bytes(), err
+}
+
+func (p *PendingOperationEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(p)
+	if err != nil {
+		return err
+	}
+
+	// Make sure to setup arrays if nil
+	if p.Bricks == nil {
+		p.Bricks = make([]*BrickEntry, 0)
+	}
+
+	return nil
+}
+
+// Saves the operation in the db as about to run the step
+func (p *PendingOperationEntry) Record(db *bolt.DB, step PendingOperationStep) error {
+	godbc.Require(db != nil)
+
+	p.Step = step
+	return db.Update(func(tx *bolt.Tx) error {
+		return p.Save(tx)
+	})
+}
+
+// Saves the operation as about to run the step together with
+// the state of its volume
+func (p *PendingOperationEntry) RecordState(db *bolt.DB,
+	step PendingOperationStep,
+	state api.VolumeState) error {
+
+	godbc.Require(db != nil)
+
+	p.Step = step
+	return db.Update(func(tx *bolt.Tx) error {
+		err := p.Volume.saveState(tx, state)
+		if err != nil {
+			return err
+		}
+		return p.Save(tx)
+	})
+}
+
+// Removes the operation from the db once it has been undone
+func (p *PendingOperationEntry) Remove(db *bolt.DB) {
+	godbc.Require(db != nil)
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		return p.Delete(tx)
+	})
+	if err != nil {
+		logger.LogError("Unable to remove pending operation %v: %v", p.Id, err)
+	}
+}
+
+// Returns true when the bricks of a failed operation could not be
+// destroyed, after journaling the operation to be rolled back on the
+// next start.  GlusterFS may still hold the bricks when the failure
+// came after it took them, which the recovery checks.
+func (p *PendingOperationEntry) keepOnFailedDestroy(db *bolt.DB, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	logger.LogError("Unable to destroy bricks of operation %v, "+
+		"keeping it to be recovered: %v", p.Id, err)
+	if p.Step == PENDING_STEP_VOLUME_CREATED {
+		err = p.Record(db, PENDING_STEP_BRICKS_CREATED)
+		if err != nil {
+			logger.LogError("Unable to journal operation %v: %v", p.Id, err)
+		}
+	}
+	return true
+}
+
+// Rolls back, or forward, the volume operations which were in
+// progress when heketi stopped.  Operations which cannot be recovered,
+// for example because a node is unreachable, are kept and tried again
+// on the next start.
+func RecoverPendingOperations(db *bolt.DB, executor executors.Executor) error {
+	ops, err := LoadPendingOperations(db)
+	if err != nil {
+		return err
+	}
+
+	recoverPendingOperations(db, executor, ops)
+	return nil
+}
+
+// Returns the operations in the journal.  Only these can be recovered,
+// as later ones belong to operations still running.
+func LoadPendingOperations(db *bolt.DB) ([]*PendingOperationEntry, error) {
+	godbc.Require(db != nil)
+
+	ops := make([]*PendingOperationEntry, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		ids, err := PendingOperationList(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			op, err := NewPendingOperationEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, op)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+func recoverPendingOperations(db *bolt.DB,
+	executor executors.Executor,
+	ops []*PendingOperationEntry) {
+
+	for _, op := range ops {
+		var err error
+		logger.Info("Recovering %v of volume %v interrupted at step: %v",
+			op.Type, op.Volume.Info.Id, op.Step)
+
+		switch op.Type {
+		case PENDING_VOLUME_CREATE:
+			err = op.recoverCreate(db, executor)
+		case PENDING_VOLUME_EXPAND:
+			err = op.recoverExpand(db, executor)
+		case PENDING_VOLUME_DESTROY:
+			err = op.recoverDestroy(db, executor)
+		case PENDING_BRICK_REPLACE:
+			err = op.recoverReplace(db, executor)
+		default:
+			err = fmt.Errorf("Unknown operation type %v", op.Type)
+		}
+		if err != nil {
+			logger.LogError("Unable to recover pending operation %v: %v", op.Id, err)
+		}
+	}
+}
+
+// Returns true when GlusterFS has all the bricks of the operation
+// in the volume
+func (p *PendingOperationEntry) volumeHasBricks(db *bolt.DB,
+	executor executors.Executor) (bool, error) {
+
+	_, host, err := p.Volume.createVolumeRequest(db, p.Bricks)
+	if err != nil {
+		return false, err
+	}
+
+	volumes, err := executor.VolumeList(host)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, name := range volumes {
+		if name == p.Volume.Info.Name {
+			found = true
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	info, err := executor.VolumeInfo(host, p.Volume.Info.Name)
+	if err != nil {
+		return false, err
+	}
+
+	paths := make(map[string]bool)
+	for _, brick := range info.Bricks {
+		paths[brick.Path] = true
+	}
+	for _, brick := range p.Bricks {
+		if !paths[brick.Info.Path] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Returns true when the operation got far enough to be rolled forward
+func (p *PendingOperationEntry) volumeCreated(db *bolt.DB,
+	executor executors.Executor) (bool, error) {
+
+	switch p.Step {
+	case PENDING_STEP_VOLUME_CREATED:
+		return true, nil
+	case PENDING_STEP_BRICKS_CREATED:
+		// Heketi may have stopped after GlusterFS took the bricks
+		return p.volumeHasBricks(db, executor)
+	default:
+		return false, nil
+	}
+}
+
+// Destroys the bricks of the operation and releases their space.
+// Destroying a brick which was never created succeeds, so the
+// operation is only kept when a node cannot destroy its brick.
+func (p *PendingOperationEntry) rollbackBricks(db *bolt.DB,
+	executor executors.Executor) error {
+
+	err := DestroyBricks(db, executor, p.Bricks)
+	if err != nil {
+		return fmt.Errorf("Unable to destroy bricks of operation %v: %v", p.Id, err)
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if p.Type == PENDING_VOLUME_CREATE {
+			p.Volume.deleteFromDb(tx, p.Bricks)
+			return p.Delete(tx)
+		}
+
+		// The bricks are only added to the volume entry in the
+		// db once an expansion or replacement completes
+		for _, brick := range p.Bricks {
+			err := p.Volume.removeBrickFromDb(tx, brick)
+			if err != nil {
+				return err
+			}
+		}
+		err := p.Volume.saveState(tx, api.VolumeStateOnline)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		return p.Delete(tx)
+	})
+}
+
+func (p *PendingOperationEntry) recoverCreate(db *bolt.DB,
+	executor executors.Executor) error {
+
+	v := p.Volume
+	created, err := p.volumeCreated(db, executor)
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		logger.Info("Rolling back creation of volume %v", v.Info.Id)
+		return p.rollbackBricks(db, executor)
+	}
+
+	logger.Info("Completing creation of volume %v", v.Info.Id)
+	if p.Step != PENDING_STEP_VOLUME_CREATED {
+		vr, _, err := v.createVolumeRequest(db, p.Bricks)
+		if err != nil {
+			return err
+		}
+		v.setMountInfo(vr)
+	}
+
+	v.Info.State = api.VolumeStateOnline
+	return db.Update(func(tx *bolt.Tx) error {
+		err := v.saveCreated(tx, p.Bricks)
+		if err != nil {
+			return err
+		}
+		return p.Delete(tx)
+	})
+}
+
+func (p *PendingOperationEntry) recoverExpand(db *bolt.DB,
+	executor executors.Executor) error {
+
+	created, err := p.volumeCreated(db, executor)
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		logger.Info("Rolling back expansion of volume %v", p.Volume.Info.Id)
+		return p.rollbackBricks(db, executor)
+	}
+
+	logger.Info("Completing expansion of volume %v", p.Volume.Info.Id)
+	return db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, p.Volume.Info.Id)
+		if err != nil {
+			return err
+		}
+
+		for _, brick := range p.Bricks {
+			v.BrickAdd(brick.Id())
+		}
+		v.Info.Size += p.Size
+		v.Info.State = api.VolumeStateOnline
+
+		err = v.saveExpanded(tx, p.Bricks)
+		if err != nil {
+			return err
+		}
+		return p.Delete(tx)
+	})
+}
+
+func (p *PendingOperationEntry) recoverReplace(db *bolt.DB,
+	executor executors.Executor) error {
+
+	created, err := p.volumeCreated(db, executor)
+	if err != nil {
+		return err
+	}
+
+	if !created {
+		logger.Info("Rolling back replacement of brick %v of volume %v",
+			p.ReplacedBrickId, p.Volume.Info.Id)
+		return p.rollbackBricks(db, executor)
+	}
+
+	logger.Info("Completing replacement of brick %v of volume %v",
+		p.ReplacedBrickId, p.Volume.Info.Id)
+	var old *BrickEntry
+	err = db.Update(func(tx *bolt.Tx) error {
+		v, err := NewVolumeEntryFromId(tx, p.Volume.Info.Id)
+		if err != nil {
+			return err
+		}
+
+		for _, brick := range p.Bricks {
+			err := brick.Save(tx)
+			if err != nil {
+				return err
+			}
+			if !utils.SortedStringHas(v.Bricks, brick.Id()) {
+				v.BrickAdd(brick.Id())
+			}
+		}
+
+		old, err = NewBrickEntryFromId(tx, p.ReplacedBrickId)
+		if err == nil {
+			err = v.removeBrickFromDb(tx, old)
+		}
+		if err == ErrNotFound {
+			old = nil
+		} else if err != nil {
+			return err
+		}
+
+		err = v.updateMountInfo(tx)
+		if err != nil {
+			return err
+		}
+		v.Info.State = api.VolumeStateOnline
+		err = v.Save(tx)
+		if err != nil {
+			return err
+		}
+		return p.Delete(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The volume no longer uses the old brick
+	if old != nil {
+		destroyReplacedBrick(db, executor, old)
+	}
+	return nil
+}
+
+// Destroys a brick removed from its volume when its node and device
+// are online.  Otherwise, or when it fails, the brick is left on its
+// node for the brick garbage collection.
+func destroyReplacedBrick(db *bolt.DB,
+	executor executors.Executor,
+	brick *BrickEntry) {
+
+	online := false
+	err := db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return err
+		}
+		device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		online = node.isOnline() && device.isOnline()
+		return nil
+	})
+	if err == nil && !online {
+		logger.Warning("Node or device of replaced brick %v is not online, "+
+			"the brick will not be destroyed", brick.Info.Id)
+		return
+	}
+	if err == nil {
+		err = brick.DestroyCheck(db, executor)
+	}
+	if err == nil {
+		err = brick.Destroy(db, executor)
+	}
+	if err != nil {
+		logger.LogError("Unable to destroy replaced brick %v: %v",
+			brick.Info.Id, err)
+	}
+}
+
+func (p *PendingOperationEntry) recoverDestroy(db *bolt.DB,
+	executor executors.Executor) error {
+
+	var (
+		v             *VolumeEntry
+		brick_entries []*BrickEntry
+		host          string
+	)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = NewVolumeEntryFromId(tx, p.Volume.Info.Id)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range v.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			brick_entries = append(brick_entries, brick)
+		}
+
+		host, err = v.manageHostName(tx)
+		return err
+	})
+	if err == ErrNotFound {
+		// Nothing left to destroy
+		return db.Update(func(tx *bolt.Tx) error {
+			return p.Delete(tx)
+		})
+	} else if err != nil {
+		return err
+	}
+
+	if p.Step == PENDING_STEP_PLANNED {
+		volumes, err := executor.VolumeList(host)
+		if err != nil {
+			return err
+		}
+		for _, name := range volumes {
+			if name == v.Info.Name {
+				// Nothing has been destroyed yet
+				logger.Info("Volume %v was not destroyed", v.Info.Id)
+				return db.Update(func(tx *bolt.Tx) error {
+					err := v.saveState(tx, api.VolumeStateOnline)
+					if err != nil {
+						return err
+					}
+					return p.Delete(tx)
+				})
+			}
+		}
+	}
+
+	logger.Info("Completing destruction of volume %v", v.Info.Id)
+	err = DestroyBricks(db, executor, brick_entries)
+	if err != nil {
+		db.Update(func(tx *bolt.Tx) error {
+			return v.saveState(tx, api.VolumeStateFailed)
+		})
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		v.deleteFromDb(tx, brick_entries)
+		return p.Delete(tx)
+	})
+}
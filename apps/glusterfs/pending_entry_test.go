@@ -0,0 +1,523 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+// Allocates the bricks of a new volume in the only cluster and journals its creation
+// as if heketi stopped during the step
+func createPendingVolume(t *testing.T, app *App,
+	step PendingOperationStep) (*VolumeEntry, *PendingOperationEntry) {
+
+	var cluster string
+	err := app.db.View(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		tests.Assert(t, len(clusters) == 1)
+		cluster = clusters[0]
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	v.Info.Cluster = cluster
+	brick_entries, err := v.allocBricksInCluster(app.db, app.allocator, cluster, v.Info.Size)
+	tests.Assert(t, err == nil)
+
+	if step != PENDING_STEP_PLANNED {
+		err = CreateBricks(app.db, app.executor, brick_entries)
+		tests.Assert(t, err == nil)
+	}
+
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_CREATE, v, brick_entries)
+	err = op.Record(app.db, step)
+	tests.Assert(t, err == nil)
+
+	return v, op
+}
+
+func pendingOperations(t *testing.T, app *App) []string {
+	var ops []string
+	err := app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		ops, err = PendingOperationList(tx)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	return ops
+}
+
+// Checks the db has no volumes, bricks or used space
+func assertNoVolumes(t *testing.T, app *App) {
+	err := app.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(volumes) == 0)
+
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bricks) == 0)
+
+		devices, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(device.Bricks) == 0)
+			tests.Assert(t, device.Info.Storage.Used == 0)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestPendingOperationEntryMarshal(t *testing.T) {
+	v := createSampleVolumeEntry(100)
+	b := NewBrickEntry(10, 20, 5, "device", "node")
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_EXPAND,
+		v, []*BrickEntry{b})
+	op.Step = PENDING_STEP_BRICKS_CREATED
+	op.Size = 50
+
+	buffer, err := op.Marshal()
+	tests.Assert(t, err == nil)
+
+	um := NewPendingOperationEntry()
+	err = um.Unmarshal(buffer)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, um.Id == op.Id)
+	tests.Assert(t, um.Type == PENDING_VOLUME_EXPAND)
+	tests.Assert(t, um.Step == PENDING_STEP_BRICKS_CREATED)
+	tests.Assert(t, um.Size == 50)
+	tests.Assert(t, um.Volume.Info.Id == v.Info.Id)
+	tests.Assert(t, um.Volume.Durability.BricksInSet() == 2)
+	tests.Assert(t, len(um.Bricks) == 1)
+	tests.Assert(t, um.Bricks[0].Info.Id == b.Info.Id)
+	tests.Assert(t, um.Bricks[0].TpSize == 20)
+}
+
+func TestVolumeEntryCreateLeavesNoPendingOperation(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	err = v.Expand(app.db, app.executor, app.allocator, 100)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	// Failed operations are rolled back in process
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		return nil, errors.New("volume create failed")
+	}
+	v = createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+	assertNoVolumes(t, app)
+}
+
+func TestRecoverPendingCreateRollBack(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+	_, op := createPendingVolume(t, app, PENDING_STEP_PLANNED)
+	app.Close()
+
+	// Restarting heketi undoes the allocation once it has started
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	<-app.recovered
+
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+	assertNoVolumes(t, app)
+	tests.Assert(t, len(op.Bricks) > 0)
+}
+
+func TestRecoverPendingCreateRollForward(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v, op := createPendingVolume(t, app, PENDING_STEP_BRICKS_CREATED)
+
+	// GlusterFS created the volume before heketi stopped
+	app.xo.MockVolumeList = func(host string) ([]string, error) {
+		return []string{v.Info.Name}, nil
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		info := &executors.VolumeInfo{Name: volume}
+		for _, brick := range op.Bricks {
+			info.Bricks = append(info.Bricks, executors.BrickInfo{
+				Path: brick.Info.Path,
+			})
+		}
+		return info, nil
+	}
+	destroyed := 0
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed++
+		return nil
+	}
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, destroyed == 0)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(entry.Bricks) == len(op.Bricks))
+		tests.Assert(t, len(entry.Info.Mount.GlusterFS.Hosts) > 0)
+
+		cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(cluster.Info.Volumes) == 1)
+
+		bricks, err := BrickList(tx)
+		tests.Assert(t, len(bricks) == len(op.Bricks))
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// Without the bricks in GlusterFS the creation is undone
+	app.xo.MockVolumeList = func(host string) ([]string, error) {
+		return []string{}, nil
+	}
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	_, op = createPendingVolume(t, app, PENDING_STEP_BRICKS_CREATED)
+
+	destroyed = 0
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, destroyed == len(op.Bricks))
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+}
+
+func TestRecoverPendingUnreachableNode(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	createPendingVolume(t, app, PENDING_STEP_BRICKS_CREATED)
+
+	// The operation is kept until it can be recovered
+	app.xo.MockVolumeList = func(host string) ([]string, error) {
+		return nil, errors.New("unreachable")
+	}
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 1)
+}
+
+func TestRecoverPendingExpand(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	bricks := len(v.Bricks)
+
+	// Expansion interrupted after GlusterFS took the bricks
+	brick_entries, err := v.allocBricksInCluster(app.db, app.allocator, v.Info.Cluster, 100)
+	tests.Assert(t, err == nil)
+	err = CreateBricks(app.db, app.executor, brick_entries)
+	tests.Assert(t, err == nil)
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_EXPAND, v, brick_entries)
+	op.Size = 100
+	err = op.Record(app.db, PENDING_STEP_VOLUME_CREATED)
+	tests.Assert(t, err == nil)
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.Size == 200)
+		tests.Assert(t, len(entry.Bricks) == bricks+len(brick_entries))
+
+		list, err := BrickList(tx)
+		tests.Assert(t, len(list) == len(entry.Bricks))
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// Expansion interrupted before creating the bricks
+	err = app.db.View(func(tx *bolt.Tx) error {
+		v, err = NewVolumeEntryFromId(tx, v.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	brick_entries, err = v.allocBricksInCluster(app.db, app.allocator, v.Info.Cluster, 100)
+	tests.Assert(t, err == nil)
+	op = NewPendingOperationEntryForVolume(PENDING_VOLUME_EXPAND, v, brick_entries)
+	op.Size = 100
+	err = op.Record(app.db, PENDING_STEP_PLANNED)
+	tests.Assert(t, err == nil)
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.Size == 200)
+		tests.Assert(t, len(entry.Bricks) == bricks*2)
+
+		for _, brick := range brick_entries {
+			_, err := NewBrickEntryFromId(tx, brick.Info.Id)
+			tests.Assert(t, err == ErrNotFound)
+
+			device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+			tests.Assert(t, err == nil)
+			for _, id := range device.Bricks {
+				tests.Assert(t, id != brick.Info.Id)
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestRecoverPendingDestroy(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Heketi stopped before GlusterFS destroyed the volume
+	app.xo.MockVolumeList = func(host string) ([]string, error) {
+		return []string{v.Info.Name}, nil
+	}
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_DESTROY, v, nil)
+	err = op.Record(app.db, PENDING_STEP_PLANNED)
+	tests.Assert(t, err == nil)
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// Heketi stopped after GlusterFS destroyed the volume
+	err = op.Record(app.db, PENDING_STEP_VOLUME_DESTROYED)
+	tests.Assert(t, err == nil)
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+	assertNoVolumes(t, app)
+}
+
+func TestRecoverPendingReplace(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	bricks := len(v.Bricks)
+
+	var oldBrick *BrickEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		oldBrick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// Replacement interrupted after GlusterFS took the new brick
+	newBrick, err := v.allocReplacementBrick(app.db, app.allocator,
+		oldBrick, map[string]bool{})
+	tests.Assert(t, err == nil)
+	err = CreateBricks(app.db, app.executor, []*BrickEntry{newBrick})
+	tests.Assert(t, err == nil)
+	op := NewPendingOperationEntryForVolume(PENDING_BRICK_REPLACE, v,
+		[]*BrickEntry{newBrick})
+	op.ReplacedBrickId = oldBrick.Info.Id
+	err = op.Record(app.db, PENDING_STEP_VOLUME_CREATED)
+	tests.Assert(t, err == nil)
+
+	destroyed := []string{}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed = append(destroyed, brick.Name)
+		return nil
+	}
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	// The old brick is removed from its node
+	tests.Assert(t, len(destroyed) == 1, destroyed)
+	tests.Assert(t, destroyed[0] == oldBrick.Info.Id, destroyed)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(entry.Bricks) == bricks)
+		tests.Assert(t, utils.SortedStringHas(entry.Bricks, newBrick.Info.Id))
+		tests.Assert(t, !utils.SortedStringHas(entry.Bricks, oldBrick.Info.Id))
+
+		_, err = NewBrickEntryFromId(tx, oldBrick.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+
+		device, err := NewDeviceEntryFromId(tx, oldBrick.Info.DeviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, !utils.SortedStringHas(device.Bricks, oldBrick.Info.Id))
+
+		list, err := BrickList(tx)
+		tests.Assert(t, len(list) == bricks)
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// Replacement interrupted before creating the new brick
+	err = app.db.View(func(tx *bolt.Tx) error {
+		v, err = NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		oldBrick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		return err
+	})
+	tests.Assert(t, err == nil)
+	newBrick, err = v.allocReplacementBrick(app.db, app.allocator,
+		oldBrick, map[string]bool{})
+	tests.Assert(t, err == nil)
+	op = NewPendingOperationEntryForVolume(PENDING_BRICK_REPLACE, v,
+		[]*BrickEntry{newBrick})
+	op.ReplacedBrickId = oldBrick.Info.Id
+	err = op.Record(app.db, PENDING_STEP_PLANNED)
+	tests.Assert(t, err == nil)
+
+	err = RecoverPendingOperations(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(pendingOperations(t, app)) == 0)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.State == api.VolumeStateOnline)
+		tests.Assert(t, utils.SortedStringHas(entry.Bricks, oldBrick.Info.Id))
+		tests.Assert(t, !utils.SortedStringHas(entry.Bricks, newBrick.Info.Id))
+
+		device, err := NewDeviceEntryFromId(tx, newBrick.Info.DeviceId)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, !utils.SortedStringHas(device.Bricks, newBrick.Info.Id))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
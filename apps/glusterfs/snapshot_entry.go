@@ -0,0 +1,498 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"regexp"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+var (
+	// Names and descriptions are passed to the gluster cli through
+	// a shell, so only characters without a meaning to it are allowed
+	snapshotNameRegex        = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	snapshotDescriptionRegex = regexp.MustCompile(`^[A-Za-z0-9_.,:+= -]*$`)
+)
+
+// Checks a snapshot or clone name can be passed to the gluster cli
+func ValidateSnapshotName(name string) error {
+	if !snapshotNameRegex.MatchString(name) {
+		return fmt.Errorf("Invalid name '%v'", name)
+	}
+	return nil
+}
+
+// Checks a snapshot description can be passed to the gluster cli
+func ValidateSnapshotDescription(description string) error {
+	if !snapshotDescriptionRegex.MatchString(description) {
+		return fmt.Errorf("Invalid description '%v'", description)
+	}
+	return nil
+}
+
+type SnapshotEntry struct {
+	Info api.SnapshotInfo
+}
+
+func SnapshotList(tx *bolt.Tx) ([]string, error) {
+
+	list := EntryKeys(tx, BOLTDB_BUCKET_SNAPSHOT)
+	if list == nil {
+		return nil, ErrAccessList
+	}
+	return list, nil
+}
+
+func NewSnapshotEntry() *SnapshotEntry {
+	return &SnapshotEntry{}
+}
+
+func NewSnapshotEntryFromRequest(volumeId string,
+	req *api.SnapshotCreateRequest) *SnapshotEntry {
+
+	godbc.Require(req != nil)
+	godbc.Require(volumeId != "")
+
+	snapshot := NewSnapshotEntry()
+	snapshot.Info.Id = utils.GenUUID()
+	snapshot.Info.VolumeId = volumeId
+	snapshot.Info.Description = req.Description
+
+	// Set default name
+	if req.Name == "" {
+		snapshot.Info.Name = "snap_" + snapshot.Info.Id
+	} else {
+		snapshot.Info.Name = req.Name
+	}
+
+	return snapshot
+}
+
+func NewSnapshotEntryFromId(tx *bolt.Tx, id string) (*SnapshotEntry, error) {
+	godbc.Require(tx != nil)
+
+	entry := NewSnapshotEntry()
+	err := EntryLoad(tx, entry, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *SnapshotEntry) BucketName() string {
+	return BOLTDB_BUCKET_SNAPSHOT
+}
+
+func (s *SnapshotEntry) Save(tx *bolt.Tx) error {
+	godbc.Require(tx != nil)
+	godbc.Require(len(s.Info.Id) > 0)
+
+	return EntrySave(tx, s, s.Info.Id)
+}
+
+func (s *SnapshotEntry) Delete(tx *bolt.Tx) error {
+	return EntryDelete(tx, s, s.Info.Id)
+}
+
+func (s *SnapshotEntry) NewInfoResponse(tx *bolt.Tx) (*api.SnapshotInfoResponse, error) {
+	godbc.Require(tx != nil)
+
+	info := &api.SnapshotInfoResponse{}
+	info.SnapshotInfo = s.Info
+
+	return info, nil
+}
+
+func (s *SnapshotEntry) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	err := enc.Encode(*s)
+
+	return buffer.Bytes(), err
+}
+
+func (s *SnapshotEntry) Unmarshal(buffer []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(buffer))
+	err := dec.Decode(s)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns the executor request for this snapshot together with the
+// host used to send the gluster commands
+func (s *SnapshotEntry) snapshotRequest(db *bolt.DB) (*executors.SnapshotRequest, string, error) {
+	godbc.Require(db != nil)
+
+	req := &executors.SnapshotRequest{}
+	var host string
+	err := db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, s.Info.VolumeId)
+		if err != nil {
+			return err
+		}
+
+		host, err = volume.manageHostName(tx)
+		if err != nil {
+			return err
+		}
+
+		req.Name = s.Info.Name
+		req.Volume = volume.Info.Name
+		req.Description = s.Info.Description
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return req, host, nil
+}
+
+func (s *SnapshotEntry) Create(db *bolt.DB, executor executors.Executor) (e error) {
+	godbc.Require(db != nil)
+
+	req, host, err := s.snapshotRequest(db)
+	if err != nil {
+		return err
+	}
+
+	// Create the snapshot
+	logger.Info("Creating snapshot %v of volume %v", s.Info.Name, req.Volume)
+	_, err = executor.SnapshotCreate(host, req)
+	if err != nil {
+		return err
+	}
+
+	// Delete the snapshot on failure
+	defer func() {
+		if e != nil {
+			executor.SnapshotDelete(host, s.Info.Name)
+		}
+	}()
+
+	// Save information on db
+	return db.Update(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromId(tx, s.Info.VolumeId)
+		if err != nil {
+			return err
+		}
+
+		volume.SnapshotAdd(s.Info.Id)
+		err = volume.Save(tx)
+		if err != nil {
+			return err
+		}
+
+		return s.Save(tx)
+	})
+}
+
+func (s *SnapshotEntry) Destroy(db *bolt.DB, executor executors.Executor) error {
+	godbc.Require(db != nil)
+
+	_, host, err := s.snapshotRequest(db)
+	if err != nil {
+		return err
+	}
+
+	// Delete the snapshot
+	logger.Info("Deleting snapshot %v", s.Info.Name)
+	err = executor.SnapshotDelete(host, s.Info.Name)
+	if err != nil {
+		return err
+	}
+
+	return s.removeFromDb(db)
+}
+
+func (s *SnapshotEntry) Restore(db *bolt.DB, executor executors.Executor) error {
+	godbc.Require(db != nil)
+
+	req, host, err := s.snapshotRequest(db)
+	if err != nil {
+		return err
+	}
+
+	// GlusterFS replaces the bricks of the volume with the LVs of the
+	// snapshot.  Bricks keep their order, so reading them before and
+	// after the restore tells where each brick moved.
+	before, err := executor.VolumeInfo(host, req.Volume)
+	if err != nil {
+		return err
+	}
+
+	// Restore the volume from the snapshot
+	logger.Info("Restoring volume %v from snapshot %v", req.Volume, s.Info.Name)
+	err = executor.SnapshotRestore(host, req)
+	if err != nil {
+		return err
+	}
+
+	// GlusterFS removes a snapshot once it has been restored
+	after, err := executor.VolumeInfo(host, req.Volume)
+	if err == nil {
+		err = db.Update(func(tx *bolt.Tx) error {
+			err := s.restoreBricks(tx, before.Bricks, after.Bricks)
+			if err != nil {
+				return err
+			}
+			return s.removeFromTx(tx)
+		})
+	}
+	if err != nil {
+		s.removeFromDb(db)
+		return logger.Err(fmt.Errorf("Restored snapshot %v, but unable to "+
+			"update the bricks of volume %v: %v", s.Info.Name, req.Volume, err))
+	}
+
+	return nil
+}
+
+// Updates the paths of the bricks of the volume after a restore
+func (s *SnapshotEntry) restoreBricks(tx *bolt.Tx,
+	before, after []executors.BrickInfo) error {
+
+	if len(before) != len(after) {
+		return fmt.Errorf("Volume of snapshot %v had %v bricks before the "+
+			"restore, but has %v", s.Info.Name, len(before), len(after))
+	}
+
+	paths := make(map[executors.BrickInfo]string)
+	for i, brick := range before {
+		paths[brick] = after[i].Path
+	}
+
+	volume, err := NewVolumeEntryFromId(tx, s.Info.VolumeId)
+	if err != nil {
+		return err
+	}
+	for _, id := range volume.BricksIds() {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return err
+		}
+
+		path, ok := paths[executors.BrickInfo{
+			Host: node.StorageHostName(),
+			Path: brick.Info.Path,
+		}]
+		if !ok || path == brick.Info.Path {
+			continue
+		}
+
+		logger.Info("Brick %v moved from %v to %v", brick.Info.Id,
+			brick.Info.Path, path)
+		brick.Info.Path = path
+		err = brick.Save(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates a new volume from the snapshot.  The bricks of the new volume
+// live in the thin pools of the bricks of the snapshot's volume.
+func (s *SnapshotEntry) Clone(db *bolt.DB,
+	executor executors.Executor,
+	name string) (_ *VolumeEntry, e error) {
+
+	godbc.Require(db != nil)
+
+	clone := NewVolumeEntry()
+	clone.Info.Id = utils.GenUUID()
+	if name == "" {
+		clone.Info.Name = "vol_" + clone.Info.Id
+	} else {
+		clone.Info.Name = name
+	}
+	clone.Info.State = api.VolumeStateOnline
+
+	// Gather the bricks of the volume the snapshot was taken from
+	var (
+		origin        *VolumeEntry
+		origin_bricks []*BrickEntry
+		host          string
+	)
+	req := &executors.SnapshotCloneRequest{}
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		origin, err = NewVolumeEntryFromId(tx, s.Info.VolumeId)
+		if err != nil {
+			return err
+		}
+
+		host, err = origin.manageHostName(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range origin.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			if err != nil {
+				return err
+			}
+
+			origin_bricks = append(origin_bricks, brick)
+			req.Bricks = append(req.Bricks, executors.BrickInfo{
+				Host: node.StorageHostName(),
+				Path: brick.Info.Path,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req.Volume = clone.Info.Name
+	req.Snapshot = s.Info.Name
+	req.Origin = origin.Info.Name
+
+	// Clone the snapshot
+	logger.Info("Cloning snapshot %v to volume %v", s.Info.Name, clone.Info.Name)
+	info, err := executor.SnapshotClone(host, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Destroy the clone on failure
+	var brick_entries []*BrickEntry
+	defer func() {
+		if e != nil {
+			executor.VolumeDestroy(host, clone.Info.Name)
+			DestroyBricks(db, executor, brick_entries)
+		}
+	}()
+
+	if len(info.Bricks) != len(origin_bricks) {
+		return nil, fmt.Errorf("Clone %v has %v bricks, but volume %v has %v",
+			clone.Info.Name, len(info.Bricks), origin.Info.Name, len(origin_bricks))
+	}
+
+	// Create the brick entries of the clone
+	for i, brick := range origin_bricks {
+		entry := brick.NewCloneBrickEntry(info.Bricks[i].Path)
+		brick_entries = append(brick_entries, entry)
+		clone.BrickAdd(entry.Info.Id)
+	}
+
+	// The clone has the same layout as the origin volume
+	clone.Info.Cluster = origin.Info.Cluster
+	clone.Info.Size = origin.Info.Size
+	clone.Info.Durability = origin.Info.Durability
+	clone.Info.Snapshot = origin.Info.Snapshot
+	clone.Info.Options = origin.Info.Options
+	clone.Durability = origin.Durability
+
+	vr, _, err := clone.createVolumeRequest(db, brick_entries)
+	if err != nil {
+		return nil, err
+	}
+	clone.setMountInfo(vr)
+
+	// Save information on db
+	err = db.Update(func(tx *bolt.Tx) error {
+
+		// Save brick entries
+		for _, brick := range brick_entries {
+			device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			device.BrickAdd(brick.Info.Id)
+			err = device.Save(tx)
+			if err != nil {
+				return err
+			}
+
+			err = brick.Save(tx)
+			if err != nil {
+				return err
+			}
+
+			err = brick.poolCloneAdd(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Save volume information
+		err := clone.Save(tx)
+		if err != nil {
+			return err
+		}
+
+		// Save cluster
+		cluster, err := NewClusterEntryFromId(tx, clone.Info.Cluster)
+		if err != nil {
+			return err
+		}
+		cluster.VolumeAdd(clone.Info.Id)
+		return cluster.Save(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
+
+func (s *SnapshotEntry) removeFromDb(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return s.removeFromTx(tx)
+	})
+}
+
+func (s *SnapshotEntry) removeFromTx(tx *bolt.Tx) error {
+	volume, err := NewVolumeEntryFromId(tx, s.Info.VolumeId)
+	if err != nil {
+		return err
+	}
+
+	volume.SnapshotDelete(s.Info.Id)
+	err = volume.Save(tx)
+	if err != nil {
+		return err
+	}
+
+	return s.Delete(tx)
+}
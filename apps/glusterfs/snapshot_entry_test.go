@@ -0,0 +1,567 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func createSampleSnapshotVolume(t *testing.T, app *App) *VolumeEntry {
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	return v
+}
+
+func TestNewSnapshotEntryFromRequest(t *testing.T) {
+	req := &api.SnapshotCreateRequest{}
+	req.Description = "mydesc"
+
+	s := NewSnapshotEntryFromRequest("volid", req)
+	tests.Assert(t, s.Info.Id != "")
+	tests.Assert(t, s.Info.Name == "snap_"+s.Info.Id)
+	tests.Assert(t, s.Info.VolumeId == "volid")
+	tests.Assert(t, s.Info.Description == "mydesc")
+
+	req.Name = "mysnap"
+	s = NewSnapshotEntryFromRequest("volid", req)
+	tests.Assert(t, s.Info.Name == "mysnap")
+}
+
+func TestValidateSnapshotNameAndDescription(t *testing.T) {
+	for _, name := range []string{"snap", "snap_1", "snap-1.0"} {
+		tests.Assert(t, ValidateSnapshotName(name) == nil, name)
+	}
+	for _, name := range []string{"", "my snap", "$(id)", "`id`",
+		"a;id", "a/b", "a'b", "a\\b", "a\nb"} {
+		tests.Assert(t, ValidateSnapshotName(name) != nil, name)
+	}
+
+	for _, desc := range []string{"", "Before upgrade, take 2: v1.0-rc"} {
+		tests.Assert(t, ValidateSnapshotDescription(desc) == nil, desc)
+	}
+	for _, desc := range []string{"$(id)", "`id`", "it's", "a\" b",
+		"a;id", "a\\b", "a|b", "a&b", "a>b", "a\nb"} {
+		tests.Assert(t, ValidateSnapshotDescription(desc) != nil, desc)
+	}
+}
+
+func TestNewSnapshotEntryMarshal(t *testing.T) {
+	req := &api.SnapshotCreateRequest{}
+	req.Name = "mysnap"
+	s := NewSnapshotEntryFromRequest("volid", req)
+
+	buffer, err := s.Marshal()
+	tests.Assert(t, err == nil)
+	tests.Assert(t, buffer != nil)
+	tests.Assert(t, len(buffer) > 0)
+
+	um := &SnapshotEntry{}
+	err = um.Unmarshal(buffer)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(s, um))
+}
+
+func TestSnapshotEntryFromIdNotFound(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Test for ID not found
+	err := app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewSnapshotEntryFromId(tx, "123")
+		return err
+	})
+	tests.Assert(t, err == ErrNotFound)
+}
+
+func TestSnapshotEntryCreateDestroy(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	// Check the request sent to the executor
+	app.xo.MockSnapshotCreate = func(host string,
+		snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error) {
+		tests.Assert(t, snapshot.Name == "mysnap")
+		tests.Assert(t, snapshot.Volume == v.Info.Name)
+		tests.Assert(t, snapshot.Description == "mydesc")
+		return &executors.SnapshotInfo{}, nil
+	}
+
+	req := &api.SnapshotCreateRequest{}
+	req.Name = "mysnap"
+	req.Description = "mydesc"
+	s := NewSnapshotEntryFromRequest(v.Info.Id, req)
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Check db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, reflect.DeepEqual(entry, s))
+
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(volume.Snapshots) == 1)
+		tests.Assert(t, volume.Snapshots[0] == s.Info.Id)
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Destroy
+	err = s.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(volume.Snapshots) == 0)
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestSnapshotEntryCreateFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	// Fail the snapshot creation
+	mockerror := errors.New("MOCK")
+	app.xo.MockSnapshotCreate = func(host string,
+		snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error) {
+		return nil, mockerror
+	}
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == mockerror)
+
+	// Check nothing was saved
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(volume.Snapshots) == 0)
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestSnapshotEntryRestore(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Fail the restore first
+	mockerror := errors.New("MOCK")
+	app.xo.MockSnapshotRestore = func(host string,
+		snapshot *executors.SnapshotRequest) error {
+		return mockerror
+	}
+	err = s.Restore(app.db, app.executor)
+	tests.Assert(t, err == mockerror)
+
+	// Snapshot must still be there
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// Now restore
+	app.xo.MockSnapshotRestore = func(host string,
+		snapshot *executors.SnapshotRequest) error {
+		tests.Assert(t, snapshot.Name == s.Info.Name)
+		tests.Assert(t, snapshot.Volume == v.Info.Name)
+		return nil
+	}
+	err = s.Restore(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// The snapshot is consumed by the restore
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+
+		volume, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(volume.Snapshots) == 0)
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestSnapshotEntryRestoreBricks(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Bricks as GlusterFS reports them
+	var bricks []executors.BrickInfo
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range v.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			brick.Info.Path = "/bricks/" + id
+			tests.Assert(t, brick.Save(tx) == nil)
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			tests.Assert(t, err == nil)
+			bricks = append(bricks, executors.BrickInfo{
+				Host: node.StorageHostName(),
+				Path: brick.Info.Path,
+			})
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(bricks) > 0)
+
+	// The restore moves the bricks to the LVs of the snapshot
+	restored := false
+	app.xo.MockSnapshotRestore = func(host string,
+		snapshot *executors.SnapshotRequest) error {
+		restored = true
+		return nil
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		info := &executors.VolumeInfo{Name: volume}
+		for i, brick := range bricks {
+			if restored {
+				brick.Path = fmt.Sprintf("/run/gluster/snaps/s/brick%v/brick", i)
+			}
+			info.Bricks = append(info.Bricks, brick)
+		}
+		return info, nil
+	}
+
+	err = s.Restore(app.db, app.executor)
+	tests.Assert(t, err == nil, err)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		paths := make(map[string]bool)
+		for _, id := range v.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, strings.HasPrefix(brick.Info.Path, "/run/gluster/snaps/s/"),
+				brick.Info.Path)
+			paths[brick.Info.Path] = true
+		}
+		tests.Assert(t, len(paths) == len(bricks))
+
+		_, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// The snapshot is removed even when the bricks cannot be read
+	s = NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err = s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		if restored {
+			return nil, errors.New("MOCK")
+		}
+		return &executors.VolumeInfo{Name: volume}, nil
+	}
+	restored = false
+	err = s.Restore(app.db, app.executor)
+	tests.Assert(t, err != nil)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewSnapshotEntryFromId(tx, s.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestSnapshotEntryClone(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Get the storage used before cloning
+	usedStorage := func() uint64 {
+		var used uint64
+		err := app.db.View(func(tx *bolt.Tx) error {
+			devices, err := DeviceList(tx)
+			if err != nil {
+				return err
+			}
+			for _, id := range devices {
+				device, err := NewDeviceEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				used += device.Info.Storage.Used
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil)
+		return used
+	}
+	used := usedStorage()
+
+	// Check the request sent to the executor
+	app.xo.MockSnapshotClone = func(host string,
+		clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error) {
+		tests.Assert(t, clone.Volume == "devcopy")
+		tests.Assert(t, clone.Snapshot == s.Info.Name)
+		tests.Assert(t, clone.Origin == v.Info.Name)
+		tests.Assert(t, len(clone.Bricks) == len(v.Bricks))
+
+		info := &executors.SnapshotCloneInfo{}
+		for _, brick := range clone.Bricks {
+			info.Bricks = append(info.Bricks, executors.BrickInfo{
+				Host: brick.Host,
+				Path: "/clone" + brick.Path,
+			})
+		}
+		return info, nil
+	}
+
+	clone, err := s.Clone(app.db, app.executor, "devcopy")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, clone.Info.Name == "devcopy")
+	tests.Assert(t, clone.Info.Cluster == v.Info.Cluster)
+	tests.Assert(t, clone.Info.Size == v.Info.Size)
+	tests.Assert(t, len(clone.Bricks) == len(v.Bricks))
+	tests.Assert(t, clone.Info.Mount.GlusterFS.MountPoint != "")
+
+	// Clones do not use more storage
+	tests.Assert(t, used == usedStorage())
+
+	// Check the bricks share the thin pools of the origin bricks
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, clone.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, reflect.DeepEqual(entry.Bricks, clone.Bricks))
+
+		for _, id := range entry.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			tests.Assert(t, brick.TotalSize() == 0)
+
+			origin, err := NewBrickEntryFromId(tx, brick.PoolId)
+			if err != nil {
+				return err
+			}
+			tests.Assert(t, utils.SortedStringHas(v.Bricks, origin.Info.Id))
+			tests.Assert(t, utils.SortedStringHas(origin.Clones, brick.Info.Id))
+			tests.Assert(t, brick.Info.Path == "/clone"+origin.Info.Path)
+			tests.Assert(t, brick.Info.DeviceId == origin.Info.DeviceId)
+
+			device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			tests.Assert(t, utils.SortedStringHas(device.Bricks, brick.Info.Id))
+		}
+
+		cluster, err := NewClusterEntryFromId(tx, clone.Info.Cluster)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, utils.SortedStringHas(cluster.Info.Volumes, clone.Info.Id))
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// The origin volume cannot be deleted while the clone exists
+	err = s.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = NewVolumeEntryFromId(tx, v.Info.Id)
+		return err
+	})
+	tests.Assert(t, err == nil)
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err != nil)
+
+	// Delete the clone
+	var poolIds []string
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		tests.Assert(t, brick.PoolId != "")
+		tests.Assert(t, brick.Path != "")
+		poolIds = append(poolIds, brick.PoolId)
+		return nil
+	}
+	err = clone.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(poolIds) == len(v.Bricks))
+	tests.Assert(t, used == usedStorage())
+
+	// The origin bricks no longer have clones
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range v.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, len(brick.Clones) == 0, brick.Clones)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Now the origin can be deleted
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		return nil
+	}
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, usedStorage() == 0)
+}
+
+func TestSnapshotEntryCloneFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	v := createSampleSnapshotVolume(t, app)
+
+	s := NewSnapshotEntryFromRequest(v.Info.Id, &api.SnapshotCreateRequest{})
+	err := s.Create(app.db, app.executor)
+	tests.Assert(t, err == nil)
+
+	// Return less bricks than requested
+	app.xo.MockSnapshotClone = func(host string,
+		clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error) {
+		return &executors.SnapshotCloneInfo{
+			Bricks: clone.Bricks[1:],
+		}, nil
+	}
+	destroyed := ""
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		destroyed = volume
+		return nil
+	}
+
+	clone, err := s.Clone(app.db, app.executor, "devcopy")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, clone == nil)
+	tests.Assert(t, destroyed == "devcopy")
+
+	// Check nothing was saved
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volumes, err := VolumeList(tx)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(volumes) == 1)
+
+		bricks, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, len(bricks) == len(v.Bricks))
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
@@ -23,6 +23,7 @@ import (
 type VolumeDurability interface {
 	BrickSizeGenerator(size uint64) func() (int, uint64, error)
 	BricksInSet() int
+	BrickInSet(index int, brickSize uint64) (uint64, bool)
 	SetDurability()
 	SetExecutorVolumeRequest(v *executors.VolumeRequest)
 }
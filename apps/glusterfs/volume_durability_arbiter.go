@@ -0,0 +1,74 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"github.com/heketi/heketi/executors"
+)
+
+var (
+	// Expected average size of the files on arbiter volumes.  Arbiter
+	// bricks only hold metadata, about 4KB for each file on the volume.
+	ArbiterAverageFileSize = uint64(64 * KB)
+	ArbiterBrickMinSize    = uint64(1 * GB)
+)
+
+const (
+	// The last brick of each set is the arbiter
+	arbiterBrickIndex = 2
+)
+
+// Replica 3 with two bricks holding the data and the third
+// only holding metadata
+type VolumeArbiterDurability struct {
+	VolumeReplicaDurability
+}
+
+func NewVolumeArbiterDurability() *VolumeArbiterDurability {
+	a := &VolumeArbiterDurability{}
+	a.Replica = 3
+
+	return a
+}
+
+func (a *VolumeArbiterDurability) SetDurability() {
+	a.Replica = 3
+}
+
+// The data bricks use the sizes of the replica generator, and
+// the arbiter brick only needs enough space for the metadata
+// of the files which fit in a data brick
+func (a *VolumeArbiterDurability) BrickInSet(index int, brickSize uint64) (uint64, bool) {
+	if index != arbiterBrickIndex {
+		return brickSize, false
+	}
+
+	size := brickSize / ArbiterAverageFileSize * 4 * KB
+	if size < ArbiterBrickMinSize {
+		size = ArbiterBrickMinSize
+	}
+	if size > brickSize {
+		size = brickSize
+	}
+
+	return size, true
+}
+
+func (a *VolumeArbiterDurability) SetExecutorVolumeRequest(v *executors.VolumeRequest) {
+	v.Type = executors.DurabilityArbiter
+	v.Replica = a.Replica
+}
@@ -72,6 +72,10 @@ func (d *VolumeDisperseDurability) BricksInSet() int {
 	return d.Data + d.Redundancy
 }
 
+func (d *VolumeDisperseDurability) BrickInSet(index int, brickSize uint64) (uint64, bool) {
+	return brickSize, false
+}
+
 func (d *VolumeDisperseDurability) SetExecutorVolumeRequest(v *executors.VolumeRequest) {
 	v.Type = executors.DurabilityDispersion
 	v.Data = d.Data
@@ -39,6 +39,10 @@ func (n *NoneDurability) BricksInSet() int {
 	return 1
 }
 
+func (n *NoneDurability) BrickInSet(index int, brickSize uint64) (uint64, bool) {
+	return brickSize, false
+}
+
 func (n *NoneDurability) SetExecutorVolumeRequest(v *executors.VolumeRequest) {
 	v.Type = executors.DurabilityNone
 	v.Replica = n.Replica
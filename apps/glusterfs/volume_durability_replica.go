@@ -64,6 +64,10 @@ func (r *VolumeReplicaDurability) BricksInSet() int {
 	return r.Replica
 }
 
+func (r *VolumeReplicaDurability) BrickInSet(index int, brickSize uint64) (uint64, bool) {
+	return brickSize, false
+}
+
 func (r *VolumeReplicaDurability) SetExecutorVolumeRequest(v *executors.VolumeRequest) {
 	v.Type = executors.DurabilityReplica
 	v.Replica = r.Replica
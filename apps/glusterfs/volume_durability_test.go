@@ -220,3 +220,53 @@ func TestReplicaDurabilityLargeBrickGenerator(t *testing.T) {
 	tests.Assert(t, brick_size == 3200*GB)
 	tests.Assert(t, 2 == r.BricksInSet())
 }
+
+func TestArbiterDurabilityDefaults(t *testing.T) {
+	r := &VolumeArbiterDurability{}
+	tests.Assert(t, r.Replica == 0)
+
+	r.SetDurability()
+	tests.Assert(t, r.Replica == 3)
+	tests.Assert(t, 3 == r.BricksInSet())
+}
+
+func TestArbiterDurabilitySetExecutorRequest(t *testing.T) {
+	r := NewVolumeArbiterDurability()
+	r.SetDurability()
+
+	v := &executors.VolumeRequest{}
+	r.SetExecutorVolumeRequest(v)
+	tests.Assert(t, v.Replica == 3)
+	tests.Assert(t, v.Type == executors.DurabilityArbiter)
+}
+
+func TestArbiterDurabilityBrickInSet(t *testing.T) {
+	r := NewVolumeArbiterDurability()
+
+	// Data bricks
+	for i := 0; i < 2; i++ {
+		size, arbiter := r.BrickInSet(i, 100*GB)
+		tests.Assert(t, size == 100*GB)
+		tests.Assert(t, !arbiter)
+	}
+
+	// Metadata for the files of the data brick
+	size, arbiter := r.BrickInSet(2, 100*GB)
+	tests.Assert(t, size == 100*GB/16, size)
+	tests.Assert(t, arbiter)
+
+	// Small bricks use the minimum arbiter size
+	size, arbiter = r.BrickInSet(2, 8*GB)
+	tests.Assert(t, size == ArbiterBrickMinSize)
+	tests.Assert(t, arbiter)
+
+	// Never larger than the data bricks
+	size, arbiter = r.BrickInSet(2, 512*MB)
+	tests.Assert(t, size == 512*MB)
+	tests.Assert(t, arbiter)
+
+	// Other durabilities use the same size for all the bricks
+	size, arbiter = (&VolumeReplicaDurability{}).BrickInSet(2, 100*GB)
+	tests.Assert(t, size == 100*GB)
+	tests.Assert(t, !arbiter)
+}
@@ -47,7 +47,12 @@ const (
 type VolumeEntry struct {
 	Info       api.VolumeInfo
 	Bricks     sort.StringSlice
+	Snapshots  sort.StringSlice
 	Durability VolumeDurability
+	Quota      VolumeQuota
+
+	// Geo-replication sessions from or to the volume
+	GeoReplications sort.StringSlice
 }
 
 func VolumeList(tx *bolt.Tx) ([]string, error) {
@@ -59,13 +64,42 @@ func VolumeList(tx *bolt.Tx) ([]string, error) {
 	return list, nil
 }
 
+// Marks the volumes saved before states were kept as online, and
+// the volumes heketi stopped shrinking.  GlusterFS keeps serving
+// those while the shrink is not journaled.
+func upgradeVolumeStates(tx *bolt.Tx) error {
+	volumes, err := VolumeList(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range volumes {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		if volume.Info.State == "" ||
+			volume.Info.State == api.VolumeStateShrinking {
+			volume.Info.State = api.VolumeStateOnline
+			err = volume.Save(tx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func NewVolumeEntry() *VolumeEntry {
 	entry := &VolumeEntry{}
 	entry.Bricks = make(sort.StringSlice, 0)
+	entry.Snapshots = make(sort.StringSlice, 0)
 
 	gob.Register(&NoneDurability{})
 	gob.Register(&VolumeReplicaDurability{})
 	gob.Register(&VolumeDisperseDurability{})
+	gob.Register(&VolumeArbiterDurability{})
 
 	return entry
 }
@@ -78,6 +112,7 @@ func NewVolumeEntryFromRequest(req *api.VolumeCreateRequest) *VolumeEntry {
 	vol.Info.Durability = req.Durability
 	vol.Info.Snapshot = req.Snapshot
 	vol.Info.Size = req.Size
+	vol.Info.Options = req.Options
 
 	// Set default durability values
 	durability := vol.Info.Durability.Type
@@ -96,6 +131,10 @@ func NewVolumeEntryFromRequest(req *api.VolumeCreateRequest) *VolumeEntry {
 			vol.Info.Durability.Disperse.Redundancy)
 		vol.Durability = NewVolumeDisperseDurability(&vol.Info.Durability.Disperse)
 
+	case durability == api.DurabilityArbiter:
+		logger.Debug("[%v] Replica 3 Arbiter 1", vol.Info.Id)
+		vol.Durability = NewVolumeArbiterDurability()
+
 	case durability == api.DurabilityDistributeOnly || durability == "":
 		logger.Debug("[%v] Distributed", vol.Info.Id)
 		vol.Durability = NewNoneDurability()
@@ -139,6 +178,28 @@ func NewVolumeEntryFromId(tx *bolt.Tx, id string) (*VolumeEntry, error) {
 	return entry, nil
 }
 
+// Returns the volume which uses the brick
+func NewVolumeEntryFromBrickId(tx *bolt.Tx, brickId string) (*VolumeEntry, error) {
+	godbc.Require(tx != nil)
+
+	volumes, err := VolumeList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range volumes {
+		volume, err := NewVolumeEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if utils.SortedStringHas(volume.Bricks, brickId) {
+			return volume, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
 func (v *VolumeEntry) BucketName() string {
 	return BOLTDB_BUCKET_VOLUME
 }
@@ -160,11 +221,13 @@ func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, err
 	info := api.NewVolumeInfoResponse()
 	info.Id = v.Info.Id
 	info.Cluster = v.Info.Cluster
+	info.State = v.Info.State
 	info.Mount = v.Info.Mount
 	info.Snapshot = v.Info.Snapshot
 	info.Size = v.Info.Size
 	info.Durability = v.Info.Durability
 	info.Name = v.Info.Name
+	info.Options = v.Info.Options
 
 	for _, brickid := range v.BricksIds() {
 		brick, err := NewBrickEntryFromId(tx, brickid)
@@ -182,6 +245,62 @@ func (v *VolumeEntry) NewInfoResponse(tx *bolt.Tx) (*api.VolumeInfoResponse, err
 	return info, nil
 }
 
+// Returns the state of the volume as reported by GlusterFS
+func (v *VolumeEntry) NewLiveInfo(db *bolt.DB,
+	executor executors.Executor) (*api.VolumeLiveInfo, error) {
+
+	godbc.Require(db != nil)
+
+	var (
+		host   string
+		bricks map[executors.BrickInfo]*BrickEntry
+	)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		host, err = v.manageHostName(tx)
+		if err != nil {
+			return err
+		}
+
+		bricks, err = v.brickEntriesByHostPath(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	volInfo, err := executor.VolumeInfo(host, v.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &api.VolumeLiveInfo{
+		Type:    volInfo.Type,
+		Status:  volInfo.Status,
+		Bricks:  make([]api.VolumeLiveBrick, 0, len(volInfo.Bricks)),
+		Options: volInfo.Options,
+	}
+	if info.Options == nil {
+		info.Options = make(map[string]string)
+	}
+	for _, b := range volInfo.Bricks {
+		status := volInfo.BrickStatus[b]
+		brickInfo := api.VolumeLiveBrick{
+			Host:   b.Host,
+			Path:   b.Path,
+			Online: status.Online,
+			Port:   status.Port,
+		}
+		if brick, ok := bricks[b]; ok {
+			brickInfo.Id = brick.Info.Id
+		}
+
+		info.Bricks = append(info.Bricks, brickInfo)
+	}
+
+	return info, nil
+}
+
 func (v *VolumeEntry) Marshal() ([]byte, error) {
 	var buffer bytes.Buffer
 	enc := gob.NewEncoder(&buffer)
@@ -201,6 +320,9 @@ func (v *VolumeEntry) Unmarshal(buffer []byte) error {
 	if v.Bricks == nil {
 		v.Bricks = make(sort.StringSlice, 0)
 	}
+	if v.Snapshots == nil {
+		v.Snapshots = make(sort.StringSlice, 0)
+	}
 
 	return nil
 }
@@ -216,14 +338,93 @@ func (v *VolumeEntry) BrickDelete(id string) {
 	v.Bricks = utils.SortedStringsDelete(v.Bricks, id)
 }
 
+func (v *VolumeEntry) SnapshotAdd(id string) {
+	godbc.Require(!utils.SortedStringHas(v.Snapshots, id))
+
+	v.Snapshots = append(v.Snapshots, id)
+	v.Snapshots.Sort()
+}
+
+func (v *VolumeEntry) SnapshotDelete(id string) {
+	v.Snapshots = utils.SortedStringsDelete(v.Snapshots, id)
+}
+
+func (v *VolumeEntry) GeoReplicationAdd(id string) {
+	godbc.Require(!utils.SortedStringHas(v.GeoReplications, id))
+
+	v.GeoReplications = append(v.GeoReplications, id)
+	v.GeoReplications.Sort()
+}
+
+func (v *VolumeEntry) GeoReplicationDelete(id string) {
+	v.GeoReplications = utils.SortedStringsDelete(v.GeoReplications, id)
+}
+
+// Returns the brick entries of the volume by the storage hostname
+// and path GlusterFS knows them by
+func (v *VolumeEntry) brickEntriesByHostPath(tx *bolt.Tx) (map[executors.BrickInfo]*BrickEntry, error) {
+	godbc.Require(tx != nil)
+
+	bricks := make(map[executors.BrickInfo]*BrickEntry)
+	for _, id := range v.Bricks {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		bricks[executors.BrickInfo{
+			Host: node.StorageHostName(),
+			Path: brick.Info.Path,
+		}] = brick
+	}
+
+	return bricks, nil
+}
+
+// Returns the management hostname of the node holding the first
+// brick of the volume.  It is used to send volume commands.
+func (v *VolumeEntry) manageHostName(tx *bolt.Tx) (string, error) {
+	godbc.Require(tx != nil)
+
+	if len(v.Bricks) == 0 {
+		return "", fmt.Errorf("Volume %v has no bricks", v.Info.Id)
+	}
+
+	brick, err := NewBrickEntryFromId(tx, v.Bricks[0])
+	if err != nil {
+		return "", err
+	}
+
+	node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+	if err != nil {
+		return "", err
+	}
+
+	return node.ManageHostName(), nil
+}
+
 func (v *VolumeEntry) Create(db *bolt.DB,
 	executor executors.Executor,
 	allocator Allocator) (e error) {
 
+	// Set when the rollback is left to the recovery of the
+	// journaled operation
+	keepOp := false
+
 	// On any error, remove the volume
 	defer func() {
-		if e != nil {
+		if e != nil && !keepOp {
 			db.Update(func(tx *bolt.Tx) error {
+				if v.Info.Cluster != "" {
+					cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+					if err == nil {
+						cluster.VolumeDelete(v.Info.Id)
+						cluster.Save(tx)
+					}
+				}
 				v.Delete(tx)
 
 				return nil
@@ -308,9 +509,23 @@ func (v *VolumeEntry) Create(db *bolt.DB,
 		return ErrNoSpace
 	}
 
+	// Journal the operation so that it can be recovered if heketi
+	// stops before it completes.  Removed last on error, unless the
+	// bricks could not be destroyed and the rollback is left to the
+	// recovery of the operation.
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_CREATE, v, brick_entries)
+	defer func() {
+		if e != nil && !keepOp {
+			op.Remove(db)
+		}
+	}()
+
+	// Set once the volume and its bricks are gone from the db
+	destroyed := false
+
 	// Make sure to clean up bricks on error
 	defer func() {
-		if e != nil {
+		if e != nil && !keepOp && !destroyed {
 			db.Update(func(tx *bolt.Tx) error {
 				for _, brick := range brick_entries {
 					v.removeBrickFromDb(tx, brick)
@@ -320,19 +535,42 @@ func (v *VolumeEntry) Create(db *bolt.DB,
 		}
 	}()
 
+	// Make the volume visible while it is being created
+	v.Info.State = api.VolumeStateCreating
+	op.Step = PENDING_STEP_PLANNED
+	err := db.Update(func(tx *bolt.Tx) error {
+		err := v.saveCreated(tx, brick_entries)
+		if err != nil {
+			return err
+		}
+		return op.Save(tx)
+	})
+	if err != nil {
+		return err
+	}
+
 	// Create the bricks on the nodes
-	err := CreateBricks(db, executor, brick_entries)
+	err = CreateBricks(db, executor, brick_entries)
 	if err != nil {
+		if _, ok := err.(*BrickCleanupError); ok {
+			keepOp = true
+		}
 		return err
 	}
 
 	// Clean up created bricks on failure
 	defer func() {
-		if e != nil {
-			DestroyBricks(db, executor, brick_entries)
+		if e != nil && !destroyed {
+			keepOp = op.keepOnFailedDestroy(db,
+				DestroyBricks(db, executor, brick_entries))
 		}
 	}()
 
+	err = op.Record(db, PENDING_STEP_BRICKS_CREATED)
+	if err != nil {
+		return err
+	}
+
 	// Create GlusterFS volume
 	err = v.createVolume(db, executor, brick_entries)
 	if err != nil {
@@ -342,41 +580,85 @@ func (v *VolumeEntry) Create(db *bolt.DB,
 	// Destroy volume on failure
 	defer func() {
 		if e != nil {
-			v.Destroy(db, executor)
+			destroyed = v.Destroy(db, executor) == nil
 		}
 	}()
 
+	err = op.Record(db, PENDING_STEP_VOLUME_CREATED)
+	if err != nil {
+		return err
+	}
+
 	// Save information on db
+	v.Info.State = api.VolumeStateOnline
 	err = db.Update(func(tx *bolt.Tx) error {
-
-		// Save brick entries
-		for _, brick := range brick_entries {
-			err := brick.Save(tx)
-			if err != nil {
-				return err
-			}
-		}
-
-		// Save volume information
-		err = v.Save(tx)
+		err := v.saveCreated(tx, brick_entries)
 		if err != nil {
 			return err
 		}
+		return op.Delete(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// Saves a new volume with its bricks and adds it to its cluster
+func (v *VolumeEntry) saveCreated(tx *bolt.Tx, brick_entries []*BrickEntry) error {
 
-		// Save cluster
-		cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+	// Save brick entries
+	for _, brick := range brick_entries {
+		err := brick.Save(tx)
 		if err != nil {
 			return err
 		}
-		cluster.VolumeAdd(v.Info.Id)
-		return cluster.Save(tx)
-	})
+	}
+
+	// Save volume information
+	err := v.Save(tx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Save cluster
+	cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+	if err != nil {
+		return err
+	}
+	if !utils.SortedStringHas(cluster.Info.Volumes, v.Info.Id) {
+		cluster.VolumeAdd(v.Info.Id)
+	}
+	return cluster.Save(tx)
+}
+
+// Saves a volume together with the bricks it was expanded with
+func (v *VolumeEntry) saveExpanded(tx *bolt.Tx, brick_entries []*BrickEntry) error {
 
+	// Save brick entries
+	for _, brick := range brick_entries {
+		err := brick.Save(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return v.Save(tx)
+}
+
+// Updates the state of the volume, leaving the rest of
+// its entry in the db as is
+func (v *VolumeEntry) saveState(tx *bolt.Tx, state api.VolumeState) error {
+	v.Info.State = state
+
+	entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+	if err != nil {
+		return err
+	}
+	entry.Info.State = state
+	return entry.Save(tx)
 }
 
 func (v *VolumeEntry) Destroy(db *bolt.DB, executor executors.Executor) error {
@@ -421,38 +703,69 @@ func (v *VolumeEntry) Destroy(db *bolt.DB, executor executors.Executor) error {
 		return err
 	}
 
+	// Journal the operation so that it can be completed if heketi
+	// stops before it does
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_DESTROY, v, nil)
+	err = op.RecordState(db, PENDING_STEP_PLANNED, api.VolumeStateDeleting)
+	if err != nil {
+		return err
+	}
+
 	// :TODO: What if the host is no longer available, we may need to try others
 	// Stop volume
 	err = executor.VolumeDestroy(sshhost, v.Info.Name)
 	if err != nil {
 		logger.LogError("Unable to delete volume: %v", err)
+		db.Update(func(tx *bolt.Tx) error {
+			v.saveState(tx, api.VolumeStateOnline)
+			return op.Delete(tx)
+		})
 		return err
 	}
 
-	// Destroy bricks
-	err = DestroyBricks(db, executor, brick_entries)
+	// From here on the operation can only be rolled forward
+	err = op.Record(db, PENDING_STEP_VOLUME_DESTROYED)
+	if err == nil {
+		// Destroy bricks
+		err = DestroyBricks(db, executor, brick_entries)
+		if err != nil {
+			logger.LogError("Unable to delete bricks: %v", err)
+		}
+	}
 	if err != nil {
-		logger.LogError("Unable to delete bricks: %v", err)
+		db.Update(func(tx *bolt.Tx) error {
+			return v.saveState(tx, api.VolumeStateFailed)
+		})
 		return err
 	}
 
 	// Remove from entries from the db
 	err = db.Update(func(tx *bolt.Tx) error {
-		for _, brick := range brick_entries {
-			err = v.removeBrickFromDb(tx, brick)
-			if err != nil {
-				logger.Err(err)
-				// Everything is destroyed anyways, just keep deleting the others
-				// Do not return here
-			}
-		}
+		v.deleteFromDb(tx, brick_entries)
+		return op.Delete(tx)
+	})
+
+	return err
+}
 
-		// Remove volume from cluster
-		cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+// Removes the volume, its bricks, and their space on the devices
+// from the db
+func (v *VolumeEntry) deleteFromDb(tx *bolt.Tx, brick_entries []*BrickEntry) {
+	for _, brick := range brick_entries {
+		err := v.removeBrickFromDb(tx, brick)
 		if err != nil {
 			logger.Err(err)
-			// Do not return here.. keep going
+			// Everything is destroyed anyways, just keep deleting the others
+			// Do not return here
 		}
+	}
+
+	// Remove volume from cluster
+	cluster, err := NewClusterEntryFromId(tx, v.Info.Cluster)
+	if err != nil {
+		logger.Err(err)
+		// Do not return here.. keep going
+	} else {
 		cluster.VolumeDelete(v.Info.Id)
 
 		err = cluster.Save(tx)
@@ -460,14 +773,10 @@ func (v *VolumeEntry) Destroy(db *bolt.DB, executor executors.Executor) error {
 			logger.Err(err)
 			// Do not return here.. keep going
 		}
+	}
 
-		// Delete volume
-		v.Delete(tx)
-
-		return nil
-	})
-
-	return err
+	// Delete volume
+	v.Delete(tx)
 }
 
 func (v *VolumeEntry) Expand(db *bolt.DB,
@@ -481,9 +790,22 @@ func (v *VolumeEntry) Expand(db *bolt.DB,
 		return err
 	}
 
+	// Journal the operation so that it can be recovered if heketi
+	// stops before it completes.  Removed last on error, unless the
+	// bricks could not be destroyed and the rollback is left to the
+	// recovery of the operation.
+	op := NewPendingOperationEntryForVolume(PENDING_VOLUME_EXPAND, v, brick_entries)
+	op.Size = sizeGB
+	keepOp := false
+	defer func() {
+		if e != nil && !keepOp {
+			op.Remove(db)
+		}
+	}()
+
 	// Setup cleanup function
 	defer func() {
-		if e != nil {
+		if e != nil && !keepOp {
 			logger.Debug("Error detected, cleaning up")
 
 			// Remove from db
@@ -491,6 +813,7 @@ func (v *VolumeEntry) Expand(db *bolt.DB,
 				for _, brick := range brick_entries {
 					v.removeBrickFromDb(tx, brick)
 				}
+				v.Info.State = api.VolumeStateOnline
 				err := v.Save(tx)
 				godbc.Check(err == nil)
 
@@ -499,21 +822,35 @@ func (v *VolumeEntry) Expand(db *bolt.DB,
 		}
 	}()
 
+	err = op.RecordState(db, PENDING_STEP_PLANNED, api.VolumeStateExpanding)
+	if err != nil {
+		return err
+	}
+
 	// Create bricks
 	err = CreateBricks(db, executor, brick_entries)
 	if err != nil {
+		if _, ok := err.(*BrickCleanupError); ok {
+			keepOp = true
+		}
 		logger.Err(err)
 		return err
 	}
 
 	// Setup cleanup function
 	defer func() {
-		if e != nil {
+		if e != nil && !keepOp {
 			logger.Debug("Error detected, cleaning up")
-			DestroyBricks(db, executor, brick_entries)
+			keepOp = op.keepOnFailedDestroy(db,
+				DestroyBricks(db, executor, brick_entries))
 		}
 	}()
 
+	err = op.Record(db, PENDING_STEP_BRICKS_CREATED)
+	if err != nil {
+		return err
+	}
+
 	// Create a volume request to send to executor
 	// so that it can add the new bricks
 	vr, host, err := v.createVolumeRequest(db, brick_entries)
@@ -527,21 +864,29 @@ func (v *VolumeEntry) Expand(db *bolt.DB,
 		return err
 	}
 
+	// GlusterFS serves the new bricks now, so they are never rolled
+	// back.  The recovery completes the expansion if the db update
+	// below fails.
+	keepOp = true
+
 	// Increase the recorded volume size
 	v.Info.Size += sizeGB
 
+	// Record the expansion before updating the db
+	err = op.Record(db, PENDING_STEP_VOLUME_CREATED)
+	if err != nil {
+		v.Info.Size -= sizeGB
+		return err
+	}
+
 	// Save volume entry
+	v.Info.State = api.VolumeStateOnline
 	err = db.Update(func(tx *bolt.Tx) error {
-
-		// Save brick entries
-		for _, brick := range brick_entries {
-			err := brick.Save(tx)
-			if err != nil {
-				return err
-			}
+		err := v.saveExpanded(tx, brick_entries)
+		if err != nil {
+			return err
 		}
-
-		return v.Save(tx)
+		return op.Delete(tx)
 	})
 
 	return err
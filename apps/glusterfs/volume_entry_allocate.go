@@ -105,6 +105,9 @@ func (v *VolumeEntry) allocBricks(
 		// proposed bricks and devices are acceptable
 		setlist := make([]*BrickEntry, 0)
 
+		// Classes of the devices holding data bricks of the set
+		setClasses := make(map[string]bool)
+
 		// Generate an id for the brick
 		brickId := utils.GenUUID()
 
@@ -119,10 +122,43 @@ func (v *VolumeEntry) allocBricks(
 		for i := 0; i < v.Durability.BricksInSet(); i++ {
 			logger.Debug("%v / %v", i, v.Durability.BricksInSet())
 
+			size, arbiter := v.Durability.BrickInSet(i, brick_size)
+
 			// Do the work in the database context so that the cluster
 			// data does not change while determining brick location
 			err := db.Update(func(tx *bolt.Tx) error {
 
+				// Adds the brick on the device to the set
+				addBrick := func(device *DeviceEntry, brick *BrickEntry) error {
+
+					// If the first in the set, the reset the id
+					if i == 0 {
+						brick.SetId(brickId)
+					}
+
+					// Save the brick entry to create later
+					brick_entries = append(brick_entries, brick)
+
+					// Add to set list
+					setlist = append(setlist, brick)
+					if !arbiter {
+						setClasses[device.Info.Class] = true
+					}
+
+					// Add brick to device
+					device.BrickAdd(brick.Id())
+
+					// Add brick to volume
+					v.BrickAdd(brick.Id())
+
+					// Save values
+					return device.Save(tx)
+				}
+
+				// Device to use for an arbiter brick if none of
+				// another class has space
+				var fallbackId string
+
 				// Check the ring for devices to place the brick
 				for deviceId := range deviceCh {
 
@@ -146,35 +182,23 @@ func (v *VolumeEntry) allocBricks(
 					}
 
 					// Try to allocate a brick on this device
-					brick := device.NewBrickEntry(brick_size, float64(v.Info.Snapshot.Factor))
+					brick := device.NewBrickEntry(size, float64(v.Info.Snapshot.Factor))
 
 					// Determine if it was successful
-					if brick != nil {
-
-						// If the first in the set, the reset the id
-						if i == 0 {
-							brick.SetId(brickId)
-						}
-
-						// Save the brick entry to create later
-						brick_entries = append(brick_entries, brick)
-
-						// Add to set list
-						setlist = append(setlist, brick)
-
-						// Add brick to device
-						device.BrickAdd(brick.Id())
-
-						// Add brick to volume
-						v.BrickAdd(brick.Id())
+					if brick == nil {
+						continue
+					}
 
-						// Save values
-						err := device.Save(tx)
-						if err != nil {
-							return err
+					// Prefer a device of another class than the data
+					// bricks for the arbiter brick
+					if arbiter && setClasses[device.Info.Class] {
+						if fallbackId == "" {
+							fallbackId = deviceId
 						}
-						return nil
+						continue
 					}
+
+					return addBrick(device, brick)
 				}
 
 				// Check if allocator returned an error
@@ -182,6 +206,17 @@ func (v *VolumeEntry) allocBricks(
 					return err
 				}
 
+				if fallbackId != "" {
+					device, err := NewDeviceEntryFromId(tx, fallbackId)
+					if err != nil {
+						return err
+					}
+					brick := device.NewBrickEntry(size, float64(v.Info.Snapshot.Factor))
+					if brick != nil {
+						return addBrick(device, brick)
+					}
+				}
+
 				// No devices found
 				return ErrNoSpace
 
@@ -225,6 +260,15 @@ func (v *VolumeEntry) removeBrickFromDb(tx *bolt.Tx, brick *BrickEntry) error {
 		return err
 	}
 
+	// The thin pool of its owner brick is no longer used by the clone
+	if brick.PoolId != "" {
+		err = brick.poolCloneDelete(tx)
+		if err != nil {
+			logger.Err(err)
+			return err
+		}
+	}
+
 	// Delete brick from volume db
 	v.BrickDelete(brick.Info.Id)
 	if err != nil {
@@ -45,6 +45,16 @@ func (v *VolumeEntry) createVolume(db *bolt.DB,
 		return err
 	}
 
+	v.setMountInfo(vr)
+
+	return nil
+}
+
+// Save the mount information of the volume using the bricks in the request
+func (v *VolumeEntry) setMountInfo(vr *executors.VolumeRequest) {
+	godbc.Require(vr != nil)
+	godbc.Require(len(vr.Bricks) > 0)
+
 	// Get all brick hosts
 	stringset := utils.NewStringSet()
 	for _, brick := range vr.Bricks {
@@ -63,7 +73,6 @@ func (v *VolumeEntry) createVolume(db *bolt.DB,
 		strings.Join(hosts[1:], ",")
 
 	godbc.Ensure(v.Info.Mount.GlusterFS.MountPoint != "")
-	return nil
 }
 
 func (v *VolumeEntry) createVolumeRequest(db *bolt.DB,
@@ -103,6 +112,7 @@ func (v *VolumeEntry) createVolumeRequest(db *bolt.DB,
 
 	// Setup volume information in the request
 	vr.Name = v.Info.Name
+	vr.Options = v.Info.Options
 	v.Durability.SetExecutorVolumeRequest(vr)
 
 	return vr, sshhost, nil
@@ -0,0 +1,462 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/lpabon/godbc"
+)
+
+// Returned when a brick was replaced, but could not be destroyed on
+// its node.  The brick is no longer in the db.
+type BrickTeardownError struct {
+	BrickId string
+	NodeId  string
+	Path    string
+	Err     error
+}
+
+func (e *BrickTeardownError) Error() string {
+	return fmt.Sprintf("Brick %v was replaced, but %v is left on node %v: %v",
+		e.BrickId, e.Path, e.NodeId, e.Err)
+}
+
+// Replaces a brick of the volume with a new brick on another device.
+// The new device is taken from the allocator ring and must not be on
+// a node holding another brick of the same brick set.
+func (v *VolumeEntry) ReplaceBrick(db *bolt.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	oldBrickId string) error {
+
+	return v.replaceBrick(db, executor, allocator, oldBrickId, false)
+}
+
+// Replaces the brick when retire is set even when it cannot be checked
+// on its node, since the node or device is being removed
+func (v *VolumeEntry) replaceBrick(db *bolt.DB,
+	executor executors.Executor,
+	allocator Allocator,
+	oldBrickId string,
+	retire bool) (e error) {
+
+	godbc.Require(db != nil)
+	godbc.Require(oldBrickId != "")
+
+	if !utils.SortedStringHas(v.Bricks, oldBrickId) {
+		return ErrNotFound
+	}
+
+	// Get the brick to replace
+	var (
+		oldBrick     *BrickEntry
+		oldBrickInfo executors.BrickInfo
+		oldNode      *NodeEntry
+		oldDevice    *DeviceEntry
+		host         string
+	)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		oldBrick, err = NewBrickEntryFromId(tx, oldBrickId)
+		if err != nil {
+			return err
+		}
+
+		oldNode, err = NewNodeEntryFromId(tx, oldBrick.Info.NodeId)
+		if err != nil {
+			return err
+		}
+		oldBrickInfo.Host = oldNode.StorageHostName()
+		oldBrickInfo.Path = oldBrick.Info.Path
+
+		oldDevice, err = NewDeviceEntryFromId(tx, oldBrick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+
+		// The node of the old brick may be down
+		host, err = v.manageHostNameExcept(tx, oldNode.Info.Id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Bricks of cloned volumes cannot be moved out of the thin pool
+	// they share, and moving a brick would lose its snapshots and clones
+	if oldBrick.PoolId != "" {
+		return fmt.Errorf("Brick %v of cloned volume %v cannot be replaced",
+			oldBrick.Info.Id, v.Info.Id)
+	}
+
+	// The old brick is only checked, and later destroyed, when its node
+	// is online.  Otherwise it is left on the node for the brick garbage
+	// collection.  A brick which cannot be checked on a retired node is
+	// left there so that its snapshots are not lost.
+	var teardownErr *BrickTeardownError
+	switch {
+	case oldNode.State == api.EntryStateFailed || oldDevice.State == api.EntryStateFailed:
+		logger.Warning("Node or device of brick %v has failed, "+
+			"the brick will not be destroyed", oldBrick.Info.Id)
+	case !oldNode.isOnline():
+		logger.Warning("Node of brick %v is not online, "+
+			"the brick will not be destroyed", oldBrick.Info.Id)
+	case retire:
+		err = oldBrick.DestroyCheck(db, executor)
+		if err != nil {
+			teardownErr = &BrickTeardownError{
+				BrickId: oldBrick.Info.Id,
+				NodeId:  oldNode.Info.Id,
+				Path:    oldBrick.Info.Path,
+				Err:     err,
+			}
+		}
+	default:
+		err = oldBrick.DestroyCheck(db, executor)
+		if err != nil {
+			return err
+		}
+	}
+	teardown := teardownErr == nil &&
+		oldNode.isOnline() &&
+		oldDevice.State != api.EntryStateFailed
+
+	// Find the nodes of the other bricks in the same set
+	setHosts, err := v.brickSetHosts(executor, host, &oldBrickInfo)
+	if err != nil {
+		return err
+	}
+
+	// Allocate the new brick
+	newBrick, err := v.allocReplacementBrick(db, allocator, oldBrick, setHosts)
+	if err != nil {
+		return err
+	}
+
+	// Once GlusterFS uses the new brick it must not be rolled back
+	replaced := false
+
+	// Journal the replacement so that it can be recovered if heketi
+	// stops before it completes.  The brick garbage collection also
+	// leaves the new brick alone while it is in the journal.
+	op := NewPendingOperationEntryForVolume(PENDING_BRICK_REPLACE, v,
+		[]*BrickEntry{newBrick})
+	op.ReplacedBrickId = oldBrick.Info.Id
+	keepOp := false
+	defer func() {
+		if e != nil && !replaced && !keepOp {
+			op.Remove(db)
+		}
+	}()
+
+	// Free the new brick on failure
+	defer func() {
+		if e != nil && !replaced && !keepOp {
+			db.Update(func(tx *bolt.Tx) error {
+				device, err := NewDeviceEntryFromId(tx, newBrick.Info.DeviceId)
+				if err != nil {
+					return err
+				}
+				device.StorageFree(newBrick.TotalSize())
+				device.BrickDelete(newBrick.Info.Id)
+				err = device.Save(tx)
+				if err != nil {
+					return err
+				}
+				return v.saveState(tx, api.VolumeStateOnline)
+			})
+		}
+	}()
+
+	err = op.RecordState(db, PENDING_STEP_PLANNED, api.VolumeStateReplacing)
+	if err != nil {
+		return err
+	}
+
+	// Create the new brick
+	err = CreateBricks(db, executor, []*BrickEntry{newBrick})
+	if err != nil {
+		if _, ok := err.(*BrickCleanupError); ok {
+			keepOp = true
+		}
+		return err
+	}
+
+	// Destroy the new brick on failure
+	defer func() {
+		if e != nil && !replaced {
+			keepOp = op.keepOnFailedDestroy(db,
+				DestroyBricks(db, executor, []*BrickEntry{newBrick}))
+		}
+	}()
+
+	err = op.Record(db, PENDING_STEP_BRICKS_CREATED)
+	if err != nil {
+		return err
+	}
+
+	newBrickInfo := executors.BrickInfo{
+		Path: newBrick.Info.Path,
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		node, err := NewNodeEntryFromId(tx, newBrick.Info.NodeId)
+		if err != nil {
+			return err
+		}
+		newBrickInfo.Host = node.StorageHostName()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Move the volume to the new brick
+	logger.Info("Replacing brick %v with %v in volume %v",
+		oldBrick.Info.Id, newBrick.Info.Id, v.Info.Id)
+	err = executor.VolumeReplaceBrick(host, v.Info.Name, &oldBrickInfo, &newBrickInfo)
+	if err != nil {
+		return err
+	}
+	replaced = true
+
+	err = op.Record(db, PENDING_STEP_VOLUME_CREATED)
+	if err != nil {
+		logger.LogError("Unable to journal replacement of brick %v: %v",
+			oldBrick.Info.Id, err)
+	}
+
+	// Save information on db
+	err = db.Update(func(tx *bolt.Tx) error {
+		err := newBrick.Save(tx)
+		if err != nil {
+			return err
+		}
+		v.BrickAdd(newBrick.Info.Id)
+
+		err = v.removeBrickFromDb(tx, oldBrick)
+		if err != nil {
+			return err
+		}
+
+		err = v.updateMountInfo(tx)
+		if err != nil {
+			return err
+		}
+
+		v.Info.State = api.VolumeStateOnline
+		err = v.Save(tx)
+		if err != nil {
+			return err
+		}
+
+		return op.Delete(tx)
+	})
+	if err != nil {
+		// Both bricks stay allocated on their devices, and the journal
+		// completes the replacement on the next start.  Save the new
+		// brick so that it is known to the db.
+		db.Update(func(tx *bolt.Tx) error {
+			return newBrick.Save(tx)
+		})
+		return logger.Err(fmt.Errorf("Volume %v now uses brick %v instead of %v, "+
+			"but the db could not be updated: %v",
+			v.Info.Id, newBrick.Info.Id, oldBrick.Info.Id, err))
+	}
+
+	// The volume no longer uses the old brick
+	if teardown {
+		err = oldBrick.Destroy(db, executor)
+		if err != nil {
+			teardownErr = &BrickTeardownError{
+				BrickId: oldBrick.Info.Id,
+				NodeId:  oldNode.Info.Id,
+				Path:    oldBrick.Info.Path,
+				Err:     err,
+			}
+		}
+	}
+	if teardownErr != nil {
+		return logger.Err(teardownErr)
+	}
+
+	return nil
+}
+
+// Returns the management hostname of an online node holding a brick
+// of the volume, other than the node nodeId when possible
+func (v *VolumeEntry) manageHostNameExcept(tx *bolt.Tx, nodeId string) (string, error) {
+	godbc.Require(tx != nil)
+
+	for _, id := range v.BricksIds() {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return "", err
+		}
+		if brick.Info.NodeId == nodeId {
+			continue
+		}
+
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return "", err
+		}
+		if node.isOnline() {
+			return node.ManageHostName(), nil
+		}
+	}
+
+	return v.manageHostName(tx)
+}
+
+// Returns the storage hostnames of the other bricks in the same
+// brick set as the brick
+func (v *VolumeEntry) brickSetHosts(executor executors.Executor,
+	host string,
+	brick *executors.BrickInfo) (map[string]bool, error) {
+
+	hosts := make(map[string]bool)
+	setSize := v.Durability.BricksInSet()
+	if setSize == 1 {
+		return hosts, nil
+	}
+
+	info, err := executor.VolumeInfo(host, v.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, b := range info.Bricks {
+		if b == *brick {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, fmt.Errorf("Brick %v:%v not found in volume %v",
+			brick.Host, brick.Path, v.Info.Name)
+	}
+
+	start := (index / setSize) * setSize
+	end := start + setSize
+	if end > len(info.Bricks) {
+		end = len(info.Bricks)
+	}
+
+	for i := start; i < end; i++ {
+		if i != index {
+			hosts[info.Bricks[i].Host] = true
+		}
+	}
+
+	return hosts, nil
+}
+
+// Allocates a brick with the same size as the old brick on a device not
+// used by the old brick and not on any of the nodes in setHosts
+func (v *VolumeEntry) allocReplacementBrick(db *bolt.DB,
+	allocator Allocator,
+	oldBrick *BrickEntry,
+	setHosts map[string]bool) (*BrickEntry, error) {
+
+	// Get allocator generator
+	brickId := utils.GenUUID()
+	deviceCh, done, errc := allocator.GetNodes(v.Info.Cluster, brickId)
+	defer func() {
+		close(done)
+	}()
+
+	var brick *BrickEntry
+	err := db.Update(func(tx *bolt.Tx) error {
+
+		// Check the ring for devices to place the brick
+		for deviceId := range deviceCh {
+			if deviceId == oldBrick.Info.DeviceId {
+				continue
+			}
+
+			// Get device entry
+			device, err := NewDeviceEntryFromId(tx, deviceId)
+			if err != nil {
+				return err
+			}
+
+			// Do not allow a node already in the set
+			node, err := NewNodeEntryFromId(tx, device.NodeId)
+			if err != nil {
+				return err
+			}
+			if setHosts[node.StorageHostName()] {
+				continue
+			}
+
+			// Try to allocate a brick on this device
+			brick = device.NewBrickEntry(oldBrick.Info.Size,
+				float64(v.Info.Snapshot.Factor))
+			if brick == nil {
+				continue
+			}
+			brick.SetId(brickId)
+
+			// Add brick to device
+			device.BrickAdd(brick.Id())
+			return device.Save(tx)
+		}
+
+		// Check if allocator returned an error
+		if err := <-errc; err != nil {
+			return err
+		}
+
+		// No devices found
+		return ErrNoSpace
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return brick, nil
+}
+
+// Updates the mount information with the nodes currently holding bricks
+func (v *VolumeEntry) updateMountInfo(tx *bolt.Tx) error {
+	vr := &executors.VolumeRequest{}
+	vr.Name = v.Info.Name
+	for _, id := range v.BricksIds() {
+		brick, err := NewBrickEntryFromId(tx, id)
+		if err != nil {
+			return err
+		}
+		node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+		if err != nil {
+			return err
+		}
+		vr.Bricks = append(vr.Bricks, executors.BrickInfo{
+			Host: node.StorageHostName(),
+			Path: brick.Info.Path,
+		})
+	}
+
+	v.setMountInfo(vr)
+
+	return nil
+}
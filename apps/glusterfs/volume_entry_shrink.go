@@ -0,0 +1,249 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+var (
+	// Time between checks of the data migration off removed bricks
+	ShrinkPollInterval = 10 * time.Second
+
+	// Time after which a data migration which has not finished
+	// is stopped
+	ShrinkTimeout = 24 * time.Hour
+)
+
+// Shrinks the volume by up to sizeGB by removing whole brick sets,
+// starting with the last ones added.  The data on the bricks is moved
+// to the rest of the volume before they are destroyed.
+func (v *VolumeEntry) Shrink(db *bolt.DB,
+	executor executors.Executor,
+	sizeGB int) (e error) {
+
+	godbc.Require(db != nil)
+	godbc.Require(sizeGB > 0)
+
+	if sizeGB >= v.Info.Size {
+		return fmt.Errorf("Unable to shrink volume %v of %v GB by %v GB",
+			v.Info.Id, v.Info.Size, sizeGB)
+	}
+
+	// Get the bricks and the host to send volume commands
+	var (
+		host      string
+		totalSize uint64
+	)
+	bricks := make(map[executors.BrickInfo]*BrickEntry)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		host, err = v.manageHostName(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range v.BricksIds() {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+			if err != nil {
+				return err
+			}
+			bricks[executors.BrickInfo{
+				Host: node.StorageHostName(),
+				Path: brick.Info.Path,
+			}] = brick
+			totalSize += brick.Info.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Brick sets are only known to GlusterFS
+	info, err := executor.VolumeInfo(host, v.Info.Name)
+	if err != nil {
+		return err
+	}
+	setSize := v.Durability.BricksInSet()
+	if len(info.Bricks) != len(bricks) || len(info.Bricks)%setSize != 0 {
+		return fmt.Errorf("Bricks of volume %v do not match the bricks in the db",
+			v.Info.Name)
+	}
+
+	// Choose the sets to remove, always keeping the first one
+	var (
+		removeInfo    []executors.BrickInfo
+		removeEntries []*BrickEntry
+		removeSize    int
+	)
+	for end := len(info.Bricks); end > setSize; end -= setSize {
+		set := info.Bricks[end-setSize : end]
+
+		var setBricksSize uint64
+		for _, b := range set {
+			brick, ok := bricks[b]
+			if !ok {
+				return fmt.Errorf("Brick %v:%v of volume %v not found in db",
+					b.Host, b.Path, v.Info.Name)
+			}
+			setBricksSize += brick.Info.Size
+		}
+
+		// The set provides the same share of the volume size
+		// as its bricks of the total size of the bricks
+		setSizeGB := int(uint64(v.Info.Size) * setBricksSize / totalSize)
+		if removeSize+setSizeGB > sizeGB {
+			break
+		}
+
+		removeSize += setSizeGB
+		for _, b := range set {
+			removeInfo = append(removeInfo, b)
+			removeEntries = append(removeEntries, bricks[b])
+		}
+	}
+	if len(removeEntries) == 0 {
+		return fmt.Errorf("Unable to shrink volume %v by %v GB without "+
+			"removing part of a brick set", v.Info.Id, sizeGB)
+	}
+
+	// Determine if the bricks can be destroyed
+	err = v.checkBricksCanBeDestroyed(db, executor, removeEntries)
+	if err != nil {
+		return err
+	}
+
+	// Show the volume is being shrunk until the db is updated.  The
+	// shrink is not journaled, so a volume heketi stopped shrinking is
+	// shown online again on the next start.
+	err = db.Update(func(tx *bolt.Tx) error {
+		return v.saveState(tx, api.VolumeStateShrinking)
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e != nil {
+			db.Update(func(tx *bolt.Tx) error {
+				return v.saveState(tx, api.VolumeStateOnline)
+			})
+		}
+	}()
+
+	// Move the data off the bricks and take them out of the volume
+	logger.Info("Removing %v bricks from volume %v", len(removeEntries), v.Info.Id)
+	err = v.removeBricks(executor, host, removeInfo)
+	if err != nil {
+		return err
+	}
+
+	// Save information on db
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, brick := range removeEntries {
+			err := v.removeBrickFromDb(tx, brick)
+			if err != nil {
+				return err
+			}
+		}
+		v.Info.Size -= removeSize
+		v.Info.State = api.VolumeStateOnline
+
+		err := v.updateMountInfo(tx)
+		if err != nil {
+			return err
+		}
+
+		return v.Save(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The volume no longer uses the bricks
+	err = DestroyBricks(db, executor, removeEntries)
+	if err != nil {
+		logger.LogError("Unable to destroy bricks removed from volume %v: %v",
+			v.Info.Id, err)
+	}
+
+	return nil
+}
+
+// Migrates the data off the bricks and removes them from the volume.
+// The bricks are returned to the volume on failure.
+func (v *VolumeEntry) removeBricks(executor executors.Executor,
+	host string,
+	bricks []executors.BrickInfo) (e error) {
+
+	err := executor.VolumeRemoveBricksStart(host, v.Info.Name, bricks)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if e != nil {
+			err := executor.VolumeRemoveBricksStop(host, v.Info.Name, bricks)
+			if err != nil {
+				logger.LogError("Unable to stop removing bricks from volume %v: %v",
+					v.Info.Name, err)
+			}
+		}
+	}()
+
+	// Wait for the migration to finish
+	deadline := time.Now().Add(ShrinkTimeout)
+	for {
+		status, err := executor.VolumeRemoveBricksStatus(host, v.Info.Name, bricks)
+		if err != nil {
+			return err
+		}
+
+		if status.State == executors.MigrationFailed {
+			return fmt.Errorf("Migration of data off bricks of volume %v failed",
+				v.Info.Name)
+		}
+
+		if status.State == executors.MigrationCompleted {
+			if status.Failures > 0 {
+				return fmt.Errorf("Unable to migrate %v files off bricks of volume %v",
+					status.Failures, v.Info.Name)
+			}
+			break
+		}
+
+		logger.Debug("Migrated %v files off bricks of volume %v",
+			status.Files, v.Info.Name)
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Migration of data off bricks of volume %v "+
+				"did not finish within %v", v.Info.Name, ShrinkTimeout)
+		}
+		time.Sleep(ShrinkPollInterval)
+	}
+
+	return executor.VolumeRemoveBricksCommit(host, v.Info.Name, bricks)
+}
@@ -24,6 +24,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/heketi/heketi/executors"
@@ -1490,3 +1491,949 @@ func TestVolumeEntryNameConflictMultiCluster(t *testing.T) {
 	err = v.Create(app.db, app.executor, app.allocator)
 	tests.Assert(t, err != nil, err)
 }
+
+// Mock GlusterFS volume information using the brick order in the db.
+// Bricks must have unique paths.
+func mockVolumeInfoFromDb(t *testing.T, app *App) {
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		info := &executors.VolumeInfo{
+			Name: volume,
+		}
+		err := app.db.View(func(tx *bolt.Tx) error {
+			volumes, err := VolumeList(tx)
+			if err != nil {
+				return err
+			}
+			for _, id := range volumes {
+				v, err := NewVolumeEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				if v.Info.Name != volume {
+					continue
+				}
+				for _, brickId := range v.Bricks {
+					brick, err := NewBrickEntryFromId(tx, brickId)
+					if err != nil {
+						return err
+					}
+					node, err := NewNodeEntryFromId(tx, brick.Info.NodeId)
+					if err != nil {
+						return err
+					}
+					info.Bricks = append(info.Bricks, executors.BrickInfo{
+						Host: node.StorageHostName(),
+						Path: brick.Info.Path,
+					})
+				}
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil)
+		return info, nil
+	}
+	app.xo.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+		return &executors.BrickInfo{
+			Path: "/mockpath/" + brick.Name,
+		}, nil
+	}
+}
+
+func TestVolumeEntryReplaceBrick(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoFromDb(t, app)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Get the brick to replace and the host of the other
+	// brick in the set
+	info, err := app.executor.VolumeInfo("", v.Info.Name)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(info.Bricks) == 4)
+	peerHost := info.Bricks[1].Host
+
+	var (
+		oldBrick *BrickEntry
+		oldUsed  uint64
+	)
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		oldBrick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		if err != nil {
+			return err
+		}
+		device, err := NewDeviceEntryFromId(tx, oldBrick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		oldUsed = device.Info.Storage.Used
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	var replaced, replacement *executors.BrickInfo
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		tests.Assert(t, volume == v.Info.Name)
+		replaced = oldBrick
+		replacement = newBrick
+		return nil
+	}
+	destroyed := ""
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed = brick.Name
+		return nil
+	}
+
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, oldBrick.Info.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, replaced.Path == oldBrick.Info.Path)
+	tests.Assert(t, replacement.Host != peerHost)
+	tests.Assert(t, destroyed == oldBrick.Info.Id)
+	tests.Assert(t, len(v.Bricks) == 4)
+	tests.Assert(t, !utils.SortedStringHas(v.Bricks, oldBrick.Info.Id))
+
+	// Check db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		_, err := NewBrickEntryFromId(tx, oldBrick.Info.Id)
+		tests.Assert(t, err == ErrNotFound)
+
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, reflect.DeepEqual(entry.Bricks, v.Bricks))
+
+		// Old device no longer has the brick
+		device, err := NewDeviceEntryFromId(tx, oldBrick.Info.DeviceId)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, !utils.SortedStringHas(device.Bricks, oldBrick.Info.Id))
+		tests.Assert(t, device.Info.Storage.Used == oldUsed-oldBrick.TotalSize())
+
+		// New brick is on another device with the same size
+		for _, id := range entry.Bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if brick.Info.Path != replacement.Path {
+				continue
+			}
+			tests.Assert(t, brick.Info.DeviceId != oldBrick.Info.DeviceId)
+			tests.Assert(t, brick.Info.Size == oldBrick.Info.Size)
+
+			device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			tests.Assert(t, utils.SortedStringHas(device.Bricks, brick.Info.Id))
+		}
+
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeEntryReplaceBrickFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoFromDb(t, app)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Save a copy of the volume before the replace
+	vcopy := &VolumeEntry{}
+	*vcopy = *v
+	var devices []*DeviceEntry
+	getDevices := func() []*DeviceEntry {
+		var devices []*DeviceEntry
+		err := app.db.View(func(tx *bolt.Tx) error {
+			list, err := DeviceList(tx)
+			if err != nil {
+				return err
+			}
+			for _, id := range list {
+				device, err := NewDeviceEntryFromId(tx, id)
+				if err != nil {
+					return err
+				}
+				devices = append(devices, device)
+			}
+			return nil
+		})
+		tests.Assert(t, err == nil)
+		return devices
+	}
+	devices = getDevices()
+
+	// Unknown brick
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, "123")
+	tests.Assert(t, err == ErrNotFound)
+
+	// Fail the replace
+	ErrMock := errors.New("MOCK")
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		return ErrMock
+	}
+	destroyed := 0
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed++
+		return nil
+	}
+
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, v.Bricks[0])
+	tests.Assert(t, err == ErrMock)
+	tests.Assert(t, destroyed == 1)
+
+	// Check db is the same as before
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, reflect.DeepEqual(vcopy, entry))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(devices, getDevices()))
+
+	// Bricks whose thin pool is in use cannot be replaced
+	app.xo.MockBrickDestroyCheck = func(host string, brick *executors.BrickRequest) error {
+		return ErrMock
+	}
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, v.Bricks[0])
+	tests.Assert(t, err == ErrMock)
+}
+
+func TestVolumeEntryReplaceBrickNoSpace(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoFromDb(t, app)
+
+	// Only one device on each node
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		2,    // nodes_per_cluster
+		1,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Put the first brick in a set with a brick of the other node
+	info, err := app.executor.VolumeInfo("", v.Info.Name)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(info.Bricks) == 4)
+	for i := 2; i < len(info.Bricks); i++ {
+		if info.Bricks[i].Host != info.Bricks[0].Host {
+			info.Bricks[1], info.Bricks[i] = info.Bricks[i], info.Bricks[1]
+			break
+		}
+	}
+	tests.Assert(t, info.Bricks[0].Host != info.Bricks[1].Host)
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		return info, nil
+	}
+
+	// The only other device is on the node of the other brick in the set
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, v.Bricks[0])
+	tests.Assert(t, err == ErrNoSpace, err)
+}
+
+func TestVolumeEntryReplaceBrickDbFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoFromDb(t, app)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	var oldBrick *BrickEntry
+	err = app.db.View(func(tx *bolt.Tx) error {
+		var err error
+		oldBrick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+		return err
+	})
+	tests.Assert(t, err == nil)
+
+	// The db cannot be updated once GlusterFS uses the new brick
+	var replacement *executors.BrickInfo
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		t.Errorf("Brick %v destroyed", brick.Name)
+		return nil
+	}
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		old *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		replacement = newBrick
+		return app.db.Update(func(tx *bolt.Tx) error {
+			device, err := NewDeviceEntryFromId(tx, oldBrick.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			return EntryDelete(tx, device, device.Info.Id)
+		})
+	}
+
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, oldBrick.Info.Id)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, replacement != nil)
+
+	// The new brick is kept and saved
+	err = app.db.View(func(tx *bolt.Tx) error {
+		bricks, err := BrickList(tx)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, id := range bricks {
+			brick, err := NewBrickEntryFromId(tx, id)
+			if err != nil {
+				return err
+			}
+			if brick.Info.Path != replacement.Path || brick.Info.Id == oldBrick.Info.Id {
+				continue
+			}
+			found = true
+
+			device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+			if err != nil {
+				return err
+			}
+			tests.Assert(t, utils.SortedStringHas(device.Bricks, brick.Info.Id))
+		}
+		tests.Assert(t, found)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeEntryReplaceBrickNodeDown(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoFromDb(t, app)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	var oldBrick *BrickEntry
+	var oldHost string
+	setNodeState := func(state api.EntryState) {
+		err := app.db.Update(func(tx *bolt.Tx) error {
+			var err error
+			oldBrick, err = NewBrickEntryFromId(tx, v.Bricks[0])
+			if err != nil {
+				return err
+			}
+			node, err := NewNodeEntryFromId(tx, oldBrick.Info.NodeId)
+			if err != nil {
+				return err
+			}
+			oldHost = node.ManageHostName()
+			node.State = state
+			return node.Save(tx)
+		})
+		tests.Assert(t, err == nil)
+	}
+
+	var managedBy string
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		managedBy = host
+		return nil
+	}
+	checked, destroyed := 0, 0
+	app.xo.MockBrickDestroyCheck = func(host string, brick *executors.BrickRequest) error {
+		checked++
+		return errors.New("unreachable")
+	}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed++
+		return nil
+	}
+
+	// The brick of a failed node is replaced without reaching the node
+	setNodeState(api.EntryStateFailed)
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, oldBrick.Info.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, checked == 0, checked)
+	tests.Assert(t, destroyed == 0, destroyed)
+	tests.Assert(t, managedBy != oldHost, managedBy)
+	tests.Assert(t, !utils.SortedStringHas(v.Bricks, oldBrick.Info.Id))
+
+	// Nor is the brick of an offline node, which is left there
+	setNodeState(api.EntryStateOffline)
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, oldBrick.Info.Id)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, checked == 0, checked)
+	tests.Assert(t, destroyed == 0, destroyed)
+	tests.Assert(t, managedBy != oldHost, managedBy)
+	tests.Assert(t, !utils.SortedStringHas(v.Bricks, oldBrick.Info.Id))
+}
+
+func TestNewVolumeEntryFromBrickId(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	// Create a cluster
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		5*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volumes
+	v1 := createSampleVolumeEntry(100)
+	err = v1.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	v2 := createSampleVolumeEntry(100)
+	err = v2.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		volume, err := NewVolumeEntryFromBrickId(tx, v2.Bricks[1])
+		tests.Assert(t, err == nil)
+		tests.Assert(t, volume.Info.Id == v2.Info.Id)
+
+		_, err = NewVolumeEntryFromBrickId(tx, "123")
+		tests.Assert(t, err == ErrNotFound)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+// Returns the bricks of the volume in the order they were given to
+// GlusterFS, like it does
+func mockVolumeInfoInCreateOrder(t *testing.T, app *App) {
+	mockVolumeInfoFromDb(t, app)
+
+	var bricks []executors.BrickInfo
+	app.xo.MockVolumeCreate = func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		bricks = append([]executors.BrickInfo{}, volume.Bricks...)
+		return &executors.VolumeInfo{}, nil
+	}
+	app.xo.MockVolumeExpand = func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		bricks = append(bricks, volume.Bricks...)
+		return &executors.VolumeInfo{}, nil
+	}
+	app.xo.MockVolumeRemoveBricksCommit = func(host string, volume string, removed []executors.BrickInfo) error {
+		bricks = bricks[:len(bricks)-len(removed)]
+		return nil
+	}
+	app.xo.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		return &executors.VolumeInfo{
+			Name:   volume,
+			Bricks: bricks,
+		}, nil
+	}
+}
+
+func TestVolumeEntryShrink(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoInCreateOrder(t, app)
+	defer tests.Patch(&ShrinkPollInterval, time.Millisecond).Restore()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume and add two more brick sets
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	original := v.BricksIds()
+
+	err = v.Expand(app.db, app.executor, app.allocator, 100)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(v.Bricks) == 8)
+
+	// Less than a brick set cannot be removed
+	err = v.Shrink(app.db, app.executor, 40)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "brick set"))
+
+	// The whole volume cannot be removed
+	err = v.Shrink(app.db, app.executor, 200)
+	tests.Assert(t, err != nil)
+
+	// Migration is polled until it completes
+	polls := 0
+	app.xo.MockVolumeRemoveBricksStatus = func(host string, volume string,
+		bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+		polls++
+		tests.Assert(t, len(bricks) == 4)
+		status := &executors.RemoveBricksStatus{
+			State: executors.MigrationCompleted,
+		}
+		if polls < 3 {
+			status.State = executors.MigrationInProgress
+		}
+		return status, nil
+	}
+	destroyed := 0
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		destroyed++
+		return nil
+	}
+
+	// Remove up to 120GB, which is the two sets added
+	err = v.Shrink(app.db, app.executor, 120)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, polls == 3)
+	tests.Assert(t, destroyed == 4)
+	tests.Assert(t, v.Info.Size == 100)
+	tests.Assert(t, reflect.DeepEqual(v.BricksIds(), original))
+
+	// Check db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Info.Size == 100)
+		tests.Assert(t, reflect.DeepEqual(entry.BricksIds(), original))
+
+		bricks, err := BrickList(tx)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, len(bricks) == 4)
+
+		// Only the remaining bricks use storage
+		var used uint64
+		devices, err := DeviceList(tx)
+		tests.Assert(t, err == nil)
+		for _, id := range devices {
+			device, err := NewDeviceEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			used += device.Info.Storage.Used
+		}
+		var expected uint64
+		for _, id := range original {
+			brick, err := NewBrickEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			expected += brick.TotalSize()
+		}
+		tests.Assert(t, used == expected)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeEntryShrinkFailure(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoInCreateOrder(t, app)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		4,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume with two more brick sets
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	err = v.Expand(app.db, app.executor, app.allocator, 100)
+	tests.Assert(t, err == nil)
+
+	// Save a copy of the volume before the shrink
+	vcopy := &VolumeEntry{}
+	*vcopy = *v
+
+	// Fail the migration
+	app.xo.MockVolumeRemoveBricksStatus = func(host string, volume string,
+		bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+		return &executors.RemoveBricksStatus{
+			State: executors.MigrationFailed,
+		}, nil
+	}
+	stopped := 0
+	app.xo.MockVolumeRemoveBricksStop = func(host string, volume string,
+		bricks []executors.BrickInfo) error {
+		stopped++
+		return nil
+	}
+	app.xo.MockVolumeRemoveBricksCommit = func(host string, volume string,
+		bricks []executors.BrickInfo) error {
+		t.Error("Bricks must not be committed")
+		return nil
+	}
+
+	err = v.Shrink(app.db, app.executor, 100)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, stopped == 1)
+
+	// Files which could not be moved also fail the shrink
+	app.xo.MockVolumeRemoveBricksStatus = func(host string, volume string,
+		bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+		return &executors.RemoveBricksStatus{
+			State:    executors.MigrationCompleted,
+			Failures: 2,
+		}, nil
+	}
+
+	err = v.Shrink(app.db, app.executor, 100)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, stopped == 2)
+
+	// A migration which does not finish in time is stopped
+	defer tests.Patch(&ShrinkPollInterval, time.Millisecond).Restore()
+	defer tests.Patch(&ShrinkTimeout, 20*time.Millisecond).Restore()
+	polls := 0
+	app.xo.MockVolumeRemoveBricksStatus = func(host string, volume string,
+		bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+		polls++
+		return &executors.RemoveBricksStatus{
+			State: executors.MigrationInProgress,
+		}, nil
+	}
+
+	err = v.Shrink(app.db, app.executor, 100)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "did not finish"), err)
+	tests.Assert(t, polls > 1, polls)
+	tests.Assert(t, stopped == 3)
+
+	// Check db is the same as before
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, reflect.DeepEqual(vcopy, entry))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeEntryCreateArbiter(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Make the second device of each node an ssd
+	var cluster string
+	err = app.db.Update(func(tx *bolt.Tx) error {
+		clusters, err := ClusterList(tx)
+		if err != nil {
+			return err
+		}
+		cluster = clusters[0]
+
+		entry, err := NewClusterEntryFromId(tx, cluster)
+		if err != nil {
+			return err
+		}
+		for _, nodeId := range entry.Info.Nodes {
+			node, err := NewNodeEntryFromId(tx, nodeId)
+			if err != nil {
+				return err
+			}
+			device, err := NewDeviceEntryFromId(tx, node.Devices[1])
+			if err != nil {
+				return err
+			}
+			device.Info.Class = "ssd"
+			err = device.Save(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	req := &api.VolumeCreateRequest{}
+	req.Size = 200
+	req.Durability.Type = api.DurabilityArbiter
+	v := NewVolumeEntryFromRequest(req)
+	tests.Assert(t, v.Durability.BricksInSet() == 3)
+
+	// Allocate the bricks in set order
+	bricks, err := v.allocBricksInCluster(app.db, app.allocator, cluster, 200)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(bricks) == 6, len(bricks))
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for set := 0; set < len(bricks); set += 3 {
+			var classes []string
+			nodes := make(map[string]bool)
+			for _, brick := range bricks[set : set+3] {
+				device, err := NewDeviceEntryFromId(tx, brick.Info.DeviceId)
+				if err != nil {
+					return err
+				}
+				classes = append(classes, device.Info.Class)
+				nodes[brick.Info.NodeId] = true
+			}
+			tests.Assert(t, len(nodes) == 3)
+
+			// Data bricks hold the volume, the arbiter only the metadata
+			tests.Assert(t, bricks[set].Info.Size == 100*GB)
+			tests.Assert(t, bricks[set+1].Info.Size == 100*GB)
+			tests.Assert(t, bricks[set+2].Info.Size == 100*GB/16)
+
+			// The arbiter is on another class when the data bricks
+			// share one
+			if classes[0] == classes[1] {
+				tests.Assert(t, classes[2] != classes[0], classes)
+			}
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Create the volume
+	var created *executors.VolumeRequest
+	app.xo.MockVolumeCreate = func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		created = volume
+		return &executors.VolumeInfo{}, nil
+	}
+	v = NewVolumeEntryFromRequest(req)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, created.Type == executors.DurabilityArbiter)
+	tests.Assert(t, len(created.Bricks)%3 == 0)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		if err != nil {
+			return err
+		}
+		tests.Assert(t, entry.Info.Durability.Type == api.DurabilityArbiter)
+		tests.Assert(t, entry.Durability.BricksInSet() == 3)
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestVolumeEntryStates(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+	mockVolumeInfoFromDb(t, app)
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		1*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	savedState := func() api.VolumeState {
+		var state api.VolumeState
+		err := app.db.View(func(tx *bolt.Tx) error {
+			entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+			if err != nil {
+				return err
+			}
+			state = entry.Info.State
+			return nil
+		})
+		tests.Assert(t, err == nil)
+		return state
+	}
+
+	// The volume is listed while it is being created
+	var state api.VolumeState
+	app.xo.MockVolumeCreate = func(host string,
+		volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		state = savedState()
+		return &executors.VolumeInfo{}, nil
+	}
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, state == api.VolumeStateCreating, state)
+	tests.Assert(t, savedState() == api.VolumeStateOnline)
+
+	app.xo.MockVolumeExpand = func(host string,
+		volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+		state = savedState()
+		return &executors.VolumeInfo{}, nil
+	}
+	err = v.Expand(app.db, app.executor, app.allocator, 100)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, state == api.VolumeStateExpanding, state)
+	tests.Assert(t, savedState() == api.VolumeStateOnline)
+
+	app.xo.MockVolumeReplaceBrick = func(host string, volume string,
+		oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		state = savedState()
+		return nil
+	}
+	err = v.ReplaceBrick(app.db, app.executor, app.allocator, v.Bricks[0])
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, state == api.VolumeStateReplacing, state)
+	tests.Assert(t, savedState() == api.VolumeStateOnline)
+
+	// A volume GlusterFS failed to shrink is still online
+	app.xo.MockVolumeRemoveBricksStatus = func(host string, volume string,
+		bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+		state = savedState()
+		return &executors.RemoveBricksStatus{
+			State: executors.MigrationFailed,
+		}, nil
+	}
+	err = v.Shrink(app.db, app.executor, 100)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, state == api.VolumeStateShrinking, state)
+	tests.Assert(t, savedState() == api.VolumeStateOnline)
+
+	// A volume GlusterFS failed to delete is still online
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		state = savedState()
+		return errors.New("volume destroy failed")
+	}
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, state == api.VolumeStateDeleting, state)
+	tests.Assert(t, savedState() == api.VolumeStateOnline)
+
+	// Bricks left behind once GlusterFS deleted the volume
+	app.xo.MockVolumeDestroy = func(host string, volume string) error {
+		return nil
+	}
+	app.xo.MockBrickDestroy = func(host string, brick *executors.BrickRequest) error {
+		return errors.New("brick destroy failed")
+	}
+	err = v.Destroy(app.db, app.executor)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, savedState() == api.VolumeStateFailed)
+}
+
+func TestUpgradeVolumeStates(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Volume saved before states were kept, and a volume heketi
+	// stopped shrinking
+	app := NewTestApp(tmpfile)
+	v := createSampleVolumeEntry(100)
+	shrinking := createSampleVolumeEntry(100)
+	shrinking.Info.State = api.VolumeStateShrinking
+	err := app.db.Update(func(tx *bolt.Tx) error {
+		err := shrinking.Save(tx)
+		if err != nil {
+			return err
+		}
+		return v.Save(tx)
+	})
+	tests.Assert(t, err == nil)
+	app.Close()
+
+	app = NewTestApp(tmpfile)
+	defer app.Close()
+	err = app.db.View(func(tx *bolt.Tx) error {
+		for _, id := range []string{v.Info.Id, shrinking.Info.Id} {
+			entry, err := NewVolumeEntryFromId(tx, id)
+			tests.Assert(t, err == nil)
+			tests.Assert(t, entry.Info.State == api.VolumeStateOnline)
+		}
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
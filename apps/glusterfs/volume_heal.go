@@ -0,0 +1,95 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+var (
+	ErrNoHeal = errors.New("Volume has no replica or disperse sets to heal")
+)
+
+// Returns the heal state of each brick of the volume as reported by GlusterFS
+func (v *VolumeEntry) HealInfo(db *bolt.DB,
+	executor executors.Executor) (*api.VolumeHealInfoResponse, error) {
+
+	godbc.Require(db != nil)
+
+	if v.Durability.BricksInSet() == 1 {
+		return nil, ErrNoHeal
+	}
+
+	// Map bricks as named by GlusterFS to the brick entries
+	var (
+		host   string
+		bricks map[executors.BrickInfo]*BrickEntry
+	)
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		host, err = v.manageHostName(tx)
+		if err != nil {
+			return err
+		}
+
+		bricks, err = v.brickEntriesByHostPath(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	healInfo, err := executor.VolumeHealInfo(host, v.Info.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &api.VolumeHealInfoResponse{
+		VolumeId: v.Info.Id,
+		Healed:   true,
+		Bricks:   make([]api.BrickHealInfo, 0, len(healInfo.Bricks)),
+	}
+	for _, b := range healInfo.Bricks {
+		brickInfo := api.BrickHealInfo{
+			Host:              b.Host,
+			Path:              b.Path,
+			Connected:         b.Connected,
+			PendingEntries:    b.PendingEntries,
+			SplitBrainEntries: b.SplitBrainEntries,
+		}
+		if brickInfo.SplitBrainEntries == nil {
+			brickInfo.SplitBrainEntries = []string{}
+		}
+		if brick, ok := bricks[executors.BrickInfo{Host: b.Host, Path: b.Path}]; ok {
+			brickInfo.Id = brick.Info.Id
+			brickInfo.NodeId = brick.Info.NodeId
+		}
+
+		if !b.Connected || b.PendingEntries != 0 || len(b.SplitBrainEntries) != 0 {
+			info.Healed = false
+		}
+
+		info.Bricks = append(info.Bricks, brickInfo)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+type volumeOptionType int
+
+const (
+	optionBool volumeOptionType = iota
+	optionInt
+	optionSize
+	optionEnum
+)
+
+// Values accepted by a GlusterFS volume option
+type volumeOption struct {
+	Type volumeOptionType
+
+	// Range for optionInt
+	Min, Max int
+
+	// Values for optionEnum
+	Values []string
+}
+
+var (
+	optionSizeRegex = regexp.MustCompile(`^[0-9]+([KMGT]B?)?$`)
+
+	optionBoolValues = []string{
+		"on", "off",
+		"true", "false",
+		"yes", "no",
+		"enable", "disable",
+		"1", "0",
+	}
+
+	optionLogLevels = []string{
+		"DEBUG", "WARNING", "ERROR", "INFO", "CRITICAL", "NONE", "TRACE",
+	}
+
+	// GlusterFS volume options which can be set through Heketi
+	volumeOptions = map[string]volumeOption{
+		"performance.cache-size":               {Type: optionSize},
+		"performance.cache-refresh-timeout":    {Type: optionInt, Min: 0, Max: 61},
+		"performance.client-io-threads":        {Type: optionBool},
+		"performance.flush-behind":             {Type: optionBool},
+		"performance.io-cache":                 {Type: optionBool},
+		"performance.io-thread-count":          {Type: optionInt, Min: 1, Max: 64},
+		"performance.open-behind":              {Type: optionBool},
+		"performance.parallel-readdir":         {Type: optionBool},
+		"performance.quick-read":               {Type: optionBool},
+		"performance.read-ahead":               {Type: optionBool},
+		"performance.readdir-ahead":            {Type: optionBool},
+		"performance.stat-prefetch":            {Type: optionBool},
+		"performance.strict-o-direct":          {Type: optionBool},
+		"performance.write-behind":             {Type: optionBool},
+		"performance.write-behind-window-size": {Type: optionSize},
+		"network.compression":                  {Type: optionBool},
+		"network.frame-timeout":                {Type: optionInt, Min: 30, Max: 1800},
+		"network.inode-lru-limit":              {Type: optionInt, Min: 0, Max: 1048576},
+		"network.ping-timeout":                 {Type: optionInt, Min: 0, Max: 1013},
+		"network.remote-dio":                   {Type: optionBool},
+		"client.event-threads":                 {Type: optionInt, Min: 1, Max: 32},
+		"server.event-threads":                 {Type: optionInt, Min: 1, Max: 1024},
+		"cluster.eager-lock":                   {Type: optionBool},
+		"cluster.lookup-optimize":              {Type: optionBool},
+		"cluster.quorum-type": {Type: optionEnum,
+			Values: []string{"none", "auto", "fixed"}},
+		"cluster.server-quorum-type": {Type: optionEnum,
+			Values: []string{"none", "server"}},
+		"diagnostics.brick-log-level":  {Type: optionEnum, Values: optionLogLevels},
+		"diagnostics.client-log-level": {Type: optionEnum, Values: optionLogLevels},
+		"features.shard":               {Type: optionBool},
+		"features.shard-block-size":    {Type: optionSize},
+		"nfs.disable":                  {Type: optionBool},
+	}
+)
+
+// Checks the options are known and their values are valid
+func ValidateVolumeOptions(options map[string]string) error {
+	for key, value := range options {
+		option, ok := volumeOptions[key]
+		if !ok {
+			return fmt.Errorf("Unknown volume option %v", key)
+		}
+
+		valid := false
+		switch option.Type {
+		case optionBool:
+			valid = optionHasValue(optionBoolValues, strings.ToLower(value))
+		case optionInt:
+			n, err := strconv.Atoi(value)
+			valid = err == nil && n >= option.Min && n <= option.Max
+		case optionSize:
+			valid = optionSizeRegex.MatchString(strings.ToUpper(value))
+		case optionEnum:
+			valid = optionHasValue(option.Values, value)
+		}
+
+		if !valid {
+			return fmt.Errorf("Invalid value '%v' for volume option %v", value, key)
+		}
+	}
+
+	return nil
+}
+
+func optionHasValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies the options to the volume and saves them with the
+// options already set
+func (v *VolumeEntry) SetOptions(db *bolt.DB,
+	executor executors.Executor,
+	options map[string]string) error {
+
+	godbc.Require(db != nil)
+	godbc.Require(len(options) > 0)
+
+	var host string
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		host, err = v.manageHostName(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = executor.VolumeSetOptions(host, v.Info.Name, options)
+	if err != nil {
+		return err
+	}
+
+	// Save information on db
+	return db.Update(func(tx *bolt.Tx) error {
+		if v.Info.Options == nil {
+			v.Info.Options = make(map[string]string)
+		}
+		for key, value := range options {
+			v.Info.Options[key] = value
+		}
+		return v.Save(tx)
+	})
+}
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/tests"
+)
+
+func TestValidateVolumeOptions(t *testing.T) {
+	valid := []map[string]string{
+		nil,
+		{"performance.cache-size": "1GB"},
+		{"performance.cache-size": "256mb"},
+		{"performance.cache-size": "1048576"},
+		{"performance.write-behind": "off"},
+		{"performance.write-behind": "Enable"},
+		{"performance.io-thread-count": "64"},
+		{"network.ping-timeout": "0"},
+		{"cluster.quorum-type": "auto"},
+		{"diagnostics.client-log-level": "WARNING"},
+		{
+			"network.ping-timeout":   "10",
+			"performance.cache-size": "32MB",
+		},
+	}
+	for _, options := range valid {
+		err := ValidateVolumeOptions(options)
+		tests.Assert(t, err == nil, options, err)
+	}
+
+	invalid := []map[string]string{
+		{"performance.unknown": "on"},
+		{"auth.allow": "*"},
+		{"performance.cache-size": "1PB"},
+		{"performance.cache-size": "big"},
+		{"performance.write-behind": "maybe"},
+		{"performance.io-thread-count": "0"},
+		{"performance.io-thread-count": "65"},
+		{"network.ping-timeout": "ten"},
+		{"cluster.quorum-type": "majority"},
+		{
+			"network.ping-timeout": "10",
+			"nfs.disable":          "on; reboot",
+		},
+	}
+	for _, options := range invalid {
+		err := ValidateVolumeOptions(options)
+		tests.Assert(t, err != nil, options)
+	}
+}
+
+func TestVolumeEntrySetOptions(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	// Create volume with an option
+	v := createSampleVolumeEntry(100)
+	v.Info.Options = map[string]string{
+		"network.ping-timeout": "10",
+	}
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Failure keeps the options in the db
+	ErrMock := errors.New("MOCK")
+	app.xo.MockVolumeSetOptions = func(host string, volume string,
+		options map[string]string) error {
+		return ErrMock
+	}
+	err = v.SetOptions(app.db, app.executor, map[string]string{
+		"network.ping-timeout": "20",
+	})
+	tests.Assert(t, err == ErrMock)
+
+	// Set options
+	var set map[string]string
+	app.xo.MockVolumeSetOptions = func(host string, volume string,
+		options map[string]string) error {
+		tests.Assert(t, volume == v.Info.Name)
+		set = options
+		return nil
+	}
+	err = v.SetOptions(app.db, app.executor, map[string]string{
+		"network.ping-timeout":   "20",
+		"performance.cache-size": "1GB",
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(set) == 2)
+
+	// Check db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, reflect.DeepEqual(entry.Info.Options, map[string]string{
+			"network.ping-timeout":   "20",
+			"performance.cache-size": "1GB",
+		}))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
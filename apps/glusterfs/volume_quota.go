@@ -0,0 +1,183 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/lpabon/godbc"
+)
+
+var (
+	ErrQuotaNotEnabled = errors.New("Quota is not enabled on the volume")
+
+	quotaPathRegex = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+)
+
+// Quota configuration of a volume
+type VolumeQuota struct {
+	Enable bool
+
+	// Usage limits keyed by directory
+	Limits map[string]api.QuotaLimit
+}
+
+// Checks the usage limit can be set on a volume
+func ValidateQuotaLimit(limit *api.QuotaLimit) error {
+	if !quotaPathRegex.MatchString(limit.Path) || path.Clean(limit.Path) != limit.Path {
+		return fmt.Errorf("Invalid quota path '%v'", limit.Path)
+	}
+	if limit.Size < 1 {
+		return fmt.Errorf("Invalid quota size %v", limit.Size)
+	}
+	if limit.SoftLimit < 0 || limit.SoftLimit > 99 {
+		return fmt.Errorf("Invalid quota soft limit %v", limit.SoftLimit)
+	}
+	return nil
+}
+
+// Returns the usage limits sorted by path
+func (v *VolumeEntry) QuotaLimits() []api.QuotaLimit {
+	paths := make(sort.StringSlice, 0, len(v.Quota.Limits))
+	for p := range v.Quota.Limits {
+		paths = append(paths, p)
+	}
+	paths.Sort()
+
+	limits := make([]api.QuotaLimit, 0, len(paths))
+	for _, p := range paths {
+		limits = append(limits, v.Quota.Limits[p])
+	}
+	return limits
+}
+
+func (v *VolumeEntry) NewQuotaInfoResponse() *api.QuotaInfoResponse {
+	return &api.QuotaInfoResponse{
+		Enable: v.Quota.Enable,
+		Limits: v.QuotaLimits(),
+	}
+}
+
+// Enables quota on the volume
+func (v *VolumeEntry) QuotaEnable(db *bolt.DB, executor executors.Executor) error {
+	godbc.Require(db != nil)
+
+	if v.Quota.Enable {
+		return nil
+	}
+
+	host, err := v.quotaHostName(db)
+	if err != nil {
+		return err
+	}
+
+	err = executor.VolumeQuotaEnable(host, v.Info.Name)
+	if err != nil {
+		return err
+	}
+
+	// Save information on db
+	return db.Update(func(tx *bolt.Tx) error {
+		v.Quota.Enable = true
+		return v.Save(tx)
+	})
+}
+
+// Sets or replaces the usage limit on a directory of the volume
+func (v *VolumeEntry) QuotaSetLimit(db *bolt.DB,
+	executor executors.Executor,
+	limit *api.QuotaLimit) error {
+
+	godbc.Require(db != nil)
+	godbc.Require(limit != nil)
+
+	if !v.Quota.Enable {
+		return ErrQuotaNotEnabled
+	}
+	err := ValidateQuotaLimit(limit)
+	if err != nil {
+		return err
+	}
+
+	host, err := v.quotaHostName(db)
+	if err != nil {
+		return err
+	}
+
+	err = executor.VolumeQuotaSetLimit(host, v.Info.Name, &executors.QuotaLimit{
+		Path:      limit.Path,
+		Size:      uint64(limit.Size) * GB,
+		SoftLimit: limit.SoftLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Save information on db
+	return db.Update(func(tx *bolt.Tx) error {
+		if v.Quota.Limits == nil {
+			v.Quota.Limits = make(map[string]api.QuotaLimit)
+		}
+		v.Quota.Limits[limit.Path] = *limit
+		return v.Save(tx)
+	})
+}
+
+// Removes the usage limit on a directory of the volume
+func (v *VolumeEntry) QuotaRemoveLimit(db *bolt.DB,
+	executor executors.Executor,
+	path string) error {
+
+	godbc.Require(db != nil)
+
+	if _, ok := v.Quota.Limits[path]; !ok {
+		return ErrNotFound
+	}
+
+	host, err := v.quotaHostName(db)
+	if err != nil {
+		return err
+	}
+
+	err = executor.VolumeQuotaRemoveLimit(host, v.Info.Name, path)
+	if err != nil {
+		return err
+	}
+
+	// Save information on db
+	return db.Update(func(tx *bolt.Tx) error {
+		delete(v.Quota.Limits, path)
+		return v.Save(tx)
+	})
+}
+
+func (v *VolumeEntry) quotaHostName(db *bolt.DB) (string, error) {
+	var host string
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		host, err = v.manageHostName(tx)
+		return err
+	})
+	return host, err
+}
@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package glusterfs
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/tests"
+)
+
+func TestValidateQuotaLimit(t *testing.T) {
+	valid := []api.QuotaLimit{
+		{Path: "/", Size: 1},
+		{Path: "/tenant1", Size: 100},
+		{Path: "/a/b.c/d_e-f", Size: 10, SoftLimit: 70},
+		{Path: "/a", Size: 10, SoftLimit: 99},
+	}
+	for _, limit := range valid {
+		tests.Assert(t, ValidateQuotaLimit(&limit) == nil, limit)
+	}
+
+	invalid := []api.QuotaLimit{
+		{Path: "", Size: 1},
+		{Path: "tenant1", Size: 1},
+		{Path: "/tenant1/", Size: 1},
+		{Path: "/a/../b", Size: 1},
+		{Path: "//a", Size: 1},
+		{Path: "/a b", Size: 1},
+		{Path: "/a;ls", Size: 1},
+		{Path: "/a", Size: 0},
+		{Path: "/a", Size: 1, SoftLimit: -1},
+		{Path: "/a", Size: 1, SoftLimit: 100},
+	}
+	for _, limit := range invalid {
+		tests.Assert(t, ValidateQuotaLimit(&limit) != nil, limit)
+	}
+}
+
+func TestVolumeEntryQuota(t *testing.T) {
+	tmpfile := tests.Tempfile()
+	defer os.Remove(tmpfile)
+
+	// Create the app
+	app := NewTestApp(tmpfile)
+	defer app.Close()
+
+	err := setupSampleDbWithTopology(app,
+		1,    // clusters
+		4,    // nodes_per_cluster
+		2,    // devices_per_node,
+		6*TB, // disksize)
+	)
+	tests.Assert(t, err == nil)
+
+	v := createSampleVolumeEntry(100)
+	err = v.Create(app.db, app.executor, app.allocator)
+	tests.Assert(t, err == nil)
+
+	// Limits need quota enabled
+	limit := &api.QuotaLimit{Path: "/tenant1", Size: 10, SoftLimit: 70}
+	err = v.QuotaSetLimit(app.db, app.executor, limit)
+	tests.Assert(t, err == ErrQuotaNotEnabled)
+
+	// Failure to enable leaves quota disabled
+	ErrMock := errors.New("MOCK")
+	app.xo.MockVolumeQuotaEnable = func(host string, volume string) error {
+		return ErrMock
+	}
+	err = v.QuotaEnable(app.db, app.executor)
+	tests.Assert(t, err == ErrMock)
+	tests.Assert(t, !v.Quota.Enable)
+
+	// Enable quota
+	enabled := 0
+	app.xo.MockVolumeQuotaEnable = func(host string, volume string) error {
+		tests.Assert(t, volume == v.Info.Name)
+		enabled++
+		return nil
+	}
+	err = v.QuotaEnable(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, enabled == 1)
+
+	// Enabling again does nothing
+	err = v.QuotaEnable(app.db, app.executor)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, enabled == 1)
+
+	// Set limits
+	var set *executors.QuotaLimit
+	app.xo.MockVolumeQuotaSetLimit = func(host string, volume string,
+		l *executors.QuotaLimit) error {
+		tests.Assert(t, volume == v.Info.Name)
+		set = l
+		return nil
+	}
+	err = v.QuotaSetLimit(app.db, app.executor, limit)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, set.Path == "/tenant1")
+	tests.Assert(t, set.Size == 10*GB)
+	tests.Assert(t, set.SoftLimit == 70)
+
+	root := &api.QuotaLimit{Path: "/", Size: 90}
+	err = v.QuotaSetLimit(app.db, app.executor, root)
+	tests.Assert(t, err == nil)
+
+	// Invalid limit
+	err = v.QuotaSetLimit(app.db, app.executor, &api.QuotaLimit{Path: "/a;b", Size: 1})
+	tests.Assert(t, err != nil)
+
+	// Check db
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, entry.Quota.Enable)
+		tests.Assert(t, reflect.DeepEqual(entry.QuotaLimits(),
+			[]api.QuotaLimit{*root, *limit}))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+
+	// Remove unknown limit
+	err = v.QuotaRemoveLimit(app.db, app.executor, "/tenant2")
+	tests.Assert(t, err == ErrNotFound)
+
+	// Failure keeps the limit
+	app.xo.MockVolumeQuotaRemoveLimit = func(host string, volume string,
+		path string) error {
+		return ErrMock
+	}
+	err = v.QuotaRemoveLimit(app.db, app.executor, "/tenant1")
+	tests.Assert(t, err == ErrMock)
+	tests.Assert(t, len(v.QuotaLimits()) == 2)
+
+	// Remove limit
+	app.xo.MockVolumeQuotaRemoveLimit = func(host string, volume string,
+		path string) error {
+		tests.Assert(t, path == "/tenant1")
+		return nil
+	}
+	err = v.QuotaRemoveLimit(app.db, app.executor, "/tenant1")
+	tests.Assert(t, err == nil)
+
+	err = app.db.View(func(tx *bolt.Tx) error {
+		entry, err := NewVolumeEntryFromId(tx, v.Info.Id)
+		tests.Assert(t, err == nil)
+		tests.Assert(t, reflect.DeepEqual(entry.QuotaLimits(),
+			[]api.QuotaLimit{*root}))
+		return nil
+	})
+	tests.Assert(t, err == nil)
+}
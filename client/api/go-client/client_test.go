@@ -438,6 +438,15 @@ func TestClientDevice(t *testing.T) {
 	tests.Assert(t, err == nil)
 	tests.Assert(t, deviceInfo.State == api.EntryStateOnline)
 
+	// Resync
+	deviceInfo, err = c.DeviceResync(deviceId)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, deviceInfo.Id == deviceId)
+	tests.Assert(t, deviceInfo.Storage.Total == info.DevicesInfo[0].Storage.Total)
+
+	_, err = c.DeviceResync("badid")
+	tests.Assert(t, err != nil)
+
 	// Try to delete node, and will not until we delete the device
 	err = c.NodeDelete(node.Id)
 	tests.Assert(t, err != nil)
@@ -169,3 +169,81 @@ func (c *Client) DeviceState(id string,
 	}
 	return nil
 }
+
+func (c *Client) DeviceRemove(id string) error {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/devices/"+id+"/remove", nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+func (c *Client) DeviceResync(id string) (*api.DeviceInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/devices/"+id+"/resync", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var device api.DeviceInfoResponse
+	err = utils.GetJsonFromResponse(r, &device)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
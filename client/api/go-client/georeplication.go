@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (c *Client) GeoReplicationCreate(volumeId string,
+	request *api.GeoReplicationCreateRequest) (*api.GeoReplicationInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+volumeId+"/georeplication",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.geoReplicationWaitForInfo(req)
+}
+
+func (c *Client) GeoReplicationList(volumeId string) (*api.GeoReplicationListResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/volumes/"+volumeId+"/georeplication", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var list api.GeoReplicationListResponse
+	err = utils.GetJsonFromResponse(r, &list)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func (c *Client) GeoReplicationInfo(volumeId string,
+	sessionId string) (*api.GeoReplicationInfoResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET",
+		c.host+"/volumes/"+volumeId+"/georeplication/"+sessionId, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var session api.GeoReplicationInfoResponse
+	err = utils.GetJsonFromResponse(r, &session)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (c *Client) GeoReplicationStart(volumeId string,
+	sessionId string) (*api.GeoReplicationInfoResponse, error) {
+	return c.geoReplicationAction(volumeId, sessionId, "start")
+}
+
+func (c *Client) GeoReplicationStop(volumeId string,
+	sessionId string) (*api.GeoReplicationInfoResponse, error) {
+	return c.geoReplicationAction(volumeId, sessionId, "stop")
+}
+
+func (c *Client) GeoReplicationPause(volumeId string,
+	sessionId string) (*api.GeoReplicationInfoResponse, error) {
+	return c.geoReplicationAction(volumeId, sessionId, "pause")
+}
+
+func (c *Client) GeoReplicationResume(volumeId string,
+	sessionId string) (*api.GeoReplicationInfoResponse, error) {
+	return c.geoReplicationAction(volumeId, sessionId, "resume")
+}
+
+func (c *Client) GeoReplicationDelete(volumeId string, sessionId string) error {
+
+	// Create a request
+	req, err := http.NewRequest("DELETE",
+		c.host+"/volumes/"+volumeId+"/georeplication/"+sessionId, nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+func (c *Client) geoReplicationAction(volumeId string,
+	sessionId string,
+	action string) (*api.GeoReplicationInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+volumeId+"/georeplication/"+sessionId+"/"+action, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.geoReplicationWaitForInfo(req)
+}
+
+// Sends an asynchronous geo-replication request and returns the
+// session information once it completes
+func (c *Client) geoReplicationWaitForInfo(req *http.Request) (*api.GeoReplicationInfoResponse, error) {
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var session api.GeoReplicationInfoResponse
+	err = utils.GetJsonFromResponse(r, &session)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
@@ -176,3 +176,38 @@ func (c *Client) NodeState(id string, request *api.StateRequest) error {
 	}
 	return nil
 }
+
+func (c *Client) NodeRemove(id string) error {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/nodes/"+id+"/remove", nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+func (c *Client) VolumeQuota(id string) (*api.QuotaInfoResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/volumes/"+id+"/quota", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var quota api.QuotaInfoResponse
+	err = utils.GetJsonFromResponse(r, &quota)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &quota, nil
+}
+
+func (c *Client) VolumeQuotaEnable(id string) (*api.QuotaInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST", c.host+"/volumes/"+id+"/quota/enable", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.quotaWaitForInfo(req)
+}
+
+func (c *Client) VolumeQuotaSetLimit(id string, limit *api.QuotaLimit) (
+	*api.QuotaInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/quota/limits",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.quotaWaitForInfo(req)
+}
+
+func (c *Client) VolumeQuotaRemoveLimit(id string, path string) error {
+
+	// Create a request
+	req, err := http.NewRequest("DELETE",
+		c.host+"/volumes/"+id+"/quota/limits?path="+url.QueryEscape(path), nil)
+	if err != nil {
+		return err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != http.StatusNoContent {
+		return utils.GetErrorFromResponse(r)
+	}
+
+	return nil
+}
+
+// Sends an asynchronous quota request and returns the quota
+// information of the volume once it completes
+func (c *Client) quotaWaitForInfo(req *http.Request) (*api.QuotaInfoResponse, error) {
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var quota api.QuotaInfoResponse
+	err = utils.GetJsonFromResponse(r, &quota)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &quota, nil
+}
@@ -134,6 +134,106 @@ func (c *Client) VolumeExpand(id string, request *api.VolumeExpandRequest) (
 
 }
 
+func (c *Client) VolumeShrink(id string, request *api.VolumeShrinkRequest) (
+	*api.VolumeInfoResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/shrink",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volume api.VolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &volume)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+
+}
+
+func (c *Client) VolumeReplaceBrick(id, brickId string) (
+	*api.VolumeInfoResponse, error) {
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/bricks/"+brickId+"/replace", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var volume api.VolumeInfoResponse
+	err = utils.GetJsonFromResponse(r, &volume)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &volume, nil
+
+}
+
 func (c *Client) VolumeList() (*api.VolumeListResponse, error) {
 
 	// Create request
@@ -168,9 +268,18 @@ func (c *Client) VolumeList() (*api.VolumeListResponse, error) {
 }
 
 func (c *Client) VolumeInfo(id string) (*api.VolumeInfoResponse, error) {
+	return c.volumeInfo(c.host + "/volumes/" + id)
+}
+
+// Same as VolumeInfo, adding the state of the volume on the nodes
+func (c *Client) VolumeLiveInfo(id string) (*api.VolumeInfoResponse, error) {
+	return c.volumeInfo(c.host + "/volumes/" + id + "?live=true")
+}
+
+func (c *Client) volumeInfo(url string) (*api.VolumeInfoResponse, error) {
 
 	// Create request
-	req, err := http.NewRequest("GET", c.host+"/volumes/"+id, nil)
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -235,3 +344,124 @@ func (c *Client) VolumeDelete(id string) error {
 
 	return nil
 }
+
+func (c *Client) VolumeOptions(id string) (*api.VolumeOptionsResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/volumes/"+id+"/options", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var options api.VolumeOptionsResponse
+	err = utils.GetJsonFromResponse(r, &options)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &options, nil
+}
+
+func (c *Client) VolumeSetOptions(id string, request *api.VolumeOptionsRequest) (
+	*api.VolumeOptionsResponse, error) {
+
+	// Marshal request to JSON
+	buffer, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a request
+	req, err := http.NewRequest("POST",
+		c.host+"/volumes/"+id+"/options",
+		bytes.NewBuffer(buffer))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send request
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusAccepted {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Wait for response
+	r, err = c.waitForResponseWithTimer(r, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var options api.VolumeOptionsResponse
+	err = utils.GetJsonFromResponse(r, &options)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &options, nil
+}
+
+func (c *Client) VolumeHealInfo(id string) (*api.VolumeHealInfoResponse, error) {
+
+	// Create request
+	req, err := http.NewRequest("GET", c.host+"/volumes/"+id+"/heal", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set token
+	err = c.setToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get info
+	r, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, utils.GetErrorFromResponse(r)
+	}
+
+	// Read JSON response
+	var heal api.VolumeHealInfoResponse
+	err = utils.GetJsonFromResponse(r, &heal)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &heal, nil
+}
@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	RootCmd.AddCommand(dbCommand)
+	dbCommand.AddCommand(dbCheckCommand)
+	dbCheckCommand.SilenceUsage = true
+}
+
+var dbCommand = &cobra.Command{
+	Use:   "db",
+	Short: "Heketi db management",
+	Long:  "Heketi Db Management",
+}
+
+var dbCheckCommand = &cobra.Command{
+	Use:   "check",
+	Short: "Compares the Heketi db with the nodes and volumes of the clusters",
+	Long: "Compares the Heketi db with the nodes and volumes of the clusters.\n" +
+		"Reports missing and unknown volume groups, bricks and volumes, and\n" +
+		"bricks or devices whose size differs from the db.",
+	Example: "  $ heketi-cli db check",
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Check the db
+		report, err := heketi.ConsistencyCheck()
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(report)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", report)
+		}
+
+		if !report.Consistent {
+			return errors.New("Heketi db is not consistent with the clusters")
+		}
+		return nil
+	},
+}
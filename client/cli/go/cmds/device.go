@@ -28,6 +28,8 @@ import (
 
 var (
 	device, nodeId string
+	deviceClass    string
+	destroyData    bool
 )
 
 func init() {
@@ -37,13 +39,23 @@ func init() {
 	deviceCommand.AddCommand(deviceInfoCommand)
 	deviceCommand.AddCommand(deviceEnableCommand)
 	deviceCommand.AddCommand(deviceDisableCommand)
+	deviceCommand.AddCommand(deviceRemoveCommand)
+	deviceCommand.AddCommand(deviceResyncCommand)
 	deviceAddCommand.Flags().StringVar(&device, "name", "",
 		"Name of device to add")
 	deviceAddCommand.Flags().StringVar(&nodeId, "node", "",
 		"Id of the node which has this device")
+	deviceAddCommand.Flags().StringVar(&deviceClass, "class", "",
+		"Optional: Class of the device, such as ssd.  Arbiter bricks are placed"+
+			"\n\ton devices of another class than the data bricks when possible")
+	deviceAddCommand.Flags().BoolVar(&destroyData, "destroy-existing-data", false,
+		"Optional: Wipe the partition table, filesystem and volume group"+
+			"\n\tsignatures found on the device.  Mounted devices are never wiped")
 	deviceAddCommand.SilenceUsage = true
 	deviceDeleteCommand.SilenceUsage = true
 	deviceInfoCommand.SilenceUsage = true
+	deviceRemoveCommand.SilenceUsage = true
+	deviceResyncCommand.SilenceUsage = true
 }
 
 var deviceCommand = &cobra.Command{
@@ -72,6 +84,8 @@ var deviceAddCommand = &cobra.Command{
 		req := &api.DeviceAddRequest{}
 		req.Name = device
 		req.NodeId = nodeId
+		req.Class = deviceClass
+		req.DestroyData = destroyData
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
@@ -160,6 +174,9 @@ var deviceInfoCommand = &cobra.Command{
 				info.Storage.Total/(1024*1024),
 				info.Storage.Used/(1024*1024),
 				info.Storage.Free/(1024*1024))
+			if info.Class != "" {
+				fmt.Fprintf(stdout, "Class: %v\n", info.Class)
+			}
 
 			fmt.Fprintf(stdout, "Bricks:\n")
 			for _, d := range info.Bricks {
@@ -239,3 +256,65 @@ var deviceDisableCommand = &cobra.Command{
 		return err
 	},
 }
+
+var deviceRemoveCommand = &cobra.Command{
+	Use:   "remove [device_id]",
+	Short: "Moves all bricks off a device",
+	Long: "Moves all bricks off a device to other devices in the cluster." +
+		"\nThe device must be disabled first, and can be deleted once" +
+		"\nall of its bricks have been moved.",
+	Example: "  $ heketi-cli device remove 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("device id missing")
+		}
+
+		//set deviceId
+		deviceId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		err := heketi.DeviceRemove(deviceId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Device %v is now empty\n", deviceId)
+		}
+
+		return err
+	},
+}
+
+var deviceResyncCommand = &cobra.Command{
+	Use:   "resync [device_id]",
+	Short: "Updates the size of a device",
+	Long: "Grows the physical volume of a device to the size of the disk" +
+		"\nand updates the storage of the device in Heketi.",
+	Example: "  $ heketi-cli device resync 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("device id missing")
+		}
+
+		//set deviceId
+		deviceId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		device, err := heketi.DeviceResync(deviceId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Device %v size is now %v GiB, %v GiB free\n",
+				deviceId,
+				device.Storage.Total/(1024*1024),
+				device.Storage.Free/(1024*1024))
+		}
+
+		return err
+	},
+}
@@ -0,0 +1,236 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	geoReplicationSlaveVolume string
+)
+
+func init() {
+	volumeCommand.AddCommand(geoReplicationCommand)
+	geoReplicationCommand.AddCommand(geoReplicationCreateCommand)
+	geoReplicationCommand.AddCommand(geoReplicationListCommand)
+	geoReplicationCommand.AddCommand(geoReplicationInfoCommand)
+	geoReplicationCommand.AddCommand(geoReplicationStartCommand)
+	geoReplicationCommand.AddCommand(geoReplicationStopCommand)
+	geoReplicationCommand.AddCommand(geoReplicationPauseCommand)
+	geoReplicationCommand.AddCommand(geoReplicationResumeCommand)
+	geoReplicationCommand.AddCommand(geoReplicationDeleteCommand)
+
+	geoReplicationCreateCommand.Flags().StringVar(&geoReplicationSlaveVolume, "slave-volume", "",
+		"\n\tId of the volume in another cluster receiving the data")
+	geoReplicationCreateCommand.SilenceUsage = true
+	geoReplicationListCommand.SilenceUsage = true
+	geoReplicationInfoCommand.SilenceUsage = true
+	geoReplicationStartCommand.SilenceUsage = true
+	geoReplicationStopCommand.SilenceUsage = true
+	geoReplicationPauseCommand.SilenceUsage = true
+	geoReplicationResumeCommand.SilenceUsage = true
+	geoReplicationDeleteCommand.SilenceUsage = true
+}
+
+func printGeoReplicationInfo(info *api.GeoReplicationInfoResponse) error {
+	if options.Json {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s", data)
+	} else {
+		fmt.Fprintf(stdout, "%v", info)
+	}
+	return nil
+}
+
+// Returns a command running the client function on a session
+func newGeoReplicationSessionCommand(name string,
+	short string,
+	run func(heketi *client.Client, volumeId, sessionId string) (*api.GeoReplicationInfoResponse, error)) *cobra.Command {
+
+	return &cobra.Command{
+		Use:   name + " [volume_id] [session_id]",
+		Short: short,
+		Long:  short,
+		Example: fmt.Sprintf("  $ heketi-cli volume georeplication %v "+
+			"886a86a868711bef83001 a0d3fe8b56cd8e82b3e9", name),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			//ensure proper number of args
+			s := cmd.Flags().Args()
+			if len(s) < 2 {
+				return errors.New("Volume id or session id missing")
+			}
+
+			// Set ids
+			volumeId := cmd.Flags().Arg(0)
+			sessionId := cmd.Flags().Arg(1)
+
+			// Create a client
+			heketi := client.NewClient(options.Url, options.User, options.Key)
+
+			info, err := run(heketi, volumeId, sessionId)
+			if err != nil {
+				return err
+			}
+
+			return printGeoReplicationInfo(info)
+		},
+	}
+}
+
+var geoReplicationCommand = &cobra.Command{
+	Use:     "georeplication",
+	Aliases: []string{"georep"},
+	Short:   "Heketi Volume Geo-replication Management",
+	Long:    "Heketi Volume Geo-replication Management",
+}
+
+var geoReplicationCreateCommand = &cobra.Command{
+	Use:   "create [volume_id]",
+	Short: "Creates a geo-replication session to a volume of another cluster",
+	Long: "Creates a geo-replication session to a volume of another cluster." +
+		"\nThe nodes of the volume must be able to ssh as root to the nodes" +
+		"\nof the slave volume.",
+	Example: `  $ heketi-cli volume georeplication create 886a86a868711bef83001 \
+      --slave-volume=5e8bd7ee2d5a1b2ab0f1`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+		if geoReplicationSlaveVolume == "" {
+			return errors.New("Missing slave volume id")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create request blob
+		req := &api.GeoReplicationCreateRequest{}
+		req.SlaveVolumeId = geoReplicationSlaveVolume
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Create session
+		info, err := heketi.GeoReplicationCreate(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		return printGeoReplicationInfo(info)
+	},
+}
+
+var geoReplicationListCommand = &cobra.Command{
+	Use:     "list [volume_id]",
+	Short:   "Lists the geo-replication sessions from or to a volume",
+	Long:    "Lists the geo-replication sessions from or to a volume",
+	Example: "  $ heketi-cli volume georeplication list 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// List sessions
+		list, err := heketi.GeoReplicationList(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			for _, id := range list.Sessions {
+				fmt.Fprintf(stdout, "Id:%v\n", id)
+			}
+		}
+
+		return nil
+	},
+}
+
+var geoReplicationInfoCommand = newGeoReplicationSessionCommand("info",
+	"Retreives information and status of a geo-replication session",
+	(*client.Client).GeoReplicationInfo)
+
+var geoReplicationStartCommand = newGeoReplicationSessionCommand("start",
+	"Starts a geo-replication session",
+	(*client.Client).GeoReplicationStart)
+
+var geoReplicationStopCommand = newGeoReplicationSessionCommand("stop",
+	"Stops a geo-replication session",
+	(*client.Client).GeoReplicationStop)
+
+var geoReplicationPauseCommand = newGeoReplicationSessionCommand("pause",
+	"Pauses a started geo-replication session",
+	(*client.Client).GeoReplicationPause)
+
+var geoReplicationResumeCommand = newGeoReplicationSessionCommand("resume",
+	"Resumes a paused geo-replication session",
+	(*client.Client).GeoReplicationResume)
+
+var geoReplicationDeleteCommand = &cobra.Command{
+	Use:     "delete [volume_id] [session_id]",
+	Short:   "Stops and deletes a geo-replication session",
+	Long:    "Stops and deletes a geo-replication session",
+	Example: "  $ heketi-cli volume georeplication delete 886a86a868711bef83001 a0d3fe8b56cd8e82b3e9",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or session id missing")
+		}
+
+		// Set ids
+		volumeId := cmd.Flags().Arg(0)
+		sessionId := cmd.Flags().Arg(1)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Delete session
+		err := heketi.GeoReplicationDelete(volumeId, sessionId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Geo-replication session %v deleted\n", sessionId)
+		}
+
+		return err
+	},
+}
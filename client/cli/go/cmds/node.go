@@ -31,6 +31,9 @@ var (
 	managmentHostNames string
 	storageHostNames   string
 	clusterId          string
+	sshUser            string
+	sshPort            string
+	sshKeyFile         string
 )
 
 func init() {
@@ -40,13 +43,18 @@ func init() {
 	nodeCommand.AddCommand(nodeInfoCommand)
 	nodeCommand.AddCommand(nodeEnableCommand)
 	nodeCommand.AddCommand(nodeDisableCommand)
+	nodeCommand.AddCommand(nodeRemoveCommand)
 	nodeAddCommand.Flags().IntVar(&zone, "zone", -1, "The zone in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&clusterId, "cluster", "", "The cluster in which the node should reside")
 	nodeAddCommand.Flags().StringVar(&managmentHostNames, "management-host-name", "", "Management host name")
 	nodeAddCommand.Flags().StringVar(&storageHostNames, "storage-host-name", "", "Storage host name")
+	nodeAddCommand.Flags().StringVar(&sshUser, "ssh-user", "", "Optional: Ssh user of the node.  Default is the server configuration")
+	nodeAddCommand.Flags().StringVar(&sshPort, "ssh-port", "", "Optional: Ssh port of the node.  Default is the server configuration")
+	nodeAddCommand.Flags().StringVar(&sshKeyFile, "ssh-keyfile", "", "Optional: Ssh private key file on the server for the node")
 	nodeAddCommand.SilenceUsage = true
 	nodeDeleteCommand.SilenceUsage = true
 	nodeInfoCommand.SilenceUsage = true
+	nodeRemoveCommand.SilenceUsage = true
 }
 
 var nodeCommand = &cobra.Command{
@@ -86,6 +94,13 @@ var nodeAddCommand = &cobra.Command{
 		req.Hostnames.Manage = []string{managmentHostNames}
 		req.Hostnames.Storage = []string{storageHostNames}
 		req.Zone = zone
+		if sshUser != "" || sshPort != "" || sshKeyFile != "" {
+			req.Ssh = &api.NodeSshSettings{
+				User:    sshUser,
+				Port:    sshPort,
+				KeyFile: sshKeyFile,
+			}
+		}
 
 		// Create a client
 		heketi := client.NewClient(options.Url, options.User, options.Key)
@@ -276,3 +291,34 @@ var nodeInfoCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var nodeRemoveCommand = &cobra.Command{
+	Use:   "remove [node_id]",
+	Short: "Moves all bricks off a node",
+	Long: "Moves all bricks off the devices of a node to other nodes in" +
+		"\nthe cluster.  The node must be disabled first.  Once all of" +
+		"\nits bricks have been moved, its devices and then the node" +
+		"\ncan be deleted.",
+	Example: "  $ heketi-cli node remove 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := cmd.Flags().Args()
+
+		//ensure proper number of args
+		if len(s) < 1 {
+			return errors.New("node id missing")
+		}
+
+		//set nodeId
+		nodeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		err := heketi.NodeRemove(nodeId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Node %v is now empty\n", nodeId)
+		}
+
+		return err
+	},
+}
@@ -0,0 +1,308 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotName        string
+	snapshotDescription string
+	snapshotCloneName   string
+)
+
+func init() {
+	volumeCommand.AddCommand(snapshotCommand)
+	snapshotCommand.AddCommand(snapshotCreateCommand)
+	snapshotCommand.AddCommand(snapshotDeleteCommand)
+	snapshotCommand.AddCommand(snapshotInfoCommand)
+	snapshotCommand.AddCommand(snapshotListCommand)
+	snapshotCommand.AddCommand(snapshotRestoreCommand)
+	snapshotCommand.AddCommand(snapshotCloneCommand)
+
+	snapshotCreateCommand.Flags().StringVar(&snapshotName, "name", "",
+		"\n\tOptional: Name of the snapshot")
+	snapshotCreateCommand.Flags().StringVar(&snapshotDescription, "description", "",
+		"\n\tOptional: Description of the snapshot")
+	snapshotCloneCommand.Flags().StringVar(&snapshotCloneName, "name", "",
+		"\n\tOptional: Name of the new volume")
+	snapshotCreateCommand.SilenceUsage = true
+	snapshotDeleteCommand.SilenceUsage = true
+	snapshotInfoCommand.SilenceUsage = true
+	snapshotListCommand.SilenceUsage = true
+	snapshotRestoreCommand.SilenceUsage = true
+	snapshotCloneCommand.SilenceUsage = true
+}
+
+var snapshotCommand = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Heketi Volume Snapshot Management",
+	Long:  "Heketi Volume Snapshot Management",
+}
+
+var snapshotCreateCommand = &cobra.Command{
+	Use:   "create [volume_id]",
+	Short: "Create a snapshot of a volume",
+	Long:  "Create a snapshot of a volume",
+	Example: `  * Create a snapshot of a volume:
+      $ heketi-cli volume snapshot create 886a86a868711bef83001
+
+  * Create a named snapshot with a description:
+      $ heketi-cli volume snapshot create 886a86a868711bef83001 \
+        --name=nightly --description="Before upgrade"
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create request blob
+		req := &api.SnapshotCreateRequest{}
+		req.Name = snapshotName
+		req.Description = snapshotDescription
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Create snapshot
+		snapshot, err := heketi.SnapshotCreate(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", snapshot)
+		}
+
+		return nil
+	},
+}
+
+var snapshotDeleteCommand = &cobra.Command{
+	Use:     "delete [volume_id] [snapshot_id]",
+	Short:   "Deletes a snapshot of a volume",
+	Long:    "Deletes a snapshot of a volume",
+	Example: "  $ heketi-cli volume snapshot delete 886a86a868711bef83001 a0d3fe8b56cd8e82b3e9",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or snapshot id missing")
+		}
+
+		// Set ids
+		volumeId := cmd.Flags().Arg(0)
+		snapshotId := cmd.Flags().Arg(1)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Delete snapshot
+		err := heketi.SnapshotDelete(volumeId, snapshotId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Snapshot %v deleted\n", snapshotId)
+		}
+
+		return err
+	},
+}
+
+var snapshotInfoCommand = &cobra.Command{
+	Use:     "info [volume_id] [snapshot_id]",
+	Short:   "Retreives information about a snapshot",
+	Long:    "Retreives information about a snapshot",
+	Example: "  $ heketi-cli volume snapshot info 886a86a868711bef83001 a0d3fe8b56cd8e82b3e9",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or snapshot id missing")
+		}
+
+		// Set ids
+		volumeId := cmd.Flags().Arg(0)
+		snapshotId := cmd.Flags().Arg(1)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Get snapshot information
+		info, err := heketi.SnapshotInfo(volumeId, snapshotId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", info)
+		}
+		return nil
+	},
+}
+
+var snapshotListCommand = &cobra.Command{
+	Use:     "list [volume_id]",
+	Short:   "Lists the snapshots of a volume",
+	Long:    "Lists the snapshots of a volume",
+	Example: "  $ heketi-cli volume snapshot list 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// List snapshots
+		list, err := heketi.SnapshotList(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(list)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			for _, id := range list.Snapshots {
+				snapshot, err := heketi.SnapshotInfo(volumeId, id)
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintf(stdout, "Id:%-35v Name:%v\n",
+					id,
+					snapshot.Name)
+			}
+		}
+
+		return nil
+	},
+}
+
+var snapshotRestoreCommand = &cobra.Command{
+	Use:   "restore [volume_id] [snapshot_id]",
+	Short: "Restores a volume from one of its snapshots",
+	Long: "Restores a volume from one of its snapshots.  The volume is" +
+		"\nstopped during the restore and GlusterFS removes the snapshot" +
+		"\nonce it has been restored.",
+	Example: "  $ heketi-cli volume snapshot restore 886a86a868711bef83001 a0d3fe8b56cd8e82b3e9",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or snapshot id missing")
+		}
+
+		// Set ids
+		volumeId := cmd.Flags().Arg(0)
+		snapshotId := cmd.Flags().Arg(1)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Restore snapshot
+		_, err := heketi.SnapshotRestore(volumeId, snapshotId)
+		if err == nil {
+			fmt.Fprintf(stdout, "Volume %v restored from snapshot %v\n",
+				volumeId, snapshotId)
+		}
+
+		return err
+	},
+}
+
+var snapshotCloneCommand = &cobra.Command{
+	Use:   "clone [volume_id] [snapshot_id]",
+	Short: "Creates a new volume from a snapshot",
+	Long: "Creates a new volume from a snapshot.  The new volume shares" +
+		"\nthe storage of the volume the snapshot was taken from, which" +
+		"\ncannot be deleted while the new volume exists.",
+	Example: `  * Clone a snapshot:
+      $ heketi-cli volume snapshot clone 886a86a868711bef83001 a0d3fe8b56cd8e82b3e9
+
+  * Clone a snapshot to a volume named 'devcopy':
+      $ heketi-cli volume snapshot clone 886a86a868711bef83001 a0d3fe8b56cd8e82b3e9 \
+        --name=devcopy
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or snapshot id missing")
+		}
+
+		// Set ids
+		volumeId := cmd.Flags().Arg(0)
+		snapshotId := cmd.Flags().Arg(1)
+
+		// Create request blob
+		req := &api.SnapshotCloneRequest{}
+		req.Name = snapshotCloneName
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Clone snapshot
+		volume, err := heketi.SnapshotClone(volumeId, snapshotId, req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(volume)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+
+		return nil
+	},
+}
@@ -248,6 +248,7 @@ var topologyInfoCommand = &cobra.Command{
 						"\tSize: %v\n"+
 						"\tId: %v\n"+
 						"\tCluster Id: %v\n"+
+						"\tState: %v\n"+
 						"\tMount: %v\n"+
 						"\tMount Options: backup-volfile-servers=%v\n"+
 						"\tDurability Type: %v\n",
@@ -255,6 +256,7 @@ var topologyInfoCommand = &cobra.Command{
 						v.Size,
 						v.Id,
 						v.Cluster,
+						v.State,
 						v.Mount.GlusterFS.MountPoint,
 						v.Mount.GlusterFS.Options["backup-volfile-servers"],
 						v.Durability.Type)
@@ -39,10 +39,13 @@ var (
 	snapshotFactor float64
 	clusters       string
 	expandSize     int
+	shrinkSize     int
+	glusterOptions string
 	id             string
 	kubePvFile     string
 	kubePvEndpoint string
 	kubePv         bool
+	volumeLive     bool
 )
 
 func init() {
@@ -50,8 +53,11 @@ func init() {
 	volumeCommand.AddCommand(volumeCreateCommand)
 	volumeCommand.AddCommand(volumeDeleteCommand)
 	volumeCommand.AddCommand(volumeExpandCommand)
+	volumeCommand.AddCommand(volumeHealInfoCommand)
 	volumeCommand.AddCommand(volumeInfoCommand)
 	volumeCommand.AddCommand(volumeListCommand)
+	volumeCommand.AddCommand(volumeReplaceBrickCommand)
+	volumeCommand.AddCommand(volumeShrinkCommand)
 
 	volumeCreateCommand.Flags().IntVar(&size, "size", -1,
 		"\n\tSize of volume in GB")
@@ -61,7 +67,9 @@ func init() {
 		"\n\tOptional: Durability type.  Values are:"+
 			"\n\t\tnone: No durability.  Distributed volume only."+
 			"\n\t\treplicate: (Default) Distributed-Replica volume."+
-			"\n\t\tdisperse: Distributed-Erasure Coded volume.")
+			"\n\t\tdisperse: Distributed-Erasure Coded volume."+
+			"\n\t\tarbiter: Distributed-Replica 3 volume with an arbiter brick"+
+			"\n\t\t\tonly holding metadata in each replica set.")
 	volumeCreateCommand.Flags().IntVar(&replica, "replica", 3,
 		"\n\tReplica value for durability type 'replicate'."+
 			"\n\tDefault is 3")
@@ -82,6 +90,9 @@ func init() {
 			"\n\ton any of the configured clusters which have the available space."+
 			"\n\tProviding a set of clusters will ensure Heketi allocates storage"+
 			"\n\tfor this volume only in the clusters specified.")
+	volumeCreateCommand.Flags().StringVar(&glusterOptions, "options", "",
+		"\n\tOptional: Comma separated list of GlusterFS volume options"+
+			"\n\tin the form option=value.")
 	volumeCreateCommand.Flags().BoolVar(&kubePv, "persistent-volume", false,
 		"\n\tOptional: Output to standard out a persistent volume JSON file for OpenShift or"+
 			"\n\tKubernetes with the name provided.")
@@ -94,11 +105,21 @@ func init() {
 		"\n\tAmount in GB to add to the volume")
 	volumeExpandCommand.Flags().StringVar(&id, "volume", "",
 		"\n\tId of volume to expand")
+	volumeInfoCommand.Flags().BoolVar(&volumeLive, "live", false,
+		"\n\tOptional: Add the state of the volume and its bricks"+
+			"\n\tas reported by GlusterFS.")
+	volumeShrinkCommand.Flags().IntVar(&shrinkSize, "shrink-size", -1,
+		"\n\tAmount in GB to remove from the volume")
+	volumeShrinkCommand.Flags().StringVar(&id, "volume", "",
+		"\n\tId of volume to shrink")
 	volumeCreateCommand.SilenceUsage = true
 	volumeDeleteCommand.SilenceUsage = true
 	volumeExpandCommand.SilenceUsage = true
+	volumeHealInfoCommand.SilenceUsage = true
 	volumeInfoCommand.SilenceUsage = true
 	volumeListCommand.SilenceUsage = true
+	volumeReplaceBrickCommand.SilenceUsage = true
+	volumeShrinkCommand.SilenceUsage = true
 }
 
 var volumeCommand = &cobra.Command{
@@ -130,6 +151,12 @@ var volumeCreateCommand = &cobra.Command{
   * Create a 100GB erasure coded 8+3 volume with 25GB snapshot storage:
       $ heketi-cli volume create --size=100 --durability=disperse --snapshot-factor=1.25 \
         --disperse-data=8 --redundancy=3
+
+  * Create a 100GB replica 3 arbiter 1 volume:
+      $ heketi-cli volume create --size=100 --durability=arbiter
+
+  * Create a 100GB replica 3 volume with a 1GB read cache:
+      $ heketi-cli volume create --size=100 --options=performance.cache-size=1GB
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check volume size
@@ -162,6 +189,14 @@ var volumeCreateCommand = &cobra.Command{
 			req.Name = volname
 		}
 
+		if glusterOptions != "" {
+			var err error
+			req.Options, err = parseVolumeOptions(strings.Split(glusterOptions, ","))
+			if err != nil {
+				return err
+			}
+		}
+
 		if snapshotFactor > 1.0 {
 			req.Snapshot.Factor = float32(snapshotFactor)
 			req.Snapshot.Enable = true
@@ -289,11 +324,62 @@ var volumeExpandCommand = &cobra.Command{
 	},
 }
 
+var volumeShrinkCommand = &cobra.Command{
+	Use:   "shrink",
+	Short: "Shrink a volume",
+	Long: "Shrink a volume by removing whole brick sets.  The data on the" +
+		"\nremoved bricks is moved to the rest of the volume first.  The" +
+		"\nvolume shrinks by the largest amount up to the size requested" +
+		"\nwhich can be removed in brick sets.",
+	Example: `  * Remove up to 10GB from a volume
+    $ heketi-cli volume shrink --volume=60d46d518074b13a04ce1022c8c7193c --shrink-size=10
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Check volume size
+		if shrinkSize == -1 {
+			return errors.New("Missing volume amount to shrink")
+		}
+
+		if id == "" {
+			return errors.New("Missing volume id")
+		}
+
+		// Create request
+		req := &api.VolumeShrinkRequest{}
+		req.Size = shrinkSize
+
+		// Create client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Shrink volume
+		volume, err := heketi.VolumeShrink(id, req)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(volume)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
+
 var volumeInfoCommand = &cobra.Command{
-	Use:     "info",
-	Short:   "Retreives information about the volume",
-	Long:    "Retreives information about the volume",
-	Example: "  $ heketi-cli volume info 886a86a868711bef83001",
+	Use:   "info",
+	Short: "Retreives information about the volume",
+	Long:  "Retreives information about the volume",
+	Example: `  * Show the information Heketi has about a volume
+    $ heketi-cli volume info 886a86a868711bef83001
+
+  * Also show the state of the volume and its bricks on the nodes
+    $ heketi-cli volume info 886a86a868711bef83001 --live
+`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		//ensure proper number of args
 		s := cmd.Flags().Args()
@@ -307,8 +393,16 @@ var volumeInfoCommand = &cobra.Command{
 		// Create a client to talk to Heketi
 		heketi := client.NewClient(options.Url, options.User, options.Key)
 
-		// Create cluster
-		info, err := heketi.VolumeInfo(volumeId)
+		// Get volume information
+		var (
+			info *api.VolumeInfoResponse
+			err  error
+		)
+		if volumeLive {
+			info, err = heketi.VolumeLiveInfo(volumeId)
+		} else {
+			info, err = heketi.VolumeInfo(volumeId)
+		}
 		if err != nil {
 			return err
 		}
@@ -327,6 +421,45 @@ var volumeInfoCommand = &cobra.Command{
 	},
 }
 
+var volumeHealInfoCommand = &cobra.Command{
+	Use:   "heal-info",
+	Short: "Shows the entries of the volume pending heal and in split-brain",
+	Long:  "Shows the entries of the volume pending heal and in split-brain",
+	Example: `  * Check a volume is healed before taking another node down
+    $ heketi-cli volume heal-info 886a86a868711bef83001
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client to talk to Heketi
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Get heal information
+		info, err := heketi.VolumeHealInfo(volumeId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", info)
+		}
+		return nil
+	},
+}
+
 var volumeListCommand = &cobra.Command{
 	Use:     "list",
 	Short:   "Lists the volumes managed by Heketi",
@@ -355,9 +488,10 @@ var volumeListCommand = &cobra.Command{
 					return err
 				}
 
-				fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v Name:%v\n",
+				fmt.Fprintf(stdout, "Id:%-35v Cluster:%-35v State:%-10v Name:%v\n",
 					id,
 					volume.Cluster,
+					volume.State,
 					volume.Name)
 			}
 		}
@@ -365,3 +499,43 @@ var volumeListCommand = &cobra.Command{
 		return nil
 	},
 }
+
+var volumeReplaceBrickCommand = &cobra.Command{
+	Use:   "replace-brick",
+	Short: "Moves a brick of the volume to another device",
+	Long:  "Moves a brick of the volume to another device",
+	Example: `  * Replace brick 3e0bdb5a85d8d2bb8dd6a2a1fc3fc18e of a volume
+    $ heketi-cli volume replace-brick 886a86a868711bef83001 3e0bdb5a85d8d2bb8dd6a2a1fc3fc18e
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or brick id missing")
+		}
+
+		// Set ids
+		volumeId := cmd.Flags().Arg(0)
+		brickId := cmd.Flags().Arg(1)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Replace brick
+		volume, err := heketi.VolumeReplaceBrick(volumeId, brickId)
+		if err != nil {
+			return err
+		}
+
+		if options.Json {
+			data, err := json.Marshal(volume)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s", data)
+		} else {
+			fmt.Fprintf(stdout, "%v", volume)
+		}
+		return nil
+	},
+}
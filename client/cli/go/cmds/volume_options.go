@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	volumeCommand.AddCommand(volumeOptionsCommand)
+	volumeOptionsCommand.AddCommand(volumeOptionsGetCommand)
+	volumeOptionsCommand.AddCommand(volumeOptionsSetCommand)
+
+	volumeOptionsGetCommand.SilenceUsage = true
+	volumeOptionsSetCommand.SilenceUsage = true
+}
+
+// Parses options in the form option=value
+func parseVolumeOptions(list []string) (map[string]string, error) {
+	parsed := make(map[string]string)
+	for _, option := range list {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("Invalid volume option '%v', must be option=value", option)
+		}
+		parsed[kv[0]] = kv[1]
+	}
+	return parsed, nil
+}
+
+func printVolumeOptions(info *api.VolumeOptionsResponse) error {
+	if options.Json {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s", data)
+		return nil
+	}
+
+	keys := make([]string, 0, len(info.Options))
+	for key := range info.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(stdout, "%v: %v\n", key, info.Options[key])
+	}
+
+	return nil
+}
+
+var volumeOptionsCommand = &cobra.Command{
+	Use:   "options",
+	Short: "Heketi Volume Options Management",
+	Long:  "Heketi Volume Options Management",
+}
+
+var volumeOptionsGetCommand = &cobra.Command{
+	Use:     "get [volume_id]",
+	Short:   "Shows the GlusterFS options set on a volume",
+	Long:    "Shows the GlusterFS options set on a volume",
+	Example: "  $ heketi-cli volume options get 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Get options
+		info, err := heketi.VolumeOptions(volumeId)
+		if err != nil {
+			return err
+		}
+
+		return printVolumeOptions(info)
+	},
+}
+
+var volumeOptionsSetCommand = &cobra.Command{
+	Use:   "set [volume_id] [option=value]...",
+	Short: "Sets GlusterFS options on a volume",
+	Long:  "Sets GlusterFS options on a volume",
+	Example: `  * Set the read cache size and ping timeout of a volume:
+      $ heketi-cli volume options set 886a86a868711bef83001 \
+        performance.cache-size=1GB network.ping-timeout=10
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 2 {
+			return errors.New("Volume id or options missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create request blob
+		req := &api.VolumeOptionsRequest{}
+		var err error
+		req.Options, err = parseVolumeOptions(s[1:])
+		if err != nil {
+			return err
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Set options
+		info, err := heketi.VolumeSetOptions(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		return printVolumeOptions(info)
+	},
+}
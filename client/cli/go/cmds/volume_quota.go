@@ -0,0 +1,221 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	client "github.com/heketi/heketi/client/api/go-client"
+	"github.com/heketi/heketi/pkg/glusterfs/api"
+	"github.com/spf13/cobra"
+)
+
+var (
+	quotaPath      string
+	quotaSize      int
+	quotaSoftLimit int
+)
+
+func init() {
+	volumeCommand.AddCommand(volumeQuotaCommand)
+	volumeQuotaCommand.AddCommand(volumeQuotaEnableCommand)
+	volumeQuotaCommand.AddCommand(volumeQuotaListCommand)
+	volumeQuotaCommand.AddCommand(volumeQuotaSetCommand)
+	volumeQuotaCommand.AddCommand(volumeQuotaRemoveCommand)
+
+	volumeQuotaSetCommand.Flags().StringVar(&quotaPath, "path", "/",
+		"\n\tDirectory of the volume to limit, / for the whole volume")
+	volumeQuotaSetCommand.Flags().IntVar(&quotaSize, "size", -1,
+		"\n\tUsage limit in GB")
+	volumeQuotaSetCommand.Flags().IntVar(&quotaSoftLimit, "soft-limit", 0,
+		"\n\tOptional: Percentage of the usage limit after which warnings"+
+			"\n\tare logged. Default is the GlusterFS default of 80")
+	volumeQuotaRemoveCommand.Flags().StringVar(&quotaPath, "path", "",
+		"\n\tDirectory of the volume to remove the usage limit from")
+
+	volumeQuotaEnableCommand.SilenceUsage = true
+	volumeQuotaListCommand.SilenceUsage = true
+	volumeQuotaSetCommand.SilenceUsage = true
+	volumeQuotaRemoveCommand.SilenceUsage = true
+}
+
+func printVolumeQuota(quota *api.QuotaInfoResponse) error {
+	if options.Json {
+		data, err := json.Marshal(quota)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s", data)
+		return nil
+	}
+
+	fmt.Fprintf(stdout, "Quota Enabled: %v\n", quota.Enable)
+	for _, limit := range quota.Limits {
+		fmt.Fprintf(stdout, "Path: %v\tSize: %v GB", limit.Path, limit.Size)
+		if limit.SoftLimit != 0 {
+			fmt.Fprintf(stdout, "\tSoft Limit: %v%%", limit.SoftLimit)
+		}
+		fmt.Fprintf(stdout, "\n")
+	}
+
+	return nil
+}
+
+var volumeQuotaCommand = &cobra.Command{
+	Use:   "quota",
+	Short: "Heketi Volume Quota Management",
+	Long:  "Heketi Volume Quota Management",
+}
+
+var volumeQuotaEnableCommand = &cobra.Command{
+	Use:     "enable [volume_id]",
+	Short:   "Enables quota on a volume",
+	Long:    "Enables quota on a volume",
+	Example: "  $ heketi-cli volume quota enable 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Enable quota
+		quota, err := heketi.VolumeQuotaEnable(volumeId)
+		if err != nil {
+			return err
+		}
+
+		return printVolumeQuota(quota)
+	},
+}
+
+var volumeQuotaListCommand = &cobra.Command{
+	Use:     "list [volume_id]",
+	Short:   "Lists the usage limits of a volume",
+	Long:    "Lists the usage limits of a volume",
+	Example: "  $ heketi-cli volume quota list 886a86a868711bef83001",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Get quota
+		quota, err := heketi.VolumeQuota(volumeId)
+		if err != nil {
+			return err
+		}
+
+		return printVolumeQuota(quota)
+	},
+}
+
+var volumeQuotaSetCommand = &cobra.Command{
+	Use:   "set [volume_id]",
+	Short: "Sets the usage limit of a directory of a volume",
+	Long:  "Sets the usage limit of a directory of a volume",
+	Example: `  * Limit the whole volume to 100GB:
+      $ heketi-cli volume quota set 886a86a868711bef83001 --size=100
+
+  * Limit a directory to 10GB with warnings at 70% of usage:
+      $ heketi-cli volume quota set 886a86a868711bef83001 \
+        --path=/tenant1 --size=10 --soft-limit=70
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Check size
+		if quotaSize == -1 {
+			return errors.New("Missing quota size")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create request blob
+		req := &api.QuotaLimit{
+			Path:      quotaPath,
+			Size:      quotaSize,
+			SoftLimit: quotaSoftLimit,
+		}
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Set limit
+		quota, err := heketi.VolumeQuotaSetLimit(volumeId, req)
+		if err != nil {
+			return err
+		}
+
+		return printVolumeQuota(quota)
+	},
+}
+
+var volumeQuotaRemoveCommand = &cobra.Command{
+	Use:     "remove [volume_id]",
+	Short:   "Removes the usage limit of a directory of a volume",
+	Long:    "Removes the usage limit of a directory of a volume",
+	Example: "  $ heketi-cli volume quota remove 886a86a868711bef83001 --path=/tenant1",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		//ensure proper number of args
+		s := cmd.Flags().Args()
+		if len(s) < 1 {
+			return errors.New("Volume id missing")
+		}
+
+		// Check path
+		if quotaPath == "" {
+			return errors.New("Missing quota path")
+		}
+
+		// Set volume id
+		volumeId := cmd.Flags().Arg(0)
+
+		// Create a client
+		heketi := client.NewClient(options.Url, options.User, options.Key)
+
+		// Remove limit
+		err := heketi.VolumeQuotaRemoveLimit(volumeId, quotaPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "Quota limit on %v of volume %v removed\n",
+			quotaPath, volumeId)
+		return nil
+	},
+}
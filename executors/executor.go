@@ -16,11 +16,19 @@
 
 package executors
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Executor interface {
 	PeerProbe(exec_host, newnode string) error
 	PeerDetach(exec_host, detachnode string) error
-	DeviceSetup(host, device, vgid string) (*DeviceInfo, error)
+	GlusterdCheck(host string) error
+	DeviceSetup(host, device, vgid string, destroyData bool) (*DeviceInfo, error)
 	DeviceTeardown(host, device, vgid string) error
+	DeviceResync(host, device, vgid string) (*DeviceInfo, error)
+	NodeStorage(host string) (*NodeStorage, error)
 	BrickCreate(host string, brick *BrickRequest) (*BrickInfo, error)
 	BrickDestroy(host string, brick *BrickRequest) error
 	BrickDestroyCheck(host string, brick *BrickRequest) error
@@ -28,6 +36,30 @@ type Executor interface {
 	VolumeDestroy(host string, volume string) error
 	VolumeDestroyCheck(host, volume string) error
 	VolumeExpand(host string, volume *VolumeRequest) (*VolumeInfo, error)
+	VolumeInfo(host string, volume string) (*VolumeInfo, error)
+	VolumeList(host string) ([]string, error)
+	VolumeHealInfo(host string, volume string) (*VolumeHealInfo, error)
+	VolumeReplaceBrick(host string, volume string, oldBrick *BrickInfo, newBrick *BrickInfo) error
+	VolumeRemoveBricksStart(host string, volume string, bricks []BrickInfo) error
+	VolumeRemoveBricksStatus(host string, volume string, bricks []BrickInfo) (*RemoveBricksStatus, error)
+	VolumeRemoveBricksStop(host string, volume string, bricks []BrickInfo) error
+	VolumeRemoveBricksCommit(host string, volume string, bricks []BrickInfo) error
+	VolumeSetOptions(host string, volume string, options map[string]string) error
+	VolumeQuotaEnable(host string, volume string) error
+	VolumeQuotaSetLimit(host string, volume string, limit *QuotaLimit) error
+	VolumeQuotaRemoveLimit(host string, volume string, path string) error
+	GeoReplicationCreate(host string, session *GeoReplicationRequest) error
+	GeoReplicationStart(host string, session *GeoReplicationRequest) error
+	GeoReplicationStop(host string, session *GeoReplicationRequest) error
+	GeoReplicationPause(host string, session *GeoReplicationRequest) error
+	GeoReplicationResume(host string, session *GeoReplicationRequest) error
+	GeoReplicationDelete(host string, session *GeoReplicationRequest) error
+	GeoReplicationStatus(host string, session *GeoReplicationRequest) (*GeoReplicationStatus, error)
+	SnapshotCreate(host string, snapshot *SnapshotRequest) (*SnapshotInfo, error)
+	SnapshotDelete(host string, snapshot string) error
+	SnapshotRestore(host string, snapshot *SnapshotRequest) error
+	SnapshotList(host string, volume string) ([]SnapshotInfo, error)
+	SnapshotClone(host string, clone *SnapshotCloneRequest) (*SnapshotCloneInfo, error)
 	SetLogLevel(level string)
 }
 
@@ -38,15 +70,69 @@ const (
 	DurabilityNone DurabilityType = iota
 	DurabilityReplica
 	DurabilityDispersion
+	DurabilityArbiter
 )
 
 // Returns the size of the device
 type DeviceInfo struct {
-	// Size in KB
+	// Size in KB of the volume group
 	Size       uint64
 	ExtentSize uint64
 }
 
+// Returned by DeviceSetup when the device holds data
+type DeviceInUseError struct {
+	Host   string
+	Device string
+
+	// Partition table, filesystem and other signatures found by wipefs
+	Signatures []string
+
+	// Mounted device or partitions, as "partition on mountpoint"
+	Mounted []string
+
+	// Volume group of another device id the device belongs to
+	VolumeGroup string
+}
+
+func (e *DeviceInUseError) Error() string {
+	var conflicts []string
+	if len(e.Signatures) > 0 {
+		conflicts = append(conflicts, "signatures "+strings.Join(e.Signatures, ", "))
+	}
+	if len(e.Mounted) > 0 {
+		conflicts = append(conflicts, "mounted "+strings.Join(e.Mounted, ", "))
+	}
+	if e.VolumeGroup != "" {
+		conflicts = append(conflicts, "volume group "+e.VolumeGroup)
+	}
+	return fmt.Sprintf("Device %v on %v is in use: %v", e.Device, e.Host,
+		strings.Join(conflicts, "; "))
+}
+
+// Thin pool and LV of a brick found on a node
+type BrickStorage struct {
+	VgId string
+
+	// Sizes in KB, zero when the thin pool or the LV is missing
+	TpSize uint64
+	Size   uint64
+
+	// Set when the brick has a line in fstab and when
+	// its mount point directory exists
+	Fstab     bool
+	Directory bool
+}
+
+// Storage created by Heketi found on a node
+type NodeStorage struct {
+	// Size in KB of the volume groups by device id
+	Devices map[string]uint64
+
+	// Bricks by brick id
+	Bricks map[string]*BrickStorage
+}
+
 // Brick description
 type BrickRequest struct {
 	VgId             string
@@ -54,6 +140,11 @@ type BrickRequest struct {
 	TpSize           uint64
 	Size             uint64
 	PoolMetadataSize uint64
+
+	// Set for bricks of cloned volumes.  Their LV lives in the thin
+	// pool of the brick PoolId and is mounted by GlusterFS on Path
+	PoolId string
+	Path   string
 }
 
 // Returns information about the location of the brick
@@ -73,7 +164,139 @@ type VolumeRequest struct {
 
 	// Replica
 	Replica int
+
+	// GlusterFS volume options
+	Options map[string]string
+}
+
+// State of a brick process of a started volume
+type BrickStatus struct {
+	Online bool
+
+	// Zero when the brick is offline
+	Port int
+	Pid  int
 }
 
 type VolumeInfo struct {
+	Name string
+	Id   string
+
+	// Type and status as reported by GlusterFS, for example
+	// "Distributed-Replicate" and "Started"
+	Type   string
+	Status string
+
+	// Bricks in the order GlusterFS has them.  Bricks of the same
+	// replica or disperse set are next to each other.
+	Bricks []BrickInfo
+
+	// State of the bricks.  Only set when the volume is started.
+	BrickStatus map[BrickInfo]BrickStatus
+
+	// Options reconfigured on the volume
+	Options map[string]string
+}
+
+// Files a brick holds which still need to be healed
+type BrickHealInfo struct {
+	Host string
+	Path string
+
+	// False when the brick process could not be reached.  The
+	// counts are then unknown and left at zero.
+	Connected bool
+
+	// Entries pending heal, some of which may be in split-brain
+	PendingEntries uint64
+
+	// Paths, or gfids when the path is unknown, in split-brain
+	SplitBrainEntries []string
+}
+
+// Returns the heal state of each brick of a volume
+type VolumeHealInfo struct {
+	Bricks []BrickHealInfo
+}
+
+// State of the data migration off bricks being removed
+type MigrationState int
+
+const (
+	MigrationInProgress MigrationState = iota
+	MigrationCompleted
+	MigrationFailed
+)
+
+// Progress of the data migration off bricks being removed
+type RemoveBricksStatus struct {
+	State MigrationState
+
+	// Files moved and files which could not be moved
+	Files    uint64
+	Failures uint64
+}
+
+// Usage limit on a directory of a volume
+type QuotaLimit struct {
+	Path string
+
+	// Size in KB
+	Size uint64
+
+	// Percentage of Size, zero for the GlusterFS default
+	SoftLimit int
+}
+
+// Snapshot description
+type SnapshotRequest struct {
+	Name        string
+	Volume      string
+	Description string
+}
+
+// Returns information about a snapshot of a volume
+type SnapshotInfo struct {
+	Name   string
+	Volume string
+}
+
+// Clone description
+type SnapshotCloneRequest struct {
+	// Name of the new volume
+	Volume string
+
+	// Snapshot to clone, the volume it was taken from
+	// and the bricks of that volume
+	Snapshot string
+	Origin   string
+	Bricks   []BrickInfo
+}
+
+// Returns the bricks of the cloned volume.  Bricks[i] is the clone
+// of the brick Bricks[i] in the request.
+type SnapshotCloneInfo struct {
+	Bricks []BrickInfo
+}
+
+// Geo-replication session from a volume to a volume of another cluster
+type GeoReplicationRequest struct {
+	Volume      string
+	SlaveHost   string
+	SlaveVolume string
+}
+
+// State of the replication of a brick of the master volume
+type GeoReplicationPair struct {
+	MasterNode  string
+	MasterBrick string
+	SlaveNode   string
+	Status      string
+	CrawlStatus string
+	LastSynced  string
+}
+
+// Returns the status of a geo-replication session
+type GeoReplicationStatus struct {
+	Pairs []GeoReplicationPair
 }
@@ -0,0 +1,47 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package faultexec
+
+type FaultConfig struct {
+	// Wrap the configured executor and accept faults from
+	// the config file and the /admin/faults endpoint
+	Enabled bool    `json:"enabled"`
+	Faults  []Fault `json:"faults"`
+}
+
+// Fault describes calls of an executor method to fail
+type Fault struct {
+	// Executor method, for example BrickCreate
+	Method string `json:"method"`
+
+	// Only calls on this host.  Any host when empty.
+	Host string `json:"host,omitempty"`
+
+	// Only the Nth matching call, counting from one.  Every
+	// matching call when zero.
+	Call int `json:"call,omitempty"`
+
+	// Milliseconds to wait before acting
+	Delay int `json:"delay_ms,omitempty"`
+
+	// One of FAULT_ERROR (default), FAULT_TIMEOUT, FAULT_HANG
+	// or FAULT_SLOW
+	Action string `json:"action,omitempty"`
+
+	// Message of the returned error
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,430 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package faultexec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+const (
+	FAULT_ERROR   = "error"
+	FAULT_TIMEOUT = "timeout"
+	FAULT_HANG    = "hang"
+	FAULT_SLOW    = "slow"
+)
+
+var (
+	logger = utils.NewLogger("[faultexec]", utils.LEVEL_DEBUG)
+
+	// Same error the ssh executor returns when a command times out
+	ErrTimeout = errors.New("SSH command timeout")
+
+	executorType = reflect.TypeOf((*executors.Executor)(nil)).Elem()
+)
+
+type fault struct {
+	Fault
+	calls int
+}
+
+// FaultExecutor passes the calls to another executor unless a
+// fault matches them
+type FaultExecutor struct {
+	executor executors.Executor
+	lock     sync.Mutex
+	faults   []*fault
+
+	// Closed by Clear() to release the hung calls
+	release chan struct{}
+}
+
+func NewFaultExecutor(executor executors.Executor, faults []Fault) (*FaultExecutor, error) {
+	f := &FaultExecutor{
+		executor: executor,
+		release:  make(chan struct{}),
+	}
+	for _, fault := range faults {
+		if err := f.Add(fault); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Add checks and registers a fault
+func (f *FaultExecutor) Add(fa Fault) error {
+	if _, ok := executorType.MethodByName(fa.Method); !ok {
+		return fmt.Errorf("Unknown executor method %v", fa.Method)
+	}
+	if fa.Call < 0 || fa.Delay < 0 {
+		return fmt.Errorf("Call and delay of a fault cannot be negative")
+	}
+	switch fa.Action {
+	case "":
+		fa.Action = FAULT_ERROR
+	case FAULT_ERROR, FAULT_TIMEOUT, FAULT_HANG, FAULT_SLOW:
+	default:
+		return fmt.Errorf("Unknown fault action %v", fa.Action)
+	}
+	if fa.Action == FAULT_ERROR && fa.Error == "" {
+		fa.Error = "Injected fault in " + fa.Method
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = append(f.faults, &fault{Fault: fa})
+	return nil
+}
+
+// Faults returns the registered faults
+func (f *FaultExecutor) Faults() []Fault {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	faults := make([]Fault, 0, len(f.faults))
+	for _, fa := range f.faults {
+		faults = append(faults, fa.Fault)
+	}
+	return faults
+}
+
+// Clear removes all faults and releases the hung calls
+func (f *FaultExecutor) Clear() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.faults = nil
+	close(f.release)
+	f.release = make(chan struct{})
+}
+
+// inject returns the error of the first fault matching the call,
+// or nil to let the call through
+func (f *FaultExecutor) inject(method, host string) error {
+	f.lock.Lock()
+	var match *Fault
+	for _, fa := range f.faults {
+		if fa.Method != method || (fa.Host != "" && fa.Host != host) {
+			continue
+		}
+		fa.calls++
+		if match == nil && (fa.Call == 0 || fa.Call == fa.calls) {
+			m := fa.Fault
+			match = &m
+		}
+	}
+	release := f.release
+	f.lock.Unlock()
+
+	if match == nil {
+		return nil
+	}
+	logger.Info("Injecting %v fault in %v on %v", match.Action, method, host)
+
+	if match.Delay > 0 {
+		time.Sleep(time.Duration(match.Delay) * time.Millisecond)
+	}
+
+	switch match.Action {
+	case FAULT_TIMEOUT:
+		return ErrTimeout
+	case FAULT_HANG:
+		<-release
+		return ErrTimeout
+	case FAULT_SLOW:
+		return nil
+	default:
+		return errors.New(match.Error)
+	}
+}
+
+func (f *FaultExecutor) SetLogLevel(level string) {
+	f.executor.SetLogLevel(level)
+}
+
+func (f *FaultExecutor) PeerProbe(exec_host, newnode string) error {
+	if err := f.inject("PeerProbe", exec_host); err != nil {
+		return err
+	}
+	return f.executor.PeerProbe(exec_host, newnode)
+}
+
+func (f *FaultExecutor) PeerDetach(exec_host, detachnode string) error {
+	if err := f.inject("PeerDetach", exec_host); err != nil {
+		return err
+	}
+	return f.executor.PeerDetach(exec_host, detachnode)
+}
+
+func (f *FaultExecutor) GlusterdCheck(host string) error {
+	if err := f.inject("GlusterdCheck", host); err != nil {
+		return err
+	}
+	return f.executor.GlusterdCheck(host)
+}
+
+func (f *FaultExecutor) DeviceSetup(host, device, vgid string, destroyData bool) (*executors.DeviceInfo, error) {
+	if err := f.inject("DeviceSetup", host); err != nil {
+		return nil, err
+	}
+	return f.executor.DeviceSetup(host, device, vgid, destroyData)
+}
+
+func (f *FaultExecutor) DeviceTeardown(host, device, vgid string) error {
+	if err := f.inject("DeviceTeardown", host); err != nil {
+		return err
+	}
+	return f.executor.DeviceTeardown(host, device, vgid)
+}
+
+func (f *FaultExecutor) DeviceResync(host, device, vgid string) (*executors.DeviceInfo, error) {
+	if err := f.inject("DeviceResync", host); err != nil {
+		return nil, err
+	}
+	return f.executor.DeviceResync(host, device, vgid)
+}
+
+func (f *FaultExecutor) NodeStorage(host string) (*executors.NodeStorage, error) {
+	if err := f.inject("NodeStorage", host); err != nil {
+		return nil, err
+	}
+	return f.executor.NodeStorage(host)
+}
+
+func (f *FaultExecutor) BrickCreate(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
+	if err := f.inject("BrickCreate", host); err != nil {
+		return nil, err
+	}
+	return f.executor.BrickCreate(host, brick)
+}
+
+func (f *FaultExecutor) BrickDestroy(host string, brick *executors.BrickRequest) error {
+	if err := f.inject("BrickDestroy", host); err != nil {
+		return err
+	}
+	return f.executor.BrickDestroy(host, brick)
+}
+
+func (f *FaultExecutor) BrickDestroyCheck(host string, brick *executors.BrickRequest) error {
+	if err := f.inject("BrickDestroyCheck", host); err != nil {
+		return err
+	}
+	return f.executor.BrickDestroyCheck(host, brick)
+}
+
+func (f *FaultExecutor) VolumeCreate(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+	if err := f.inject("VolumeCreate", host); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeCreate(host, volume)
+}
+
+func (f *FaultExecutor) VolumeDestroy(host string, volume string) error {
+	if err := f.inject("VolumeDestroy", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeDestroy(host, volume)
+}
+
+func (f *FaultExecutor) VolumeDestroyCheck(host, volume string) error {
+	if err := f.inject("VolumeDestroyCheck", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeDestroyCheck(host, volume)
+}
+
+func (f *FaultExecutor) VolumeExpand(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error) {
+	if err := f.inject("VolumeExpand", host); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeExpand(host, volume)
+}
+
+func (f *FaultExecutor) VolumeInfo(host string, volume string) (*executors.VolumeInfo, error) {
+	if err := f.inject("VolumeInfo", host); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeInfo(host, volume)
+}
+
+func (f *FaultExecutor) VolumeList(host string) ([]string, error) {
+	if err := f.inject("VolumeList", host); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeList(host)
+}
+
+func (f *FaultExecutor) VolumeHealInfo(host string, volume string) (*executors.VolumeHealInfo, error) {
+	if err := f.inject("VolumeHealInfo", host); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeHealInfo(host, volume)
+}
+
+func (f *FaultExecutor) VolumeReplaceBrick(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+	if err := f.inject("VolumeReplaceBrick", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeReplaceBrick(host, volume, oldBrick, newBrick)
+}
+
+func (f *FaultExecutor) VolumeRemoveBricksStart(host string, volume string, bricks []executors.BrickInfo) error {
+	if err := f.inject("VolumeRemoveBricksStart", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeRemoveBricksStart(host, volume, bricks)
+}
+
+func (f *FaultExecutor) VolumeRemoveBricksStatus(host string, volume string, bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+	if err := f.inject("VolumeRemoveBricksStatus", host); err != nil {
+		return nil, err
+	}
+	return f.executor.VolumeRemoveBricksStatus(host, volume, bricks)
+}
+
+func (f *FaultExecutor) VolumeRemoveBricksStop(host string, volume string, bricks []executors.BrickInfo) error {
+	if err := f.inject("VolumeRemoveBricksStop", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeRemoveBricksStop(host, volume, bricks)
+}
+
+func (f *FaultExecutor) VolumeRemoveBricksCommit(host string, volume string, bricks []executors.BrickInfo) error {
+	if err := f.inject("VolumeRemoveBricksCommit", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeRemoveBricksCommit(host, volume, bricks)
+}
+
+func (f *FaultExecutor) VolumeSetOptions(host string, volume string, options map[string]string) error {
+	if err := f.inject("VolumeSetOptions", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeSetOptions(host, volume, options)
+}
+
+func (f *FaultExecutor) VolumeQuotaEnable(host string, volume string) error {
+	if err := f.inject("VolumeQuotaEnable", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeQuotaEnable(host, volume)
+}
+
+func (f *FaultExecutor) VolumeQuotaSetLimit(host string, volume string, limit *executors.QuotaLimit) error {
+	if err := f.inject("VolumeQuotaSetLimit", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeQuotaSetLimit(host, volume, limit)
+}
+
+func (f *FaultExecutor) VolumeQuotaRemoveLimit(host string, volume string, path string) error {
+	if err := f.inject("VolumeQuotaRemoveLimit", host); err != nil {
+		return err
+	}
+	return f.executor.VolumeQuotaRemoveLimit(host, volume, path)
+}
+
+func (f *FaultExecutor) GeoReplicationCreate(host string, session *executors.GeoReplicationRequest) error {
+	if err := f.inject("GeoReplicationCreate", host); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationCreate(host, session)
+}
+
+func (f *FaultExecutor) GeoReplicationStart(host string, session *executors.GeoReplicationRequest) error {
+	if err := f.inject("GeoReplicationStart", host); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationStart(host, session)
+}
+
+func (f *FaultExecutor) GeoReplicationStop(host string, session *executors.GeoReplicationRequest) error {
+	if err := f.inject("GeoReplicationStop", host); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationStop(host, session)
+}
+
+func (f *FaultExecutor) GeoReplicationPause(host string, session *executors.GeoReplicationRequest) error {
+	if err := f.inject("GeoReplicationPause", host); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationPause(host, session)
+}
+
+func (f *FaultExecutor) GeoReplicationResume(host string, session *executors.GeoReplicationRequest) error {
+	if err := f.inject("GeoReplicationResume", host); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationResume(host, session)
+}
+
+func (f *FaultExecutor) GeoReplicationDelete(host string, session *executors.GeoReplicationRequest) error {
+	if err := f.inject("GeoReplicationDelete", host); err != nil {
+		return err
+	}
+	return f.executor.GeoReplicationDelete(host, session)
+}
+
+func (f *FaultExecutor) GeoReplicationStatus(host string, session *executors.GeoReplicationRequest) (*executors.GeoReplicationStatus, error) {
+	if err := f.inject("GeoReplicationStatus", host); err != nil {
+		return nil, err
+	}
+	return f.executor.GeoReplicationStatus(host, session)
+}
+
+func (f *FaultExecutor) SnapshotCreate(host string, snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error) {
+	if err := f.inject("SnapshotCreate", host); err != nil {
+		return nil, err
+	}
+	return f.executor.SnapshotCreate(host, snapshot)
+}
+
+func (f *FaultExecutor) SnapshotDelete(host string, snapshot string) error {
+	if err := f.inject("SnapshotDelete", host); err != nil {
+		return err
+	}
+	return f.executor.SnapshotDelete(host, snapshot)
+}
+
+func (f *FaultExecutor) SnapshotRestore(host string, snapshot *executors.SnapshotRequest) error {
+	if err := f.inject("SnapshotRestore", host); err != nil {
+		return err
+	}
+	return f.executor.SnapshotRestore(host, snapshot)
+}
+
+func (f *FaultExecutor) SnapshotList(host string, volume string) ([]executors.SnapshotInfo, error) {
+	if err := f.inject("SnapshotList", host); err != nil {
+		return nil, err
+	}
+	return f.executor.SnapshotList(host, volume)
+}
+
+func (f *FaultExecutor) SnapshotClone(host string, clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error) {
+	if err := f.inject("SnapshotClone", host); err != nil {
+		return nil, err
+	}
+	return f.executor.SnapshotClone(host, clone)
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package faultexec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+func TestFaultExecutorAdd(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+
+	_, err = NewFaultExecutor(m, []Fault{{Method: "NoSuchMethod"}})
+	tests.Assert(t, err != nil)
+
+	_, err = NewFaultExecutor(m, []Fault{{Method: "BrickCreate", Action: "explode"}})
+	tests.Assert(t, err != nil)
+
+	_, err = NewFaultExecutor(m, []Fault{{Method: "BrickCreate", Call: -1}})
+	tests.Assert(t, err != nil)
+
+	f, err := NewFaultExecutor(m, []Fault{{Method: "BrickCreate"}})
+	tests.Assert(t, err == nil)
+	faults := f.Faults()
+	tests.Assert(t, len(faults) == 1)
+	tests.Assert(t, faults[0].Action == FAULT_ERROR)
+	tests.Assert(t, faults[0].Error == "Injected fault in BrickCreate")
+
+	f.Clear()
+	tests.Assert(t, len(f.Faults()) == 0)
+}
+
+func TestFaultExecutorNthCallOnHost(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+
+	f, err := NewFaultExecutor(m, []Fault{
+		{Method: "BrickCreate", Host: "host1", Call: 2, Error: "boom"},
+	})
+	tests.Assert(t, err == nil)
+
+	brick := &executors.BrickRequest{Name: "b", Size: 1}
+
+	// Other hosts are not counted
+	_, err = f.BrickCreate("host2", brick)
+	tests.Assert(t, err == nil)
+	_, err = f.BrickCreate("host1", brick)
+	tests.Assert(t, err == nil)
+	_, err = f.BrickCreate("host2", brick)
+	tests.Assert(t, err == nil)
+
+	_, err = f.BrickCreate("host1", brick)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "boom", err)
+
+	_, err = f.BrickCreate("host1", brick)
+	tests.Assert(t, err == nil)
+
+	// Other methods are not affected
+	err = f.BrickDestroy("host1", brick)
+	tests.Assert(t, err == nil)
+}
+
+func TestFaultExecutorActions(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+
+	called := 0
+	m.MockVolumeDestroy = func(host string, volume string) error {
+		called++
+		return nil
+	}
+
+	f, err := NewFaultExecutor(m, []Fault{
+		{Method: "VolumeDestroy", Action: FAULT_SLOW, Delay: 10},
+		{Method: "VolumeCreate", Action: FAULT_TIMEOUT},
+	})
+	tests.Assert(t, err == nil)
+
+	start := time.Now()
+	err = f.VolumeDestroy("host", "vol")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, called == 1)
+	tests.Assert(t, time.Since(start) >= 10*time.Millisecond)
+
+	_, err = f.VolumeCreate("host", &executors.VolumeRequest{})
+	tests.Assert(t, err == ErrTimeout)
+}
+
+func TestFaultExecutorHang(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+
+	f, err := NewFaultExecutor(m, []Fault{
+		{Method: "PeerProbe", Host: "down", Action: FAULT_HANG},
+	})
+	tests.Assert(t, err == nil)
+
+	done := make(chan error)
+	go func() {
+		done <- f.PeerProbe("down", "newnode")
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("call to the hung host returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Other hosts still answer
+	tests.Assert(t, f.PeerProbe("up", "newnode") == nil)
+
+	f.Clear()
+	select {
+	case err = <-done:
+		tests.Assert(t, err == ErrTimeout)
+	case <-time.After(time.Second):
+		t.Fatal("hung call not released")
+	}
+
+	tests.Assert(t, f.PeerProbe("down", "newnode") == nil)
+}
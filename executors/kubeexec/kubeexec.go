@@ -150,6 +150,13 @@ func NewKubeExecutor(config *KubeConfig) (*KubeExecutor, error) {
 		k.Fstab = config.Fstab
 	}
 
+	// Timeouts and retries of the operations
+	var err error
+	k.Operations, err = sshexec.NewOperations(config.Operations)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check required values
 	if k.config.Namespace == "" {
 		return nil, fmt.Errorf("Namespace must be provided in configuration")
@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package localexec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// Runs the commands on the host heketi runs on, for deployments
+// where heketi runs on the only GlusterFS node
+type LocalExecutor struct {
+	// Embed all sshexecutor functions
+	sshexec.SshExecutor
+
+	// save local configuration
+	config *LocalConfig
+
+	// Hosts already checked to be the local host or not
+	localHosts     map[string]bool
+	localHostsLock sync.Mutex
+}
+
+var (
+	logger = utils.NewLogger("[localexec]", utils.LEVEL_DEBUG)
+)
+
+func NewLocalExecutor(config *LocalConfig) (*LocalExecutor, error) {
+	godbc.Require(config != nil)
+
+	// Initialize
+	l := &LocalExecutor{}
+	l.config = config
+	l.localHosts = make(map[string]bool)
+	l.Throttlemap = make(map[string]chan bool)
+	l.RemoteExecutor = l
+
+	if l.config.Fstab == "" {
+		l.Fstab = "/etc/fstab"
+	} else {
+		l.Fstab = config.Fstab
+	}
+
+	// Timeouts and retries of the operations
+	var err error
+	l.Operations, err = sshexec.NewOperations(config.Operations)
+	if err != nil {
+		return nil, err
+	}
+
+	// Show experimental settings
+	if l.config.RebalanceOnExpansion {
+		logger.Warning("Rebalance on volume expansion has been enabled.  This is an EXPERIMENTAL feature")
+	}
+
+	godbc.Ensure(l != nil)
+	godbc.Ensure(l.Fstab != "")
+
+	return l, nil
+}
+
+func (l *LocalExecutor) RemoteCommandExecute(host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	// Commands for any other node would run on this one
+	if !l.isLocalHost(host) {
+		return nil, logger.Err(fmt.Errorf("Host %v is not the host heketi runs on, "+
+			"which is the only node the local executor manages", host))
+	}
+
+	// Throttle
+	l.AccessConnection(host)
+	defer l.FreeConnection(host)
+
+	// Execute
+	return l.Exec(commands, timeoutMinutes)
+}
+
+// Returns true when host is the name or an address of the host
+// heketi runs on
+func (l *LocalExecutor) isLocalHost(host string) bool {
+	l.localHostsLock.Lock()
+	defer l.localHostsLock.Unlock()
+
+	if local, ok := l.localHosts[host]; ok {
+		return local
+	}
+
+	local := false
+	if hostname, err := os.Hostname(); err == nil && hostname == host {
+		local = true
+	} else {
+		local = hostHasLocalAddress(host)
+	}
+	l.localHosts[host] = local
+
+	return local
+}
+
+func hostHasLocalAddress(host string) bool {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		var err error
+		ips, err = net.LookupIP(host)
+		if err != nil {
+			logger.Warning("Unable to resolve %v: %v", host, err)
+			return false
+		}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		logger.Warning("Unable to get the local addresses: %v", err)
+		return false
+	}
+
+	for _, ip := range ips {
+		if ip.IsLoopback() {
+			return true
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Runs each command in a shell on the local host and returns
+// their output
+func (l *LocalExecutor) Exec(commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	buffers := make([]string, len(commands))
+
+	for index, command := range commands {
+
+		// Execute command in a shell
+		args := []string{"/bin/bash", "-c", command}
+
+		// Check if we need to use sudo for the entire command
+		if l.config.Sudo {
+			args = append([]string{"sudo"}, args...)
+		}
+
+		var b bytes.Buffer
+		var berr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = &b
+		cmd.Stderr = &berr
+
+		err := cmd.Start()
+		if err != nil {
+			return nil, err
+		}
+
+		// Spawn function to wait for results
+		errch := make(chan error)
+		go func() {
+			errch <- cmd.Wait()
+		}()
+
+		// Set the timeout
+		timeout := time.After(time.Minute * time.Duration(timeoutMinutes))
+
+		// Wait for either the command completion or timeout
+		select {
+		case err := <-errch:
+			if err != nil {
+				logger.LogError("Failed to run command [%v]: Err[%v]: Stdout [%v]: Stderr [%v]",
+					command, err, b.String(), berr.String())
+				return nil, fmt.Errorf("%s", berr.String())
+			}
+			logger.Debug("Command: %v\nResult: %v", command, b.String())
+			buffers[index] = b.String()
+
+		case <-timeout:
+			logger.LogError("Timeout on command [%v]: Stdout [%v]: Stderr [%v]",
+				command, b.String(), berr.String())
+			err := cmd.Process.Kill()
+			if err != nil {
+				logger.LogError("Unable to kill command [%v]: %v", command, err)
+			}
+			<-errch
+			return nil, errors.New("Local command timeout")
+		}
+	}
+
+	return buffers, nil
+}
+
+func (l *LocalExecutor) RebalanceOnExpansion() bool {
+	return l.config.RebalanceOnExpansion
+}
+
+func (l *LocalExecutor) SnapShotLimit() int {
+	return l.config.SnapShotLimit
+}
@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package localexec
+
+import (
+	"os"
+	"testing"
+
+	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/tests"
+)
+
+func TestNewLocalExecutor(t *testing.T) {
+	config := &LocalConfig{
+		CLICommandConfig: sshexec.CLICommandConfig{
+			Fstab: "myfstab",
+		},
+	}
+
+	l, err := NewLocalExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, l.Fstab == "myfstab")
+	tests.Assert(t, l.Throttlemap != nil)
+	tests.Assert(t, l.config != nil)
+	tests.Assert(t, l.RemoteExecutor == l)
+}
+
+func TestNewLocalExecutorDefaults(t *testing.T) {
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, l.Fstab == "/etc/fstab")
+	tests.Assert(t, l.RebalanceOnExpansion() == false)
+	tests.Assert(t, l.SnapShotLimit() == 0)
+
+	config := &LocalConfig{
+		CLICommandConfig: sshexec.CLICommandConfig{
+			RebalanceOnExpansion: true,
+			SnapShotLimit:        14,
+		},
+	}
+	l, err = NewLocalExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, l.RebalanceOnExpansion() == true)
+	tests.Assert(t, l.SnapShotLimit() == 14)
+}
+
+func TestLocalExecutorRemoteCommandExecute(t *testing.T) {
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil)
+
+	// Commands run in a shell, one after the other
+	out, err := l.RemoteCommandExecute("localhost", []string{
+		"echo hello",
+		"echo $((1 + 2)) | tr 3 4",
+	}, 5)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(out) == 2)
+	tests.Assert(t, out[0] == "hello\n", out)
+	tests.Assert(t, out[1] == "4\n", out)
+
+	// Errors carry the output of the command on stderr
+	out, err = l.RemoteCommandExecute("localhost", []string{
+		"echo first",
+		"echo failed >&2; exit 1",
+		"echo never",
+	}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "failed\n", err)
+	tests.Assert(t, out == nil)
+}
+
+func TestLocalExecutorRejectsOtherHosts(t *testing.T) {
+	l, err := NewLocalExecutor(&LocalConfig{})
+	tests.Assert(t, err == nil)
+
+	hostname, err := os.Hostname()
+	tests.Assert(t, err == nil)
+	for _, host := range []string{"localhost", "127.0.0.1", "::1", hostname} {
+		out, err := l.RemoteCommandExecute(host, []string{"echo hello"}, 5)
+		tests.Assert(t, err == nil, host, err)
+		tests.Assert(t, out[0] == "hello\n", out)
+	}
+
+	// Commands for another node must not run here
+	out, err := l.RemoteCommandExecute("192.0.2.1", []string{"echo hello"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, out == nil)
+	_, ok := l.localHosts["192.0.2.1"]
+	tests.Assert(t, ok)
+}
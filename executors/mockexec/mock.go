@@ -22,17 +22,44 @@ import (
 
 type MockExecutor struct {
 	// These functions can be overwritten for testing
-	MockPeerProbe          func(exec_host, newnode string) error
-	MockPeerDetach         func(exec_host, newnode string) error
-	MockDeviceSetup        func(host, device, vgid string) (*executors.DeviceInfo, error)
-	MockDeviceTeardown     func(host, device, vgid string) error
-	MockBrickCreate        func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error)
-	MockBrickDestroy       func(host string, brick *executors.BrickRequest) error
-	MockBrickDestroyCheck  func(host string, brick *executors.BrickRequest) error
-	MockVolumeCreate       func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error)
-	MockVolumeExpand       func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error)
-	MockVolumeDestroy      func(host string, volume string) error
-	MockVolumeDestroyCheck func(host, volume string) error
+	MockPeerProbe                func(exec_host, newnode string) error
+	MockPeerDetach               func(exec_host, newnode string) error
+	MockGlusterdCheck            func(host string) error
+	MockDeviceSetup              func(host, device, vgid string, destroyData bool) (*executors.DeviceInfo, error)
+	MockDeviceTeardown           func(host, device, vgid string) error
+	MockDeviceResync             func(host, device, vgid string) (*executors.DeviceInfo, error)
+	MockBrickCreate              func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error)
+	MockBrickDestroy             func(host string, brick *executors.BrickRequest) error
+	MockBrickDestroyCheck        func(host string, brick *executors.BrickRequest) error
+	MockVolumeCreate             func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error)
+	MockVolumeExpand             func(host string, volume *executors.VolumeRequest) (*executors.VolumeInfo, error)
+	MockVolumeInfo               func(host string, volume string) (*executors.VolumeInfo, error)
+	MockVolumeList               func(host string) ([]string, error)
+	MockNodeStorage              func(host string) (*executors.NodeStorage, error)
+	MockVolumeHealInfo           func(host string, volume string) (*executors.VolumeHealInfo, error)
+	MockVolumeReplaceBrick       func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error
+	MockVolumeRemoveBricksStart  func(host string, volume string, bricks []executors.BrickInfo) error
+	MockVolumeRemoveBricksStatus func(host string, volume string, bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error)
+	MockVolumeRemoveBricksStop   func(host string, volume string, bricks []executors.BrickInfo) error
+	MockVolumeRemoveBricksCommit func(host string, volume string, bricks []executors.BrickInfo) error
+	MockVolumeSetOptions         func(host string, volume string, options map[string]string) error
+	MockVolumeQuotaEnable        func(host string, volume string) error
+	MockVolumeQuotaSetLimit      func(host string, volume string, limit *executors.QuotaLimit) error
+	MockVolumeQuotaRemoveLimit   func(host string, volume string, path string) error
+	MockVolumeDestroy            func(host string, volume string) error
+	MockVolumeDestroyCheck       func(host, volume string) error
+	MockGeoReplicationCreate     func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationStart      func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationStop       func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationPause      func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationResume     func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationDelete     func(host string, session *executors.GeoReplicationRequest) error
+	MockGeoReplicationStatus     func(host string, session *executors.GeoReplicationRequest) (*executors.GeoReplicationStatus, error)
+	MockSnapshotCreate           func(host string, snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error)
+	MockSnapshotDelete           func(host string, snapshot string) error
+	MockSnapshotRestore          func(host string, snapshot *executors.SnapshotRequest) error
+	MockSnapshotList             func(host string, volume string) ([]executors.SnapshotInfo, error)
+	MockSnapshotClone            func(host string, clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error)
 }
 
 func NewMockExecutor() (*MockExecutor, error) {
@@ -46,7 +73,11 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
-	m.MockDeviceSetup = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+	m.MockGlusterdCheck = func(host string) error {
+		return nil
+	}
+
+	m.MockDeviceSetup = func(host, device, vgid string, destroyData bool) (*executors.DeviceInfo, error) {
 		d := &executors.DeviceInfo{}
 		d.Size = 500 * 1024 * 1024 // Size in KB
 		d.ExtentSize = 4096
@@ -57,6 +88,13 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockDeviceResync = func(host, device, vgid string) (*executors.DeviceInfo, error) {
+		d := &executors.DeviceInfo{}
+		d.Size = 500 * 1024 * 1024 // Size in KB
+		d.ExtentSize = 4096
+		return d, nil
+	}
+
 	m.MockBrickCreate = func(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
 		b := &executors.BrickInfo{
 			Path: "/mockpath",
@@ -80,6 +118,65 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return &executors.VolumeInfo{}, nil
 	}
 
+	m.MockVolumeInfo = func(host string, volume string) (*executors.VolumeInfo, error) {
+		return &executors.VolumeInfo{
+			Name: volume,
+		}, nil
+	}
+
+	m.MockVolumeList = func(host string) ([]string, error) {
+		return []string{}, nil
+	}
+
+	m.MockNodeStorage = func(host string) (*executors.NodeStorage, error) {
+		return &executors.NodeStorage{
+			Devices: make(map[string]uint64),
+			Bricks:  make(map[string]*executors.BrickStorage),
+		}, nil
+	}
+
+	m.MockVolumeHealInfo = func(host string, volume string) (*executors.VolumeHealInfo, error) {
+		return &executors.VolumeHealInfo{}, nil
+	}
+
+	m.MockVolumeReplaceBrick = func(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+		return nil
+	}
+
+	m.MockVolumeRemoveBricksStart = func(host string, volume string, bricks []executors.BrickInfo) error {
+		return nil
+	}
+
+	m.MockVolumeRemoveBricksStatus = func(host string, volume string, bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+		return &executors.RemoveBricksStatus{
+			State: executors.MigrationCompleted,
+		}, nil
+	}
+
+	m.MockVolumeRemoveBricksStop = func(host string, volume string, bricks []executors.BrickInfo) error {
+		return nil
+	}
+
+	m.MockVolumeRemoveBricksCommit = func(host string, volume string, bricks []executors.BrickInfo) error {
+		return nil
+	}
+
+	m.MockVolumeSetOptions = func(host string, volume string, options map[string]string) error {
+		return nil
+	}
+
+	m.MockVolumeQuotaEnable = func(host string, volume string) error {
+		return nil
+	}
+
+	m.MockVolumeQuotaSetLimit = func(host string, volume string, limit *executors.QuotaLimit) error {
+		return nil
+	}
+
+	m.MockVolumeQuotaRemoveLimit = func(host string, volume string, path string) error {
+		return nil
+	}
+
 	m.MockVolumeDestroy = func(host string, volume string) error {
 		return nil
 	}
@@ -88,6 +185,65 @@ func NewMockExecutor() (*MockExecutor, error) {
 		return nil
 	}
 
+	m.MockGeoReplicationCreate = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationStart = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationStop = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationPause = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationResume = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationDelete = func(host string, session *executors.GeoReplicationRequest) error {
+		return nil
+	}
+
+	m.MockGeoReplicationStatus = func(host string, session *executors.GeoReplicationRequest) (*executors.GeoReplicationStatus, error) {
+		return &executors.GeoReplicationStatus{}, nil
+	}
+
+	m.MockSnapshotCreate = func(host string, snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error) {
+		s := &executors.SnapshotInfo{
+			Name:   snapshot.Name,
+			Volume: snapshot.Volume,
+		}
+		return s, nil
+	}
+
+	m.MockSnapshotDelete = func(host string, snapshot string) error {
+		return nil
+	}
+
+	m.MockSnapshotRestore = func(host string, snapshot *executors.SnapshotRequest) error {
+		return nil
+	}
+
+	m.MockSnapshotList = func(host string, volume string) ([]executors.SnapshotInfo, error) {
+		return []executors.SnapshotInfo{}, nil
+	}
+
+	m.MockSnapshotClone = func(host string, clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error) {
+		c := &executors.SnapshotCloneInfo{}
+		for _, brick := range clone.Bricks {
+			c.Bricks = append(c.Bricks, executors.BrickInfo{
+				Host: brick.Host,
+				Path: "/mockclonepath",
+			})
+		}
+		return c, nil
+	}
+
 	return m, nil
 }
 
@@ -103,14 +259,22 @@ func (m *MockExecutor) PeerDetach(exec_host, newnode string) error {
 	return m.MockPeerDetach(exec_host, newnode)
 }
 
-func (m *MockExecutor) DeviceSetup(host, device, vgid string) (*executors.DeviceInfo, error) {
-	return m.MockDeviceSetup(host, device, vgid)
+func (m *MockExecutor) GlusterdCheck(host string) error {
+	return m.MockGlusterdCheck(host)
+}
+
+func (m *MockExecutor) DeviceSetup(host, device, vgid string, destroyData bool) (*executors.DeviceInfo, error) {
+	return m.MockDeviceSetup(host, device, vgid, destroyData)
 }
 
 func (m *MockExecutor) DeviceTeardown(host, device, vgid string) error {
 	return m.MockDeviceTeardown(host, device, vgid)
 }
 
+func (m *MockExecutor) DeviceResync(host, device, vgid string) (*executors.DeviceInfo, error) {
+	return m.MockDeviceResync(host, device, vgid)
+}
+
 func (m *MockExecutor) BrickCreate(host string, brick *executors.BrickRequest) (*executors.BrickInfo, error) {
 	return m.MockBrickCreate(host, brick)
 }
@@ -131,6 +295,58 @@ func (m *MockExecutor) VolumeExpand(host string, volume *executors.VolumeRequest
 	return m.MockVolumeExpand(host, volume)
 }
 
+func (m *MockExecutor) VolumeInfo(host string, volume string) (*executors.VolumeInfo, error) {
+	return m.MockVolumeInfo(host, volume)
+}
+
+func (m *MockExecutor) VolumeList(host string) ([]string, error) {
+	return m.MockVolumeList(host)
+}
+
+func (m *MockExecutor) NodeStorage(host string) (*executors.NodeStorage, error) {
+	return m.MockNodeStorage(host)
+}
+
+func (m *MockExecutor) VolumeHealInfo(host string, volume string) (*executors.VolumeHealInfo, error) {
+	return m.MockVolumeHealInfo(host, volume)
+}
+
+func (m *MockExecutor) VolumeReplaceBrick(host string, volume string, oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+	return m.MockVolumeReplaceBrick(host, volume, oldBrick, newBrick)
+}
+
+func (m *MockExecutor) VolumeRemoveBricksStart(host string, volume string, bricks []executors.BrickInfo) error {
+	return m.MockVolumeRemoveBricksStart(host, volume, bricks)
+}
+
+func (m *MockExecutor) VolumeRemoveBricksStatus(host string, volume string, bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+	return m.MockVolumeRemoveBricksStatus(host, volume, bricks)
+}
+
+func (m *MockExecutor) VolumeRemoveBricksStop(host string, volume string, bricks []executors.BrickInfo) error {
+	return m.MockVolumeRemoveBricksStop(host, volume, bricks)
+}
+
+func (m *MockExecutor) VolumeRemoveBricksCommit(host string, volume string, bricks []executors.BrickInfo) error {
+	return m.MockVolumeRemoveBricksCommit(host, volume, bricks)
+}
+
+func (m *MockExecutor) VolumeSetOptions(host string, volume string, options map[string]string) error {
+	return m.MockVolumeSetOptions(host, volume, options)
+}
+
+func (m *MockExecutor) VolumeQuotaEnable(host string, volume string) error {
+	return m.MockVolumeQuotaEnable(host, volume)
+}
+
+func (m *MockExecutor) VolumeQuotaSetLimit(host string, volume string, limit *executors.QuotaLimit) error {
+	return m.MockVolumeQuotaSetLimit(host, volume, limit)
+}
+
+func (m *MockExecutor) VolumeQuotaRemoveLimit(host string, volume string, path string) error {
+	return m.MockVolumeQuotaRemoveLimit(host, volume, path)
+}
+
 func (m *MockExecutor) VolumeDestroy(host string, volume string) error {
 	return m.MockVolumeDestroy(host, volume)
 }
@@ -138,3 +354,51 @@ func (m *MockExecutor) VolumeDestroy(host string, volume string) error {
 func (m *MockExecutor) VolumeDestroyCheck(host string, volume string) error {
 	return m.MockVolumeDestroyCheck(host, volume)
 }
+
+func (m *MockExecutor) GeoReplicationCreate(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationCreate(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationStart(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationStart(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationStop(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationStop(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationPause(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationPause(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationResume(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationResume(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationDelete(host string, session *executors.GeoReplicationRequest) error {
+	return m.MockGeoReplicationDelete(host, session)
+}
+
+func (m *MockExecutor) GeoReplicationStatus(host string, session *executors.GeoReplicationRequest) (*executors.GeoReplicationStatus, error) {
+	return m.MockGeoReplicationStatus(host, session)
+}
+
+func (m *MockExecutor) SnapshotCreate(host string, snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error) {
+	return m.MockSnapshotCreate(host, snapshot)
+}
+
+func (m *MockExecutor) SnapshotDelete(host string, snapshot string) error {
+	return m.MockSnapshotDelete(host, snapshot)
+}
+
+func (m *MockExecutor) SnapshotRestore(host string, snapshot *executors.SnapshotRequest) error {
+	return m.MockSnapshotRestore(host, snapshot)
+}
+
+func (m *MockExecutor) SnapshotList(host string, volume string) ([]executors.SnapshotInfo, error) {
+	return m.MockSnapshotList(host, volume)
+}
+
+func (m *MockExecutor) SnapshotClone(host string, clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error) {
+	return m.MockSnapshotClone(host, clone)
+}
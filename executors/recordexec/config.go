@@ -0,0 +1,36 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package recordexec
+
+import (
+	"github.com/heketi/heketi/executors/sshexec"
+)
+
+type RecordConfig struct {
+	sshexec.CLICommandConfig
+
+	// File the commands sent to the nodes are appended to
+	Record string `json:"record"`
+
+	// File of recorded commands served by the replay executor
+	Replay string `json:"replay"`
+
+	// Serve the records in the order of the file, only checking the
+	// host and the verbs of the commands, so that commands with ids
+	// generated by heketi can be replayed
+	ReplaySequential bool `json:"replay_sequential"`
+}
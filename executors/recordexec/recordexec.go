@@ -0,0 +1,304 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package recordexec
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lpabon/godbc"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/kubeexec"
+	"github.com/heketi/heketi/executors/localexec"
+	"github.com/heketi/heketi/executors/sshexec"
+	"github.com/heketi/heketi/pkg/utils"
+)
+
+// One call to RemoteCommandExecute, saved as a line of JSON
+type Record struct {
+	Host     string   `json:"host"`
+	Commands []string `json:"commands"`
+	Output   []string `json:"output"`
+	Error    string   `json:"error,omitempty"`
+
+	// Duration of the call in milliseconds
+	Duration int64 `json:"duration_ms"`
+}
+
+// Transport logging every call of the transport it wraps
+type Recorder struct {
+	transport sshexec.RemoteCommandTransport
+	lock      sync.Mutex
+	enc       *json.Encoder
+}
+
+// Transport serving recorded outputs back instead of running
+// the commands
+type Replayer struct {
+	lock    sync.Mutex
+	records []Record
+	used    []bool
+	next    int
+	config  *RecordConfig
+}
+
+// Executor running the GlusterFS and LVM logic of the ssh executor
+// on recorded outputs
+type ReplayExecutor struct {
+	// Embed all sshexecutor functions
+	sshexec.SshExecutor
+
+	Replayer *Replayer
+}
+
+var (
+	logger = utils.NewLogger("[recordexec]", utils.LEVEL_DEBUG)
+)
+
+func NewRecorder(transport sshexec.RemoteCommandTransport, w io.Writer) *Recorder {
+	godbc.Require(transport != nil)
+	godbc.Require(w != nil)
+
+	return &Recorder{
+		transport: transport,
+		enc:       json.NewEncoder(w),
+	}
+}
+
+func (r *Recorder) RemoteCommandExecute(host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	start := time.Now()
+	output, err := r.transport.RemoteCommandExecute(host, commands, timeoutMinutes)
+
+	record := &Record{
+		Host:     host,
+		Commands: commands,
+		Output:   output,
+		Duration: int64(time.Since(start) / time.Millisecond),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	r.lock.Lock()
+	werr := r.enc.Encode(record)
+	r.lock.Unlock()
+	if werr != nil {
+		logger.LogError("Unable to record commands sent to %v: %v", host, werr)
+	}
+
+	return output, err
+}
+
+func (r *Recorder) RebalanceOnExpansion() bool {
+	return r.transport.RebalanceOnExpansion()
+}
+
+func (r *Recorder) SnapShotLimit() int {
+	return r.transport.SnapShotLimit()
+}
+
+// Records the commands the executor sends to the nodes
+func RecordCommands(executor executors.Executor, w io.Writer) error {
+	var s *sshexec.SshExecutor
+	switch e := executor.(type) {
+	case *sshexec.SshExecutor:
+		s = e
+	case *kubeexec.KubeExecutor:
+		s = &e.SshExecutor
+	case *localexec.LocalExecutor:
+		s = &e.SshExecutor
+	default:
+		return fmt.Errorf("Unable to record the commands of executor %T", executor)
+	}
+
+	s.RemoteExecutor = NewRecorder(s.RemoteExecutor, w)
+	return nil
+}
+
+func NewReplayer(r io.Reader, config *RecordConfig) (*Replayer, error) {
+	godbc.Require(r != nil)
+	godbc.Require(config != nil)
+
+	p := &Replayer{
+		records: make([]Record, 0),
+		config:  config,
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record Record
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse recorded command on line %v: %v",
+				line, err)
+		}
+		p.records = append(p.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p.used = make([]bool, len(p.records))
+
+	return p, nil
+}
+
+// Serves the first record not used yet with the same host and
+// commands.  Calls to different hosts may run concurrently, so
+// the records are only kept in order for each of them.
+//
+// In sequential mode the next record of the file is served when it
+// has the same host and command verbs.  Calls must then reach the
+// replayer in the order they were recorded.
+func (p *Replayer) RemoteCommandExecute(host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.config.ReplaySequential {
+		return p.replayNext(host, commands)
+	}
+
+	for i, record := range p.records {
+		if p.used[i] || record.Host != host ||
+			!reflect.DeepEqual(record.Commands, commands) {
+			continue
+		}
+		return p.replay(i, host, commands)
+	}
+
+	logger.LogError("No recorded output left for %v on %v", commands, host)
+	return nil, fmt.Errorf("No recorded output left for %v on %v", commands, host)
+}
+
+func (p *Replayer) replayNext(host string, commands []string) ([]string, error) {
+	if p.next >= len(p.records) {
+		logger.LogError("No recorded output left for %v on %v", commands, host)
+		return nil, fmt.Errorf("No recorded output left for %v on %v", commands, host)
+	}
+
+	record := p.records[p.next]
+	if record.Host != host || !sameVerbs(record.Commands, commands) {
+		err := fmt.Errorf("Record %v is %v on %v, not %v on %v",
+			p.next+1, record.Commands, record.Host, commands, host)
+		return nil, logger.Err(err)
+	}
+
+	p.next++
+	return p.replay(p.next-1, host, commands)
+}
+
+func (p *Replayer) replay(i int, host string, commands []string) ([]string, error) {
+	p.used[i] = true
+	logger.Debug("Replaying record %v on %v: %v", i+1, host, commands)
+	if p.records[i].Error != "" {
+		return nil, errors.New(p.records[i].Error)
+	}
+	return p.records[i].Output, nil
+}
+
+// Returns true when both lists have as many commands, each starting
+// with the same program
+func sameVerbs(recorded, commands []string) bool {
+	if len(recorded) != len(commands) {
+		return false
+	}
+	for i := range commands {
+		if commandVerb(recorded[i]) != commandVerb(commands[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func commandVerb(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func (p *Replayer) RebalanceOnExpansion() bool {
+	return p.config.RebalanceOnExpansion
+}
+
+func (p *Replayer) SnapShotLimit() int {
+	return p.config.SnapShotLimit
+}
+
+// Returns the records which have not been replayed
+func (p *Replayer) Remaining() []Record {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	remaining := make([]Record, 0)
+	for i, record := range p.records {
+		if !p.used[i] {
+			remaining = append(remaining, record)
+		}
+	}
+	return remaining
+}
+
+func NewReplayExecutor(r io.Reader, config *RecordConfig) (*ReplayExecutor, error) {
+	godbc.Require(config != nil)
+
+	replayer, err := NewReplayer(r, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize
+	e := &ReplayExecutor{}
+	e.Replayer = replayer
+	e.Throttlemap = make(map[string]chan bool)
+	e.RemoteExecutor = replayer
+
+	if config.Fstab == "" {
+		e.Fstab = "/etc/fstab"
+	} else {
+		e.Fstab = config.Fstab
+	}
+
+	// Timeouts and retries of the operations
+	e.Operations, err = sshexec.NewOperations(config.Operations)
+	if err != nil {
+		return nil, err
+	}
+
+	godbc.Ensure(e.Fstab != "")
+
+	return e, nil
+}
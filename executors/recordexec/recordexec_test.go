@@ -0,0 +1,272 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package recordexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/executors/localexec"
+	"github.com/heketi/heketi/executors/mockexec"
+	"github.com/heketi/tests"
+)
+
+type fakeTransport struct {
+	execute func(host string, commands []string) ([]string, error)
+}
+
+func (f *fakeTransport) RemoteCommandExecute(host string,
+	commands []string,
+	timeoutMinutes int) ([]string, error) {
+	return f.execute(host, commands)
+}
+
+func (f *fakeTransport) RebalanceOnExpansion() bool {
+	return true
+}
+
+func (f *fakeTransport) SnapShotLimit() int {
+	return 14
+}
+
+func readRecords(t *testing.T, b *bytes.Buffer) []Record {
+	records := make([]Record, 0)
+	dec := json.NewDecoder(b)
+	for dec.More() {
+		var record Record
+		err := dec.Decode(&record)
+		tests.Assert(t, err == nil, err)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRecorder(t *testing.T) {
+	f := &fakeTransport{
+		execute: func(host string, commands []string) ([]string, error) {
+			if host == "bad" {
+				return nil, errors.New("unreachable")
+			}
+			return []string{"out " + commands[0]}, nil
+		},
+	}
+
+	var b bytes.Buffer
+	r := NewRecorder(f, &b)
+	tests.Assert(t, r.RebalanceOnExpansion() == true)
+	tests.Assert(t, r.SnapShotLimit() == 14)
+
+	out, err := r.RemoteCommandExecute("host1", []string{"cmd1"}, 5)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(out, []string{"out cmd1"}))
+
+	out, err = r.RemoteCommandExecute("bad", []string{"cmd2"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "unreachable")
+	tests.Assert(t, out == nil)
+
+	// One line of JSON per call
+	tests.Assert(t, strings.Count(b.String(), "\n") == 2, b.String())
+	records := readRecords(t, &b)
+	tests.Assert(t, len(records) == 2)
+	tests.Assert(t, records[0].Host == "host1")
+	tests.Assert(t, reflect.DeepEqual(records[0].Commands, []string{"cmd1"}))
+	tests.Assert(t, reflect.DeepEqual(records[0].Output, []string{"out cmd1"}))
+	tests.Assert(t, records[0].Error == "")
+	tests.Assert(t, records[0].Duration >= 0)
+	tests.Assert(t, records[1].Host == "bad")
+	tests.Assert(t, records[1].Output == nil)
+	tests.Assert(t, records[1].Error == "unreachable")
+}
+
+func TestReplayer(t *testing.T) {
+	data := `{"host":"host1","commands":["cmd"],"output":["first"],"duration_ms":3}
+{"host":"host2","commands":["cmd"],"output":["other host"],"duration_ms":1}
+
+{"host":"host1","commands":["cmd"],"output":["second"],"duration_ms":2}
+{"host":"host1","commands":["fail"],"output":null,"error":"failed","duration_ms":1}
+`
+	p, err := NewReplayer(strings.NewReader(data), &RecordConfig{})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(p.Remaining()) == 4)
+
+	// Records are served in order for each host
+	out, err := p.RemoteCommandExecute("host1", []string{"cmd"}, 5)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(out, []string{"first"}), out)
+
+	out, err = p.RemoteCommandExecute("host1", []string{"cmd"}, 5)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(out, []string{"second"}), out)
+
+	out, err = p.RemoteCommandExecute("host1", []string{"fail"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "failed")
+	tests.Assert(t, out == nil)
+
+	// Nothing left to serve
+	_, err = p.RemoteCommandExecute("host1", []string{"cmd"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "No recorded output left"))
+
+	remaining := p.Remaining()
+	tests.Assert(t, len(remaining) == 1)
+	tests.Assert(t, remaining[0].Host == "host2")
+}
+
+func TestReplayerBadRecord(t *testing.T) {
+	data := `{"host":"host1","commands":["cmd"],"output":["first"]}
+not json
+`
+	p, err := NewReplayer(strings.NewReader(data), &RecordConfig{})
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "line 2"), err)
+	tests.Assert(t, p == nil)
+}
+
+func TestRecordCommands(t *testing.T) {
+	l, err := localexec.NewLocalExecutor(&localexec.LocalConfig{})
+	tests.Assert(t, err == nil)
+
+	// Record the commands of a real executor
+	var b bytes.Buffer
+	err = RecordCommands(l, &b)
+	tests.Assert(t, err == nil)
+	out, err := l.RemoteExecutor.RemoteCommandExecute("localhost", []string{"echo hi"}, 5)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, reflect.DeepEqual(out, []string{"hi\n"}))
+
+	records := readRecords(t, &b)
+	tests.Assert(t, len(records) == 1)
+	tests.Assert(t, records[0].Host == "localhost")
+	tests.Assert(t, reflect.DeepEqual(records[0].Commands, []string{"echo hi"}))
+	tests.Assert(t, reflect.DeepEqual(records[0].Output, []string{"hi\n"}))
+}
+
+func TestReplayExecutor(t *testing.T) {
+	data := `{"host":"myhost","commands":["gluster peer probe newnode"],"output":[""]}
+{"host":"myhost","commands":["gluster --mode=script snapshot config snap-max-hard-limit 14"],"output":null,"error":"snapshot config failed"}
+`
+	config := &RecordConfig{}
+	config.SnapShotLimit = 14
+	e, err := NewReplayExecutor(strings.NewReader(data), config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, e.Fstab == "/etc/fstab")
+	tests.Assert(t, e.RemoteExecutor == e.Replayer)
+
+	// The executor fails as recorded without running anything
+	err = e.PeerProbe("myhost", "newnode")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, err.Error() == "snapshot config failed", err)
+	tests.Assert(t, len(e.Replayer.Remaining()) == 0)
+}
+
+func TestReplayerSequential(t *testing.T) {
+	data := `{"host":"host1","commands":["mkdir -p /a","mount /a"],"output":["",""]}
+{"host":"host2","commands":["gluster volume info vol_a"],"output":["info"]}
+`
+	p, err := NewReplayer(strings.NewReader(data), &RecordConfig{
+		ReplaySequential: true,
+	})
+	tests.Assert(t, err == nil, err)
+
+	// Only the next record may be served
+	_, err = p.RemoteCommandExecute("host2", []string{"gluster volume info vol_b"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Record 1"), err)
+
+	// The verbs must match
+	_, err = p.RemoteCommandExecute("host1", []string{"mkdir -p /b", "umount /b"}, 5)
+	tests.Assert(t, err != nil)
+	_, err = p.RemoteCommandExecute("host1", []string{"mkdir -p /b"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(p.Remaining()) == 2)
+
+	out, err := p.RemoteCommandExecute("host1", []string{"mkdir -p /b", "mount /b"}, 5)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, reflect.DeepEqual(out, []string{"", ""}), out)
+
+	out, err = p.RemoteCommandExecute("host2", []string{"gluster volume info vol_b"}, 5)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, reflect.DeepEqual(out, []string{"info"}), out)
+	tests.Assert(t, len(p.Remaining()) == 0)
+
+	_, err = p.RemoteCommandExecute("host2", []string{"gluster volume info vol_b"}, 5)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "No recorded output left"))
+}
+
+func volumeRequest(name string) *executors.VolumeRequest {
+	return &executors.VolumeRequest{
+		Name: name,
+		Type: executors.DurabilityReplica,
+		Bricks: []executors.BrickInfo{
+			{Host: "host1", Path: "/bricks/" + name + "_1/brick"},
+			{Host: "host2", Path: "/bricks/" + name + "_2/brick"},
+		},
+		Replica: 2,
+	}
+}
+
+func TestReplayVolumeCreate(t *testing.T) {
+	f := &fakeTransport{
+		execute: func(host string, commands []string) ([]string, error) {
+			return make([]string, len(commands)), nil
+		},
+	}
+
+	// Record the creation of a volume
+	var b bytes.Buffer
+	e, err := NewReplayExecutor(strings.NewReader(""), &RecordConfig{})
+	tests.Assert(t, err == nil, err)
+	e.RemoteExecutor = NewRecorder(f, &b)
+	_, err = e.VolumeCreate("host1", volumeRequest("vol_a"))
+	tests.Assert(t, err == nil, err)
+	recorded := b.String()
+	tests.Assert(t, strings.Contains(recorded, "vol_a"), recorded)
+
+	// Volumes created again get new names and brick paths, so
+	// the exact records cannot be served
+	e, err = NewReplayExecutor(strings.NewReader(recorded), &RecordConfig{})
+	tests.Assert(t, err == nil, err)
+	_, err = e.VolumeCreate("host1", volumeRequest("vol_b"))
+	tests.Assert(t, err != nil)
+
+	e, err = NewReplayExecutor(strings.NewReader(recorded), &RecordConfig{
+		ReplaySequential: true,
+	})
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(e.Replayer.Remaining()) > 0)
+	info, err := e.VolumeCreate("host1", volumeRequest("vol_b"))
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Name == "vol_b", info)
+	tests.Assert(t, len(e.Replayer.Remaining()) == 0, e.Replayer.Remaining())
+}
+
+func TestRecordCommandsUnsupportedExecutor(t *testing.T) {
+	m, err := mockexec.NewMockExecutor()
+	tests.Assert(t, err == nil)
+
+	var b bytes.Buffer
+	err = RecordCommands(m, &b)
+	tests.Assert(t, err != nil)
+}
@@ -18,6 +18,7 @@ package sshexec
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/heketi/heketi/executors"
@@ -55,14 +56,21 @@ func (s *SshExecutor) BrickCreate(host string,
 	// Create mountpoint name
 	mountpoint := s.brickMountPoint(brick)
 
-	// Create command set to execute on the node
+	// Create command set to execute on the node.  Each step is skipped
+	// when already done so that the brick can be created again after a
+	// partial failure.
 	commands := []string{
 
 		// Create a directory
 		fmt.Sprintf("mkdir -p %v", mountpoint),
 
 		// Setup the LV
-		fmt.Sprintf("lvcreate --poolmetadatasize %vK -c 256K -L %vK -T %v/%v -V %vK -n %v",
+		fmt.Sprintf("lvs %v/%v > /dev/null 2>&1 || "+
+			"lvcreate --poolmetadatasize %vK -c 256K -L %vK -T %v/%v -V %vK -n %v",
+			// Existing LV
+			s.vgName(brick.VgId),
+			s.brickName(brick.Name),
+
 			// MetadataSize
 			brick.PoolMetadataSize,
 
@@ -82,23 +90,31 @@ func (s *SshExecutor) BrickCreate(host string,
 			s.brickName(brick.Name)),
 
 		// Format
-		fmt.Sprintf("mkfs.xfs -i size=512 -n size=8192 %v", s.devnode(brick)),
+		fmt.Sprintf("blkid -o value -s TYPE %v | grep -qx xfs || "+
+			"mkfs.xfs -i size=512 -n size=8192 %v",
+			s.devnode(brick),
+			s.devnode(brick)),
 
 		// Fstab
-		fmt.Sprintf("echo \"%v %v xfs rw,inode64,noatime,nouuid 1 2\" | tee -a %v > /dev/null ",
+		fmt.Sprintf("grep -qs \"^%v %v \" %v || "+
+			"echo \"%v %v xfs rw,inode64,noatime,nouuid 1 2\" | tee -a %v > /dev/null ",
+			s.devnode(brick),
+			mountpoint,
+			s.Fstab,
 			s.devnode(brick),
 			mountpoint,
 			s.Fstab),
 
 		// Mount
-		fmt.Sprintf("mount -o rw,inode64,noatime,nouuid %v %v", s.devnode(brick), mountpoint),
+		fmt.Sprintf("mountpoint -q %v || mount -o rw,inode64,noatime,nouuid %v %v",
+			mountpoint, s.devnode(brick), mountpoint),
 
 		// Create a directory inside the formated volume for GlusterFS
-		fmt.Sprintf("mkdir %v/brick", mountpoint),
+		fmt.Sprintf("mkdir -p %v/brick", mountpoint),
 	}
 
 	// Execute commands
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.executeIdempotent("BrickCreate", host, commands)
 	if err != nil {
 		// Cleanup
 		s.BrickDestroy(host, brick)
@@ -120,31 +136,50 @@ func (s *SshExecutor) BrickDestroy(host string,
 	godbc.Require(brick.Name != "")
 	godbc.Require(brick.VgId != "")
 
+	if brick.PoolId != "" {
+		return s.cloneBrickDestroy(host, brick)
+	}
+
+	// Each step is skipped when already done so that the brick can be
+	// destroyed again after a partial failure.  The first failure is
+	// returned and the remaining steps are left for the next attempt.
+
+	// A restored brick is served from an LV of the snapshot
+	if s.brickRestored(brick) {
+		err := s.mountedLvDestroy(host, path.Dir(brick.Path))
+		if err != nil {
+			return err
+		}
+	}
+
 	// Try to unmount first
 	commands := []string{
-		fmt.Sprintf("umount %v", s.brickMountPoint(brick)),
+		fmt.Sprintf("if mountpoint -q %v; then umount %v; fi",
+			s.brickMountPoint(brick), s.brickMountPoint(brick)),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err := s.executeIdempotent("BrickDestroy", host, commands)
 	if err != nil {
-		logger.Err(err)
+		return logger.Err(err)
 	}
 
 	// Now try to remove the LV
+	tp := s.vgName(brick.VgId) + "/" + s.tpName(brick.Name)
 	commands = []string{
-		fmt.Sprintf("lvremove -f %v/%v", s.vgName(brick.VgId), s.tpName(brick.Name)),
+		fmt.Sprintf("if lvs %v > /dev/null 2>&1; then lvremove -f %v; fi", tp, tp),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.executeIdempotent("BrickDestroy", host, commands)
 	if err != nil {
-		logger.Err(err)
+		return logger.Err(err)
 	}
 
 	// Now cleanup the mount point
 	commands = []string{
-		fmt.Sprintf("rmdir %v", s.brickMountPoint(brick)),
+		fmt.Sprintf("if [ -d %v ]; then rmdir %v; fi",
+			s.brickMountPoint(brick), s.brickMountPoint(brick)),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.executeIdempotent("BrickDestroy", host, commands)
 	if err != nil {
-		logger.Err(err)
+		return logger.Err(err)
 	}
 
 	// Remove from fstab
@@ -153,14 +188,21 @@ func (s *SshExecutor) BrickDestroy(host string,
 			s.brickName(brick.Name),
 			s.Fstab),
 	}
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.executeIdempotent("BrickDestroy", host, commands)
 	if err != nil {
-		logger.Err(err)
+		return logger.Err(err)
 	}
 
 	return nil
 }
 
+// After a snapshot restore GlusterFS serves the brick from an LV of the
+// snapshot, created in the thin pool of the brick, instead of from the
+// brick's own LV
+func (s *SshExecutor) brickRestored(brick *executors.BrickRequest) bool {
+	return brick.Path != "" && brick.Path != s.brickMountPoint(brick)+"/brick"
+}
+
 func (s *SshExecutor) BrickDestroyCheck(host string,
 	brick *executors.BrickRequest) error {
 	godbc.Require(brick != nil)
@@ -168,6 +210,11 @@ func (s *SshExecutor) BrickDestroyCheck(host string,
 	godbc.Require(brick.Name != "")
 	godbc.Require(brick.VgId != "")
 
+	// The thin pool of a cloned brick always has other users
+	if brick.PoolId != "" {
+		return nil
+	}
+
 	err := s.checkThinPoolUsage(host, brick)
 	if err != nil {
 		return err
@@ -176,6 +223,70 @@ func (s *SshExecutor) BrickDestroyCheck(host string,
 	return nil
 }
 
+// Bricks of cloned volumes are LVs created and mounted by GlusterFS
+// inside the thin pool of another brick.  Only the LV is removed.
+func (s *SshExecutor) cloneBrickDestroy(host string,
+	brick *executors.BrickRequest) error {
+
+	godbc.Require(brick.Path != "")
+
+	// GlusterFS mounts the LV one level above the brick path
+	return s.mountedLvDestroy(host, path.Dir(brick.Path))
+}
+
+// Unmounts and removes the LV mounted on mountpoint.  Nothing is
+// mounted there once GlusterFS or an earlier attempt removed it.
+// All steps are tried, and the first failure is returned.
+func (s *SshExecutor) mountedLvDestroy(host, mountpoint string) error {
+
+	// Find the LV before unmounting it
+	commands := []string{
+		fmt.Sprintf("if mountpoint -q %v; then findmnt -n -o SOURCE %v; fi",
+			mountpoint, mountpoint),
+	}
+	output, err := s.executeIdempotent("BrickDestroy", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to find LV mounted on %v: %v",
+			mountpoint, err))
+	}
+	lv := ""
+	if len(output) > 0 {
+		lv = strings.TrimSpace(output[0])
+	}
+
+	var result error
+	if lv != "" {
+		// Unmount
+		commands = []string{
+			fmt.Sprintf("if mountpoint -q %v; then umount %v; fi", mountpoint, mountpoint),
+		}
+		_, err = s.executeIdempotent("BrickDestroy", host, commands)
+		if err != nil {
+			return logger.Err(fmt.Errorf("Unable to unmount %v: %v", mountpoint, err))
+		}
+
+		// Remove the LV
+		commands = []string{
+			fmt.Sprintf("if lvs %v > /dev/null 2>&1; then lvremove -f %v; fi", lv, lv),
+		}
+		_, err = s.executeIdempotent("BrickDestroy", host, commands)
+		if err != nil {
+			result = logger.Err(fmt.Errorf("Unable to remove LV %v: %v", lv, err))
+		}
+	}
+
+	// Cleanup the mount point
+	commands = []string{
+		fmt.Sprintf("if [ -d %v ]; then rmdir %v; fi", mountpoint, mountpoint),
+	}
+	_, err = s.executeIdempotent("BrickDestroy", host, commands)
+	if err != nil && result == nil {
+		result = logger.Err(fmt.Errorf("Unable to remove %v: %v", mountpoint, err))
+	}
+
+	return result
+}
+
 // Determine if any other logical volumes are using the thin pool.
 // If they are, then either a clone volume or a snapshot is using that storage,
 // and we cannot delete the brick.
@@ -193,17 +304,31 @@ func (s *SshExecutor) checkThinPoolUsage(host string,
 		fmt.Sprintf("lvs --options=lv_name,thin_count --separator=:"),
 	}
 
+	// A restored brick also owns the LV of the snapshot, and its
+	// own LV may have been left by GlusterFS
+	if s.brickRestored(brick) {
+		lv := s.vgName(brick.VgId) + "/" + s.brickName(brick.Name)
+		commands = append(commands,
+			fmt.Sprintf("if lvs %v > /dev/null 2>&1; then echo %v:2; else echo %v:1; fi",
+				lv, tp, tp))
+	}
+
 	// Send command
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	output, err := s.executeIdempotent("BrickDestroyCheck", host, commands)
 	if err != nil {
 		logger.Err(err)
 		return fmt.Errorf("Unable to determine number of logical volumes in "+
 			"thin pool %v on host %v", tp, host)
 	}
 
-	// Determine if do not have only one LV in the thin pool,
-	// we cannot delete the brick
-	lvs := strings.Index(output[0], tp+":1")
+	expected := tp + ":1"
+	if len(output) > 1 {
+		expected = strings.TrimSpace(output[1])
+	}
+
+	// Determine if do not have only the LVs of the brick in the
+	// thin pool, we cannot delete the brick
+	lvs := strings.Index(output[0], expected)
 	if lvs == -1 {
 		return fmt.Errorf("Cannot delete thin pool %v on %v because it "+
 			"is used by [%v] snapshot(s) or cloned volume(s)",
@@ -17,6 +17,7 @@
 package sshexec
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -73,30 +74,35 @@ func TestSshExecBrickCreate(t *testing.T) {
 
 			case 1:
 				tests.Assert(t,
-					cmd == "lvcreate --poolmetadatasize 5K "+
+					cmd == "lvs vg_xvgid/brick_id > /dev/null 2>&1 || "+
+						"lvcreate --poolmetadatasize 5K "+
 						"-c 256K -L 100K -T vg_xvgid/tp_id -V 10K -n brick_id", cmd)
 
 			case 2:
 				tests.Assert(t,
-					cmd == "mkfs.xfs -i size=512 "+
+					cmd == "blkid -o value -s TYPE /dev/mapper/vg_xvgid-brick_id | "+
+						"grep -qx xfs || mkfs.xfs -i size=512 "+
 						"-n size=8192 /dev/mapper/vg_xvgid-brick_id", cmd)
 
 			case 3:
 				tests.Assert(t,
-					cmd == "echo \"/dev/mapper/vg_xvgid-brick_id "+
+					cmd == "grep -qs \"^/dev/mapper/vg_xvgid-brick_id "+
+						"/var/lib/heketi/mounts/vg_xvgid/brick_id \" /my/fstab || "+
+						"echo \"/dev/mapper/vg_xvgid-brick_id "+
 						"/var/lib/heketi/mounts/vg_xvgid/brick_id "+
 						"xfs rw,inode64,noatime,nouuid 1 2\" | "+
 						"tee -a /my/fstab > /dev/null", cmd)
 
 			case 4:
 				tests.Assert(t,
-					cmd == "mount -o rw,inode64,noatime,nouuid "+
+					cmd == "mountpoint -q /var/lib/heketi/mounts/vg_xvgid/brick_id || "+
+						"mount -o rw,inode64,noatime,nouuid "+
 						"/dev/mapper/vg_xvgid-brick_id "+
 						"/var/lib/heketi/mounts/vg_xvgid/brick_id", cmd)
 
 			case 5:
 				tests.Assert(t,
-					cmd == "mkdir "+
+					cmd == "mkdir -p "+
 						"/var/lib/heketi/mounts/vg_xvgid/brick_id/brick", cmd)
 			}
 		}
@@ -160,30 +166,35 @@ func TestSshExecBrickCreateSudo(t *testing.T) {
 
 			case 1:
 				tests.Assert(t,
-					cmd == "lvcreate --poolmetadatasize 5K "+
+					cmd == "lvs vg_xvgid/brick_id > /dev/null 2>&1 || "+
+						"lvcreate --poolmetadatasize 5K "+
 						"-c 256K -L 100K -T vg_xvgid/tp_id -V 10K -n brick_id", cmd)
 
 			case 2:
 				tests.Assert(t,
-					cmd == "mkfs.xfs -i size=512 "+
+					cmd == "blkid -o value -s TYPE /dev/mapper/vg_xvgid-brick_id | "+
+						"grep -qx xfs || mkfs.xfs -i size=512 "+
 						"-n size=8192 /dev/mapper/vg_xvgid-brick_id", cmd)
 
 			case 3:
 				tests.Assert(t,
-					cmd == "echo \"/dev/mapper/vg_xvgid-brick_id "+
+					cmd == "grep -qs \"^/dev/mapper/vg_xvgid-brick_id "+
+						"/var/lib/heketi/mounts/vg_xvgid/brick_id \" /my/fstab || "+
+						"echo \"/dev/mapper/vg_xvgid-brick_id "+
 						"/var/lib/heketi/mounts/vg_xvgid/brick_id "+
 						"xfs rw,inode64,noatime,nouuid 1 2\" | "+
 						"tee -a /my/fstab > /dev/null", cmd)
 
 			case 4:
 				tests.Assert(t,
-					cmd == "mount -o rw,inode64,noatime,nouuid "+
+					cmd == "mountpoint -q /var/lib/heketi/mounts/vg_xvgid/brick_id || "+
+						"mount -o rw,inode64,noatime,nouuid "+
 						"/dev/mapper/vg_xvgid-brick_id "+
 						"/var/lib/heketi/mounts/vg_xvgid/brick_id", cmd)
 
 			case 5:
 				tests.Assert(t,
-					cmd == "mkdir "+
+					cmd == "mkdir -p "+
 						"/var/lib/heketi/mounts/vg_xvgid/brick_id/brick", cmd)
 			}
 		}
@@ -240,17 +251,18 @@ func TestSshExecBrickDestroy(t *testing.T) {
 			switch {
 			case strings.Contains(cmd, "umount"):
 				tests.Assert(t,
-					cmd == "umount "+
-						"/var/lib/heketi/mounts/vg_xvgid/brick_id", cmd)
+					cmd == "if mountpoint -q /var/lib/heketi/mounts/vg_xvgid/brick_id; "+
+						"then umount /var/lib/heketi/mounts/vg_xvgid/brick_id; fi", cmd)
 
 			case strings.Contains(cmd, "lvremove"):
 				tests.Assert(t,
-					cmd == "lvremove -f vg_xvgid/tp_id", cmd)
+					cmd == "if lvs vg_xvgid/tp_id > /dev/null 2>&1; "+
+						"then lvremove -f vg_xvgid/tp_id; fi", cmd)
 
 			case strings.Contains(cmd, "rmdir"):
 				tests.Assert(t,
-					cmd == "rmdir "+
-						"/var/lib/heketi/mounts/vg_xvgid/brick_id", cmd)
+					cmd == "if [ -d /var/lib/heketi/mounts/vg_xvgid/brick_id ]; "+
+						"then rmdir /var/lib/heketi/mounts/vg_xvgid/brick_id; fi", cmd)
 
 			case strings.Contains(cmd, "sed"):
 				tests.Assert(t,
@@ -265,4 +277,206 @@ func TestSshExecBrickDestroy(t *testing.T) {
 	// Create Brick
 	err = s.BrickDestroy("myhost", b)
 	tests.Assert(t, err == nil, err)
+
+	// The first failure is returned and the brick is left in place
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		executed = append(executed, commands...)
+		if strings.Contains(commands[0], "lvremove") {
+			return nil, errors.New("Logical volume vg_xvgid/tp_id in use")
+		}
+		return make([]string, len(commands)), nil
+	}
+	err = s.BrickDestroy("myhost", b)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "in use"), err)
+	for _, cmd := range executed {
+		tests.Assert(t, !strings.Contains(cmd, "rmdir"), executed)
+		tests.Assert(t, !strings.Contains(cmd, "sed"), executed)
+	}
+}
+
+func TestSshExecCloneBrickDestroy(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+		CLICommandConfig: CLICommandConfig{
+			Fstab: "/my/fstab",
+		},
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Brick of a cloned volume
+	b := &executors.BrickRequest{
+		VgId:   "xvgid",
+		Name:   "id",
+		TpSize: 100,
+		Size:   10,
+		PoolId: "origin",
+		Path:   "/run/gluster/snaps/c/brick1/brick",
+	}
+
+	// Mock ssh function
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		executed = append(executed, commands...)
+
+		if strings.Contains(commands[0], "findmnt") {
+			return []string{"/dev/mapper/vg_xvgid-c_0\n"}, nil
+		}
+		return nil, nil
+	}
+
+	// Only the LV of the clone is removed
+	err = s.BrickDestroy("myhost", b)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(executed) == 4, executed)
+	tests.Assert(t, executed[0] == "if mountpoint -q /run/gluster/snaps/c/brick1; "+
+		"then findmnt -n -o SOURCE /run/gluster/snaps/c/brick1; fi", executed[0])
+	tests.Assert(t, executed[1] == "if mountpoint -q /run/gluster/snaps/c/brick1; "+
+		"then umount /run/gluster/snaps/c/brick1; fi", executed[1])
+	tests.Assert(t, executed[2] == "if lvs /dev/mapper/vg_xvgid-c_0 > /dev/null 2>&1; "+
+		"then lvremove -f /dev/mapper/vg_xvgid-c_0; fi", executed[2])
+	tests.Assert(t, executed[3] == "if [ -d /run/gluster/snaps/c/brick1 ]; "+
+		"then rmdir /run/gluster/snaps/c/brick1; fi", executed[3])
+
+	// Nothing is left to unmount once GlusterFS removed the clone
+	executed = []string{}
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		executed = append(executed, commands...)
+		return []string{""}, nil
+	}
+	err = s.BrickDestroy("myhost", b)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 2, executed)
+	tests.Assert(t, strings.Contains(executed[1], "rmdir"), executed[1])
+
+	// Failures are returned
+	for _, step := range []string{"findmnt", "lvremove", "rmdir"} {
+		executed = []string{}
+		f.FakeConnectAndExec = func(host string,
+			commands []string,
+			timeoutMinutes int,
+			useSudo bool) ([]string, error) {
+
+			executed = append(executed, commands...)
+			if strings.Contains(commands[0], step) {
+				return nil, errors.New(step + " failed")
+			}
+			if strings.Contains(commands[0], "findmnt") {
+				return []string{"/dev/mapper/vg_xvgid-c_0"}, nil
+			}
+			return []string{""}, nil
+		}
+		err = s.BrickDestroy("myhost", b)
+		tests.Assert(t, err != nil, step)
+		tests.Assert(t, strings.Contains(err.Error(), step+" failed"), err)
+	}
+
+	// The thin pool is always shared
+	executed = []string{}
+	err = s.BrickDestroyCheck("myhost", b)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(executed) == 0)
+}
+
+func TestSshExecRestoredBrickDestroy(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+		CLICommandConfig: CLICommandConfig{
+			Fstab: "/my/fstab",
+		},
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Brick of a volume restored from a snapshot
+	b := &executors.BrickRequest{
+		VgId:   "xvgid",
+		Name:   "id",
+		TpSize: 100,
+		Size:   10,
+		Path:   "/run/gluster/snaps/s/brick1/brick",
+	}
+
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		executed = append(executed, commands...)
+		switch {
+		case strings.Contains(commands[0], "findmnt"):
+			return []string{"/dev/mapper/vg_xvgid-s_0"}, nil
+		case strings.HasPrefix(commands[0], "lvs --options"):
+			return []string{"tp_id:2\ntp_other:1\n", "tp_id:2"}, nil
+		}
+		return make([]string, len(commands)), nil
+	}
+
+	// The LV of the snapshot and the thin pool of the brick are removed
+	err = s.BrickDestroy("myhost", b)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 8, executed)
+	tests.Assert(t, strings.Contains(executed[0], "findmnt -n -o SOURCE /run/gluster/snaps/s/brick1"),
+		executed[0])
+	tests.Assert(t, executed[2] == "if lvs /dev/mapper/vg_xvgid-s_0 > /dev/null 2>&1; "+
+		"then lvremove -f /dev/mapper/vg_xvgid-s_0; fi", executed[2])
+	tests.Assert(t, executed[5] == "if lvs vg_xvgid/tp_id > /dev/null 2>&1; "+
+		"then lvremove -f vg_xvgid/tp_id; fi", executed[5])
+
+	// The thin pool holds the LV of the snapshot and the one of the brick
+	executed = []string{}
+	err = s.BrickDestroyCheck("myhost", b)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(executed) == 2, executed)
+	tests.Assert(t, executed[1] == "if lvs vg_xvgid/brick_id > /dev/null 2>&1; "+
+		"then echo tp_id:2; else echo tp_id:1; fi", executed[1])
+
+	// Other users of the thin pool still block it
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		return []string{"tp_id:3\n", "tp_id:2"}, nil
+	}
+	err = s.BrickDestroyCheck("myhost", b)
+	tests.Assert(t, err != nil)
 }
@@ -16,11 +16,18 @@
 
 package sshexec
 
+import (
+	"github.com/heketi/heketi/pkg/utils/ssh"
+)
+
 type CLICommandConfig struct {
 	Fstab         string `json:"fstab"`
 	Sudo          bool   `json:"sudo"`
 	SnapShotLimit int    `json:"snapshot_limit"`
 
+	// Timeouts and retries by executor operation, or "default"
+	Operations map[string]OperationConfig `json:"operations"`
+
 	// Experimental Settings
 	RebalanceOnExpansion bool `json:"rebalance_on_expansion"`
 }
@@ -30,4 +37,30 @@ type SshConfig struct {
 	PrivateKeyFile string `json:"keyfile"`
 	User           string `json:"user"`
 	Port           string `json:"port"`
+
+	// Authentication: keyfile (default), agent or password
+	AuthMethod   string `json:"auth"`
+	PasswordFile string `json:"password_file"`
+
+	// Connections to each node
+	MaxConnections        int  `json:"max_connections_per_host"`
+	KeepAlive             int  `json:"keepalive_seconds"`
+	IdleTimeout           int  `json:"idle_timeout_seconds"`
+	DisableConnectionPool bool `json:"disable_connection_pool"`
+
+	// Verification of the host keys of the nodes
+	KnownHostsFile string `json:"known_hosts"`
+	HostKeyPolicy  string `json:"host_key_policy"`
+}
+
+// Returns the policy verifying the host keys of the nodes.  Without
+// a policy the keys are checked against the known hosts file if set.
+func (c *SshConfig) EffectiveHostKeyPolicy() string {
+	if c.HostKeyPolicy != "" {
+		return c.HostKeyPolicy
+	}
+	if c.KnownHostsFile != "" {
+		return ssh.HOSTKEY_STRICT
+	}
+	return ssh.HOSTKEY_INSECURE
 }
@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -32,20 +34,57 @@ const (
 	VGDISPLAY_FREE_NUMBER_EXTENTS      = 15
 )
 
+var (
+	lsblkMountRegexp = regexp.MustCompile(`NAME="([^"]*)" MOUNTPOINT="([^"]*)"`)
+)
+
 // Read:
 // https://access.redhat.com/documentation/en-US/Red_Hat_Storage/3.1/html/Administration_Guide/Brick_Configuration.html
 //
 
-func (s *SshExecutor) DeviceSetup(host, device, vgid string) (d *executors.DeviceInfo, e error) {
+func (s *SshExecutor) DeviceSetup(host, device, vgid string,
+	destroyData bool) (d *executors.DeviceInfo, e error) {
+
+	// Check the device holds no data
+	conflict, err := s.devicePreflight(host, device, vgid)
+	if err != nil {
+		return nil, err
+	}
+	if conflict != nil {
+		// Mounted filesystems are never wiped
+		if !destroyData || len(conflict.Mounted) > 0 {
+			return nil, logger.Err(conflict)
+		}
+
+		logger.Warning("Destroying data on device %v on %v: %v", device, host, conflict)
+		var commands []string
 
-	// Setup commands
+		// Signatures of a physical volume in use cannot be wiped
+		// until it leaves its volume group
+		if conflict.VolumeGroup != "" {
+			commands, err = s.vgLeaveCommands(host, device, conflict)
+			if err != nil {
+				return nil, err
+			}
+		}
+		commands = append(commands, fmt.Sprintf("wipefs --all %v", device))
+		_, err = s.executeIdempotent("DeviceSetup", host, commands)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Setup commands.  Skipped when already done so that the device can
+	// be setup again after a partial failure.
 	commands := []string{
-		fmt.Sprintf("pvcreate --metadatasize=128M --dataalignment=256K %v", device),
-		fmt.Sprintf("vgcreate %v %v", s.vgName(vgid), device),
+		fmt.Sprintf("pvs %v > /dev/null 2>&1 || "+
+			"pvcreate --metadatasize=128M --dataalignment=256K %v", device, device),
+		fmt.Sprintf("vgs %v > /dev/null 2>&1 || vgcreate %v %v",
+			s.vgName(vgid), s.vgName(vgid), device),
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err = s.executeIdempotent("DeviceSetup", host, commands)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +98,7 @@ func (s *SshExecutor) DeviceSetup(host, device, vgid string) (d *executors.Devic
 
 	// Vg info
 	d = &executors.DeviceInfo{}
-	err = s.getVgSizeFromNode(d, host, device, vgid)
+	err = s.getVgSizeFromNode(d, "DeviceSetup", host, device, vgid)
 	if err != nil {
 		return nil, err
 	}
@@ -67,16 +106,120 @@ func (s *SshExecutor) DeviceSetup(host, device, vgid string) (d *executors.Devic
 	return d, nil
 }
 
+// Returns what keeps the device from being setup, or nil when it is
+// empty or was already setup with the volume group of vgid
+func (s *SshExecutor) devicePreflight(host, device, vgid string) (*executors.DeviceInUseError, error) {
+	commands := []string{
+		fmt.Sprintf("wipefs --parsable %v", device),
+		fmt.Sprintf("lsblk --noheadings --pairs --output NAME,MOUNTPOINT %v", device),
+		fmt.Sprintf("pvs --noheadings --options vg_name %v 2> /dev/null || true", device),
+	}
+	output, err := s.executeIdempotent("DeviceSetup", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to check device %v on %v: %v",
+			device, host, err))
+	}
+
+	// Set up by an earlier attempt
+	vg := strings.TrimSpace(output[2])
+	if vg == s.vgName(vgid) {
+		return nil, nil
+	}
+
+	conflict := &executors.DeviceInUseError{
+		Host:        host,
+		Device:      device,
+		VolumeGroup: vg,
+	}
+
+	// Lines of offset,uuid,label,type
+	for _, line := range strings.Split(output[0], "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		signature := fields[len(fields)-1]
+
+		// A physical volume without volume group is reused as is
+		if signature == "LVM2_member" && vg == "" {
+			continue
+		}
+		conflict.Signatures = append(conflict.Signatures, signature)
+	}
+
+	// Lines of NAME="sdb1" MOUNTPOINT="/mnt"
+	for _, m := range lsblkMountRegexp.FindAllStringSubmatch(output[1], -1) {
+		if m[2] != "" {
+			conflict.Mounted = append(conflict.Mounted, m[1]+" on "+m[2])
+		}
+	}
+
+	if len(conflict.Signatures) == 0 &&
+		len(conflict.Mounted) == 0 &&
+		conflict.VolumeGroup == "" {
+		return nil, nil
+	}
+	return conflict, nil
+}
+
+// Returns the commands taking the device out of the volume group it
+// belongs to.  The volume group is only removed when the device is its
+// only physical volume.  Otherwise the data of the device is moved to
+// the other physical volumes of the group, which keeps its LVs.
+func (s *SshExecutor) vgLeaveCommands(host, device string,
+	conflict *executors.DeviceInUseError) ([]string, error) {
+
+	vg := conflict.VolumeGroup
+	commands := []string{
+		fmt.Sprintf("pvs --noheadings --options pv_name --select vg_name=%v", vg),
+	}
+	output, err := s.executeIdempotent("DeviceSetup", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to list physical volumes "+
+			"of volume group %v on %v: %v", vg, host, err))
+	}
+
+	found := false
+	pvs := strings.Fields(output[0])
+	for _, pv := range pvs {
+		if pv == device {
+			found = true
+		}
+	}
+	if !found {
+		return nil, logger.Err(conflict)
+	}
+
+	if len(pvs) == 1 {
+		return []string{
+			fmt.Sprintf("vgchange -an %v", vg),
+			fmt.Sprintf("vgremove -ff %v", vg),
+			fmt.Sprintf("pvremove -ff -y %v", device),
+		}, nil
+	}
+
+	logger.Warning("Moving data of device %v on %v to the other "+
+		"physical volumes of volume group %v", device, host, vg)
+	return []string{
+		fmt.Sprintf("pvmove %v", device),
+		fmt.Sprintf("vgreduce %v %v", vg, device),
+		fmt.Sprintf("pvremove -ff -y %v", device),
+	}, nil
+}
+
 func (s *SshExecutor) DeviceTeardown(host, device, vgid string) error {
 
-	// Setup commands
+	// Setup commands.  Skipped when already done so that the device can
+	// be torn down again after a partial failure.
 	commands := []string{
-		fmt.Sprintf("vgremove %v", s.vgName(vgid)),
-		fmt.Sprintf("pvremove %v", device),
+		fmt.Sprintf("if vgs %v > /dev/null 2>&1; then vgremove %v; fi",
+			s.vgName(vgid), s.vgName(vgid)),
+		fmt.Sprintf("if pvs %v > /dev/null 2>&1; then pvremove %v; fi", device, device),
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	_, err := s.executeIdempotent("DeviceTeardown", host, commands)
 	if err != nil {
 		logger.LogError("Error while deleting device %v on %v with id %v",
 			device, host, vgid)
@@ -85,9 +228,33 @@ func (s *SshExecutor) DeviceTeardown(host, device, vgid string) error {
 	return nil
 }
 
+func (s *SshExecutor) DeviceResync(host, device, vgid string) (*executors.DeviceInfo, error) {
+	godbc.Require(host != "")
+	godbc.Require(device != "")
+	godbc.Require(vgid != "")
+
+	// Grow the physical volume to the size of the device
+	commands := []string{
+		fmt.Sprintf("pvresize %v", device),
+	}
+	_, err := s.executeIdempotent("DeviceResync", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to resize device %v on %v: %v",
+			device, host, err))
+	}
+
+	d := &executors.DeviceInfo{}
+	err = s.getVgSizeFromNode(d, "DeviceResync", host, device, vgid)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
 func (s *SshExecutor) getVgSizeFromNode(
 	d *executors.DeviceInfo,
-	host, device, vgid string) error {
+	op, host, device, vgid string) error {
 
 	// Setup command
 	commands := []string{
@@ -95,7 +262,7 @@ func (s *SshExecutor) getVgSizeFromNode(
 	}
 
 	// Execute command
-	b, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 5)
+	b, err := s.executeIdempotent(op, host, commands)
 	if err != nil {
 		return err
 	}
@@ -115,13 +282,15 @@ func (s *SshExecutor) getVgSizeFromNode(
 		return err
 	}
 
-	free_extents, err :=
-		strconv.ParseUint(vginfo[VGDISPLAY_FREE_NUMBER_EXTENTS], 10, 64)
+	// All the extents, including those of the bricks when the
+	// volume group is already used
+	total_extents, err :=
+		strconv.ParseUint(vginfo[VGDISPLAY_TOTAL_NUMBER_EXTENTS], 10, 64)
 	if err != nil {
 		return err
 	}
 
-	d.Size = free_extents * extent_size
+	d.Size = total_extents * extent_size
 	d.ExtentSize = extent_size
 	logger.Debug("Size of %v in %v is %v", device, host, d.Size)
 	return nil
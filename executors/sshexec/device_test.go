@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+// Answers the commands of device setup for a device with the
+// signatures, lsblk output, volume group and vgdisplay output
+type fakeDevice struct {
+	wipefs, lsblk, vg string
+	vgdisplay         string
+	vgPvs             string
+	executed          []string
+}
+
+func (d *fakeDevice) ConnectAndExec(host string,
+	commands []string,
+	timeoutMinutes int,
+	useSudo bool) ([]string, error) {
+
+	d.executed = append(d.executed, commands...)
+	switch {
+	case strings.HasPrefix(commands[0], "wipefs --parsable"):
+		return []string{d.wipefs, d.lsblk, d.vg}, nil
+	case strings.HasPrefix(commands[0], "pvs --noheadings --options pv_name"):
+		return []string{d.vgPvs}, nil
+	case strings.HasPrefix(commands[0], "vgdisplay"):
+		if d.vgdisplay != "" {
+			return []string{d.vgdisplay}, nil
+		}
+		return []string{"vg_xvgid:r/w:772:-1:0:0:0:-1:0:1:1:2097135616:4096:511996:0:511996:rJ0bIG"}, nil
+	}
+	return make([]string, len(commands)), nil
+}
+
+func newDeviceTestExecutor(t *testing.T, d *fakeDevice) *SshExecutor {
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return d, nil
+		}).Restore()
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	return s
+}
+
+func TestSshExecDeviceSetupTeardown(t *testing.T) {
+	d := &fakeDevice{
+		lsblk: `NAME="sdb" MOUNTPOINT=""` + "\n",
+	}
+	s := newDeviceTestExecutor(t, d)
+
+	// Existing PV and VG are kept
+	info, err := s.DeviceSetup("myhost", "/dev/sdb", "xvgid", false)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Size == 511996*4096, info.Size)
+	tests.Assert(t, len(d.executed) == 6, d.executed)
+	tests.Assert(t, d.executed[0] == "wipefs --parsable /dev/sdb", d.executed[0])
+	tests.Assert(t, d.executed[3] == "pvs /dev/sdb > /dev/null 2>&1 || "+
+		"pvcreate --metadatasize=128M --dataalignment=256K /dev/sdb", d.executed[3])
+	tests.Assert(t, d.executed[4] == "vgs vg_xvgid > /dev/null 2>&1 || "+
+		"vgcreate vg_xvgid /dev/sdb", d.executed[4])
+
+	// Missing PV and VG are not removed
+	d.executed = nil
+	err = s.DeviceTeardown("myhost", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(d.executed) == 2, d.executed)
+	tests.Assert(t, d.executed[0] == "if vgs vg_xvgid > /dev/null 2>&1; "+
+		"then vgremove vg_xvgid; fi", d.executed[0])
+	tests.Assert(t, d.executed[1] == "if pvs /dev/sdb > /dev/null 2>&1; "+
+		"then pvremove /dev/sdb; fi", d.executed[1])
+}
+
+func TestSshExecDeviceSetupPreflight(t *testing.T) {
+	d := &fakeDevice{
+		wipefs: "# offset,uuid,label,type\n" +
+			"0x1fe,,,dos\n",
+		lsblk: `NAME="sdb" MOUNTPOINT=""` + "\n" +
+			`NAME="sdb1" MOUNTPOINT="/mnt/old"` + "\n",
+	}
+	s := newDeviceTestExecutor(t, d)
+
+	// Recycled disk with a mounted partition
+	_, err := s.DeviceSetup("myhost", "/dev/sdb", "xvgid", false)
+	conflict, ok := err.(*executors.DeviceInUseError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, conflict.Host == "myhost")
+	tests.Assert(t, conflict.Device == "/dev/sdb")
+	tests.Assert(t, len(conflict.Signatures) == 1 && conflict.Signatures[0] == "dos",
+		conflict.Signatures)
+	tests.Assert(t, len(conflict.Mounted) == 1 && conflict.Mounted[0] == "sdb1 on /mnt/old",
+		conflict.Mounted)
+	tests.Assert(t, conflict.VolumeGroup == "")
+	tests.Assert(t, err.Error() == "Device /dev/sdb on myhost is in use: "+
+		"signatures dos; mounted sdb1 on /mnt/old", err)
+	tests.Assert(t, len(d.executed) == 3, d.executed)
+
+	// Mounted partitions are not wiped
+	d.executed = nil
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", true)
+	_, ok = err.(*executors.DeviceInUseError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, len(d.executed) == 3, d.executed)
+
+	// Unmounted ones are
+	d.executed = nil
+	d.lsblk = `NAME="sdb" MOUNTPOINT=""` + "\n" +
+		`NAME="sdb1" MOUNTPOINT=""` + "\n"
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", true)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(d.executed) == 7, d.executed)
+	tests.Assert(t, d.executed[3] == "wipefs --all /dev/sdb", d.executed[3])
+
+	// Volume group of another device
+	d.executed = nil
+	d.wipefs = "0x218,Ab3Cd,,LVM2_member\n"
+	d.vg = "  vg_other\n"
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", false)
+	conflict, ok = err.(*executors.DeviceInUseError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, conflict.VolumeGroup == "vg_other", conflict.VolumeGroup)
+	tests.Assert(t, len(conflict.Signatures) == 1 && conflict.Signatures[0] == "LVM2_member",
+		conflict.Signatures)
+	tests.Assert(t, len(d.executed) == 3, d.executed)
+
+	// The volume group is removed before the device is wiped
+	// when the device is its only physical volume
+	d.executed = nil
+	d.vgPvs = "  /dev/sdb\n"
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", true)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(d.executed) == 11, d.executed)
+	tests.Assert(t, d.executed[3] == "pvs --noheadings --options pv_name "+
+		"--select vg_name=vg_other", d.executed[3])
+	tests.Assert(t, d.executed[4] == "vgchange -an vg_other", d.executed[4])
+	tests.Assert(t, d.executed[5] == "vgremove -ff vg_other", d.executed[5])
+	tests.Assert(t, d.executed[6] == "pvremove -ff -y /dev/sdb", d.executed[6])
+	tests.Assert(t, d.executed[7] == "wipefs --all /dev/sdb", d.executed[7])
+
+	// Otherwise the device is moved out of the volume group
+	d.executed = nil
+	d.vgPvs = "  /dev/sdb\n  /dev/sdc\n"
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", true)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(d.executed) == 11, d.executed)
+	tests.Assert(t, d.executed[4] == "pvmove /dev/sdb", d.executed[4])
+	tests.Assert(t, d.executed[5] == "vgreduce vg_other /dev/sdb", d.executed[5])
+	tests.Assert(t, d.executed[6] == "pvremove -ff -y /dev/sdb", d.executed[6])
+	tests.Assert(t, d.executed[7] == "wipefs --all /dev/sdb", d.executed[7])
+	for _, cmd := range d.executed {
+		tests.Assert(t, !strings.Contains(cmd, "vgremove"), d.executed)
+	}
+
+	// A device not listed in the volume group is not touched
+	d.executed = nil
+	d.vgPvs = "  /dev/sdc\n"
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", true)
+	_, ok = err.(*executors.DeviceInUseError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, len(d.executed) == 4, d.executed)
+
+	// Volume group set up by an earlier attempt
+	d.executed = nil
+	d.vg = "  vg_xvgid\n"
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", false)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(d.executed) == 6, d.executed)
+
+	// Physical volume without volume group
+	d.executed = nil
+	d.vg = ""
+	_, err = s.DeviceSetup("myhost", "/dev/sdb", "xvgid", false)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(d.executed) == 6, d.executed)
+}
+
+func TestSshExecDeviceResync(t *testing.T) {
+	// The volume group has 1022 extents of which 510 are in use
+	d := &fakeDevice{
+		vgdisplay: "vg_xvgid:r/w:772:-1:0:2:2:-1:0:1:1:4186112:4096:1022:512:510:rJ0bIG",
+	}
+	s := newDeviceTestExecutor(t, d)
+
+	info, err := s.DeviceResync("myhost", "/dev/sdb", "xvgid")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Size == 1022*4096, info.Size)
+	tests.Assert(t, info.ExtentSize == 4096, info.ExtentSize)
+	tests.Assert(t, len(d.executed) == 2, d.executed)
+	tests.Assert(t, d.executed[0] == "pvresize /dev/sdb", d.executed[0])
+	tests.Assert(t, strings.HasPrefix(d.executed[1], "vgdisplay"), d.executed[1])
+	tests.Assert(t, strings.Contains(d.executed[1], "vg_xvgid"), d.executed[1])
+}
@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// Returns the gluster command running op on the geo-replication session
+func geoReplicationCommand(session *executors.GeoReplicationRequest, op string) string {
+	return fmt.Sprintf("gluster --mode=script volume geo-replication %v %v::%v %v",
+		session.Volume, session.SlaveHost, session.SlaveVolume, op)
+}
+
+// Returns the executor operation running op, as in GeoReplicationCreate
+// for "create push-pem"
+func geoReplicationOperation(op string) string {
+	return "GeoReplication" + strings.Title(strings.Fields(op)[0])
+}
+
+func (s *SshExecutor) geoReplicationExecute(host string,
+	session *executors.GeoReplicationRequest,
+	op string,
+	commands []string) error {
+
+	godbc.Require(host != "")
+	godbc.Require(session != nil)
+	godbc.Require(session.Volume != "")
+	godbc.Require(session.SlaveHost != "")
+	godbc.Require(session.SlaveVolume != "")
+
+	commands = append(commands, geoReplicationCommand(session, op))
+
+	// Execute command
+	_, err := s.execute(geoReplicationOperation(op), host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to %v geo-replication of volume %v to %v::%v: %v",
+			op, session.Volume, session.SlaveHost, session.SlaveVolume, err))
+	}
+
+	return nil
+}
+
+func (s *SshExecutor) GeoReplicationCreate(host string,
+	session *executors.GeoReplicationRequest) error {
+
+	// Generate the keys of the master nodes, and distribute
+	// them to the slave nodes when creating the session
+	return s.geoReplicationExecute(host, session, "create push-pem",
+		[]string{"gluster --mode=script system:: execute gsec_create"})
+}
+
+func (s *SshExecutor) GeoReplicationStart(host string,
+	session *executors.GeoReplicationRequest) error {
+	return s.geoReplicationExecute(host, session, "start", nil)
+}
+
+func (s *SshExecutor) GeoReplicationStop(host string,
+	session *executors.GeoReplicationRequest) error {
+	return s.geoReplicationExecute(host, session, "stop", nil)
+}
+
+func (s *SshExecutor) GeoReplicationPause(host string,
+	session *executors.GeoReplicationRequest) error {
+	return s.geoReplicationExecute(host, session, "pause", nil)
+}
+
+func (s *SshExecutor) GeoReplicationResume(host string,
+	session *executors.GeoReplicationRequest) error {
+	return s.geoReplicationExecute(host, session, "resume", nil)
+}
+
+func (s *SshExecutor) GeoReplicationDelete(host string,
+	session *executors.GeoReplicationRequest) error {
+	return s.geoReplicationExecute(host, session, "delete", nil)
+}
+
+func (s *SshExecutor) GeoReplicationStatus(host string,
+	session *executors.GeoReplicationRequest) (*executors.GeoReplicationStatus, error) {
+
+	godbc.Require(host != "")
+	godbc.Require(session != nil)
+
+	// Structure used to unmarshal XML from geo-replication gluster cli
+	type Pair struct {
+		MasterNode  string `xml:"master_node"`
+		MasterBrick string `xml:"master_brick"`
+		SlaveNode   string `xml:"slave_node"`
+		Status      string `xml:"status"`
+		CrawlStatus string `xml:"crawl_status"`
+		LastSynced  string `xml:"last_synced"`
+	}
+	type CliOutput struct {
+		OpRet  int    `xml:"opRet"`
+		OpErrs string `xml:"opErrstr"`
+		Pairs  []Pair `xml:"geoRep>volume>sessions>session>pair"`
+	}
+
+	commands := []string{
+		geoReplicationCommand(session, "status --xml"),
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("GeoReplicationStatus", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to get geo-replication status of volume %v: %v",
+			session.Volume, err))
+	}
+
+	var statusInfo CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &statusInfo)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to determine geo-replication status of volume %v: %v",
+			session.Volume, err))
+	}
+	if statusInfo.OpRet != 0 {
+		return nil, logger.Err(fmt.Errorf("Unable to get geo-replication status of volume %v: %v",
+			session.Volume, statusInfo.OpErrs))
+	}
+
+	status := &executors.GeoReplicationStatus{
+		Pairs: make([]executors.GeoReplicationPair, 0, len(statusInfo.Pairs)),
+	}
+	for _, pair := range statusInfo.Pairs {
+		status.Pairs = append(status.Pairs, executors.GeoReplicationPair{
+			MasterNode:  pair.MasterNode,
+			MasterBrick: pair.MasterBrick,
+			SlaveNode:   pair.SlaveNode,
+			Status:      pair.Status,
+			CrawlStatus: pair.CrawlStatus,
+			LastSynced:  pair.LastSynced,
+		})
+	}
+
+	return status, nil
+}
@@ -0,0 +1,188 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecGeoReplication(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	session := &executors.GeoReplicationRequest{
+		Volume:      "master",
+		SlaveHost:   "slavehost",
+		SlaveVolume: "slave",
+	}
+
+	// Mock ssh function
+	var expected []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == len(expected), commands)
+		for i, cmd := range expected {
+			tests.Assert(t, commands[i] == cmd, commands[i])
+		}
+
+		return nil, nil
+	}
+
+	// Create
+	expected = []string{
+		"gluster --mode=script system:: execute gsec_create",
+		"gluster --mode=script volume geo-replication master slavehost::slave create push-pem",
+	}
+	err = s.GeoReplicationCreate("myhost", session)
+	tests.Assert(t, err == nil)
+
+	// Operations on the session
+	for op, fn := range map[string]func(string, *executors.GeoReplicationRequest) error{
+		"start":  s.GeoReplicationStart,
+		"stop":   s.GeoReplicationStop,
+		"pause":  s.GeoReplicationPause,
+		"resume": s.GeoReplicationResume,
+		"delete": s.GeoReplicationDelete,
+	} {
+		expected = []string{
+			"gluster --mode=script volume geo-replication master slavehost::slave " + op,
+		}
+		err = fn("myhost", session)
+		tests.Assert(t, err == nil, op)
+	}
+}
+
+func TestSshExecGeoReplicationStatus(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	session := &executors.GeoReplicationRequest{
+		Volume:      "master",
+		SlaveHost:   "slavehost",
+		SlaveVolume: "slave",
+	}
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume geo-replication "+
+			"master slavehost::slave status --xml", commands[0])
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <geoRep>
+    <volume>
+      <name>master</name>
+      <sessions>
+        <session>
+          <session_slave>0f5e2a7b:ssh://slavehost::slave:7d9c1e3a</session_slave>
+          <pair>
+            <master_node>host1</master_node>
+            <master_brick>/b1/brick</master_brick>
+            <slave_user>root</slave_user>
+            <slave>ssh://slavehost::slave</slave>
+            <slave_node>slavehost</slave_node>
+            <status>Active</status>
+            <crawl_status>Changelog Crawl</crawl_status>
+            <last_synced>2016-11-02 10:02:35</last_synced>
+          </pair>
+          <pair>
+            <master_node>host2</master_node>
+            <master_brick>/b2/brick</master_brick>
+            <slave_user>root</slave_user>
+            <slave>ssh://slavehost::slave</slave>
+            <slave_node>slavehost2</slave_node>
+            <status>Passive</status>
+            <crawl_status>N/A</crawl_status>
+            <last_synced>N/A</last_synced>
+          </pair>
+        </session>
+      </sessions>
+    </volume>
+  </geoRep>
+</cliOutput>`}, nil
+	}
+
+	status, err := s.GeoReplicationStatus("myhost", session)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(status.Pairs) == 2)
+	tests.Assert(t, status.Pairs[0] == executors.GeoReplicationPair{
+		MasterNode:  "host1",
+		MasterBrick: "/b1/brick",
+		SlaveNode:   "slavehost",
+		Status:      "Active",
+		CrawlStatus: "Changelog Crawl",
+		LastSynced:  "2016-11-02 10:02:35",
+	})
+	tests.Assert(t, status.Pairs[1].Status == "Passive")
+	tests.Assert(t, status.Pairs[1].SlaveNode == "slavehost2")
+
+	// Failure reported by gluster
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return []string{`<cliOutput><opRet>-1</opRet>` +
+			`<opErrstr>No active geo-replication sessions</opErrstr></cliOutput>`}, nil
+	}
+	_, err = s.GeoReplicationStatus("myhost", session)
+	tests.Assert(t, err != nil)
+}
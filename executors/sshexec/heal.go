@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// Structure used to unmarshal XML from volume heal gluster cli
+type healInfoCliOutput struct {
+	OpRet  int    `xml:"opRet"`
+	OpErrs string `xml:"opErrstr"`
+	Bricks []struct {
+		Name            string   `xml:"name"`
+		Status          string   `xml:"status"`
+		NumberOfEntries string   `xml:"numberOfEntries"`
+		Files           []string `xml:"file"`
+	} `xml:"healInfo>bricks>brick"`
+}
+
+func parseHealInfo(volume, output string) (*healInfoCliOutput, error) {
+	var healInfo healInfoCliOutput
+	err := xml.Unmarshal([]byte(output), &healInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine heal information of volume %v: %v",
+			volume, err)
+	}
+	if healInfo.OpRet != 0 {
+		return nil, fmt.Errorf("Unable to get heal information of volume %v: %v",
+			volume, healInfo.OpErrs)
+	}
+
+	return &healInfo, nil
+}
+
+func (s *SshExecutor) VolumeHealInfo(host string, volume string) (*executors.VolumeHealInfo, error) {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume heal %v info --xml", volume),
+		fmt.Sprintf("gluster --mode=script volume heal %v info split-brain --xml", volume),
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("VolumeHealInfo", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to get heal information of volume %v: %v",
+			volume, err))
+	}
+
+	pending, err := parseHealInfo(volume, output[0])
+	if err != nil {
+		return nil, logger.Err(err)
+	}
+	splitBrain, err := parseHealInfo(volume, output[1])
+	if err != nil {
+		return nil, logger.Err(err)
+	}
+
+	// Split-brain entries of each brick
+	splitBrainFiles := make(map[string][]string)
+	for _, brick := range splitBrain.Bricks {
+		splitBrainFiles[brick.Name] = brick.Files
+	}
+
+	info := &executors.VolumeHealInfo{
+		Bricks: make([]executors.BrickHealInfo, 0, len(pending.Bricks)),
+	}
+	for _, brick := range pending.Bricks {
+		// Brick names are in the form host:/path
+		sep := strings.Index(brick.Name, ":/")
+		if sep == -1 {
+			return nil, logger.Err(fmt.Errorf("Unable to parse brick %v of volume %v",
+				brick.Name, volume))
+		}
+
+		brickInfo := executors.BrickHealInfo{
+			Host:      brick.Name[:sep],
+			Path:      brick.Name[sep+1:],
+			Connected: brick.Status == "Connected",
+		}
+
+		// The number of entries is "-" when the brick is not connected
+		if brickInfo.Connected {
+			brickInfo.PendingEntries, err = strconv.ParseUint(brick.NumberOfEntries, 10, 64)
+			if err != nil {
+				return nil, logger.Err(fmt.Errorf("Unable to parse heal entries of brick %v: %v",
+					brick.Name, err))
+			}
+			brickInfo.SplitBrainEntries = splitBrainFiles[brick.Name]
+		}
+		if brickInfo.SplitBrainEntries == nil {
+			brickInfo.SplitBrainEntries = []string{}
+		}
+
+		info.Bricks = append(info.Bricks, brickInfo)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecVolumeHealInfo(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 2)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume heal myvol info --xml",
+			commands[0])
+		tests.Assert(t, commands[1] == "gluster --mode=script volume heal myvol info split-brain --xml",
+			commands[1])
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <healInfo>
+    <bricks>
+      <brick hostUuid="a7e4f5c2-8d9b-4e1a-b3c6-1f2e3d4c5b6a">
+        <name>host1:/b1/brick</name>
+        <file gfid="3b2a1c0d-9e8f-4a7b-b6c5-d4e3f2a1b0c9">/dir/file1</file>
+        <file gfid="4c3b2a1d-0f9e-4b8a-c7d6-e5f4a3b2c1d0">/dir/file2</file>
+        <status>Connected</status>
+        <numberOfEntries>2</numberOfEntries>
+      </brick>
+      <brick hostUuid="b8f5a6d3-9e0c-4f2b-c4d7-2a3f4e5d6c7b">
+        <name>host2:/b2/brick</name>
+        <status>Connected</status>
+        <numberOfEntries>0</numberOfEntries>
+      </brick>
+      <brick hostUuid="-">
+        <name>host3:/b3/brick</name>
+        <status>Transport endpoint is not connected</status>
+        <numberOfEntries>-</numberOfEntries>
+      </brick>
+    </bricks>
+  </healInfo>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+</cliOutput>`, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <healInfo>
+    <bricks>
+      <brick hostUuid="a7e4f5c2-8d9b-4e1a-b3c6-1f2e3d4c5b6a">
+        <name>host1:/b1/brick</name>
+        <file gfid="4c3b2a1d-0f9e-4b8a-c7d6-e5f4a3b2c1d0">/dir/file2</file>
+        <status>Connected</status>
+        <numberOfEntries>1</numberOfEntries>
+      </brick>
+      <brick hostUuid="b8f5a6d3-9e0c-4f2b-c4d7-2a3f4e5d6c7b">
+        <name>host2:/b2/brick</name>
+        <status>Connected</status>
+        <numberOfEntries>0</numberOfEntries>
+      </brick>
+      <brick hostUuid="-">
+        <name>host3:/b3/brick</name>
+        <status>Transport endpoint is not connected</status>
+        <numberOfEntries>-</numberOfEntries>
+      </brick>
+    </bricks>
+  </healInfo>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+</cliOutput>`}, nil
+	}
+
+	info, err := s.VolumeHealInfo("myhost", "myvol")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(info.Bricks) == 3)
+
+	tests.Assert(t, info.Bricks[0].Host == "host1")
+	tests.Assert(t, info.Bricks[0].Path == "/b1/brick")
+	tests.Assert(t, info.Bricks[0].Connected)
+	tests.Assert(t, info.Bricks[0].PendingEntries == 2)
+	tests.Assert(t, len(info.Bricks[0].SplitBrainEntries) == 1)
+	tests.Assert(t, info.Bricks[0].SplitBrainEntries[0] == "/dir/file2")
+
+	tests.Assert(t, info.Bricks[1].Connected)
+	tests.Assert(t, info.Bricks[1].PendingEntries == 0)
+	tests.Assert(t, len(info.Bricks[1].SplitBrainEntries) == 0)
+
+	tests.Assert(t, info.Bricks[2].Host == "host3")
+	tests.Assert(t, !info.Bricks[2].Connected)
+	tests.Assert(t, info.Bricks[2].PendingEntries == 0)
+
+	// Failure reported by gluster
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		failure := `<cliOutput><opRet>-1</opRet>` +
+			`<opErrstr>Volume myvol is not of type replicate/disperse</opErrstr></cliOutput>`
+		return []string{failure, failure}, nil
+	}
+	_, err = s.VolumeHealInfo("myhost", "myvol")
+	tests.Assert(t, err != nil)
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils/ssh"
+)
+
+const (
+	// Settings of the operations not configured
+	OPERATION_DEFAULT = "default"
+
+	DefaultTimeout = 10
+	DefaultRetries = 2
+	DefaultBackoff = 1000
+)
+
+var (
+	executorType = reflect.TypeOf((*executors.Executor)(nil)).Elem()
+
+	// Operations sending commands quicker than the default timeout
+	operationTimeouts = map[string]int{
+		"BrickDestroy":      5,
+		"BrickDestroyCheck": 5,
+		"DeviceSetup":       5,
+		"DeviceTeardown":    5,
+		"DeviceResync":      5,
+		"NodeStorage":       5,
+	}
+)
+
+// Timeout and retries of the commands sent by an executor operation.
+// Zero values use the defaults and retries of -1 disable retrying.
+type OperationConfig struct {
+	TimeoutMinutes int `json:"timeout_minutes"`
+	Retries        int `json:"retries"`
+	BackoffMs      int `json:"backoff_ms"`
+}
+
+// Operations gives the timeout and retries of each executor operation
+type Operations struct {
+	config map[string]OperationConfig
+}
+
+func NewOperations(config map[string]OperationConfig) (*Operations, error) {
+	for op, c := range config {
+		if _, ok := executorType.MethodByName(op); !ok && op != OPERATION_DEFAULT {
+			return nil, fmt.Errorf("Unknown executor operation %v", op)
+		}
+		if c.TimeoutMinutes < 0 || c.Retries < -1 || c.BackoffMs < 0 {
+			return nil, fmt.Errorf("Invalid timeout or retries of operation %v", op)
+		}
+	}
+	return &Operations{config: config}, nil
+}
+
+// Policy returns the settings of the operation.  A nil Operations
+// returns the defaults.
+func (o *Operations) Policy(op string) OperationConfig {
+	p := OperationConfig{
+		TimeoutMinutes: DefaultTimeout,
+		Retries:        DefaultRetries,
+		BackoffMs:      DefaultBackoff,
+	}
+	if timeout, ok := operationTimeouts[op]; ok {
+		p.TimeoutMinutes = timeout
+	}
+
+	if o != nil {
+		for _, c := range []OperationConfig{o.config[OPERATION_DEFAULT], o.config[op]} {
+			if c.TimeoutMinutes != 0 {
+				p.TimeoutMinutes = c.TimeoutMinutes
+			}
+			if c.Retries != 0 {
+				p.Retries = c.Retries
+			}
+			if c.BackoffMs != 0 {
+				p.BackoffMs = c.BackoffMs
+			}
+		}
+	}
+
+	if p.Retries < 0 {
+		p.Retries = 0
+	}
+	return p
+}
+
+// Only failures to reach the node are retried.  Commands failing
+// on the node fail the same way when run again.
+func isTransient(err error) bool {
+	_, ok := err.(*ssh.ConnectionError)
+	return ok
+}
+
+// Sends the commands of a step of the operation
+func (s *SshExecutor) execute(op, host string, commands []string) ([]string, error) {
+	return s.RemoteExecutor.RemoteCommandExecute(host, commands,
+		s.Operations.Policy(op).TimeoutMinutes)
+}
+
+// Sends the commands of a step of the operation which can run again
+// without harm, retrying transient failures with exponential backoff
+func (s *SshExecutor) executeIdempotent(op, host string, commands []string) ([]string, error) {
+	policy := s.Operations.Policy(op)
+	backoff := time.Duration(policy.BackoffMs) * time.Millisecond
+
+	for retry := 0; ; retry++ {
+		output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands,
+			policy.TimeoutMinutes)
+		if err == nil || retry >= policy.Retries || !isTransient(err) {
+			return output, err
+		}
+
+		logger.Warning("Retrying %v on %v in %v: %v", op, host, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/heketi/pkg/utils/ssh"
+	"github.com/heketi/tests"
+)
+
+func TestOperationsPolicy(t *testing.T) {
+	// Defaults
+	var o *Operations
+	p := o.Policy("VolumeCreate")
+	tests.Assert(t, p.TimeoutMinutes == DefaultTimeout)
+	tests.Assert(t, p.Retries == DefaultRetries)
+	tests.Assert(t, p.BackoffMs == DefaultBackoff)
+	tests.Assert(t, o.Policy("BrickDestroyCheck").TimeoutMinutes == 5)
+
+	o, err := NewOperations(map[string]OperationConfig{
+		OPERATION_DEFAULT: OperationConfig{
+			Retries:   4,
+			BackoffMs: 10,
+		},
+		"VolumeCreate": OperationConfig{
+			TimeoutMinutes: 30,
+		},
+		"VolumeInfo": OperationConfig{
+			Retries: -1,
+		},
+	})
+	tests.Assert(t, err == nil)
+
+	p = o.Policy("VolumeCreate")
+	tests.Assert(t, p == OperationConfig{
+		TimeoutMinutes: 30,
+		Retries:        4,
+		BackoffMs:      10,
+	}, p)
+
+	p = o.Policy("VolumeInfo")
+	tests.Assert(t, p == OperationConfig{
+		TimeoutMinutes: DefaultTimeout,
+		Retries:        0,
+		BackoffMs:      10,
+	}, p)
+
+	p = o.Policy("DeviceSetup")
+	tests.Assert(t, p.TimeoutMinutes == 5)
+	tests.Assert(t, p.Retries == 4)
+
+	// Bad settings
+	_, err = NewOperations(map[string]OperationConfig{
+		"VolumeMake": OperationConfig{},
+	})
+	tests.Assert(t, err != nil)
+	_, err = NewOperations(map[string]OperationConfig{
+		"VolumeCreate": OperationConfig{TimeoutMinutes: -1},
+	})
+	tests.Assert(t, err != nil)
+	_, err = NewOperations(map[string]OperationConfig{
+		"VolumeCreate": OperationConfig{Retries: -2},
+	})
+	tests.Assert(t, err != nil)
+}
+
+func TestSshExecRetries(t *testing.T) {
+	var (
+		calls    int
+		timeouts []int
+		fail     error
+	)
+	f := NewFakeSsh()
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		calls++
+		timeouts = append(timeouts, timeoutMinutes)
+		if calls <= 2 {
+			return nil, fail
+		}
+		return []string{"<cliOutput><volList><count>0</count></volList></cliOutput>"}, nil
+	}
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		CLICommandConfig: CLICommandConfig{
+			Operations: map[string]OperationConfig{
+				OPERATION_DEFAULT: OperationConfig{BackoffMs: 1},
+				"VolumeList":      OperationConfig{TimeoutMinutes: 2},
+			},
+		},
+	}
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+
+	// Queries are retried after connection failures
+	fail = &ssh.ConnectionError{Err: errors.New("connection reset by peer")}
+	_, err = s.VolumeList("host")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, calls == 3, calls)
+	tests.Assert(t, timeouts[0] == 2 && timeouts[2] == 2, timeouts)
+
+	// but not after failing on the node
+	calls = 0
+	fail = errors.New("Connection failed. Please check if gluster daemon is operational.")
+	_, err = s.VolumeList("host")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 1, calls)
+
+	// Commands which may not run again are not retried
+	calls = 0
+	fail = &ssh.ConnectionError{Err: errors.New("connection reset by peer")}
+	err = s.VolumeDestroy("host", "vol")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 2, calls)
+
+	// Retries can be disabled
+	calls = 0
+	config.Operations["VolumeList"] = OperationConfig{Retries: -1}
+	s, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	_, err = s.VolumeList("host")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == 1, calls)
+
+	// Retries are limited
+	calls = -10
+	config.Operations["VolumeList"] = OperationConfig{Retries: 3}
+	s, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	_, err = s.VolumeList("host")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, calls == -6, calls)
+
+	// Hardcoded timeouts are kept by default
+	timeouts = nil
+	calls = 10
+	s.BrickDestroyCheck("host", &executors.BrickRequest{
+		Name: "brick",
+		VgId: "vg",
+	})
+	tests.Assert(t, len(timeouts) == 1 && timeouts[0] == 5, timeouts)
+}
@@ -32,7 +32,7 @@ func (s *SshExecutor) PeerProbe(host, newnode string) error {
 	commands := []string{
 		fmt.Sprintf("gluster peer probe %v", newnode),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.executeIdempotent("PeerProbe", host, commands)
 	if err != nil {
 		return err
 	}
@@ -44,7 +44,7 @@ func (s *SshExecutor) PeerProbe(host, newnode string) error {
 			fmt.Sprintf("gluster --mode=script snapshot config snap-max-hard-limit %v",
 				s.RemoteExecutor.SnapShotLimit()),
 		}
-		_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+		_, err := s.executeIdempotent("PeerProbe", host, commands)
 		if err != nil {
 			return err
 		}
@@ -53,6 +53,23 @@ func (s *SshExecutor) PeerProbe(host, newnode string) error {
 	return nil
 }
 
+// Checks glusterd is running on a node before it is added
+func (s *SshExecutor) GlusterdCheck(host string) error {
+	godbc.Require(host != "")
+
+	logger.Info("Check Glusterd service status in node %v", host)
+	commands := []string{
+		"systemctl status glusterd",
+	}
+	_, err := s.executeIdempotent("GlusterdCheck", host, commands)
+	if err != nil {
+		logger.Err(err)
+		return err
+	}
+
+	return nil
+}
+
 func (s *SshExecutor) PeerDetach(host, detachnode string) error {
 	godbc.Require(host != "")
 	godbc.Require(detachnode != "")
@@ -62,7 +79,7 @@ func (s *SshExecutor) PeerDetach(host, detachnode string) error {
 	commands := []string{
 		fmt.Sprintf("gluster peer detach %v", detachnode),
 	}
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.execute("PeerDetach", host, commands)
 	if err != nil {
 		logger.Err(err)
 	}
@@ -17,6 +17,8 @@
 package sshexec
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/heketi/heketi/pkg/utils"
@@ -106,3 +108,49 @@ func TestSshExecPeerProbe(t *testing.T) {
 	tests.Assert(t, count == 2)
 
 }
+
+func TestSshExecGlusterdCheck(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "newhost:22", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "systemctl status glusterd", commands)
+
+		return nil, nil
+	}
+
+	err = s.GlusterdCheck("newhost")
+	tests.Assert(t, err == nil, err)
+
+	// Errors reaching the node are returned
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+		return nil, errors.New("Host key verification failed for newhost")
+	}
+
+	err = s.GlusterdCheck("newhost")
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Host key verification failed"))
+}
@@ -0,0 +1,89 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"fmt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+func (s *SshExecutor) VolumeQuotaEnable(host string, volume string) error {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume quota %v enable", volume),
+	}
+
+	// Execute command
+	_, err := s.execute("VolumeQuotaEnable", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to enable quota on volume %v: %v",
+			volume, err))
+	}
+
+	return nil
+}
+
+func (s *SshExecutor) VolumeQuotaSetLimit(host string, volume string,
+	limit *executors.QuotaLimit) error {
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(limit != nil)
+	godbc.Require(limit.Path != "")
+	godbc.Require(limit.Size > 0)
+
+	cmd := fmt.Sprintf("gluster --mode=script volume quota %v limit-usage %v %vKB",
+		volume, limit.Path, limit.Size)
+	if limit.SoftLimit != 0 {
+		cmd += fmt.Sprintf(" %v%%", limit.SoftLimit)
+	}
+	commands := []string{cmd}
+
+	// Execute command
+	_, err := s.executeIdempotent("VolumeQuotaSetLimit", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to set quota limit on %v of volume %v: %v",
+			limit.Path, volume, err))
+	}
+
+	return nil
+}
+
+func (s *SshExecutor) VolumeQuotaRemoveLimit(host string, volume string,
+	path string) error {
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(path != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume quota %v remove %v", volume, path),
+	}
+
+	// Execute command
+	_, err := s.execute("VolumeQuotaRemoveLimit", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to remove quota limit on %v of volume %v: %v",
+			path, volume, err))
+	}
+
+	return nil
+}
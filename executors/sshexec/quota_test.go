@@ -0,0 +1,85 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecVolumeQuota(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	var expected string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == expected, commands[0])
+
+		return nil, nil
+	}
+
+	// Enable
+	expected = "gluster --mode=script volume quota vol enable"
+	err = s.VolumeQuotaEnable("myhost", "vol")
+	tests.Assert(t, err == nil)
+
+	// Set limit
+	expected = "gluster --mode=script volume quota vol limit-usage /tenant1 1048576KB"
+	err = s.VolumeQuotaSetLimit("myhost", "vol", &executors.QuotaLimit{
+		Path: "/tenant1",
+		Size: 1048576,
+	})
+	tests.Assert(t, err == nil)
+
+	// Set limit with soft limit
+	expected = "gluster --mode=script volume quota vol limit-usage / 2048KB 70%"
+	err = s.VolumeQuotaSetLimit("myhost", "vol", &executors.QuotaLimit{
+		Path:      "/",
+		Size:      2048,
+		SoftLimit: 70,
+	})
+	tests.Assert(t, err == nil)
+
+	// Remove limit
+	expected = "gluster --mode=script volume quota vol remove /tenant1"
+	err = s.VolumeQuotaRemoveLimit("myhost", "vol", "/tenant1")
+	tests.Assert(t, err == nil)
+}
@@ -0,0 +1,234 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+func (s *SshExecutor) SnapshotCreate(host string,
+	snapshot *executors.SnapshotRequest) (*executors.SnapshotInfo, error) {
+
+	godbc.Require(snapshot != nil)
+	godbc.Require(host != "")
+	godbc.Require(snapshot.Name != "")
+	godbc.Require(snapshot.Volume != "")
+
+	// Do not let gluster append a timestamp to the name, so that
+	// the snapshot can later be accessed by the name Heketi saved
+	cmd := fmt.Sprintf("gluster --mode=script snapshot create %v %v no-timestamp",
+		snapshot.Name, snapshot.Volume)
+	if snapshot.Description != "" {
+		cmd += fmt.Sprintf(" description \"%v\"", snapshot.Description)
+	}
+
+	// Execute command
+	commands := []string{cmd}
+	_, err := s.execute("SnapshotCreate", host, commands)
+	if err != nil {
+		return nil, err
+	}
+
+	return &executors.SnapshotInfo{
+		Name:   snapshot.Name,
+		Volume: snapshot.Volume,
+	}, nil
+}
+
+func (s *SshExecutor) SnapshotDelete(host string, snapshot string) error {
+	godbc.Require(host != "")
+	godbc.Require(snapshot != "")
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script snapshot delete %v", snapshot),
+	}
+
+	// Execute command
+	_, err := s.execute("SnapshotDelete", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to delete snapshot %v: %v", snapshot, err))
+	}
+
+	return nil
+}
+
+func (s *SshExecutor) SnapshotRestore(host string,
+	snapshot *executors.SnapshotRequest) error {
+
+	godbc.Require(snapshot != nil)
+	godbc.Require(host != "")
+	godbc.Require(snapshot.Name != "")
+	godbc.Require(snapshot.Volume != "")
+
+	// The volume must be stopped before it can be restored
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume stop %v", snapshot.Volume),
+	}
+	_, err := s.execute("SnapshotRestore", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to stop volume %v: %v", snapshot.Volume, err))
+	}
+
+	// Restore the snapshot
+	commands = []string{
+		fmt.Sprintf("gluster --mode=script snapshot restore %v", snapshot.Name),
+	}
+	_, restoreErr := s.execute("SnapshotRestore", host, commands)
+	if restoreErr != nil {
+		logger.LogError("Unable to restore snapshot %v: %v", snapshot.Name, restoreErr)
+	}
+
+	// Start the volume again even if the restore failed
+	commands = []string{
+		fmt.Sprintf("gluster --mode=script volume start %v", snapshot.Volume),
+	}
+	_, err = s.execute("SnapshotRestore", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to start volume %v: %v", snapshot.Volume, err))
+	}
+
+	if restoreErr != nil {
+		return fmt.Errorf("Unable to restore snapshot %v: %v", snapshot.Name, restoreErr)
+	}
+
+	return nil
+}
+
+func (s *SshExecutor) SnapshotList(host string, volume string) ([]executors.SnapshotInfo, error) {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	// Structure used to unmarshal XML from snapshot gluster cli
+	type CliOutput struct {
+		SnapList struct {
+			Count     int      `xml:"count"`
+			Snapshots []string `xml:"snapshot"`
+		} `xml:"snapList"`
+	}
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script snapshot list %v --xml", volume),
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("SnapshotList", host, commands)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get snapshot information from volume %v: %v", volume, err)
+	}
+
+	var snapInfo CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &snapInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine snapshot information from volume %v: %v", volume, err)
+	}
+
+	snapshots := make([]executors.SnapshotInfo, 0, len(snapInfo.SnapList.Snapshots))
+	for _, name := range snapInfo.SnapList.Snapshots {
+		snapshots = append(snapshots, executors.SnapshotInfo{
+			Name:   name,
+			Volume: volume,
+		})
+	}
+
+	return snapshots, nil
+}
+
+func (s *SshExecutor) SnapshotClone(host string,
+	clone *executors.SnapshotCloneRequest) (*executors.SnapshotCloneInfo, error) {
+
+	godbc.Require(clone != nil)
+	godbc.Require(host != "")
+	godbc.Require(clone.Volume != "")
+	godbc.Require(clone.Snapshot != "")
+	godbc.Require(clone.Origin != "")
+	godbc.Require(len(clone.Bricks) > 0)
+
+	// Only activated snapshots can be cloned
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script snapshot activate %v", clone.Snapshot),
+	}
+	_, err := s.execute("SnapshotClone", host, commands)
+	if err != nil {
+		// It may have already been activated
+		logger.Warning("Unable to activate snapshot %v: %v", clone.Snapshot, err)
+	} else {
+		defer func() {
+			commands := []string{
+				fmt.Sprintf("gluster --mode=script snapshot deactivate %v", clone.Snapshot),
+			}
+			_, err := s.execute("SnapshotClone", host, commands)
+			if err != nil {
+				logger.LogError("Unable to deactivate snapshot %v: %v", clone.Snapshot, err)
+			}
+		}()
+	}
+
+	// Clone the snapshot and start the new volume
+	commands = []string{
+		fmt.Sprintf("gluster --mode=script snapshot clone %v %v", clone.Volume, clone.Snapshot),
+		fmt.Sprintf("gluster --mode=script volume start %v", clone.Volume),
+	}
+	_, err = s.execute("SnapshotClone", host, commands)
+	if err != nil {
+		s.VolumeDestroy(host, clone.Volume)
+		return nil, logger.Err(fmt.Errorf("Unable to clone snapshot %v: %v", clone.Snapshot, err))
+	}
+
+	// GlusterFS creates the bricks of the clone in the same order
+	// as the bricks of the origin volume
+	origin, err := s.VolumeInfo(host, clone.Origin)
+	if err != nil {
+		s.VolumeDestroy(host, clone.Volume)
+		return nil, err
+	}
+	originBricks := origin.Bricks
+	volume, err := s.VolumeInfo(host, clone.Volume)
+	if err != nil {
+		s.VolumeDestroy(host, clone.Volume)
+		return nil, err
+	}
+	cloneBricks := volume.Bricks
+	if len(originBricks) != len(cloneBricks) {
+		s.VolumeDestroy(host, clone.Volume)
+		return nil, fmt.Errorf("Clone %v has %v bricks, but volume %v has %v",
+			clone.Volume, len(cloneBricks), clone.Origin, len(originBricks))
+	}
+
+	// Return the clone of each brick in the request
+	info := &executors.SnapshotCloneInfo{}
+	for _, brick := range clone.Bricks {
+		index := -1
+		for i, originBrick := range originBricks {
+			if originBrick == brick {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			s.VolumeDestroy(host, clone.Volume)
+			return nil, fmt.Errorf("Brick %v:%v not found in volume %v",
+				brick.Host, brick.Path, clone.Origin)
+		}
+		info.Bricks = append(info.Bricks, cloneBricks[index])
+	}
+
+	return info, nil
+}
@@ -0,0 +1,254 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecSnapshotCreate(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	snapshot := &executors.SnapshotRequest{
+		Name:        "snap",
+		Volume:      "vol",
+		Description: "my snapshot",
+	}
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script snapshot create "+
+			"snap vol no-timestamp description \"my snapshot\"", commands[0])
+
+		return nil, nil
+	}
+
+	info, err := s.SnapshotCreate("myhost", snapshot)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.Name == "snap")
+	tests.Assert(t, info.Volume == "vol")
+}
+
+func TestSshExecSnapshotRestore(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	snapshot := &executors.SnapshotRequest{
+		Name:   "snap",
+		Volume: "vol",
+	}
+
+	// Fail the restore and check the volume is started again
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1)
+		executed = append(executed, commands[0])
+		if commands[0] == "gluster --mode=script snapshot restore snap" {
+			return nil, errors.New("MOCK")
+		}
+
+		return nil, nil
+	}
+
+	err = s.SnapshotRestore("myhost", snapshot)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(executed) == 3, executed)
+	tests.Assert(t, executed[0] == "gluster --mode=script volume stop vol", executed[0])
+	tests.Assert(t, executed[1] == "gluster --mode=script snapshot restore snap", executed[1])
+	tests.Assert(t, executed[2] == "gluster --mode=script volume start vol", executed[2])
+}
+
+func TestSshExecSnapshotList(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script snapshot list vol --xml", commands[0])
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <snapList>
+    <count>2</count>
+    <snapshot>snap1</snapshot>
+    <snapshot>snap2</snapshot>
+  </snapList>
+</cliOutput>`}, nil
+	}
+
+	snapshots, err := s.SnapshotList("myhost", "vol")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, len(snapshots) == 2)
+	tests.Assert(t, snapshots[0].Name == "snap1")
+	tests.Assert(t, snapshots[1].Name == "snap2")
+	tests.Assert(t, snapshots[1].Volume == "vol")
+}
+
+func TestSshExecSnapshotClone(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	volumeInfo := func(bricks ...string) string {
+		xml := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <volInfo>
+    <volumes>
+      <volume>
+        <bricks>`
+		for _, brick := range bricks {
+			xml += "<brick uuid=\"x\">" + brick + "<name>" + brick + "</name></brick>"
+		}
+		return xml + `
+        </bricks>
+      </volume>
+    </volumes>
+  </volInfo>
+</cliOutput>`
+	}
+
+	clone := &executors.SnapshotCloneRequest{
+		Volume:   "clone",
+		Snapshot: "snap",
+		Origin:   "vol",
+		Bricks: []executors.BrickInfo{
+			executors.BrickInfo{Host: "host2", Path: "/b2/brick"},
+			executors.BrickInfo{Host: "host1", Path: "/b1/brick"},
+		},
+	}
+
+	// Mock ssh function
+	var executed []string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		executed = append(executed, commands...)
+		switch commands[0] {
+		case "gluster --mode=script volume info vol --xml":
+			return []string{volumeInfo("host1:/b1/brick", "host2:/b2/brick")}, nil
+		case "gluster --mode=script volume info clone --xml":
+			return []string{volumeInfo("host1:/run/gluster/snaps/c/brick1/brick",
+				"host2:/run/gluster/snaps/c/brick2/brick")}, nil
+		}
+
+		return nil, nil
+	}
+
+	info, err := s.SnapshotClone("myhost", clone)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(info.Bricks) == 2)
+
+	// Bricks are returned in the order of the request
+	tests.Assert(t, info.Bricks[0].Host == "host2")
+	tests.Assert(t, info.Bricks[0].Path == "/run/gluster/snaps/c/brick2/brick")
+	tests.Assert(t, info.Bricks[1].Host == "host1")
+	tests.Assert(t, info.Bricks[1].Path == "/run/gluster/snaps/c/brick1/brick")
+
+	tests.Assert(t, executed[0] == "gluster --mode=script snapshot activate snap", executed)
+	tests.Assert(t, executed[1] == "gluster --mode=script snapshot clone clone snap", executed)
+	tests.Assert(t, executed[2] == "gluster --mode=script volume start clone", executed)
+	tests.Assert(t, executed[len(executed)-1] == "gluster --mode=script snapshot deactivate snap", executed)
+
+	// Brick not in the origin volume
+	clone.Bricks[0].Path = "/b3/brick"
+	executed = []string{}
+	_, err = s.SnapshotClone("myhost", clone)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, executed[len(executed)-2] == "gluster --mode=script volume delete clone", executed)
+}
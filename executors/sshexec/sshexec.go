@@ -19,7 +19,10 @@ package sshexec
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/heketi/heketi/pkg/utils"
 	"github.com/heketi/heketi/pkg/utils/ssh"
@@ -36,24 +39,68 @@ type Ssher interface {
 	ConnectAndExec(host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error)
 }
 
+// Implemented by Sshers able to reuse connections
+type ConnectionPooler interface {
+	EnableConnectionPool(keepalive, idleTimeout time.Duration)
+}
+
+// Implemented by Sshers able to verify host keys
+type HostKeyChecker interface {
+	SetHostKeyVerifier(v *ssh.HostKeyVerifier)
+}
+
 type SshExecutor struct {
 	// "Public"
 	Throttlemap    map[string]chan bool
 	Lock           sync.Mutex
 	RemoteExecutor RemoteCommandTransport
 	Fstab          string
+	Operations     *Operations
+
+	// Settings of the nodes overriding the configuration
+	NodeSettings NodeSettingsSource
 
 	// Private
 	private_keyfile string
+	password        string
 	user            string
 	exec            Ssher
 	config          *SshConfig
 	port            string
+	maxConnections  int
+	hostKeys        *ssh.HostKeyVerifier
+
+	// Sshers of the nodes with their own user or key
+	sshersLock sync.Mutex
+	sshers     map[string]Ssher
+}
+
+// Connection settings of a node overriding the configuration
+type NodeSettings struct {
+	User    string
+	Port    string
+	KeyFile string
+}
+
+type NodeSettingsSource interface {
+	// Returns nil when the node uses the configuration
+	NodeSettings(host string) *NodeSettings
 }
 
+const (
+	DefaultKeepAlive   = 30
+	DefaultIdleTimeout = 300
+
+	// Authentication methods
+	AUTH_KEYFILE  = "keyfile"
+	AUTH_AGENT    = "agent"
+	AUTH_PASSWORD = "password"
+)
+
 var (
 	logger           = utils.NewLogger("[sshexec]", utils.LEVEL_DEBUG)
 	ErrSshPrivateKey = errors.New("Unable to read private key file")
+	ErrSshAgent      = errors.New("Unable to use the ssh agent")
 	sshNew           = func(logger *utils.Logger, user string, file string) (Ssher, error) {
 		s := ssh.NewSshExecWithKeyFile(logger, user, file)
 		if s == nil {
@@ -61,6 +108,16 @@ var (
 		}
 		return s, nil
 	}
+	sshNewWithAgent = func(logger *utils.Logger, user string) (Ssher, error) {
+		s := ssh.NewSshExecWithAuth(logger, user)
+		if s == nil {
+			return nil, ErrSshAgent
+		}
+		return s, nil
+	}
+	sshNewWithPassword = func(logger *utils.Logger, user string, password string) (Ssher, error) {
+		return ssh.NewSshExecWithPassword(logger, user, password), nil
+	}
 )
 
 func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
@@ -70,11 +127,28 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 	s.RemoteExecutor = s
 	s.Throttlemap = make(map[string]chan bool)
 
+	s.sshers = make(map[string]Ssher)
+
 	// Set configuration
-	if config.PrivateKeyFile == "" {
-		return nil, fmt.Errorf("Missing ssh private key file in configuration")
+	switch config.AuthMethod {
+	case AUTH_KEYFILE, "":
+		if config.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("Missing ssh private key file in configuration")
+		}
+		s.private_keyfile = config.PrivateKeyFile
+	case AUTH_AGENT:
+	case AUTH_PASSWORD:
+		if config.PasswordFile == "" {
+			return nil, fmt.Errorf("Missing ssh password file in configuration")
+		}
+		buf, err := ioutil.ReadFile(config.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read ssh password file: %v", err)
+		}
+		s.password = strings.TrimRight(string(buf), "\r\n")
+	default:
+		return nil, fmt.Errorf("Unknown ssh authentication method %v", config.AuthMethod)
 	}
-	s.private_keyfile = config.PrivateKeyFile
 
 	if config.User == "" {
 		s.user = "heketi"
@@ -94,6 +168,20 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 		s.Fstab = config.Fstab
 	}
 
+	if config.MaxConnections > 0 {
+		s.maxConnections = config.MaxConnections
+	} else {
+		s.maxConnections = 1
+	}
+
+	// Timeouts and retries of the operations
+	var err error
+	s.Operations, err = NewOperations(config.Operations)
+	if err != nil {
+		logger.Err(err)
+		return nil, err
+	}
+
 	// Save the configuration
 	s.config = config
 
@@ -102,24 +190,125 @@ func NewSshExecutor(config *SshConfig) (*SshExecutor, error) {
 		logger.Warning("Rebalance on volume expansion has been enabled.  This is an EXPERIMENTAL feature")
 	}
 
-	// Setup key
-	var err error
-	s.exec, err = sshNew(logger, s.user, s.private_keyfile)
+	// Verify the host keys of the nodes
+	policy := config.EffectiveHostKeyPolicy()
+	s.hostKeys, err = ssh.NewHostKeyVerifier(policy, config.KnownHostsFile)
+	if err != nil {
+		logger.Err(err)
+		return nil, err
+	}
+	if policy == ssh.HOSTKEY_INSECURE {
+		logger.Warning("Host keys of the nodes are not verified.  " +
+			"Set a known_hosts file or the tofu host_key_policy")
+	}
+
+	// Setup authentication
+	s.exec, err = s.newSsher(s.user, "")
 	if err != nil {
 		logger.Err(err)
 		return nil, err
 	}
+	if !config.DisableConnectionPool {
+		logger.Info("Reusing up to %v connections per node", s.maxConnections)
+	}
 
 	godbc.Ensure(s != nil)
 	godbc.Ensure(s.config == config)
 	godbc.Ensure(s.user != "")
-	godbc.Ensure(s.private_keyfile != "")
+	godbc.Ensure(s.private_keyfile != "" || config.AuthMethod != "" && config.AuthMethod != AUTH_KEYFILE)
 	godbc.Ensure(s.port != "")
 	godbc.Ensure(s.Fstab != "")
 
 	return s, nil
 }
 
+// newSsher returns an Ssher logging in as the user with the key file, or
+// with the configured authentication method when there is no key file
+func (s *SshExecutor) newSsher(user, keyfile string) (Ssher, error) {
+	var (
+		exec Ssher
+		err  error
+	)
+	switch {
+	case keyfile != "":
+		exec, err = sshNew(logger, user, keyfile)
+	case s.config.AuthMethod == AUTH_AGENT:
+		exec, err = sshNewWithAgent(logger, user)
+	case s.config.AuthMethod == AUTH_PASSWORD:
+		exec, err = sshNewWithPassword(logger, user, s.password)
+	default:
+		exec, err = sshNew(logger, user, s.private_keyfile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c, ok := exec.(HostKeyChecker); ok {
+		c.SetHostKeyVerifier(s.hostKeys)
+	}
+
+	// Reuse the connections to the nodes
+	if p, ok := exec.(ConnectionPooler); ok && !s.config.DisableConnectionPool {
+		keepalive := s.config.KeepAlive
+		if keepalive <= 0 {
+			keepalive = DefaultKeepAlive
+		}
+		idleTimeout := s.config.IdleTimeout
+		if idleTimeout <= 0 {
+			idleTimeout = DefaultIdleTimeout
+		}
+		p.EnableConnectionPool(time.Duration(keepalive)*time.Second,
+			time.Duration(idleTimeout)*time.Second)
+	}
+
+	return exec, nil
+}
+
+// connection returns the Ssher and port used to reach the host
+func (s *SshExecutor) connection(host string) (Ssher, string, error) {
+	var settings *NodeSettings
+	if s.NodeSettings != nil {
+		settings = s.NodeSettings.NodeSettings(host)
+	}
+	if settings == nil {
+		return s.exec, s.port, nil
+	}
+
+	port := s.port
+	if settings.Port != "" {
+		port = settings.Port
+	}
+	if settings.User == "" && settings.KeyFile == "" {
+		return s.exec, port, nil
+	}
+
+	user := s.user
+	if settings.User != "" {
+		user = settings.User
+	}
+
+	s.sshersLock.Lock()
+	defer s.sshersLock.Unlock()
+
+	key := user + "\x00" + settings.KeyFile
+	if exec, ok := s.sshers[key]; ok {
+		return exec, port, nil
+	}
+	exec, err := s.newSsher(user, settings.KeyFile)
+	if err != nil {
+		return nil, "", err
+	}
+	s.sshers[key] = exec
+	return exec, port, nil
+}
+
+// SetHostKeyStore sets where the host keys trusted on first use are saved
+func (s *SshExecutor) SetHostKeyStore(store ssh.HostKeyStore) {
+	if s.hostKeys != nil {
+		s.hostKeys.SetStore(store)
+	}
+}
+
 func (s *SshExecutor) SetLogLevel(level string) {
 	switch level {
 	case "none":
@@ -146,7 +335,12 @@ func (s *SshExecutor) AccessConnection(host string) {
 
 	s.Lock.Lock()
 	if c, ok = s.Throttlemap[host]; !ok {
-		c = make(chan bool, 1)
+		// Executors not created by NewSshExecutor run one batch at a time
+		max := s.maxConnections
+		if max < 1 {
+			max = 1
+		}
+		c = make(chan bool, max)
 		s.Throttlemap[host] = c
 	}
 	s.Lock.Unlock()
@@ -170,8 +364,14 @@ func (s *SshExecutor) RemoteCommandExecute(host string,
 	s.AccessConnection(host)
 	defer s.FreeConnection(host)
 
+	exec, port, err := s.connection(host)
+	if err != nil {
+		logger.LogError("Unable to connect to %v: %v", host, err)
+		return nil, err
+	}
+
 	// Execute
-	return s.exec.ConnectAndExec(host+":"+s.port, commands, timeoutMinutes, s.config.Sudo)
+	return exec.ConnectAndExec(host+":"+port, commands, timeoutMinutes, s.config.Sudo)
 }
 
 func (s *SshExecutor) vgName(vgId string) string {
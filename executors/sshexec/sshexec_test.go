@@ -17,9 +17,14 @@
 package sshexec
 
 import (
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/heketi/pkg/utils/ssh"
 	"github.com/heketi/tests"
 )
 
@@ -147,6 +152,7 @@ func TestNewSshExecDefaults(t *testing.T) {
 	tests.Assert(t, s.port == "22")
 	tests.Assert(t, s.Fstab == "/etc/fstab")
 	tests.Assert(t, s.exec != nil)
+	tests.Assert(t, s.maxConnections == 1)
 
 }
 
@@ -157,3 +163,271 @@ func TestNewSshExecBadPrivateKeyLocation(t *testing.T) {
 	tests.Assert(t, s == nil)
 	tests.Assert(t, err != nil)
 }
+
+type FakePooledSsh struct {
+	FakeSsh
+	keepalive, idleTimeout time.Duration
+}
+
+func (f *FakePooledSsh) EnableConnectionPool(keepalive, idleTimeout time.Duration) {
+	f.keepalive = keepalive
+	f.idleTimeout = idleTimeout
+}
+
+func TestNewSshExecConnectionPool(t *testing.T) {
+	f := &FakePooledSsh{FakeSsh: *NewFakeSsh()}
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+	}
+	_, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, f.keepalive == DefaultKeepAlive*time.Second)
+	tests.Assert(t, f.idleTimeout == DefaultIdleTimeout*time.Second)
+
+	config.KeepAlive = 10
+	config.IdleTimeout = 60
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, f.keepalive == 10*time.Second)
+	tests.Assert(t, f.idleTimeout == 60*time.Second)
+
+	f.keepalive = 0
+	config.DisableConnectionPool = true
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, f.keepalive == 0)
+}
+
+func TestSshExecMaxConnections(t *testing.T) {
+	var (
+		lock              sync.Mutex
+		running, maxInUse int
+	)
+	f := NewFakeSsh()
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		lock.Lock()
+		running++
+		if running > maxInUse {
+			maxInUse = running
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return []string{""}, nil
+	}
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		MaxConnections: 3,
+	}
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.RemoteCommandExecute("host", []string{"ls"}, 1)
+			tests.Assert(t, err == nil)
+		}()
+	}
+	wg.Wait()
+	tests.Assert(t, maxInUse == 3, maxInUse)
+}
+
+type FakeCheckedSsh struct {
+	FakeSsh
+	verifier *ssh.HostKeyVerifier
+}
+
+func (f *FakeCheckedSsh) SetHostKeyVerifier(v *ssh.HostKeyVerifier) {
+	f.verifier = v
+}
+
+func TestNewSshExecHostKeyPolicy(t *testing.T) {
+	f := &FakeCheckedSsh{FakeSsh: *NewFakeSsh()}
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	knownHosts := tests.Tempfile()
+	defer os.Remove(knownHosts)
+	err := ioutil.WriteFile(knownHosts, []byte("# no hosts yet\n"), 0600)
+	tests.Assert(t, err == nil)
+
+	// Not verified by default
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+	}
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, f.verifier.Policy() == ssh.HOSTKEY_INSECURE)
+
+	// Strict with a known hosts file
+	config.KnownHostsFile = knownHosts
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, f.verifier.Policy() == ssh.HOSTKEY_STRICT)
+
+	config.HostKeyPolicy = ssh.HOSTKEY_TOFU
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, f.verifier.Policy() == ssh.HOSTKEY_TOFU)
+	tests.Assert(t, s.hostKeys == f.verifier)
+
+	// Bad settings
+	config.HostKeyPolicy = "paranoid"
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+
+	config.HostKeyPolicy = ssh.HOSTKEY_STRICT
+	config.KnownHostsFile = ""
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+
+	config.KnownHostsFile = "/does/not/exist"
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+}
+
+func TestNewSshExecAuthMethods(t *testing.T) {
+	var used string
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			used = "keyfile " + user + " " + file
+			return NewFakeSsh(), nil
+		}).Restore()
+	defer tests.Patch(&sshNewWithAgent,
+		func(logger *utils.Logger, user string) (Ssher, error) {
+			used = "agent " + user
+			return NewFakeSsh(), nil
+		}).Restore()
+	defer tests.Patch(&sshNewWithPassword,
+		func(logger *utils.Logger, user string, password string) (Ssher, error) {
+			used = "password " + user + " " + password
+			return NewFakeSsh(), nil
+		}).Restore()
+
+	passwordFile := tests.Tempfile()
+	defer os.Remove(passwordFile)
+	err := ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600)
+	tests.Assert(t, err == nil)
+
+	config := &SshConfig{
+		User:           "xuser",
+		PrivateKeyFile: "xkeyfile",
+	}
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, used == "keyfile xuser xkeyfile", used)
+
+	// No key file needed with the agent
+	config.AuthMethod = AUTH_AGENT
+	config.PrivateKeyFile = ""
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, used == "agent xuser", used)
+
+	config.AuthMethod = AUTH_PASSWORD
+	config.PasswordFile = passwordFile
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, used == "password xuser secret", used)
+
+	// Bad settings
+	config.PasswordFile = "/does/not/exist"
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+
+	config.PasswordFile = ""
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+
+	config.AuthMethod = "kerberos"
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+
+	config.AuthMethod = AUTH_KEYFILE
+	_, err = NewSshExecutor(config)
+	tests.Assert(t, err != nil)
+}
+
+type FakeNodeSettings map[string]*NodeSettings
+
+func (f FakeNodeSettings) NodeSettings(host string) *NodeSettings {
+	return f[host]
+}
+
+func TestSshExecNodeSettings(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		created []string
+		called  []string
+	)
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			login := user + " " + file
+			created = append(created, login)
+
+			f := NewFakeSsh()
+			f.FakeConnectAndExec = func(host string,
+				commands []string,
+				timeoutMinutes int,
+				useSudo bool) ([]string, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				called = append(called, login+" "+host)
+				return []string{""}, nil
+			}
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		User:           "xuser",
+		Port:           "22",
+		PrivateKeyFile: "xkeyfile",
+	}
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	s.NodeSettings = FakeNodeSettings{
+		"port":  &NodeSettings{Port: "2222"},
+		"user":  &NodeSettings{User: "admin"},
+		"key":   &NodeSettings{KeyFile: "nodekey"},
+		"key2":  &NodeSettings{KeyFile: "nodekey", Port: "23"},
+		"other": nil,
+	}
+
+	for _, host := range []string{"none", "port", "user", "key", "key2", "user"} {
+		_, err := s.RemoteCommandExecute(host, []string{"ls"}, 1)
+		tests.Assert(t, err == nil)
+	}
+	tests.Assert(t, len(called) == 6, called)
+	tests.Assert(t, called[0] == "xuser xkeyfile none:22", called[0])
+	tests.Assert(t, called[1] == "xuser xkeyfile port:2222", called[1])
+	tests.Assert(t, called[2] == "admin xkeyfile user:22", called[2])
+	tests.Assert(t, called[3] == "xuser nodekey key:22", called[3])
+	tests.Assert(t, called[4] == "xuser nodekey key2:23", called[4])
+	tests.Assert(t, called[5] == "admin xkeyfile user:22", called[5])
+
+	// Connections with the same login are shared
+	tests.Assert(t, len(created) == 3, created)
+}
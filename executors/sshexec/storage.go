@@ -0,0 +1,132 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/lpabon/godbc"
+)
+
+// Returns the size in KB of a size printed by lvm with --units k --nosuffix
+func parseLvmSize(size string) (uint64, error) {
+	kb, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(kb), nil
+}
+
+func (s *SshExecutor) NodeStorage(host string) (*executors.NodeStorage, error) {
+	godbc.Require(host != "")
+	godbc.Require(s.Fstab != "")
+
+	commands := []string{
+		"vgs --noheadings --units k --nosuffix --separator : -o vg_name,vg_size",
+		"lvs --noheadings --units k --nosuffix --separator : -o vg_name,lv_name,lv_size",
+		fmt.Sprintf("cat %v", s.Fstab),
+		fmt.Sprintf("find %v -mindepth 2 -maxdepth 2 -type d -name \"brick_*\" 2>/dev/null || true",
+			rootMountPoint),
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("NodeStorage", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to get storage of node %v: %v", host, err))
+	}
+
+	storage := &executors.NodeStorage{
+		Devices: make(map[string]uint64),
+		Bricks:  make(map[string]*executors.BrickStorage),
+	}
+	brick := func(vgid, id string) *executors.BrickStorage {
+		b, ok := storage.Bricks[id]
+		if !ok {
+			b = &executors.BrickStorage{VgId: vgid}
+			storage.Bricks[id] = b
+		}
+		return b
+	}
+
+	// Volume groups created by Heketi are named after the device id
+	for _, line := range strings.Split(output[0], "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "vg_") {
+			continue
+		}
+		size, err := parseLvmSize(fields[1])
+		if err != nil {
+			return nil, logger.Err(fmt.Errorf("Unable to parse size of %v on %v: %v",
+				fields[0], host, err))
+		}
+		storage.Devices[strings.TrimPrefix(fields[0], "vg_")] = size
+	}
+
+	// Thin pools and LVs of bricks are named after the brick id
+	for _, line := range strings.Split(output[1], "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "vg_") {
+			continue
+		}
+		vgid := strings.TrimPrefix(fields[0], "vg_")
+		size, err := parseLvmSize(fields[2])
+		if err != nil {
+			return nil, logger.Err(fmt.Errorf("Unable to parse size of %v/%v on %v: %v",
+				fields[0], fields[1], host, err))
+		}
+
+		switch {
+		case strings.HasPrefix(fields[1], "tp_"):
+			brick(vgid, strings.TrimPrefix(fields[1], "tp_")).TpSize = size
+		case strings.HasPrefix(fields[1], "brick_"):
+			brick(vgid, strings.TrimPrefix(fields[1], "brick_")).Size = size
+		}
+	}
+
+	// Bricks are mounted on rootMountPoint/vg_<device id>/brick_<brick id>
+	mountPointBrick := func(mountpoint string) *executors.BrickStorage {
+		if path.Dir(path.Dir(mountpoint)) != rootMountPoint {
+			return nil
+		}
+		vg := path.Base(path.Dir(mountpoint))
+		lv := path.Base(mountpoint)
+		if !strings.HasPrefix(vg, "vg_") || !strings.HasPrefix(lv, "brick_") {
+			return nil
+		}
+		return brick(strings.TrimPrefix(vg, "vg_"), strings.TrimPrefix(lv, "brick_"))
+	}
+	for _, line := range strings.Split(output[2], "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if b := mountPointBrick(fields[1]); b != nil {
+			b.Fstab = true
+		}
+	}
+	for _, line := range strings.Split(output[3], "\n") {
+		if b := mountPointBrick(strings.TrimSpace(line)); b != nil {
+			b.Directory = true
+		}
+	}
+
+	return storage, nil
+}
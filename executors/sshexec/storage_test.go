@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecNodeStorage(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+		CLICommandConfig: CLICommandConfig{
+			Fstab: "xfstab",
+		},
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 4)
+		tests.Assert(t, commands[0] == "vgs --noheadings --units k --nosuffix --separator : "+
+			"-o vg_name,vg_size", commands[0])
+		tests.Assert(t, commands[1] == "lvs --noheadings --units k --nosuffix --separator : "+
+			"-o vg_name,lv_name,lv_size", commands[1])
+		tests.Assert(t, commands[2] == "cat xfstab", commands[2])
+		tests.Assert(t, commands[3] == "find /var/lib/heketi/mounts -mindepth 2 -maxdepth 2 "+
+			"-type d -name \"brick_*\" 2>/dev/null || true", commands[3])
+
+		return []string{
+			`  centos:20967424.00
+  vg_d1:2093056.00
+  vg_d2:524288.00
+`,
+			`  centos:root:18870272.00
+  vg_d1:tp_b1:102400.00
+  vg_d1:brick_b1:102400.00
+  vg_d1:tp_b2:53248.00
+  vg_d2:snap_0f1e2d3c_0:102400.00
+`,
+			`/dev/mapper/centos-root /                       xfs     defaults        0 0
+# /dev/mapper/vg_d1-brick_b9 /var/lib/heketi/mounts/vg_d1/brick_b9 xfs rw 1 2
+/dev/mapper/vg_d1-brick_b1 /var/lib/heketi/mounts/vg_d1/brick_b1 xfs rw,inode64,noatime,nouuid 1 2
+/dev/mapper/vg_d2-brick_b3 /var/lib/heketi/mounts/vg_d2/brick_b3 xfs rw,inode64,noatime,nouuid 1 2
+`,
+			`/var/lib/heketi/mounts/vg_d1/brick_b1
+/var/lib/heketi/mounts/vg_d2/brick_b4
+`}, nil
+	}
+
+	storage, err := s.NodeStorage("myhost")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, len(storage.Devices) == 2)
+	tests.Assert(t, storage.Devices["d1"] == 2093056)
+	tests.Assert(t, storage.Devices["d2"] == 524288)
+
+	tests.Assert(t, len(storage.Bricks) == 4, storage.Bricks)
+	tests.Assert(t, *storage.Bricks["b1"] == executors.BrickStorage{
+		VgId:      "d1",
+		TpSize:    102400,
+		Size:      102400,
+		Fstab:     true,
+		Directory: true,
+	})
+	tests.Assert(t, *storage.Bricks["b2"] == executors.BrickStorage{
+		VgId:   "d1",
+		TpSize: 53248,
+	})
+	tests.Assert(t, *storage.Bricks["b3"] == executors.BrickStorage{
+		VgId:  "d2",
+		Fstab: true,
+	})
+	tests.Assert(t, *storage.Bricks["b4"] == executors.BrickStorage{
+		VgId:      "d2",
+		Directory: true,
+	})
+}
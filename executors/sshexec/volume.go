@@ -19,6 +19,9 @@ package sshexec
 import (
 	"encoding/xml"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/heketi/heketi/executors"
 	"github.com/lpabon/godbc"
@@ -56,6 +59,11 @@ func (s *SshExecutor) VolumeCreate(host string,
 		cmd += fmt.Sprintf("disperse-data %v redundancy %v ", volume.Data, volume.Redundancy)
 		inSet = volume.Data + volume.Redundancy
 		maxPerSet = 1
+	case executors.DurabilityArbiter:
+		logger.Info("Creating volume %v replica 3 arbiter 1", volume.Name)
+		cmd += "replica 3 arbiter 1 "
+		inSet = 3
+		maxPerSet = 5
 	}
 
 	// Setup volume create command
@@ -71,17 +79,20 @@ func (s *SshExecutor) VolumeCreate(host string,
 	// Now add all the commands to add the bricks
 	commands = append(commands, s.createAddBrickCommands(volume, inSet, inSet, maxPerSet)...)
 
+	// Set the volume options before clients can mount it
+	commands = append(commands, volumeSetCommands(volume.Name, volume.Options)...)
+
 	// Add command to start the volume
 	commands = append(commands, fmt.Sprintf("gluster --mode=script volume start %v", volume.Name))
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.execute("VolumeCreate", host, commands)
 	if err != nil {
 		s.VolumeDestroy(host, volume.Name)
 		return nil, err
 	}
 
-	return &executors.VolumeInfo{}, nil
+	return s.volumeInfoAfterChange(host, volume.Name), nil
 }
 
 func (s *SshExecutor) VolumeExpand(host string,
@@ -107,6 +118,9 @@ func (s *SshExecutor) VolumeExpand(host string,
 	case executors.DurabilityDispersion:
 		inSet = volume.Data + volume.Redundancy
 		maxPerSet = 1
+	case executors.DurabilityArbiter:
+		inSet = 3
+		maxPerSet = 5
 	}
 
 	// Setup volume create command
@@ -122,12 +136,62 @@ func (s *SshExecutor) VolumeExpand(host string,
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.execute("VolumeExpand", host, commands)
 	if err != nil {
 		return nil, err
 	}
 
-	return &executors.VolumeInfo{}, nil
+	return s.volumeInfoAfterChange(host, volume.Name), nil
+}
+
+func (s *SshExecutor) VolumeList(host string) ([]string, error) {
+	godbc.Require(host != "")
+
+	// Structure used to unmarshal XML from volume list gluster cli
+	type CliOutput struct {
+		OpRet   int      `xml:"opRet"`
+		OpErrs  string   `xml:"opErrstr"`
+		Volumes []string `xml:"volList>volume"`
+	}
+
+	commands := []string{
+		"gluster --mode=script volume list --xml",
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("VolumeList", host, commands)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to list volumes: %v", err))
+	}
+
+	var volList CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &volList)
+	if err != nil {
+		return nil, logger.Err(fmt.Errorf("Unable to determine the list of volumes: %v", err))
+	}
+	if volList.OpRet != 0 {
+		return nil, logger.Err(fmt.Errorf("Unable to list volumes: %v", volList.OpErrs))
+	}
+
+	if volList.Volumes == nil {
+		return []string{}, nil
+	}
+	return volList.Volumes, nil
+}
+
+// Returns the information of a volume which was just created or
+// expanded.  The change has already succeeded, so failing to get the
+// information is only logged and the volume name is returned.
+func (s *SshExecutor) volumeInfoAfterChange(host string, volume string) *executors.VolumeInfo {
+	info, err := s.VolumeInfo(host, volume)
+	if err != nil {
+		logger.LogError("Unable to get information of volume %v: %v", volume, err)
+		return &executors.VolumeInfo{
+			Name: volume,
+		}
+	}
+
+	return info
 }
 
 func (s *SshExecutor) VolumeDestroy(host string, volume string) error {
@@ -141,7 +205,7 @@ func (s *SshExecutor) VolumeDestroy(host string, volume string) error {
 	}
 
 	// Execute command
-	_, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err := s.execute("VolumeDestroy", host, commands)
 	if err != nil {
 		logger.LogError("Unable to stop volume %v: %v", volume, err)
 	}
@@ -153,7 +217,7 @@ func (s *SshExecutor) VolumeDestroy(host string, volume string) error {
 	}
 
 	// Execute command
-	_, err = s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	_, err = s.execute("VolumeDestroy", host, commands)
 	if err != nil {
 		return logger.Err(fmt.Errorf("Unable to delete volume %v: %v", volume, err))
 	}
@@ -174,6 +238,314 @@ func (s *SshExecutor) VolumeDestroyCheck(host, volume string) error {
 	return nil
 }
 
+func (s *SshExecutor) VolumeInfo(host string, volume string) (*executors.VolumeInfo, error) {
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+
+	// Structure used to unmarshal XML from volume gluster cli
+	type CliOutput struct {
+		VolInfo struct {
+			Volumes struct {
+				Volume struct {
+					Name      string `xml:"name"`
+					Id        string `xml:"id"`
+					StatusStr string `xml:"statusStr"`
+					TypeStr   string `xml:"typeStr"`
+					Bricks    struct {
+						Brick []struct {
+							Name string `xml:"name"`
+						} `xml:"brick"`
+					} `xml:"bricks"`
+					Options struct {
+						Option []struct {
+							Name  string `xml:"name"`
+							Value string `xml:"value"`
+						} `xml:"option"`
+					} `xml:"options"`
+				} `xml:"volume"`
+			} `xml:"volumes"`
+		} `xml:"volInfo"`
+	}
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume info %v --xml", volume),
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("VolumeInfo", host, commands)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get volume information of %v: %v", volume, err)
+	}
+
+	var volInfo CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &volInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine volume information of %v: %v", volume, err)
+	}
+
+	vol := volInfo.VolInfo.Volumes.Volume
+	info := &executors.VolumeInfo{
+		Name:    vol.Name,
+		Id:      vol.Id,
+		Type:    vol.TypeStr,
+		Status:  vol.StatusStr,
+		Bricks:  make([]executors.BrickInfo, 0),
+		Options: make(map[string]string),
+	}
+	for _, brick := range vol.Bricks.Brick {
+		// Brick names are in the form host:/path
+		sep := strings.Index(brick.Name, ":/")
+		if sep == -1 {
+			return nil, fmt.Errorf("Unable to parse brick %v of volume %v", brick.Name, volume)
+		}
+		info.Bricks = append(info.Bricks, executors.BrickInfo{
+			Host: brick.Name[:sep],
+			Path: brick.Name[sep+1:],
+		})
+	}
+	for _, option := range vol.Options.Option {
+		info.Options[option.Name] = option.Value
+	}
+
+	// Brick processes only run on started volumes
+	if info.Status == "Started" {
+		info.BrickStatus, err = s.volumeBrickStatus(host, volume)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// Returns the state of the brick processes of a started volume
+func (s *SshExecutor) volumeBrickStatus(host string,
+	volume string) (map[executors.BrickInfo]executors.BrickStatus, error) {
+
+	// Structure used to unmarshal XML from volume status gluster cli.
+	// Besides the bricks, the nodes include the daemons of the volume
+	// like the self-heal daemon.
+	type CliOutput struct {
+		OpRet  int    `xml:"opRet"`
+		OpErrs string `xml:"opErrstr"`
+		Nodes  []struct {
+			Hostname string `xml:"hostname"`
+			Path     string `xml:"path"`
+			Status   int    `xml:"status"`
+			Port     string `xml:"port"`
+			Pid      string `xml:"pid"`
+		} `xml:"volStatus>volumes>volume>node"`
+	}
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume status %v --xml", volume),
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("VolumeInfo", host, commands)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get volume status of %v: %v", volume, err)
+	}
+
+	var volStatus CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &volStatus)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine volume status of %v: %v", volume, err)
+	}
+	if volStatus.OpRet != 0 {
+		return nil, fmt.Errorf("Unable to get volume status of %v: %v",
+			volume, volStatus.OpErrs)
+	}
+
+	status := make(map[executors.BrickInfo]executors.BrickStatus)
+	for _, node := range volStatus.Nodes {
+		if !strings.HasPrefix(node.Path, "/") {
+			continue
+		}
+
+		brickStatus := executors.BrickStatus{
+			Online: node.Status == 1,
+		}
+
+		// Offline bricks report N/A
+		if brickStatus.Online {
+			brickStatus.Port, _ = strconv.Atoi(node.Port)
+			brickStatus.Pid, _ = strconv.Atoi(node.Pid)
+		}
+
+		status[executors.BrickInfo{
+			Host: node.Hostname,
+			Path: node.Path,
+		}] = brickStatus
+	}
+
+	return status, nil
+}
+
+func (s *SshExecutor) VolumeReplaceBrick(host string, volume string,
+	oldBrick *executors.BrickInfo, newBrick *executors.BrickInfo) error {
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(oldBrick != nil)
+	godbc.Require(newBrick != nil)
+
+	commands := []string{
+		fmt.Sprintf("gluster --mode=script volume replace-brick %v %v:%v %v:%v commit force",
+			volume,
+			oldBrick.Host,
+			oldBrick.Path,
+			newBrick.Host,
+			newBrick.Path),
+	}
+
+	// Execute command
+	_, err := s.execute("VolumeReplaceBrick", host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to replace brick %v:%v of volume %v: %v",
+			oldBrick.Host, oldBrick.Path, volume, err))
+	}
+
+	return nil
+}
+
+func (s *SshExecutor) VolumeRemoveBricksStart(host string, volume string,
+	bricks []executors.BrickInfo) error {
+
+	return s.removeBricks(host, volume, bricks, "start")
+}
+
+func (s *SshExecutor) VolumeRemoveBricksStatus(host string, volume string,
+	bricks []executors.BrickInfo) (*executors.RemoveBricksStatus, error) {
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(len(bricks) > 0)
+
+	// Structure used to unmarshal XML from remove-brick gluster cli
+	type CliOutput struct {
+		VolRemoveBrick struct {
+			Aggregate struct {
+				Files    uint64 `xml:"files"`
+				Failures uint64 `xml:"failures"`
+				Status   int    `xml:"status"`
+			} `xml:"aggregate"`
+		} `xml:"volRemoveBrick"`
+	}
+
+	commands := []string{
+		removeBricksCommand(volume, bricks, "status") + " --xml",
+	}
+
+	// Execute command
+	output, err := s.executeIdempotent("VolumeRemoveBricksStatus", host, commands)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get remove-brick status of volume %v: %v", volume, err)
+	}
+
+	var cliOutput CliOutput
+	err = xml.Unmarshal([]byte(output[0]), &cliOutput)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to determine remove-brick status of volume %v: %v", volume, err)
+	}
+
+	aggregate := cliOutput.VolRemoveBrick.Aggregate
+	status := &executors.RemoveBricksStatus{
+		Files:    aggregate.Files,
+		Failures: aggregate.Failures,
+	}
+
+	// GlusterFS status values are 0 not started, 1 in progress,
+	// 2 stopped, 3 completed and 4 failed
+	switch aggregate.Status {
+	case 0, 1:
+		status.State = executors.MigrationInProgress
+	case 3:
+		status.State = executors.MigrationCompleted
+	default:
+		status.State = executors.MigrationFailed
+	}
+
+	return status, nil
+}
+
+func (s *SshExecutor) VolumeRemoveBricksStop(host string, volume string,
+	bricks []executors.BrickInfo) error {
+
+	return s.removeBricks(host, volume, bricks, "stop")
+}
+
+func (s *SshExecutor) VolumeRemoveBricksCommit(host string, volume string,
+	bricks []executors.BrickInfo) error {
+
+	return s.removeBricks(host, volume, bricks, "commit")
+}
+
+func (s *SshExecutor) removeBricks(host string, volume string,
+	bricks []executors.BrickInfo, op string) error {
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(len(bricks) > 0)
+
+	commands := []string{
+		removeBricksCommand(volume, bricks, op),
+	}
+
+	// Execute command
+	_, err := s.execute("VolumeRemoveBricks"+strings.Title(op), host, commands)
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to %v removing bricks from volume %v: %v",
+			op, volume, err))
+	}
+
+	return nil
+}
+
+func removeBricksCommand(volume string, bricks []executors.BrickInfo, op string) string {
+	cmd := fmt.Sprintf("gluster --mode=script volume remove-brick %v ", volume)
+	for _, brick := range bricks {
+		cmd += fmt.Sprintf("%v:%v ", brick.Host, brick.Path)
+	}
+	return cmd + op
+}
+
+func (s *SshExecutor) VolumeSetOptions(host string, volume string,
+	options map[string]string) error {
+
+	godbc.Require(host != "")
+	godbc.Require(volume != "")
+	godbc.Require(len(options) > 0)
+
+	// Execute command
+	_, err := s.executeIdempotent("VolumeSetOptions", host,
+		volumeSetCommands(volume, options))
+	if err != nil {
+		return logger.Err(fmt.Errorf("Unable to set options of volume %v: %v",
+			volume, err))
+	}
+
+	return nil
+}
+
+// Returns the commands to set the options, sorted by option name
+func volumeSetCommands(volume string, options map[string]string) []string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	commands := []string{}
+	for _, key := range keys {
+		commands = append(commands,
+			fmt.Sprintf("gluster --mode=script volume set %v %v %v",
+				volume, key, options[key]))
+	}
+
+	return commands
+}
+
 func (s *SshExecutor) createAddBrickCommands(volume *executors.VolumeRequest,
 	start, inSet, maxPerSet int) []string {
 
@@ -217,7 +589,7 @@ func (s *SshExecutor) checkForSnapshots(host, volume string) error {
 	}
 
 	// Execute command
-	output, err := s.RemoteExecutor.RemoteCommandExecute(host, commands, 10)
+	output, err := s.executeIdempotent("VolumeDestroyCheck", host, commands)
 	if err != nil {
 		return fmt.Errorf("Unable to get snapshot information from volume %v: %v", volume, err)
 	}
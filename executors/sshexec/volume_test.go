@@ -0,0 +1,585 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sshexec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heketi/heketi/executors"
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+)
+
+func TestSshExecVolumeInfo(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume info vol --xml", commands[0])
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volInfo>
+    <volumes>
+      <volume>
+        <name>vol</name>
+        <brickCount>2</brickCount>
+        <bricks>
+          <brick uuid="a">host1:/b1/brick<name>host1:/b1/brick</name><hostUuid>a</hostUuid></brick>
+          <brick uuid="b">host2:/b2/brick<name>host2:/b2/brick</name><hostUuid>b</hostUuid></brick>
+        </bricks>
+      </volume>
+      <count>1</count>
+    </volumes>
+  </volInfo>
+</cliOutput>`}, nil
+	}
+
+	info, err := s.VolumeInfo("myhost", "vol")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Name == "vol")
+	tests.Assert(t, len(info.Bricks) == 2)
+	tests.Assert(t, info.Bricks[0].Host == "host1")
+	tests.Assert(t, info.Bricks[0].Path == "/b1/brick")
+	tests.Assert(t, info.Bricks[1].Host == "host2")
+	tests.Assert(t, info.Bricks[1].Path == "/b2/brick")
+}
+
+func TestSshExecVolumeInfoStarted(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+
+		switch commands[0] {
+		case "gluster --mode=script volume info vol --xml":
+			return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volInfo>
+    <volumes>
+      <volume>
+        <name>vol</name>
+        <id>6e4c2a1b-3d5f-4a7e-9c8b-0f1e2d3c4b5a</id>
+        <status>1</status>
+        <statusStr>Started</statusStr>
+        <brickCount>2</brickCount>
+        <type>2</type>
+        <typeStr>Replicate</typeStr>
+        <bricks>
+          <brick uuid="a">host1:/b1/brick<name>host1:/b1/brick</name><hostUuid>a</hostUuid></brick>
+          <brick uuid="b">host2:/b2/brick<name>host2:/b2/brick</name><hostUuid>b</hostUuid></brick>
+        </bricks>
+        <optCount>2</optCount>
+        <options>
+          <option>
+            <name>performance.readdir-ahead</name>
+            <value>on</value>
+          </option>
+          <option>
+            <name>network.ping-timeout</name>
+            <value>10</value>
+          </option>
+        </options>
+      </volume>
+      <count>1</count>
+    </volumes>
+  </volInfo>
+</cliOutput>`}, nil
+		case "gluster --mode=script volume status vol --xml":
+			return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volStatus>
+    <volumes>
+      <volume>
+        <volName>vol</volName>
+        <nodeCount>3</nodeCount>
+        <node>
+          <hostname>host1</hostname>
+          <path>/b1/brick</path>
+          <peerid>a</peerid>
+          <status>1</status>
+          <port>49152</port>
+          <ports>
+            <tcp>49152</tcp>
+            <rdma>N/A</rdma>
+          </ports>
+          <pid>2301</pid>
+        </node>
+        <node>
+          <hostname>host2</hostname>
+          <path>/b2/brick</path>
+          <peerid>b</peerid>
+          <status>0</status>
+          <port>N/A</port>
+          <ports>
+            <tcp>N/A</tcp>
+            <rdma>N/A</rdma>
+          </ports>
+          <pid>-1</pid>
+        </node>
+        <node>
+          <hostname>Self-heal Daemon</hostname>
+          <path>localhost</path>
+          <peerid>a</peerid>
+          <status>1</status>
+          <port>N/A</port>
+          <ports>
+            <tcp>N/A</tcp>
+            <rdma>N/A</rdma>
+          </ports>
+          <pid>2322</pid>
+        </node>
+      </volume>
+    </volumes>
+  </volStatus>
+</cliOutput>`}, nil
+		}
+
+		tests.Assert(t, false, commands[0])
+		return nil, nil
+	}
+
+	info, err := s.VolumeInfo("myhost", "vol")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.Name == "vol")
+	tests.Assert(t, info.Id == "6e4c2a1b-3d5f-4a7e-9c8b-0f1e2d3c4b5a")
+	tests.Assert(t, info.Type == "Replicate")
+	tests.Assert(t, info.Status == "Started")
+	tests.Assert(t, len(info.Bricks) == 2)
+	tests.Assert(t, reflect.DeepEqual(info.Options, map[string]string{
+		"performance.readdir-ahead": "on",
+		"network.ping-timeout":      "10",
+	}))
+
+	tests.Assert(t, len(info.BrickStatus) == 2)
+	tests.Assert(t, info.BrickStatus[info.Bricks[0]] == executors.BrickStatus{
+		Online: true,
+		Port:   49152,
+		Pid:    2301,
+	})
+	tests.Assert(t, info.BrickStatus[info.Bricks[1]] == executors.BrickStatus{})
+}
+
+func TestSshExecVolumeList(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	output := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volList>
+    <count>2</count>
+    <volume>heketidbstorage</volume>
+    <volume>vol_1</volume>
+  </volList>
+</cliOutput>`
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume list --xml", commands[0])
+
+		return []string{output}, nil
+	}
+
+	volumes, err := s.VolumeList("myhost")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, reflect.DeepEqual(volumes, []string{"heketidbstorage", "vol_1"}))
+
+	// No volumes
+	output = `<cliOutput><opRet>0</opRet><volList><count>0</count></volList></cliOutput>`
+	volumes, err = s.VolumeList("myhost")
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, volumes != nil)
+	tests.Assert(t, len(volumes) == 0)
+}
+
+func TestSshExecVolumeReplaceBrick(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume replace-brick vol "+
+			"host1:/b1/brick host3:/b3/brick commit force", commands[0])
+
+		return nil, nil
+	}
+
+	err = s.VolumeReplaceBrick("myhost", "vol",
+		&executors.BrickInfo{Host: "host1", Path: "/b1/brick"},
+		&executors.BrickInfo{Host: "host3", Path: "/b3/brick"})
+	tests.Assert(t, err == nil)
+}
+
+func TestSshExecVolumeRemoveBricks(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	bricks := []executors.BrickInfo{
+		{Host: "host1", Path: "/b1/brick"},
+		{Host: "host2", Path: "/b2/brick"},
+	}
+	prefix := "gluster --mode=script volume remove-brick vol " +
+		"host1:/b1/brick host2:/b2/brick "
+
+	// Mock ssh function
+	var status string
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 1)
+		tests.Assert(t, commands[0] == prefix+"status --xml", commands[0])
+
+		return []string{`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cliOutput>
+  <opRet>0</opRet>
+  <opErrno>0</opErrno>
+  <opErrstr/>
+  <volRemoveBrick>
+    <task-id>a</task-id>
+    <nodeCount>1</nodeCount>
+    <aggregate>
+      <files>12</files>
+      <size>1024</size>
+      <lookups>12</lookups>
+      <failures>1</failures>
+      <skipped>0</skipped>
+      <status>` + status + `</status>
+      <statusStr>-</statusStr>
+      <runtime>1.00</runtime>
+    </aggregate>
+  </volRemoveBrick>
+</cliOutput>`}, nil
+	}
+
+	status = "1"
+	info, err := s.VolumeRemoveBricksStatus("myhost", "vol", bricks)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.State == executors.MigrationInProgress)
+	tests.Assert(t, info.Files == 12)
+	tests.Assert(t, info.Failures == 1)
+
+	status = "3"
+	info, err = s.VolumeRemoveBricksStatus("myhost", "vol", bricks)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.State == executors.MigrationCompleted)
+
+	status = "4"
+	info, err = s.VolumeRemoveBricksStatus("myhost", "vol", bricks)
+	tests.Assert(t, err == nil, err)
+	tests.Assert(t, info.State == executors.MigrationFailed)
+
+	// Start, stop and commit
+	for _, op := range []string{"start", "stop", "commit"} {
+		f.FakeConnectAndExec = func(host string,
+			commands []string,
+			timeoutMinutes int,
+			useSudo bool) ([]string, error) {
+
+			tests.Assert(t, host == "myhost:100", host)
+			tests.Assert(t, len(commands) == 1)
+			tests.Assert(t, commands[0] == prefix+op, commands[0])
+
+			return nil, nil
+		}
+
+		switch op {
+		case "start":
+			err = s.VolumeRemoveBricksStart("myhost", "vol", bricks)
+		case "stop":
+			err = s.VolumeRemoveBricksStop("myhost", "vol", bricks)
+		case "commit":
+			err = s.VolumeRemoveBricksCommit("myhost", "vol", bricks)
+		}
+		tests.Assert(t, err == nil)
+	}
+}
+
+func TestSshExecVolumeCreateOptions(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+
+		// Information of the new volume
+		if commands[0] == "gluster --mode=script volume info vol --xml" {
+			return []string{`<cliOutput><volInfo><volumes><volume>` +
+				`<name>vol</name><statusStr>Created</statusStr>` +
+				`</volume></volumes></volInfo></cliOutput>`}, nil
+		}
+
+		tests.Assert(t, len(commands) == 5, commands)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume create vol replica 2 "+
+			"host1:/b1/brick host2:/b2/brick ", commands[0])
+		tests.Assert(t, commands[1] == "gluster --mode=script volume add-brick vol "+
+			"host1:/b3/brick host2:/b4/brick ", commands[1])
+		tests.Assert(t, commands[2] == "gluster --mode=script volume set vol "+
+			"network.ping-timeout 10", commands[2])
+		tests.Assert(t, commands[3] == "gluster --mode=script volume set vol "+
+			"performance.cache-size 1GB", commands[3])
+		tests.Assert(t, commands[4] == "gluster --mode=script volume start vol", commands[4])
+
+		return nil, nil
+	}
+
+	info, err := s.VolumeCreate("myhost", &executors.VolumeRequest{
+		Name:    "vol",
+		Type:    executors.DurabilityReplica,
+		Replica: 2,
+		Bricks: []executors.BrickInfo{
+			{Host: "host1", Path: "/b1/brick"},
+			{Host: "host2", Path: "/b2/brick"},
+			{Host: "host1", Path: "/b3/brick"},
+			{Host: "host2", Path: "/b4/brick"},
+		},
+		Options: map[string]string{
+			"performance.cache-size": "1GB",
+			"network.ping-timeout":   "10",
+		},
+	})
+	tests.Assert(t, err == nil)
+	tests.Assert(t, info.Name == "vol")
+	tests.Assert(t, info.Status == "Created")
+}
+
+func TestSshExecVolumeSetOptions(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+		tests.Assert(t, len(commands) == 2, commands)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume set vol "+
+			"performance.io-thread-count 32", commands[0])
+		tests.Assert(t, commands[1] == "gluster --mode=script volume set vol "+
+			"performance.write-behind off", commands[1])
+
+		return nil, nil
+	}
+
+	err = s.VolumeSetOptions("myhost", "vol", map[string]string{
+		"performance.write-behind":    "off",
+		"performance.io-thread-count": "32",
+	})
+	tests.Assert(t, err == nil)
+}
+
+func TestSshExecVolumeCreateArbiter(t *testing.T) {
+
+	f := NewFakeSsh()
+	defer tests.Patch(&sshNew,
+		func(logger *utils.Logger, user string, file string) (Ssher, error) {
+			return f, nil
+		}).Restore()
+
+	config := &SshConfig{
+		PrivateKeyFile: "xkeyfile",
+		User:           "xuser",
+		Port:           "100",
+	}
+
+	s, err := NewSshExecutor(config)
+	tests.Assert(t, err == nil)
+	tests.Assert(t, s != nil)
+
+	// Mock ssh function
+	f.FakeConnectAndExec = func(host string,
+		commands []string,
+		timeoutMinutes int,
+		useSudo bool) ([]string, error) {
+
+		tests.Assert(t, host == "myhost:100", host)
+
+		// Information of the new volume
+		if commands[0] == "gluster --mode=script volume info vol --xml" {
+			return []string{"<cliOutput/>"}, nil
+		}
+
+		tests.Assert(t, len(commands) == 3, commands)
+		tests.Assert(t, commands[0] == "gluster --mode=script volume create vol "+
+			"replica 3 arbiter 1 "+
+			"host1:/b1/brick host2:/b2/brick host3:/b3/brick ", commands[0])
+		tests.Assert(t, commands[1] == "gluster --mode=script volume add-brick vol "+
+			"host2:/b4/brick host3:/b5/brick host1:/b6/brick ", commands[1])
+		tests.Assert(t, commands[2] == "gluster --mode=script volume start vol", commands[2])
+
+		return nil, nil
+	}
+
+	_, err = s.VolumeCreate("myhost", &executors.VolumeRequest{
+		Name: "vol",
+		Type: executors.DurabilityArbiter,
+		Bricks: []executors.BrickInfo{
+			{Host: "host1", Path: "/b1/brick"},
+			{Host: "host2", Path: "/b2/brick"},
+			{Host: "host3", Path: "/b3/brick"},
+			{Host: "host2", Path: "/b4/brick"},
+			{Host: "host3", Path: "/b5/brick"},
+			{Host: "host1", Path: "/b6/brick"},
+		},
+	})
+	tests.Assert(t, err == nil)
+}
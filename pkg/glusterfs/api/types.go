@@ -41,6 +41,7 @@ const (
 	DurabilityReplicate      DurabilityType = "replicate"
 	DurabilityDistributeOnly DurabilityType = "none"
 	DurabilityEC             DurabilityType = "disperse"
+	DurabilityArbiter        DurabilityType = "arbiter"
 )
 
 // Common
@@ -74,11 +75,18 @@ type BrickInfo struct {
 // Device
 type Device struct {
 	Name string `json:"name"`
+
+	// Devices of another class are preferred for arbiter bricks
+	Class string `json:"class,omitempty"`
 }
 
 type DeviceAddRequest struct {
 	Device
 	NodeId string `json:"node"`
+
+	// Take the device out of its volume group and wipe the signatures
+	// found on it before setting it up
+	DestroyData bool `json:"destroy_data,omitempty"`
 }
 
 type DeviceInfo struct {
@@ -95,9 +103,17 @@ type DeviceInfoResponse struct {
 
 // Node
 type NodeAddRequest struct {
-	Zone      int           `json:"zone"`
-	Hostnames HostAddresses `json:"hostnames"`
-	ClusterId string        `json:"cluster"`
+	Zone      int              `json:"zone"`
+	Hostnames HostAddresses    `json:"hostnames"`
+	ClusterId string           `json:"cluster"`
+	Ssh       *NodeSshSettings `json:"ssh,omitempty"`
+}
+
+// Optional ssh settings of a node overriding the server configuration
+type NodeSshSettings struct {
+	User    string `json:"user,omitempty"`
+	Port    string `json:"port,omitempty"`
+	KeyFile string `json:"keyfile,omitempty"`
 }
 
 type NodeInfo struct {
@@ -159,12 +175,31 @@ type VolumeCreateRequest struct {
 		Enable bool    `json:"enable"`
 		Factor float32 `json:"factor"`
 	} `json:"snapshot"`
+
+	// GlusterFS volume options
+	Options map[string]string `json:"options,omitempty"`
 }
 
+// Lifecycle state of a volume
+type VolumeState string
+
+const (
+	VolumeStateCreating  VolumeState = "creating"
+	VolumeStateOnline    VolumeState = "online"
+	VolumeStateExpanding VolumeState = "expanding"
+	VolumeStateShrinking VolumeState = "shrinking"
+	VolumeStateReplacing VolumeState = "replacing"
+	VolumeStateDeleting  VolumeState = "deleting"
+
+	// An operation failed and left the volume to be cleaned up
+	VolumeStateFailed VolumeState = "failed"
+)
+
 type VolumeInfo struct {
 	VolumeCreateRequest
-	Id      string `json:"id"`
-	Cluster string `json:"cluster"`
+	Id      string      `json:"id"`
+	Cluster string      `json:"cluster"`
+	State   VolumeState `json:"state"`
 	Mount   struct {
 		GlusterFS struct {
 			Hosts      []string          `json:"hosts"`
@@ -174,9 +209,31 @@ type VolumeInfo struct {
 	} `json:"mount"`
 }
 
+// State of a brick as reported by GlusterFS
+type VolumeLiveBrick struct {
+	// Empty when the brick is not known to Heketi
+	Id string `json:"id"`
+
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Online bool   `json:"online"`
+	Port   int    `json:"port,omitempty"`
+}
+
+// State of a volume as reported by GlusterFS
+type VolumeLiveInfo struct {
+	Type    string            `json:"type"`
+	Status  string            `json:"status"`
+	Bricks  []VolumeLiveBrick `json:"bricks"`
+	Options map[string]string `json:"options"`
+}
+
 type VolumeInfoResponse struct {
 	VolumeInfo
 	Bricks []BrickInfo `json:"bricks"`
+
+	// Only set when requested with live=true
+	Live *VolumeLiveInfo `json:"live,omitempty"`
 }
 
 type VolumeListResponse struct {
@@ -187,6 +244,156 @@ type VolumeExpandRequest struct {
 	Size int `json:"expand_size"`
 }
 
+type VolumeShrinkRequest struct {
+	Size int `json:"shrink_size"`
+}
+
+type VolumeOptionsRequest struct {
+	Options map[string]string `json:"options"`
+}
+
+type VolumeOptionsResponse struct {
+	Options map[string]string `json:"options"`
+}
+
+// Quota
+type QuotaLimit struct {
+	// Directory of the volume, "/" for the volume root
+	Path string `json:"path"`
+
+	// Size in GB
+	Size int `json:"size"`
+
+	// Percentage of Size, zero for the GlusterFS default
+	SoftLimit int `json:"soft_limit,omitempty"`
+}
+
+type QuotaInfoResponse struct {
+	Enable bool         `json:"enable"`
+	Limits []QuotaLimit `json:"limits"`
+}
+
+// Heal
+type BrickHealInfo struct {
+	// Empty when the brick is not known to Heketi
+	Id     string `json:"id"`
+	NodeId string `json:"node"`
+
+	Host              string   `json:"host"`
+	Path              string   `json:"path"`
+	Connected         bool     `json:"connected"`
+	PendingEntries    uint64   `json:"pending_entries"`
+	SplitBrainEntries []string `json:"split_brain_entries"`
+}
+
+type VolumeHealInfoResponse struct {
+	VolumeId string `json:"volume"`
+
+	// True when all bricks are connected and nothing is pending heal
+	Healed bool            `json:"healed"`
+	Bricks []BrickHealInfo `json:"bricks"`
+}
+
+// Snapshot
+type SnapshotCreateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type SnapshotInfo struct {
+	SnapshotCreateRequest
+	Id       string `json:"id"`
+	VolumeId string `json:"volume"`
+}
+
+type SnapshotInfoResponse struct {
+	SnapshotInfo
+}
+
+type SnapshotListResponse struct {
+	Snapshots []string `json:"snapshots"`
+}
+
+type SnapshotCloneRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+// Geo-replication
+type GeoReplicationState string
+
+const (
+	GeoReplicationCreated GeoReplicationState = "created"
+	GeoReplicationStarted GeoReplicationState = "started"
+	GeoReplicationPaused  GeoReplicationState = "paused"
+	GeoReplicationStopped GeoReplicationState = "stopped"
+)
+
+type GeoReplicationCreateRequest struct {
+	// Volume in another cluster receiving the data
+	SlaveVolumeId string `json:"slave_volume"`
+}
+
+type GeoReplicationInfo struct {
+	GeoReplicationCreateRequest
+	Id          string              `json:"id"`
+	VolumeId    string              `json:"volume"`
+	SlaveHost   string              `json:"slave_host"`
+	SlaveVolume string              `json:"slave_volume_name"`
+	State       GeoReplicationState `json:"state"`
+}
+
+type GeoReplicationPairStatus struct {
+	MasterNode  string `json:"master_node"`
+	MasterBrick string `json:"master_brick"`
+	SlaveNode   string `json:"slave_node"`
+	Status      string `json:"status"`
+	CrawlStatus string `json:"crawl_status"`
+	LastSynced  string `json:"last_synced"`
+}
+
+type GeoReplicationInfoResponse struct {
+	GeoReplicationInfo
+	Status []GeoReplicationPairStatus `json:"status"`
+}
+
+type GeoReplicationListResponse struct {
+	Sessions []string `json:"sessions"`
+}
+
+// Consistency
+type ConsistencyIssueType string
+
+const (
+	ConsistencyNodeUnreachable ConsistencyIssueType = "node_unreachable"
+	ConsistencyMissingDevice   ConsistencyIssueType = "missing_device"
+	ConsistencyOrphanDevice    ConsistencyIssueType = "orphan_device"
+	ConsistencyMissingBrick    ConsistencyIssueType = "missing_brick"
+	ConsistencyOrphanBrick     ConsistencyIssueType = "orphan_brick"
+	ConsistencyMissingFstab    ConsistencyIssueType = "missing_fstab"
+	ConsistencySizeMismatch    ConsistencyIssueType = "size_mismatch"
+	ConsistencyMissingVolume   ConsistencyIssueType = "missing_volume"
+	ConsistencyUnknownVolume   ConsistencyIssueType = "unknown_volume"
+)
+
+// Difference between the db and what was found on the nodes
+type ConsistencyIssue struct {
+	Type      ConsistencyIssueType `json:"type"`
+	ClusterId string               `json:"cluster,omitempty"`
+	NodeId    string               `json:"node,omitempty"`
+	DeviceId  string               `json:"device,omitempty"`
+	BrickId   string               `json:"brick,omitempty"`
+
+	// Id of the volume, or its name when unknown to Heketi
+	Volume string `json:"volume,omitempty"`
+
+	Description string `json:"description"`
+}
+
+type ConsistencyReport struct {
+	Consistent bool               `json:"consistent"`
+	Issues     []ConsistencyIssue `json:"issues"`
+}
+
 // Constructors
 
 func NewVolumeInfoResponse() *VolumeInfoResponse {
@@ -204,6 +411,7 @@ func (v *VolumeInfoResponse) String() string {
 		"Size: %v\n"+
 		"Volume Id: %v\n"+
 		"Cluster Id: %v\n"+
+		"State: %v\n"+
 		"Mount: %v\n"+
 		"Mount Options: backup-volfile-servers=%v\n"+
 		"Durability Type: %v\n",
@@ -211,6 +419,7 @@ func (v *VolumeInfoResponse) String() string {
 		v.Size,
 		v.Id,
 		v.Cluster,
+		v.State,
 		v.Mount.GlusterFS.MountPoint,
 		v.Mount.GlusterFS.Options["backup-volfile-servers"],
 		v.Durability.Type)
@@ -224,6 +433,8 @@ func (v *VolumeInfoResponse) String() string {
 	case DurabilityReplicate:
 		s += fmt.Sprintf("Distributed+Replica: %v\n",
 			v.Durability.Replicate.Replica)
+	case DurabilityArbiter:
+		s += "Distributed+Replica: 3 Arbiter: 1\n"
 	}
 
 	if v.Snapshot.Enable {
@@ -231,6 +442,33 @@ func (v *VolumeInfoResponse) String() string {
 			v.Snapshot.Factor)
 	}
 
+	if len(v.Options) > 0 {
+		s += "Options:\n"
+		keys := make(sort.StringSlice, 0, len(v.Options))
+		for key := range v.Options {
+			keys = append(keys, key)
+		}
+		keys.Sort()
+		for _, key := range keys {
+			s += fmt.Sprintf("    %v: %v\n", key, v.Options[key])
+		}
+	}
+
+	if v.Live != nil {
+		s += fmt.Sprintf("Live Status: %v\n"+
+			"Live Type: %v\n"+
+			"Live Bricks:\n",
+			v.Live.Status,
+			v.Live.Type)
+		for _, b := range v.Live.Bricks {
+			if b.Online {
+				s += fmt.Sprintf("    %v:%v  Online  Port: %v\n", b.Host, b.Path, b.Port)
+			} else {
+				s += fmt.Sprintf("    %v:%v  Offline\n", b.Host, b.Path)
+			}
+		}
+	}
+
 	/*
 		s += "\nBricks:\n"
 		for _, b := range v.Bricks {
@@ -249,3 +487,85 @@ func (v *VolumeInfoResponse) String() string {
 
 	return s
 }
+
+func (h *VolumeHealInfoResponse) String() string {
+	s := fmt.Sprintf("Volume Id: %v\n"+
+		"Healed: %v\n"+
+		"Bricks:\n",
+		h.VolumeId,
+		h.Healed)
+
+	for _, b := range h.Bricks {
+		if !b.Connected {
+			s += fmt.Sprintf("    %v:%v  Not connected\n", b.Host, b.Path)
+			continue
+		}
+		s += fmt.Sprintf("    %v:%v  Pending: %v  Split-brain: %v\n",
+			b.Host,
+			b.Path,
+			b.PendingEntries,
+			len(b.SplitBrainEntries))
+		for _, entry := range b.SplitBrainEntries {
+			s += fmt.Sprintf("        %v\n", entry)
+		}
+	}
+
+	return s
+}
+
+func (c *ConsistencyReport) String() string {
+	if c.Consistent {
+		return "Heketi db is consistent with the clusters\n"
+	}
+
+	s := fmt.Sprintf("Found %v issues:\n", len(c.Issues))
+	for _, issue := range c.Issues {
+		s += fmt.Sprintf("    %v: %v\n", issue.Type, issue.Description)
+	}
+
+	return s
+}
+
+func (s *SnapshotInfoResponse) String() string {
+	str := fmt.Sprintf("Name: %v\n"+
+		"Snapshot Id: %v\n"+
+		"Volume Id: %v\n",
+		s.Name,
+		s.Id,
+		s.VolumeId)
+
+	if s.Description != "" {
+		str += fmt.Sprintf("Description: %v\n", s.Description)
+	}
+
+	return str
+}
+
+func (g *GeoReplicationInfoResponse) String() string {
+	s := fmt.Sprintf("Session Id: %v\n"+
+		"Volume Id: %v\n"+
+		"Slave Volume Id: %v\n"+
+		"Slave: %v::%v\n"+
+		"State: %v\n",
+		g.Id,
+		g.VolumeId,
+		g.SlaveVolumeId,
+		g.SlaveHost,
+		g.SlaveVolume,
+		g.State)
+
+	if len(g.Status) > 0 {
+		s += "Status:\n"
+		for _, pair := range g.Status {
+			s += fmt.Sprintf("    %v:%v -> %v  Status: %v  Crawl: %v  Last Synced: %v\n",
+				pair.MasterNode,
+				pair.MasterBrick,
+				pair.SlaveNode,
+				pair.Status,
+				pair.CrawlStatus,
+				pair.LastSynced)
+		}
+	}
+
+	return s
+}
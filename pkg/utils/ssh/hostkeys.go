@@ -0,0 +1,301 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key policies
+const (
+	HOSTKEY_INSECURE = "insecure"
+	HOSTKEY_STRICT   = "strict"
+	HOSTKEY_TOFU     = "tofu"
+)
+
+var (
+	ErrNoHostKeyStore = errors.New("No store for host keys trusted on first use")
+)
+
+// HostKeyStore keeps the host keys trusted on first use
+type HostKeyStore interface {
+	// Returns the key saved for the host in authorized_keys
+	// format, or nil if there is none
+	HostKey(host string) ([]byte, error)
+	SaveHostKey(host string, key []byte) error
+}
+
+// HostKeyError is returned when the key of a host cannot be trusted
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Mismatch    bool
+	Revoked     bool
+}
+
+func (e *HostKeyError) Error() string {
+	switch {
+	case e.Revoked:
+		return fmt.Sprintf("Host key verification failed for %v: key %v has been revoked",
+			e.Host, e.Fingerprint)
+	case e.Mismatch:
+		return fmt.Sprintf("Host key verification failed for %v: key %v does not match "+
+			"the known key of the host.  Someone could be intercepting the connection, "+
+			"or the host was reinstalled and its old key must be removed",
+			e.Host, e.Fingerprint)
+	default:
+		return fmt.Sprintf("Host key verification failed for %v: unknown key %v.  "+
+			"Add the key of the host to the known hosts file",
+			e.Host, e.Fingerprint)
+	}
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key like ssh-keygen
+func Fingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + strings.TrimRight(base64.StdEncoding.EncodeToString(sum[:]), "=")
+}
+
+// KnownHostName returns the name of a host:port address in known_hosts
+func KnownHostName(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	if port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+type knownHost struct {
+	names   []string
+	hashes  [][2][]byte
+	key     ssh.PublicKey
+	revoked bool
+}
+
+func (k *knownHost) match(name string) bool {
+	for _, n := range k.names {
+		if n == name {
+			return true
+		}
+	}
+	for _, h := range k.hashes {
+		mac := hmac.New(sha1.New, h[0])
+		mac.Write([]byte(name))
+		if hmac.Equal(mac.Sum(nil), h[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKnownHosts reads the entries of a known_hosts file.  Plain and
+// hashed host names are supported, wildcard patterns are ignored.
+func parseKnownHosts(r io.Reader) ([]*knownHost, error) {
+	var known []*knownHost
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		k := &knownHost{}
+		fields := strings.Fields(text)
+		if strings.HasPrefix(fields[0], "@") {
+			switch fields[0] {
+			case "@revoked":
+				k.revoked = true
+			default:
+				// Certificate authorities are not supported
+				continue
+			}
+			fields = fields[1:]
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("Line %v of known hosts is incomplete", line)
+		}
+
+		for _, name := range strings.Split(fields[0], ",") {
+			switch {
+			case strings.HasPrefix(name, "|1|"):
+				parts := strings.Split(name[3:], "|")
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("Line %v of known hosts has a bad hashed host", line)
+				}
+				salt, err := base64.StdEncoding.DecodeString(parts[0])
+				if err != nil {
+					return nil, fmt.Errorf("Line %v of known hosts: %v", line, err)
+				}
+				hash, err := base64.StdEncoding.DecodeString(parts[1])
+				if err != nil {
+					return nil, fmt.Errorf("Line %v of known hosts: %v", line, err)
+				}
+				k.hashes = append(k.hashes, [2][]byte{salt, hash})
+			case strings.ContainsAny(name, "*?!"):
+				continue
+			default:
+				k.names = append(k.names, name)
+			}
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[1:], " ")))
+		if err != nil {
+			return nil, fmt.Errorf("Line %v of known hosts: %v", line, err)
+		}
+		k.key = key
+		known = append(known, k)
+	}
+
+	return known, scanner.Err()
+}
+
+// HostKeyVerifier checks the host keys of the nodes against a known_hosts
+// file.  With trust on first use, keys of hosts not in the file are
+// compared to the ones saved in the store, and saved on first connection.
+type HostKeyVerifier struct {
+	policy string
+	known  []*knownHost
+	store  HostKeyStore
+	lock   sync.Mutex
+}
+
+func NewHostKeyVerifier(policy, knownHostsFile string) (*HostKeyVerifier, error) {
+	v := &HostKeyVerifier{
+		policy: policy,
+	}
+
+	switch policy {
+	case HOSTKEY_INSECURE, HOSTKEY_TOFU:
+	case HOSTKEY_STRICT:
+		if knownHostsFile == "" {
+			return nil, errors.New("Strict host key checking requires a known hosts file")
+		}
+	default:
+		return nil, fmt.Errorf("Unknown host key policy %v", policy)
+	}
+
+	if knownHostsFile != "" {
+		fp, err := os.Open(knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+
+		v.known, err = parseKnownHosts(fp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+func (v *HostKeyVerifier) Policy() string {
+	return v.policy
+}
+
+// SetStore sets where the keys trusted on first use are kept
+func (v *HostKeyVerifier) SetStore(store HostKeyStore) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.store = store
+}
+
+// Check is used as the HostKeyCallback of the ssh client
+func (v *HostKeyVerifier) Check(address string, remote net.Addr, key ssh.PublicKey) error {
+	if v.policy == HOSTKEY_INSECURE {
+		return nil
+	}
+
+	name := KnownHostName(address)
+	keyErr := &HostKeyError{
+		Host:        name,
+		Fingerprint: Fingerprint(key),
+	}
+
+	// Look in the known hosts file
+	found := false
+	for _, k := range v.known {
+		if !k.match(name) {
+			continue
+		}
+		same := bytes.Equal(k.key.Marshal(), key.Marshal())
+		if k.revoked {
+			if same {
+				keyErr.Revoked = true
+				return keyErr
+			}
+			continue
+		}
+		if same {
+			return nil
+		}
+		found = true
+	}
+	if found {
+		keyErr.Mismatch = true
+		return keyErr
+	}
+	if v.policy == HOSTKEY_STRICT {
+		return keyErr
+	}
+
+	// Trust on first use
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.store == nil {
+		return ErrNoHostKeyStore
+	}
+
+	saved, err := v.store.HostKey(name)
+	if err != nil {
+		return err
+	}
+	if saved == nil {
+		return v.store.SaveHostKey(name,
+			bytes.TrimSpace(ssh.MarshalAuthorizedKey(key)))
+	}
+
+	savedKey, _, _, _, err := ssh.ParseAuthorizedKey(saved)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(savedKey.Marshal(), key.Marshal()) {
+		keyErr.Mismatch = true
+		return keyErr
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+)
+
+type memHostKeyStore map[string][]byte
+
+func (m memHostKeyStore) HostKey(host string) ([]byte, error) {
+	return m[host], nil
+}
+
+func (m memHostKeyStore) SaveHostKey(host string, key []byte) error {
+	m[host] = key
+	return nil
+}
+
+func newHostKey(t *testing.T) ssh.Signer {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests.Assert(t, err == nil)
+	signer, err := ssh.NewSignerFromKey(k)
+	tests.Assert(t, err == nil)
+	return signer
+}
+
+func authorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func hashedHost(host string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" +
+		base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func writeKnownHosts(t *testing.T, content string) string {
+	file := tests.Tempfile()
+	err := ioutil.WriteFile(file, []byte(content), 0600)
+	tests.Assert(t, err == nil)
+	return file
+}
+
+func TestKnownHostName(t *testing.T) {
+	tests.Assert(t, KnownHostName("host:22") == "host")
+	tests.Assert(t, KnownHostName("host:2222") == "[host]:2222")
+	tests.Assert(t, KnownHostName("host") == "host")
+}
+
+func TestHostKeyVerifierStrict(t *testing.T) {
+	key1 := newHostKey(t).PublicKey()
+	key2 := newHostKey(t).PublicKey()
+	revoked := newHostKey(t).PublicKey()
+
+	file := writeKnownHosts(t, "# comment\n\n"+
+		"host1,10.0.0.1 "+authorizedKey(key1)+" root@host1\n"+
+		"[host2]:2222 "+authorizedKey(key2)+"\n"+
+		hashedHost("host3")+" "+authorizedKey(key2)+"\n"+
+		"*.example.com "+authorizedKey(key1)+"\n"+
+		"@revoked host4 "+authorizedKey(revoked)+"\n"+
+		"host4 "+authorizedKey(revoked)+"\n")
+	defer os.Remove(file)
+
+	_, err := NewHostKeyVerifier(HOSTKEY_STRICT, "")
+	tests.Assert(t, err != nil)
+	_, err = NewHostKeyVerifier("paranoid", file)
+	tests.Assert(t, err != nil)
+
+	v, err := NewHostKeyVerifier(HOSTKEY_STRICT, file)
+	tests.Assert(t, err == nil, err)
+
+	tests.Assert(t, v.Check("host1:22", nil, key1) == nil)
+	tests.Assert(t, v.Check("10.0.0.1:22", nil, key1) == nil)
+	tests.Assert(t, v.Check("host2:2222", nil, key2) == nil)
+	tests.Assert(t, v.Check("host3:22", nil, key2) == nil)
+
+	// Mismatch
+	err = v.Check("host1:22", nil, key2)
+	keyErr, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, keyErr.Mismatch)
+	tests.Assert(t, keyErr.Host == "host1")
+	tests.Assert(t, keyErr.Fingerprint == Fingerprint(key2))
+	tests.Assert(t, strings.Contains(err.Error(), "does not match"), err)
+
+	// Unknown hosts, a different port is a different host
+	for _, host := range []string{"host5:22", "host2:22", "a.example.com:22"} {
+		err = v.Check(host, nil, key1)
+		keyErr, ok = err.(*HostKeyError)
+		tests.Assert(t, ok, host, err)
+		tests.Assert(t, !keyErr.Mismatch)
+		tests.Assert(t, strings.Contains(err.Error(), "unknown key"), err)
+	}
+
+	// Revoked
+	err = v.Check("host4:22", nil, revoked)
+	keyErr, ok = err.(*HostKeyError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, keyErr.Revoked)
+}
+
+func TestHostKeyVerifierBadKnownHosts(t *testing.T) {
+	_, err := NewHostKeyVerifier(HOSTKEY_STRICT, "/does/not/exist")
+	tests.Assert(t, err != nil)
+
+	file := writeKnownHosts(t, "host1 ssh-rsa\n")
+	defer os.Remove(file)
+	_, err = NewHostKeyVerifier(HOSTKEY_STRICT, file)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Line 1"), err)
+
+	file2 := writeKnownHosts(t, "\nhost1 ssh-rsa notbase64!\n")
+	defer os.Remove(file2)
+	_, err = NewHostKeyVerifier(HOSTKEY_STRICT, file2)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Line 2"), err)
+}
+
+func TestHostKeyVerifierTofu(t *testing.T) {
+	key1 := newHostKey(t).PublicKey()
+	key2 := newHostKey(t).PublicKey()
+
+	file := writeKnownHosts(t, "host1 "+authorizedKey(key1)+"\n")
+	defer os.Remove(file)
+
+	v, err := NewHostKeyVerifier(HOSTKEY_TOFU, file)
+	tests.Assert(t, err == nil)
+
+	// A store is required
+	tests.Assert(t, v.Check("host2:22", nil, key2) == ErrNoHostKeyStore)
+
+	store := memHostKeyStore{}
+	v.SetStore(store)
+
+	// The known hosts file is used first
+	tests.Assert(t, v.Check("host1:22", nil, key1) == nil)
+	err = v.Check("host1:22", nil, key2)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, len(store) == 0)
+
+	// Trusted on first use
+	tests.Assert(t, v.Check("host2:22", nil, key2) == nil)
+	tests.Assert(t, string(store["host2"]) == authorizedKey(key2))
+	tests.Assert(t, v.Check("host2:22", nil, key2) == nil)
+
+	err = v.Check("host2:22", nil, key1)
+	keyErr, ok := err.(*HostKeyError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, keyErr.Mismatch)
+	tests.Assert(t, string(store["host2"]) == authorizedKey(key2))
+}
+
+func TestHostKeyVerifierInsecure(t *testing.T) {
+	v, err := NewHostKeyVerifier(HOSTKEY_INSECURE, "")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, v.Check("host1:22", nil, newHostKey(t).PublicKey()) == nil)
+}
+
+// Serves ssh handshakes with the host key
+func startSshServer(t *testing.T, hostKey ssh.Signer) (string, func()) {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no sessions")
+				}
+				sconn.Close()
+			}()
+		}
+	}()
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestSshExecHostKeyVerification(t *testing.T) {
+	hostKey := newHostKey(t)
+	address, stop := startSshServer(t, hostKey)
+	defer stop()
+
+	s := &SshExec{
+		clientConfig: &ssh.ClientConfig{User: "heketi"},
+		logger:       utils.NewLogger("[test]", utils.LEVEL_NOLOG),
+	}
+
+	// Unknown host
+	file := writeKnownHosts(t, "otherhost "+authorizedKey(hostKey.PublicKey())+"\n")
+	defer os.Remove(file)
+	v, err := NewHostKeyVerifier(HOSTKEY_STRICT, file)
+	tests.Assert(t, err == nil)
+	s.SetHostKeyVerifier(v)
+
+	_, err = s.ConnectAndExec(address, []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "Host key verification failed"), err)
+
+	// Trusted on first use, then the connection is set up
+	v, err = NewHostKeyVerifier(HOSTKEY_TOFU, "")
+	tests.Assert(t, err == nil)
+	store := memHostKeyStore{}
+	v.SetStore(store)
+	s.SetHostKeyVerifier(v)
+
+	_, err = s.ConnectAndExec(address, []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, !strings.Contains(err.Error(), "Host key verification failed"), err)
+	tests.Assert(t, len(store) == 1)
+	for _, key := range store {
+		tests.Assert(t, string(key) == authorizedKey(hostKey.PublicKey()))
+	}
+
+	// Another host answering on the same address is rejected
+	stop()
+	address2, stop2 := startSshServer(t, newHostKey(t))
+	defer stop2()
+	for name, key := range store {
+		delete(store, name)
+		store[KnownHostName(address2)] = key
+	}
+	_, err = s.ConnectAndExec(address2, []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	tests.Assert(t, strings.Contains(err.Error(), "does not match"), err)
+}
@@ -0,0 +1,189 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Methods of ssh.Client used on pooled connections
+type sshClient interface {
+	NewSession() (*ssh.Session, error)
+	SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error)
+	Close() error
+}
+
+type idleClient struct {
+	client sshClient
+	since  time.Time
+}
+
+// ConnectionPool keeps the connections to each host open between
+// batches of commands.  Idle connections are probed with keepalives
+// and closed once they have been idle longer than the idle timeout.
+type ConnectionPool struct {
+	dial        func(host string) (sshClient, error)
+	keepalive   time.Duration
+	idleTimeout time.Duration
+
+	lock        sync.Mutex
+	idle        map[string][]*idleClient
+	maintaining bool
+}
+
+func newConnectionPool(dial func(host string) (sshClient, error),
+	keepalive, idleTimeout time.Duration) *ConnectionPool {
+
+	return &ConnectionPool{
+		dial:        dial,
+		keepalive:   keepalive,
+		idleTimeout: idleTimeout,
+		idle:        make(map[string][]*idleClient),
+	}
+}
+
+// alive sends a keepalive request on the connection.  A connection
+// which does not answer within the keepalive interval is closed, so
+// that the pending request returns.
+func (p *ConnectionPool) alive(client sshClient) bool {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		reply <- err
+	}()
+
+	timer := time.NewTimer(p.keepalive)
+	defer timer.Stop()
+	select {
+	case err := <-reply:
+		return err == nil
+	case <-timer.C:
+		client.Close()
+		return false
+	}
+}
+
+// Get returns an idle connection to the host if one still answers,
+// or dials a new one
+func (p *ConnectionPool) Get(host string) (sshClient, error) {
+	for {
+		p.lock.Lock()
+		clients := p.idle[host]
+		if len(clients) == 0 {
+			p.lock.Unlock()
+			break
+		}
+		c := clients[len(clients)-1]
+		p.idle[host] = clients[:len(clients)-1]
+		p.lock.Unlock()
+
+		if p.alive(c.client) {
+			return c.client, nil
+		}
+		c.client.Close()
+	}
+
+	return p.dial(host)
+}
+
+// Put returns a working connection to the pool
+func (p *ConnectionPool) Put(host string, client sshClient) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.idle[host] = append(p.idle[host], &idleClient{
+		client: client,
+		since:  time.Now(),
+	})
+
+	if !p.maintaining {
+		p.maintaining = true
+		go p.maintain()
+	}
+}
+
+// Idle returns the number of idle connections to the host
+func (p *ConnectionPool) Idle(host string) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.idle[host])
+}
+
+// Close closes all the idle connections
+func (p *ConnectionPool) Close() {
+	p.lock.Lock()
+	idle := p.idle
+	p.idle = make(map[string][]*idleClient)
+	p.lock.Unlock()
+
+	for _, clients := range idle {
+		for _, c := range clients {
+			c.client.Close()
+		}
+	}
+}
+
+// remove takes the connection out of the pool unless it is in use
+func (p *ConnectionPool) remove(host string, c *idleClient) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	clients := p.idle[host]
+	for i, client := range clients {
+		if client == c {
+			p.idle[host] = append(clients[:i], clients[i+1:]...)
+			if len(p.idle[host]) == 0 {
+				delete(p.idle, host)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// maintain evicts and probes the idle connections until there are none
+func (p *ConnectionPool) maintain() {
+	for {
+		time.Sleep(p.keepalive)
+
+		p.lock.Lock()
+		if len(p.idle) == 0 {
+			p.maintaining = false
+			p.lock.Unlock()
+			return
+		}
+		idle := make(map[string][]*idleClient)
+		for host, clients := range p.idle {
+			idle[host] = append([]*idleClient{}, clients...)
+		}
+		p.lock.Unlock()
+
+		for host, clients := range idle {
+			for _, c := range clients {
+				if time.Since(c.since) < p.idleTimeout && p.alive(c.client) {
+					continue
+				}
+				if p.remove(host, c) {
+					c.client.Close()
+				}
+			}
+		}
+	}
+}
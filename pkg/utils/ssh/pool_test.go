@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+)
+
+type fakeClient struct {
+	lock   sync.Mutex
+	dead   bool
+	hung   bool
+	closed bool
+	done   chan struct{}
+}
+
+func (f *fakeClient) NewSession() (*ssh.Session, error) {
+	return nil, errors.New("not supported")
+}
+
+func (f *fakeClient) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	f.lock.Lock()
+	hung, done := f.hung, f.done
+	if f.dead {
+		f.lock.Unlock()
+		return false, nil, errors.New("connection lost")
+	}
+	f.lock.Unlock()
+
+	// Requests on a hung connection only return once it is closed
+	if hung {
+		<-done
+		return false, nil, errors.New("connection closed")
+	}
+	return true, nil, nil
+}
+
+func (f *fakeClient) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.closed {
+		close(f.done)
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *fakeClient) isClosed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.closed
+}
+
+func (f *fakeClient) kill() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.dead = true
+}
+
+func (f *fakeClient) hang() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.hung = true
+}
+
+func newFakePool(keepalive, idleTimeout time.Duration) (*ConnectionPool, *int) {
+	dials := 0
+	return newConnectionPool(func(host string) (sshClient, error) {
+		dials++
+		return &fakeClient{done: make(chan struct{})}, nil
+	}, keepalive, idleTimeout), &dials
+}
+
+func TestConnectionPoolReuse(t *testing.T) {
+	p, dials := newFakePool(time.Hour, time.Hour)
+
+	c1, err := p.Get("host1")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, *dials == 1)
+	p.Put("host1", c1)
+	tests.Assert(t, p.Idle("host1") == 1)
+
+	// Reused on the same host only
+	c2, err := p.Get("host2")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, *dials == 2)
+	tests.Assert(t, c2 != c1)
+
+	c, err := p.Get("host1")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, c == c1)
+	tests.Assert(t, *dials == 2)
+	tests.Assert(t, p.Idle("host1") == 0)
+
+	// Dead connections are replaced
+	p.Put("host1", c1)
+	c1.(*fakeClient).kill()
+	c, err = p.Get("host1")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, c != c1)
+	tests.Assert(t, c1.(*fakeClient).isClosed())
+	tests.Assert(t, *dials == 3)
+
+	p.Put("host1", c)
+	p.Put("host2", c2)
+	p.Close()
+	tests.Assert(t, c.(*fakeClient).isClosed())
+	tests.Assert(t, c2.(*fakeClient).isClosed())
+	tests.Assert(t, p.Idle("host1") == 0)
+}
+
+func TestConnectionPoolEviction(t *testing.T) {
+	p, _ := newFakePool(5*time.Millisecond, 50*time.Millisecond)
+
+	idle, _ := p.Get("host1")
+	dead, _ := p.Get("host1")
+	p.Put("host1", idle)
+	p.Put("host1", dead)
+	dead.(*fakeClient).kill()
+
+	// Connections failing keepalives are closed
+	time.Sleep(25 * time.Millisecond)
+	tests.Assert(t, dead.(*fakeClient).isClosed())
+	tests.Assert(t, !idle.(*fakeClient).isClosed())
+	tests.Assert(t, p.Idle("host1") == 1)
+
+	// Idle connections are closed after the timeout
+	time.Sleep(100 * time.Millisecond)
+	tests.Assert(t, idle.(*fakeClient).isClosed())
+	tests.Assert(t, p.Idle("host1") == 0)
+
+	// Maintenance stops with the pool empty
+	time.Sleep(20 * time.Millisecond)
+	p.lock.Lock()
+	maintaining := p.maintaining
+	p.lock.Unlock()
+	tests.Assert(t, !maintaining)
+}
+
+func TestConnectionPoolHungKeepalive(t *testing.T) {
+	p, dials := newFakePool(20*time.Millisecond, time.Hour)
+
+	c1, err := p.Get("host1")
+	tests.Assert(t, err == nil)
+	p.Put("host1", c1)
+	c1.(*fakeClient).hang()
+
+	// A connection which never answers the keepalive is
+	// closed and replaced
+	c, err := p.Get("host1")
+	tests.Assert(t, err == nil)
+	tests.Assert(t, c != c1)
+	tests.Assert(t, c1.(*fakeClient).isClosed())
+	tests.Assert(t, *dials == 2)
+	tests.Assert(t, p.Idle("host1") == 0)
+	p.Close()
+}
@@ -21,7 +21,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net"
 	"os"
 	"time"
@@ -31,9 +30,24 @@ import (
 	"golang.org/x/crypto/ssh/agent"
 )
 
+var (
+	dialTimeout = 30 * time.Second
+)
+
 type SshExec struct {
 	clientConfig *ssh.ClientConfig
 	logger       *utils.Logger
+	pool         *ConnectionPool
+}
+
+// ConnectionError is returned when the commands could not be run
+// because of the connection to the host, rather than failing on it
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
 }
 
 func getKeyFile(file string) (key ssh.Signer, err error) {
@@ -56,20 +70,20 @@ func NewSshExecWithAuth(logger *utils.Logger, user string) *SshExec {
 
 	authSocket := os.Getenv("SSH_AUTH_SOCK")
 	if authSocket == "" {
-		log.Fatal("SSH_AUTH_SOCK required, check that your ssh agent is running")
+		logger.LogError("SSH_AUTH_SOCK required, check that your ssh agent is running")
 		return nil
 	}
 
 	agentUnixSock, err := net.Dial("unix", authSocket)
 	if err != nil {
-		log.Fatal(err)
+		logger.LogError("Unable to connect to the ssh agent: %v", err)
 		return nil
 	}
 
 	agent := agent.NewClient(agentUnixSock)
 	signers, err := agent.Signers()
 	if err != nil {
-		log.Fatal(err)
+		logger.LogError("Unable to get keys from the ssh agent: %v", err)
 		return nil
 	}
 
@@ -105,18 +119,106 @@ func NewSshExecWithKeyFile(logger *utils.Logger, user string, file string) *SshE
 	return sshexec
 }
 
+func NewSshExecWithPassword(logger *utils.Logger, user string, password string) *SshExec {
+
+	sshexec := &SshExec{}
+	sshexec.logger = logger
+
+	// Servers may ask for the password as a keyboard interactive challenge
+	challenge := func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range answers {
+			answers[i] = password
+		}
+		return answers, nil
+	}
+
+	sshexec.clientConfig = &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(password),
+			ssh.KeyboardInteractive(challenge),
+		},
+	}
+
+	return sshexec
+}
+
+// SetHostKeyVerifier checks the host keys of the nodes with the verifier
+func (s *SshExec) SetHostKeyVerifier(v *HostKeyVerifier) {
+	s.clientConfig.HostKeyCallback = v.Check
+}
+
+// EnableConnectionPool keeps the connections to the hosts open between
+// calls to ConnectAndExec instead of dialing one for each call
+func (s *SshExec) EnableConnectionPool(keepalive, idleTimeout time.Duration) {
+	s.pool = newConnectionPool(s.dial, keepalive, idleTimeout)
+}
+
+func (s *SshExec) dial(host string) (sshClient, error) {
+	conn, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+
+	// Do not wait forever on a host which accepts the connection
+	// but never completes the handshake
+	deadline := time.Now().Add(dialTimeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, &ConnectionError{Err: err}
+	}
+
+	// Failures to verify the host or to log in are not connection errors
+	c, chans, reqs, err := ssh.NewClientConn(conn, host, s.clientConfig)
+	if err != nil {
+		conn.Close()
+		if !time.Now().Before(deadline) {
+			return nil, &ConnectionError{Err: err}
+		}
+		return nil, err
+	}
+
+	// Commands run as long as they need once connected
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		c.Close()
+		return nil, &ConnectionError{Err: err}
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (s *SshExec) connect(host string) (sshClient, error) {
+	if s.pool != nil {
+		return s.pool.Get(host)
+	}
+	return s.dial(host)
+}
+
+// release returns the connection to the pool when it can be reused
+func (s *SshExec) release(host string, client sshClient, reuse bool) {
+	if s.pool != nil && reuse {
+		s.pool.Put(host, client)
+	} else {
+		client.Close()
+	}
+}
+
 // This function was based from https://github.com/coreos/etcd-manager/blob/master/main.go
 func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes int, useSudo bool) ([]string, error) {
 
 	buffers := make([]string, len(commands))
 
-	// :TODO: Will need a timeout here in case the server does not respond
-	client, err := ssh.Dial("tcp", host, s.clientConfig)
+	client, err := s.connect(host)
 	if err != nil {
 		s.logger.Warning("Failed to create SSH connection to %v: %v", host, err)
 		return nil, err
 	}
-	defer client.Close()
+
+	// Connections are not reused after a session error or a timeout
+	reuse := false
+	defer func() {
+		s.release(host, client, reuse)
+	}()
 
 	// Execute each command
 	for index, command := range commands {
@@ -124,7 +226,7 @@ func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes
 		session, err := client.NewSession()
 		if err != nil {
 			s.logger.LogError("Unable to create SSH session: %v", err)
-			return nil, err
+			return nil, &ConnectionError{Err: err}
 		}
 		defer session.Close()
 
@@ -145,7 +247,7 @@ func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes
 		// Execute command
 		err = session.Start(command)
 		if err != nil {
-			return nil, err
+			return nil, &ConnectionError{Err: err}
 		}
 
 		// Spawn function to wait for results
@@ -163,6 +265,10 @@ func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes
 			if err != nil {
 				s.logger.LogError("Failed to run command [%v] on %v: Err[%v]: Stdout [%v]: Stderr [%v]",
 					command, host, err, b.String(), berr.String())
+				if _, ok := err.(*ssh.ExitError); !ok {
+					return nil, &ConnectionError{Err: fmt.Errorf("%s", berr.String())}
+				}
+				reuse = true
 				return nil, fmt.Errorf("%s", berr.String())
 			}
 			s.logger.Debug("Host: %v Command: %v\nResult: %v", host, command, b.String())
@@ -180,5 +286,6 @@ func (s *SshExec) ConnectAndExec(host string, commands []string, timeoutMinutes
 		}
 	}
 
+	reuse = true
 	return buffers, nil
 }
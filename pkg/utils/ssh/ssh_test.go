@@ -0,0 +1,103 @@
+//
+// Copyright (c) 2016 The heketi Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/heketi/heketi/pkg/utils"
+	"github.com/heketi/tests"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSshExecConnectionError(t *testing.T) {
+	s := &SshExec{
+		clientConfig: &ssh.ClientConfig{User: "heketi"},
+		logger:       utils.NewLogger("[test]", utils.LEVEL_NOLOG),
+	}
+
+	// Nothing listening on the address
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil)
+	address := l.Addr().String()
+	l.Close()
+
+	_, err = s.ConnectAndExec(address, []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	_, ok := err.(*ConnectionError)
+	tests.Assert(t, ok, err)
+
+	// A host which cannot be trusted is not a connection error
+	address, stop := startSshServer(t, newHostKey(t))
+	defer stop()
+	file := writeKnownHosts(t, "")
+	defer os.Remove(file)
+	v, err := NewHostKeyVerifier(HOSTKEY_STRICT, file)
+	tests.Assert(t, err == nil)
+	s.SetHostKeyVerifier(v)
+
+	_, err = s.ConnectAndExec(address, []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	_, ok = err.(*ConnectionError)
+	tests.Assert(t, !ok, err)
+
+	// Sessions refused by the host are
+	v, err = NewHostKeyVerifier(HOSTKEY_INSECURE, "")
+	tests.Assert(t, err == nil)
+	s.SetHostKeyVerifier(v)
+
+	_, err = s.ConnectAndExec(address, []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	_, ok = err.(*ConnectionError)
+	tests.Assert(t, ok, err)
+}
+
+func TestSshExecHandshakeTimeout(t *testing.T) {
+	s := &SshExec{
+		clientConfig: &ssh.ClientConfig{User: "heketi"},
+		logger:       utils.NewLogger("[test]", utils.LEVEL_NOLOG),
+	}
+
+	defer func(timeout time.Duration) {
+		dialTimeout = timeout
+	}(dialTimeout)
+	dialTimeout = 100 * time.Millisecond
+
+	// The host accepts the connection but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.Assert(t, err == nil)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = s.ConnectAndExec(l.Addr().String(), []string{"true"}, 1, false)
+	tests.Assert(t, err != nil)
+	_, ok := err.(*ConnectionError)
+	tests.Assert(t, ok, err)
+	tests.Assert(t, time.Since(start) < 5*time.Second)
+}